@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/strategy"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleAnalyze estimates the player's memory-one strategy from the current game,
+// or from all finished games when they are not playing right now.
+func (b *Bot) handleAnalyze(message *tgbotapi.Message) {
+	playerID := message.From.ID
+
+	var transitions strategy.Transitions
+	source := "текущей игры"
+	if session, ok := b.manager.FindSessionByPlayerID(playerID); ok && len(session.History) > 0 {
+		transitions.Add(strategy.FromHistory(session.History, playerID == session.PlayerA.ID))
+	} else {
+		style, err := b.manager.PlayerStyle(playerID)
+		if err != nil {
+			b.reply(message.Chat.ID, err.Error(), nil)
+			return
+		}
+		transitions = style.Transitions
+		source = fmt.Sprintf("всех игр (%d)", style.Games)
+	}
+
+	samples := transitions.Samples()
+	if samples[0]+samples[1]+samples[2]+samples[3] == 0 {
+		b.reply(message.Chat.ID, "Недостаточно ходов для анализа. Сыграйте хотя бы два раунда.", nil)
+		return
+	}
+
+	b.reply(message.Chat.ID, formatAnalysis(transitions.Estimate("Вы"), samples, source), nil)
+}
+
+func formatAnalysis(estimate strategy.MemoryOne, samples [4]int, source string) string {
+	labels := [4]string{
+		"после 🤝/🤝 (CC)",
+		"после 😇/😈 (CD)",
+		"после 😈/😇 (DC)",
+		"после ⚔️/⚔️ (DD)",
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔬 Ваша стратегия memory-one по данным %s\n\n", source)
+	sb.WriteString("Вероятность сотрудничества:\n")
+	fmt.Fprintf(&sb, "• первый ход: %s\n", formatProbability(estimate.Initial))
+	for i, label := range labels {
+		fmt.Fprintf(&sb, "• %s: %s (ходов: %d)\n", label, formatProbability(estimate.P[i]), samples[i])
+	}
+
+	library := strategy.MemoryOneLibrary()
+	closest := strategy.Closest(estimate, library)[0]
+	fmt.Fprintf(&sb, "\nБлиже всего к: %s\n", closest.Name())
+
+	// Unknown reactions are treated as a coin flip when simulating long games.
+	player := estimate.Filled(0.5)
+	opponents := append(library, strategy.Extortioner(models.ClassicPayoff), strategy.GenerousZD(models.ClassicPayoff))
+	sb.WriteString("\nОжидаемые очки за раунд в долгой игре (вы / соперник):\n")
+	for _, opponent := range opponents {
+		own, their := strategy.ExpectedPayoffs(player, opponent, models.ClassicPayoff)
+		fmt.Fprintf(&sb, "• против %s: %.2f / %.2f\n", opponent.Name(), own, their)
+	}
+	return sb.String()
+}
+
+func formatProbability(p float64) string {
+	if math.IsNaN(p) {
+		return "—"
+	}
+	return fmt.Sprintf("%.0f%%", p*100)
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) isBanned(userID int64) bool {
+	b.bansMu.RLock()
+	defer b.bansMu.RUnlock()
+	return b.banned[userID]
+}
+
+// handleBan blocks a user from the bot until it restarts or they are unbanned.
+// Usage: /ban <user_id>
+func (b *Bot) handleBan(message *tgbotapi.Message) {
+	b.setBanned(message, "/ban", true)
+}
+
+// handleUnban lifts a ban.
+// Usage: /unban <user_id>
+func (b *Bot) handleUnban(message *tgbotapi.Message) {
+	b.setBanned(message, "/unban", false)
+}
+
+func (b *Bot) setBanned(message *tgbotapi.Message, command string, banned bool) {
+	if !b.admins[message.From.ID] {
+		b.reply(message.Chat.ID, unknownCommandText, nil)
+		return
+	}
+
+	userID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		b.reply(message.Chat.ID, fmt.Sprintf("Использование: %s <user_id>", command), nil)
+		return
+	}
+	if banned && b.admins[userID] {
+		b.reply(message.Chat.ID, "Нельзя заблокировать администратора.", nil)
+		return
+	}
+
+	b.bansMu.Lock()
+	if banned {
+		b.banned[userID] = true
+	} else {
+		delete(b.banned, userID)
+	}
+	b.bansMu.Unlock()
+
+	if banned {
+		b.reply(message.Chat.ID, fmt.Sprintf("Пользователь %d заблокирован.", userID), nil)
+	} else {
+		b.reply(message.Chat.ID, fmt.Sprintf("Пользователь %d разблокирован.", userID), nil)
+	}
+}
@@ -0,0 +1,222 @@
+package bot_test
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleChoice(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstMove := *prompt.Keyboard.ButtonByText("🤝").CallbackData
+
+	if err := playOut(h, alice, bob, gameRounds, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Rematch(alice, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "Другой игрок не захотел играть реванш"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay alice's first move from the long-finished game.
+	if err := expectExpired(h, alice, prompt.ID, firstMove); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayedRound(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstMove := *prompt.Keyboard.ButtonByText("⚔️").CallbackData
+	if err := h.PlayRound(alice, bob, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The round 1 button must not count as a move in round 2.
+	if err := expectExpired(h, alice, prompt.ID, firstMove); err != nil {
+		t.Fatal(err)
+	}
+	session, _ := h.Manager.FindSessionByPlayerID(alice.ID)
+	if session.PlayerA.CurrentChoice != models.ChoiceNone {
+		t.Fatalf("replayed button was recorded as a round 2 move")
+	}
+	if err := h.PlayRound(alice, bob, true, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForgedButton(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	alicePrompt, err := h.Prompt(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPrompt, err := h.Prompt(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob's button pressed by alice, and a payload with a tampered move.
+	stolen := *bobPrompt.Keyboard.ButtonByText("⚔️").CallbackData
+	if err := expectExpired(h, alice, alicePrompt.ID, stolen); err != nil {
+		t.Fatal(err)
+	}
+	bobPrompt, err = h.Prompt(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own := *bobPrompt.Keyboard.ButtonByText("🤝").CallbackData
+	tampered := strings.Replace(own, ":c:", ":d:", 1)
+	if err := expectExpired(h, bob, bobPrompt.ID, tampered); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectExpired presses a button with the given payload on message messageID
+// and waits for the bot to mark it expired.
+func expectExpired(h *Harness, u *User, messageID int, payload string) error {
+	u.PressRaw(messageID, payload)
+	_, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == messageID && strings.Contains(m.Text, "устарела")
+	})
+	if err != nil {
+		return fmt.Errorf("%s's button was not rejected: %v", u.Username, err)
+	}
+	return nil
+}
+
+func TestDoubleTap(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cooperate := *prompt.Keyboard.ButtonByText("🤝").CallbackData
+	defect := *prompt.Keyboard.ButtonByText("⚔️").CallbackData
+
+	// Both taps land before the prompt is edited; the first one counts.
+	alice.PressRaw(prompt.ID, cooperate)
+	alice.PressRaw(prompt.ID, defect)
+	if err := h.Move(bob, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Вы оба выбрали сотрудничество"); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectRounds(h, alice, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedelivered(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(alice, true); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := *prompt.Keyboard.ButtonByText("🤝").CallbackData
+	id := bob.PressRaw(prompt.ID, data)
+	bob.Redeliver(prompt.ID, data, id)
+	bob.Redeliver(prompt.ID, data, id)
+
+	if _, err := h.WaitText(bob, "Счет:"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := expectRounds(h, alice, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentMoves(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	for round := 1; round <= 3; round++ {
+		a, err := h.Prompt(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := h.Prompt(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Several taps from both players at once.
+		for i := 0; i < 3; i++ {
+			alice.PressRaw(a.ID, *a.Keyboard.ButtonByText("🤝").CallbackData)
+			bob.PressRaw(b.ID, *b.Keyboard.ButtonByText("⚔️").CallbackData)
+		}
+		if _, err := alice.WaitFor(h.Wait, func(Message) bool {
+			return h.CountText(alice, "Счет:") >= round
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// The next round may open before the slower player's prompt is edited;
+		// wait for it, or that prompt would be taken for the next one.
+		for _, p := range []struct {
+			u  *User
+			id int
+		}{{alice, a.ID}, {bob, b.ID}} {
+			if _, err := p.u.WaitFor(h.Wait, func(m Message) bool {
+				return m.ID == p.id && m.Edits > 0
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := expectRounds(h, alice, 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectRounds checks that exactly n rounds were scored in u's current game.
+func expectRounds(h *Harness, u *User, n int) error {
+	if got := h.CountText(u, "Счет:"); got != n {
+		return fmt.Errorf("%s got %d round reports, want %d", u.Username, got, n)
+	}
+	session, ok := h.Manager.FindSessionByPlayerID(u.ID)
+	if !ok {
+		return fmt.Errorf("%s has no session", u.Username)
+	}
+	if len(session.History) != n {
+		return fmt.Errorf("%d rounds in history, want %d", len(session.History), n)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const challengeUsage = "Использование: /challenge @username или /challenge <user_id>"
+
+// maxUsernameLen is the longest username Telegram allows.
+const maxUsernameLen = 32
+
+// handleChallenge starts an invite only one player can accept. Players who have
+// used the bot get the invite straight away; anyone else can only be sent the link.
+// Usage: /challenge @username or /challenge <user_id>
+func (b *Bot) handleChallenge(message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		b.handleGroupChallenge(message)
+		return
+	}
+	arg := strings.TrimSpace(message.CommandArguments())
+	target, err := parseTarget(arg)
+	if err != nil {
+		b.reply(message.Chat.ID, challengeUsage, nil)
+		return
+	}
+	if target.Matches(message.From.ID, message.From.UserName) {
+		b.reply(message.Chat.ID, "Нельзя вызвать на игру самого себя.", nil)
+		return
+	}
+	if b.manager.Busy(message.From.ID) {
+		b.reply(message.Chat.ID, "Вы уже в игре! Введите /quit, чтобы покинуть текущую игру.", nil)
+		return
+	}
+
+	form := utils.NewInviteForm(formatTarget(target))
+	b.reply(message.Chat.ID, b.newGameText(form), utils.RoundsKeyboard(b.flow.Codec(), message.From.ID, form))
+}
+
+// parseTarget reads the player an invite is meant for: a user ID, or a
+// username with or without the leading @.
+func parseTarget(s string) (models.InviteTarget, error) {
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if id <= 0 {
+			return models.InviteTarget{}, errors.New("invalid user ID")
+		}
+		return models.InviteTarget{ID: id}, nil
+	}
+
+	username := strings.TrimPrefix(s, "@")
+	if username == "" || len(username) > maxUsernameLen {
+		return models.InviteTarget{}, errors.New("invalid username")
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return models.InviteTarget{}, errors.New("invalid username")
+		}
+	}
+	return models.InviteTarget{Username: username}, nil
+}
+
+// formatTarget is the inverse of parseTarget.
+func formatTarget(target models.InviteTarget) string {
+	if target.Username != "" {
+		return "@" + target.Username
+	}
+	return strconv.FormatInt(target.ID, 10)
+}
+
+// sendChallenge delivers a targeted invite to a player the bot already knows.
+func (b *Bot) sendChallenge(invite *models.PendingInvite, inviter *tgbotapi.User) {
+	text := fmt.Sprintf("⚔️ %s вызывает вас на игру на %s!\n\n%s\n\nВызов действует %s.",
+		displayName(inviter), roundsText(invite.Rounds), b.rulesText(invite.Payoff, invite.TurnTimeout), formatWait(b.manager.InviteTTL()))
+	b.reply(invite.Target.ID, text, utils.ChallengeKeyboard(b.inviteURL(invite.InviteID)))
+}
+
+// displayName is how a Telegram user is shown to other players.
+func displayName(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	return user.FirstName
+}
@@ -0,0 +1,71 @@
+package bot_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChallenge(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+	// Bob has used the bot, so the challenge reaches him directly.
+	bob.Send("/start")
+	if _, err := h.WaitText(bob, "Добро пожаловать"); err != nil {
+		t.Fatal(err)
+	}
+
+	inviteID, err := h.Challenge(alice, "@Bob", gameRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := waitingRoom(alice, inviteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer, err := h.WaitText(bob, "вызывает вас на игру")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls := offer.Keyboard.URLs(); len(urls) != 1 || !strings.HasSuffix(urls[0], "invite_"+inviteID) {
+		t.Fatalf("challenge has buttons %v, want a link to invite %s", urls, inviteID)
+	}
+
+	carol.Send("/start invite_" + inviteID)
+	if _, err := h.WaitText(carol, "адресовано другому игроку"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(bob, inviteID); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectClosed(h, alice, room, "принято"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChallengeNewcomer(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, _ := players(h)
+	carol, dave := h.User(303, "carol"), h.User(404, "dave")
+
+	alice.Send("/challenge @alice")
+	if _, err := h.WaitText(alice, "самого себя"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dave hasn't used the bot yet: alice gets a link only he can accept.
+	inviteID, err := h.Challenge(alice, "@dave", gameRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "еще не пользуется ботом"); err != nil {
+		t.Fatal(err)
+	}
+	carol.Send("/start invite_" + inviteID)
+	if _, err := h.WaitText(carol, "адресовано другому игроку"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(dave, inviteID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package bot_test
+
+import (
+	"net/http"
+	"prisoners-dilemma-bot/messaging/telegram"
+	"prisoners-dilemma-bot/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFloodWait(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.FailNext("sendMessage", http.StatusTooManyRequests, "Too Many Requests: retry after 1", 1)
+	if err := h.PlayRound(alice, bob, true, false); err != nil {
+		t.Fatal(err)
+	}
+	// The delayed message must still come before everything queued after it.
+	for _, u := range []*User{alice, bob} {
+		if _, err := h.Prompt(u); err != nil {
+			t.Fatal(err)
+		}
+		report, prompt := -1, -1
+		for i, m := range u.Messages() {
+			if strings.Contains(m.Text, "Счет:") {
+				report = i
+			}
+			if strings.HasPrefix(m.Text, "Раунд 2") {
+				prompt = i
+			}
+		}
+		if report < 0 || prompt < report {
+			t.Fatalf("%s got round 2 before the round 1 report", u.Username)
+		}
+	}
+}
+
+// pacedQueue allows one message per 100ms in a chat.
+var pacedQueue = telegram.QueueConfig{
+	GlobalRate: 1000,
+	ChatRate:   10,
+	ChatBurst:  1,
+	MaxRetries: 2,
+	RetryDelay: 10 * time.Millisecond,
+}
+
+func TestChatRateLimit(t *testing.T) {
+	h := newHarness(t, Options{Queue: &pacedQueue})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PlayRound(alice, bob, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	chatID := strconv.FormatInt(alice.ID, 10)
+	var last time.Time
+	for _, call := range h.Server.Calls() {
+		if call.Params["chat_id"] != chatID || (call.Method != "sendMessage" && call.Method != "editMessageText") {
+			continue
+		}
+		// Leave some slack for timer jitter.
+		if !last.IsZero() && call.Time.Sub(last) < 80*time.Millisecond {
+			t.Fatalf("two messages to alice only %s apart", call.Time.Sub(last))
+		}
+		last = call.Time
+	}
+}
+
+func TestBlockedPlayer(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(alice, true); err != nil {
+		t.Fatal(err)
+	}
+
+	bob.Block()
+	if _, err := bob.PressText(prompt, "🤝"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "bob больше недоступен"); err != nil {
+		t.Fatal(err)
+	}
+	if session, ok := h.Manager.FindSessionByPlayerID(alice.ID); ok && session.State == models.StateInProgress {
+		t.Fatalf("the game is still in progress")
+	}
+}
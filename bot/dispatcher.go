@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultWorkers is how many updates are handled at the same time unless Config.Workers says otherwise.
+const DefaultWorkers = 16
+
+// dispatcher runs update handlers on a bounded pool of workers. Updates that
+// share a key are handled one at a time in arrival order; updates with
+// different keys run in parallel.
+type dispatcher struct {
+	handle func(tgbotapi.Update)
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	queues   map[int64][]tgbotapi.Update
+	inFlight sync.WaitGroup
+}
+
+func newDispatcher(workers int, handle func(tgbotapi.Update)) *dispatcher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &dispatcher{
+		handle: handle,
+		slots:  make(chan struct{}, workers),
+		queues: make(map[int64][]tgbotapi.Update),
+	}
+}
+
+// dispatch queues update behind everything else with the same key.
+func (d *dispatcher) dispatch(key int64, update tgbotapi.Update) {
+	d.inFlight.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	queue, running := d.queues[key]
+	d.queues[key] = append(queue, update)
+	if !running {
+		go d.run(key)
+	}
+}
+
+// run works through a key's queue, taking a worker slot for each update, and
+// forgets the key once the queue is empty.
+func (d *dispatcher) run(key int64) {
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		update := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+
+		d.slots <- struct{}{}
+		d.handle(update)
+		<-d.slots
+		d.inFlight.Done()
+	}
+}
+
+// wait blocks until every dispatched update has been handled.
+func (d *dispatcher) wait() {
+	d.inFlight.Wait()
+}
@@ -0,0 +1,32 @@
+package bot_test
+
+import "testing"
+
+func TestParallelGames(t *testing.T) {
+	h := newHarness(t, Options{})
+	pairs := [][2]*User{
+		{h.User(101, "alice"), h.User(202, "bob")},
+		{h.User(303, "carol"), h.User(404, "dave")},
+		{h.User(505, "erin"), h.User(606, "frank")},
+	}
+	errs := make(chan error, len(pairs))
+	for _, pair := range pairs {
+		go func(a, b *User) {
+			if err := h.StartGame(a, b, gameRounds); err != nil {
+				errs <- err
+				return
+			}
+			if err := playOut(h, a, b, gameRounds, true, false); err != nil {
+				errs <- err
+				return
+			}
+			_, err := h.WaitText(a, b.Username+" победил")
+			errs <- err
+		}(pair[0], pair[1])
+	}
+	for range pairs {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/utils"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const exportUsage = "Использование: /export или /export json|csv|txt"
+
+// handleExport offers the record of the player's latest finished game, or
+// sends it straight away with /export <format>.
+func (b *Bot) handleExport(message *tgbotapi.Message) {
+	chatID, playerID := message.Chat.ID, message.From.ID
+	format := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if format != "" && !validExportFormat(format) {
+		b.reply(chatID, exportUsage, nil)
+		return
+	}
+	games, err := b.manager.LastGames(playerID)
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	if len(games) == 0 {
+		b.reply(chatID, "Вы ещё не завершили ни одной игры.", nil)
+		return
+	}
+	if format != "" {
+		b.sendExport(chatID, playerID, games[0], format)
+		return
+	}
+
+	record, err := b.manager.GameRecord(games[0])
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	a, o := record.Players[0], record.Players[1]
+	text := fmt.Sprintf("📤 Последняя игра: %s %d — %d %s (%s).\nВ каком формате прислать запись?",
+		a.Username, a.Score, o.Score, o.Username, record.EndedAt.Format("02.01.2006 15:04"))
+	b.reply(chatID, text, utils.ExportKeyboard(b.flow.Codec(), playerID, record.GameID))
+}
+
+// handleExportButton sends the record of a game in the format of the pressed button.
+func (b *Bot) handleExportButton(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	if !validExportFormat(data.Arg) {
+		b.expireButton(cb)
+		return
+	}
+	b.sendExport(cb.From.ID, cb.From.ID, data.GameID, data.Arg)
+}
+
+// sendExport sends the record of a game the player played as a file.
+func (b *Bot) sendExport(chatID, playerID int64, gameID, format string) {
+	sender, ok := b.msg.(messaging.DocumentSender)
+	if !ok {
+		b.reply(chatID, "Отправка файлов сейчас недоступна.", nil)
+		return
+	}
+	record, err := b.manager.GameRecord(gameID)
+	if err == nil && !record.Played(playerID) {
+		// Nobody learns about games they didn't play.
+		err = fmt.Errorf("запись этой игры не найдена")
+	}
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	name, data, err := record.Export(format)
+	if err != nil {
+		log.Printf("Failed to export game %s as %s: %v", gameID, format, err)
+		b.reply(chatID, "Не удалось подготовить запись игры.", nil)
+		return
+	}
+	if _, err := sender.SendDocument(chatID, name, data, fmt.Sprintf("📤 Запись игры %s", gameID)); err != nil {
+		log.Printf("Failed to send export of game %s to %d: %v", gameID, chatID, err)
+	}
+}
+
+func validExportFormat(format string) bool {
+	for _, f := range game.ExportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package bot_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"prisoners-dilemma-bot/game"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds, false, true); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := h.WaitText(alice, "Игра окончена")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(summary, "JSON"); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := h.WaitDocument(alice, ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record game.GameRecord
+	if err := json.Unmarshal(doc.Data, &record); err != nil {
+		t.Fatalf("export is not JSON: %v", err)
+	}
+	if record.Version != game.RecordVersion || record.Players[0].ID != alice.ID || record.Players[1].ID != bob.ID ||
+		record.WinnerID != alice.ID || len(record.History) != gameRounds || record.StartedAt.IsZero() {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	last := record.History[gameRounds-1]
+	if last.Moves[0].Move != game.RecordDefect || last.Moves[1].Move != game.RecordCooperate || last.Moves[0].Points != 5 {
+		t.Fatalf("last round is recorded as %+v", last)
+	}
+
+	bob.Send("/export csv")
+	doc, err = h.WaitDocument(bob, ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(doc.Data)), "\n")
+	if len(rows) != 1+2*gameRounds || !strings.HasPrefix(rows[0], "game_id,round,") {
+		t.Fatalf("CSV export has %d rows, header %q", len(rows), rows[0])
+	}
+	want := fmt.Sprintf("%s,10,", record.GameID)
+	if !strings.HasPrefix(rows[len(rows)-1], want) || !strings.Contains(rows[len(rows)-1], ",202,bob,cooperate,0,0,defect,") {
+		t.Fatalf("last CSV row is %q", rows[len(rows)-1])
+	}
+
+	bob.Send("/export")
+	offer, err := h.WaitText(bob, "В каком формате")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.PressText(offer, "Текст"); err != nil {
+		t.Fatal(err)
+	}
+	doc, err = h.WaitDocument(bob, ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Раунд 10: alice предал (+5), bob сотрудничал (+0). Счет 50:0", "Победил alice."} {
+		if !strings.Contains(string(doc.Data), line) {
+			t.Fatalf("transcript lacks %q:\n%s", line, doc.Data)
+		}
+	}
+
+	carol.Send("/export")
+	_, err = h.WaitText(carol, "Вы ещё не завершили ни одной игры")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
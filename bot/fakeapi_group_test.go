@@ -0,0 +1,77 @@
+package bot_test
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Group is a simulated group chat the bot was added to. Any user may post in it.
+type Group struct {
+	server *Server
+	ID     int64
+	Title  string
+	admins map[int64]bool
+}
+
+// AddGroup registers a simulated group chat. Group chat IDs are negative.
+func (s *Server) AddGroup(id int64, title string) *Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &Group{server: s, ID: id, Title: title, admins: make(map[int64]bool)}
+	s.groups[id] = g
+	return g
+}
+
+// MakeAdmin makes u an administrator of the group.
+func (g *Group) MakeAdmin(u *User) {
+	g.server.mu.Lock()
+	defer g.server.mu.Unlock()
+	g.admins[u.ID] = true
+}
+
+// chat is the group as Telegram describes it.
+func (g *Group) chat() *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: g.ID, Type: "group", Title: g.Title}
+}
+
+// Messages returns every message the bot sent to the group.
+func (g *Group) Messages() []Message {
+	return g.server.Messages(g.ID)
+}
+
+// WaitFor blocks until a message to the group satisfies match.
+func (g *Group) WaitFor(timeout time.Duration, match func(Message) bool) (Message, error) {
+	return g.server.WaitFor(g.ID, timeout, match)
+}
+
+func (s *Server) getChatMember(w http.ResponseWriter, params map[string]string) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	userID, _ := strconv.ParseInt(params["user_id"], 10, 64)
+
+	s.mu.Lock()
+	g, ok := s.groups[chatID]
+	var admin bool
+	if ok {
+		admin = g.admins[userID]
+	}
+	user, known := s.users[userID]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat not found", 0)
+		return
+	}
+	if !known {
+		writeError(w, http.StatusBadRequest, "Bad Request: user not found", 0)
+		return
+	}
+
+	status := "member"
+	if admin {
+		status = "administrator"
+	}
+	writeResult(w, tgbotapi.ChatMember{User: user.tgUser(), Status: status})
+}
@@ -0,0 +1,153 @@
+package bot_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// InlineResult is an article the bot offered in answer to an inline query.
+type InlineResult struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     struct {
+		Text string `json:"message_text"`
+	} `json:"input_message_content"`
+	Keyboard *Keyboard `json:"reply_markup"`
+}
+
+// InlineQuery types "@botname query" as the user and returns the inline query ID.
+func (u *User) InlineQuery(query string) string {
+	u.server.mu.Lock()
+	u.server.nextCbID++
+	id := "q" + strconv.Itoa(u.server.nextCbID)
+	u.server.mu.Unlock()
+
+	u.server.pushUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+		ID:    id,
+		From:  u.tgUser(),
+		Query: query,
+	}})
+	return id
+}
+
+// ChooseInlineResult posts one of the offered results as the user, as picking
+// it from the inline results does, and returns the posted message.
+func (u *User) ChooseInlineResult(query string, result InlineResult) Message {
+	s := u.server
+	s.mu.Lock()
+	s.nextMsgID++
+	m := &Message{ID: s.nextMsgID, Text: result.Content.Text, InlineID: "inline" + strconv.Itoa(s.nextMsgID)}
+	if result.Keyboard != nil {
+		m.Keyboard = *result.Keyboard
+	}
+	s.messages = append(s.messages, m)
+	posted := *m
+	s.mu.Unlock()
+
+	chosen := &tgbotapi.ChosenInlineResult{ResultID: result.ID, From: u.tgUser(), Query: query}
+	// Telegram only tells the bot where the result went if it has a keyboard.
+	if result.Keyboard != nil {
+		chosen.InlineMessageID = posted.InlineID
+	}
+	s.pushUpdate(tgbotapi.Update{ChosenInlineResult: chosen})
+	return posted
+}
+
+// PressInline taps the inline button whose text contains substr on a message
+// posted through inline mode. It returns the callback query ID.
+func (u *User) PressInline(m Message, substr string) (string, error) {
+	if m.InlineID == "" {
+		return "", fmt.Errorf("message %d was not posted through inline mode", m.ID)
+	}
+	button := m.Keyboard.ButtonByText(substr)
+	if button == nil || button.CallbackData == nil {
+		return "", fmt.Errorf("message %s has no callback button labelled %q", m.InlineID, substr)
+	}
+
+	u.server.mu.Lock()
+	u.server.nextCbID++
+	id := strconv.Itoa(u.server.nextCbID)
+	u.server.mu.Unlock()
+
+	u.server.pushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:              id,
+		From:            u.tgUser(),
+		InlineMessageID: m.InlineID,
+		ChatInstance:    m.InlineID,
+		Data:            *button.CallbackData,
+	}})
+	return id, nil
+}
+
+// InlineResults waits for the bot to answer an inline query and returns the results.
+func (s *Server) InlineResults(queryID string, timeout time.Duration) ([]InlineResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		results, ok := s.inline[queryID]
+		s.mu.Unlock()
+		if ok {
+			return results, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("inline query %s was not answered within %s", queryID, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitInline blocks until the message posted through inline mode as inlineID
+// satisfies match, returning it. It fails after timeout.
+func (s *Server) WaitInline(inlineID string, timeout time.Duration, match func(Message) bool) (Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		var found *Message
+		for _, m := range s.messages {
+			if m.InlineID == inlineID {
+				copied := *m
+				found = &copied
+				break
+			}
+		}
+		s.mu.Unlock()
+		if found != nil && match(*found) {
+			return *found, nil
+		}
+		if time.Now().After(deadline) {
+			return Message{}, fmt.Errorf("no matching inline message %s within %s", inlineID, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *Server) answerInlineQuery(w http.ResponseWriter, params map[string]string) {
+	var results []InlineResult
+	if err := json.Unmarshal([]byte(params["results"]), &results); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: can't parse inline query results", 0)
+		return
+	}
+	s.mu.Lock()
+	s.inline[params["inline_query_id"]] = results
+	s.mu.Unlock()
+	writeResult(w, true)
+}
+
+func (s *Server) sendChatAction(w http.ResponseWriter, params map[string]string) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	s.mu.Lock()
+	user, ok := s.users[chatID]
+	blocked := ok && user.blocked
+	s.mu.Unlock()
+	if blocked {
+		writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+		return
+	}
+	writeResult(w, true)
+}
@@ -0,0 +1,491 @@
+package bot_test
+
+// This file is an in-process fake of the Telegram Bot API for the end-to-end
+// tests. Point tgbotapi.NewBotAPIWithAPIEndpoint at Server.Endpoint, drive the
+// bot with simulated users and inspect every message it sent.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is accepted by the fake server; any other token is rejected like a revoked one.
+const Token = "123456:TEST"
+
+// BotUser is the account the fake server reports from getMe.
+var BotUser = tgbotapi.User{ID: 1000, IsBot: true, FirstName: "Test Bot", UserName: "test_bot"}
+
+// Message is an outgoing bot message as last seen by the server.
+type Message struct {
+	ID       int
+	ChatID   int64
+	Text     string
+	Keyboard Keyboard
+	// Edits counts editMessageText calls made on this message.
+	Edits int
+	// InlineID is set for messages posted through inline mode, which have no chat.
+	InlineID string
+	// Document is the file name of a sendDocument upload, whose caption is
+	// the Text and whose contents are Data.
+	Document string
+	Data     []byte
+}
+
+// Keyboard is the reply_markup attached to a message.
+type Keyboard struct {
+	Inline [][]tgbotapi.InlineKeyboardButton `json:"inline_keyboard"`
+	Menu   [][]tgbotapi.KeyboardButton       `json:"keyboard"`
+}
+
+// HasData reports whether any inline button carries the given callback data.
+func (k Keyboard) HasData(data string) bool {
+	return k.ButtonByData(data) != nil
+}
+
+// ButtonByData finds the inline button carrying the given callback data.
+func (k Keyboard) ButtonByData(data string) *tgbotapi.InlineKeyboardButton {
+	for _, row := range k.Inline {
+		for i := range row {
+			if row[i].CallbackData != nil && *row[i].CallbackData == data {
+				return &row[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ButtonByText finds the first inline button whose text contains substr.
+func (k Keyboard) ButtonByText(substr string) *tgbotapi.InlineKeyboardButton {
+	for _, row := range k.Inline {
+		for i := range row {
+			if strings.Contains(row[i].Text, substr) {
+				return &row[i]
+			}
+		}
+	}
+	return nil
+}
+
+// URLs lists the links of all URL buttons.
+func (k Keyboard) URLs() []string {
+	var urls []string
+	for _, row := range k.Inline {
+		for _, b := range row {
+			if b.URL != nil {
+				urls = append(urls, *b.URL)
+			}
+		}
+	}
+	return urls
+}
+
+// Call is one Bot API request received by the server.
+type Call struct {
+	Method string
+	Params map[string]string
+	Time   time.Time
+}
+
+type injectedError struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is a fake Bot API. It is safe for concurrent use.
+type Server struct {
+	http *httptest.Server
+
+	mu         sync.Mutex
+	changed    *sync.Cond
+	closed     bool
+	nextUpdate int
+	nextMsgID  int
+	nextCbID   int
+	updates    []tgbotapi.Update
+	messages   []*Message
+	calls      []Call
+	answered   map[string]string
+	commands   []tgbotapi.BotCommand
+	failures   map[string][]injectedError
+	users      map[int64]*User
+	groups     map[int64]*Group
+	inline     map[string][]InlineResult
+}
+
+// NewServer starts a fake Bot API server.
+func NewServer() *Server {
+	s := &Server{
+		nextUpdate: 1,
+		answered:   make(map[string]string),
+		failures:   make(map[string][]injectedError),
+		users:      make(map[int64]*User),
+		groups:     make(map[int64]*Group),
+		inline:     make(map[string][]InlineResult),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	s.http = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint is the API endpoint format for tgbotapi.NewBotAPIWithAPIEndpoint.
+func (s *Server) Endpoint() string {
+	return s.http.URL + "/bot%s/%s"
+}
+
+// Close releases pending long polls and shuts the server down.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.changed.Broadcast()
+	s.mu.Unlock()
+	s.http.Close()
+}
+
+// FailNext makes the next call to method fail with the given error code.
+// A positive retryAfter is reported as parameters.retry_after, like a 429 flood wait.
+func (s *Server) FailNext(method string, code int, description string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], injectedError{code: code, description: description, retryAfter: retryAfter})
+}
+
+// Messages returns copies of every message the bot sent to a chat, oldest first.
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Message
+	for _, m := range s.messages {
+		if m.ChatID == chatID {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// Calls returns every request received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Answered reports whether the bot answered the callback query, and with which text.
+func (s *Server) Answered(callbackID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text, ok := s.answered[callbackID]
+	return text, ok
+}
+
+// Commands returns the command menu last set with setMyCommands.
+func (s *Server) Commands() []tgbotapi.BotCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tgbotapi.BotCommand(nil), s.commands...)
+}
+
+// WaitFor blocks until a message sent to chatID satisfies match, returning it.
+// It fails after timeout.
+func (s *Server) WaitFor(chatID int64, timeout time.Duration, match func(Message) bool) (Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, m := range s.Messages(chatID) {
+			if match(m) {
+				return m, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return Message{}, fmt.Errorf("no matching message for chat %d within %s", chatID, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *Server) pushUpdate(u tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.UpdateID = s.nextUpdate
+	s.nextUpdate++
+	s.updates = append(s.updates, u)
+	s.changed.Broadcast()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /bot<token>/<method>.
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/bot"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not Found", 0)
+		return
+	}
+	token, method := parts[0], parts[1]
+	if token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+	// Uploads come as multipart forms, everything else as urlencoded ones.
+	var files map[string][]*multipart.FileHeader
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxUpload); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+			return
+		}
+		files = r.MultipartForm.File
+	} else if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+		return
+	}
+
+	params := make(map[string]string, len(r.PostForm))
+	for key := range r.PostForm {
+		params[key] = r.PostForm.Get(key)
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: params, Time: time.Now()})
+	if queue := s.failures[method]; len(queue) > 0 {
+		failure := queue[0]
+		s.failures[method] = queue[1:]
+		s.mu.Unlock()
+		writeError(w, failure.code, failure.description, failure.retryAfter)
+		return
+	}
+	s.mu.Unlock()
+
+	switch method {
+	case "getMe":
+		writeResult(w, BotUser)
+	case "getUpdates":
+		s.getUpdates(w, params)
+	case "sendMessage":
+		s.sendMessage(w, params)
+	case "editMessageText":
+		s.editMessageText(w, params)
+	case "sendDocument":
+		s.sendDocument(w, params, files["document"])
+	case "setMyCommands":
+		var commands []tgbotapi.BotCommand
+		if err := json.Unmarshal([]byte(params["commands"]), &commands); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: can't parse commands", 0)
+			return
+		}
+		s.mu.Lock()
+		s.commands = commands
+		s.mu.Unlock()
+		writeResult(w, true)
+	case "answerInlineQuery":
+		s.answerInlineQuery(w, params)
+	case "sendChatAction":
+		s.sendChatAction(w, params)
+	case "getChatMember":
+		s.getChatMember(w, params)
+	case "answerCallbackQuery":
+		s.mu.Lock()
+		s.answered[params["callback_query_id"]] = params["text"]
+		s.mu.Unlock()
+		writeResult(w, true)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method "+method+" is not supported by the fake server", 0)
+	}
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, params map[string]string) {
+	offset, _ := strconv.Atoi(params["offset"])
+	timeout, _ := strconv.Atoi(params["timeout"])
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	// Wake the long poll when the deadline passes even if nothing else happens.
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		s.mu.Lock()
+		s.changed.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	s.mu.Lock()
+	for {
+		var pending []tgbotapi.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		if len(pending) > 0 || s.closed || !time.Now().Before(deadline) {
+			s.mu.Unlock()
+			if pending == nil {
+				pending = []tgbotapi.Update{}
+			}
+			writeResult(w, pending)
+			return
+		}
+		s.changed.Wait()
+	}
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, params map[string]string) {
+	chatID, err := strconv.ParseInt(params["chat_id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat_id is invalid", 0)
+		return
+	}
+	if params["text"] == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request: message text is empty", 0)
+		return
+	}
+
+	var keyboard Keyboard
+	if raw := params["reply_markup"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &keyboard); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: can't parse reply keyboard markup JSON object", 0)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if user, ok := s.users[chatID]; ok && user.blocked {
+		s.mu.Unlock()
+		writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+		return
+	}
+	s.nextMsgID++
+	m := &Message{ID: s.nextMsgID, ChatID: chatID, Text: params["text"], Keyboard: keyboard}
+	s.messages = append(s.messages, m)
+	s.changed.Broadcast()
+	s.mu.Unlock()
+
+	writeResult(w, s.wireMessage(m))
+}
+
+// maxUpload caps the size of files sent to the server.
+const maxUpload = 10 << 20
+
+func (s *Server) sendDocument(w http.ResponseWriter, params map[string]string, files []*multipart.FileHeader) {
+	chatID, err := strconv.ParseInt(params["chat_id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat_id is invalid", 0)
+		return
+	}
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "Bad Request: there is no document in the request", 0)
+		return
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+		return
+	}
+
+	s.mu.Lock()
+	if user, ok := s.users[chatID]; ok && user.blocked {
+		s.mu.Unlock()
+		writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+		return
+	}
+	s.nextMsgID++
+	m := &Message{ID: s.nextMsgID, ChatID: chatID, Text: params["caption"], Document: files[0].Filename, Data: data}
+	s.messages = append(s.messages, m)
+	s.changed.Broadcast()
+	s.mu.Unlock()
+
+	writeResult(w, s.wireMessage(m))
+}
+
+func (s *Server) editMessageText(w http.ResponseWriter, params map[string]string) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(params["message_id"])
+	inlineID := params["inline_message_id"]
+
+	var keyboard Keyboard
+	if raw := params["reply_markup"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &keyboard); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: can't parse reply keyboard markup JSON object", 0)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if user, ok := s.users[chatID]; ok && user.blocked {
+		s.mu.Unlock()
+		writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+		return
+	}
+	var target *Message
+	for _, m := range s.messages {
+		if inlineID != "" && m.InlineID == inlineID || inlineID == "" && m.InlineID == "" && m.ChatID == chatID && m.ID == messageID {
+			target = m
+			break
+		}
+	}
+	if target == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "Bad Request: message to edit not found", 0)
+		return
+	}
+	target.Text = params["text"]
+	target.Keyboard = keyboard
+	target.Edits++
+	s.changed.Broadcast()
+	edited := *target
+	s.mu.Unlock()
+
+	// Edits of inline messages are answered with true, as they are by Telegram.
+	if inlineID != "" {
+		writeResult(w, true)
+		return
+	}
+	writeResult(w, s.wireMessage(&edited))
+}
+
+func (s *Server) wireMessage(m *Message) tgbotapi.Message {
+	bot := BotUser
+	chat := &tgbotapi.Chat{ID: m.ChatID, Type: "private"}
+	s.mu.Lock()
+	if g, ok := s.groups[m.ChatID]; ok {
+		chat = g.chat()
+	}
+	s.mu.Unlock()
+	return tgbotapi.Message{
+		MessageID: m.ID,
+		From:      &bot,
+		Date:      int(time.Now().Unix()),
+		Chat:      chat,
+		Text:      m.Text,
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), 0)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, retryAfter int) {
+	resp := tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description}
+	if retryAfter > 0 {
+		resp.Parameters = &tgbotapi.ResponseParameters{RetryAfter: retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,162 @@
+package bot_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// User is a simulated Telegram user chatting with the bot in a private chat.
+type User struct {
+	server   *Server
+	ID       int64
+	Username string
+	blocked  bool
+}
+
+// AddUser registers a simulated user. The private chat ID equals the user ID.
+func (s *Server) AddUser(id int64, username string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &User{server: s, ID: id, Username: username}
+	s.users[id] = u
+	return u
+}
+
+func (u *User) tgUser() *tgbotapi.User {
+	return &tgbotapi.User{ID: u.ID, FirstName: u.Username, UserName: u.Username, LanguageCode: "ru"}
+}
+
+func (u *User) chat() *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: u.ID, Type: "private", UserName: u.Username}
+}
+
+// Send delivers a text message from the user. Text starting with "/" is marked
+// as a bot command, as the Telegram client does.
+func (u *User) Send(text string) {
+	u.send(u.chat(), text)
+}
+
+// SendIn delivers a text message from the user to a group chat.
+func (u *User) SendIn(g *Group, text string) {
+	u.send(g.chat(), text)
+}
+
+func (u *User) send(chat *tgbotapi.Chat, text string) {
+	u.server.mu.Lock()
+	u.server.nextMsgID++
+	messageID := u.server.nextMsgID
+	u.server.mu.Unlock()
+
+	msg := &tgbotapi.Message{
+		MessageID: messageID,
+		From:      u.tgUser(),
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if i := strings.IndexByte(text, ' '); i >= 0 {
+			length = i
+		}
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+	u.server.pushUpdate(tgbotapi.Update{Message: msg})
+}
+
+// Press taps the inline button with the given callback data on a message the bot
+// sent to this user. It returns the callback query ID.
+func (u *User) Press(m Message, data string) (string, error) {
+	if m.ChatID != u.ID {
+		return "", fmt.Errorf("message %d was not sent to user %d", m.ID, u.ID)
+	}
+	if !m.Keyboard.HasData(data) {
+		return "", fmt.Errorf("message %d has no button with data %q", m.ID, data)
+	}
+	return u.PressRaw(m.ID, data), nil
+}
+
+// PressIn taps the inline button whose text contains substr on a message the
+// bot sent to a group chat. It returns the callback query ID.
+func (u *User) PressIn(g *Group, m Message, substr string) (string, error) {
+	if m.ChatID != g.ID {
+		return "", fmt.Errorf("message %d was not sent to group %d", m.ID, g.ID)
+	}
+	button := m.Keyboard.ButtonByText(substr)
+	if button == nil || button.CallbackData == nil {
+		return "", fmt.Errorf("message %d has no callback button labelled %q", m.ID, substr)
+	}
+	return u.pressIn(g.chat(), m.ID, *button.CallbackData), nil
+}
+
+// PressText taps the inline button whose text contains substr.
+func (u *User) PressText(m Message, substr string) (string, error) {
+	button := m.Keyboard.ButtonByText(substr)
+	if button == nil || button.CallbackData == nil {
+		return "", fmt.Errorf("message %d has no callback button labelled %q", m.ID, substr)
+	}
+	return u.Press(m, *button.CallbackData)
+}
+
+// PressRaw sends a callback query for any data, e.g. to simulate a forged or
+// stale button. It returns the callback query ID.
+func (u *User) PressRaw(messageID int, data string) string {
+	u.server.mu.Lock()
+	u.server.nextCbID++
+	id := strconv.Itoa(u.server.nextCbID)
+	u.server.mu.Unlock()
+
+	u.Redeliver(messageID, data, id)
+	return id
+}
+
+func (u *User) pressIn(chat *tgbotapi.Chat, messageID int, data string) string {
+	u.server.mu.Lock()
+	u.server.nextCbID++
+	id := strconv.Itoa(u.server.nextCbID)
+	u.server.mu.Unlock()
+
+	u.server.pushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:           id,
+		From:         u.tgUser(),
+		Message:      &tgbotapi.Message{MessageID: messageID, Chat: chat, From: &BotUser},
+		ChatInstance: strconv.FormatInt(chat.ID, 10),
+		Data:         data,
+	}})
+	return id
+}
+
+// Redeliver sends a callback query with an ID that was already used, as
+// Telegram does when it retries an update.
+func (u *User) Redeliver(messageID int, data, callbackID string) {
+	u.server.pushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:           callbackID,
+		From:         u.tgUser(),
+		Message:      &tgbotapi.Message{MessageID: messageID, Chat: u.chat(), From: &BotUser},
+		ChatInstance: strconv.FormatInt(u.ID, 10),
+		Data:         data,
+	}})
+}
+
+// Block makes every later sendMessage to this user fail with 403, as when the
+// user blocks the bot.
+func (u *User) Block() {
+	u.server.mu.Lock()
+	defer u.server.mu.Unlock()
+	u.blocked = true
+}
+
+// Messages returns every message the bot sent to this user.
+func (u *User) Messages() []Message {
+	return u.server.Messages(u.ID)
+}
+
+// WaitFor blocks until a message to this user satisfies match.
+func (u *User) WaitFor(timeout time.Duration, match func(Message) bool) (Message, error) {
+	return u.server.WaitFor(u.ID, timeout, match)
+}
@@ -0,0 +1,156 @@
+package bot_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gameRounds is the shortest game the rounds menu offers.
+const gameRounds = 10
+
+func players(h *Harness) (*User, *User) {
+	return h.User(101, "alice"), h.User(202, "bob")
+}
+
+// playOut plays n rounds in which both players repeat the same move.
+func playOut(h *Harness, a, b *User, n int, aCooperates, bCooperates bool) error {
+	for i := 0; i < n; i++ {
+		if err := h.PlayRound(a, b, aCooperates, bCooperates); err != nil {
+			return fmt.Errorf("round %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func TestFullGame(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Ваше приглашение принято"); err != nil {
+		t.Fatal(err)
+	}
+
+	rounds := [][2]bool{{true, true}, {true, false}, {false, false}}
+	for _, r := range rounds {
+		if err := h.PlayRound(alice, bob, r[0], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := playOut(h, alice, bob, gameRounds-len(rounds), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// alice: 3 + 0 + 1 + 7, bob: 3 + 5 + 1 + 7
+	for _, u := range []*User{alice, bob} {
+		final, err := h.WaitText(u, "Игра окончена")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(final.Text, "Игрок: alice\nОчки: 11") || !strings.Contains(final.Text, "Игрок: bob\nОчки: 16") {
+			t.Fatalf("unexpected final score for %s:\n%s", u.Username, final.Text)
+		}
+		if !strings.Contains(final.Text, "bob победил") {
+			t.Fatalf("bob should have won:\n%s", final.Text)
+		}
+		if _, err := h.WaitText(u, "Ваш стиль в этой игре"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRematch(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Rematch(alice, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Ждем другого игрока"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Rematch(bob, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{alice, bob} {
+		if _, err := h.WaitText(u, "Реванш начинается"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := playOut(h, alice, bob, gameRounds, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "alice победил"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeclineRematch(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Rematch(bob, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Другой игрок не захотел играть реванш"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Manager.FindSessionByPlayerID(alice.ID); ok {
+		t.Fatalf("alice is still attached to a session")
+	}
+}
+
+func TestTurnTimeout(t *testing.T) {
+	h := newHarness(t, Options{TurnTimeout: 300 * time.Millisecond})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PlayRound(alice, bob, true, true); err != nil {
+		t.Fatal(err)
+	}
+	// Only bob moves in round two, so alice is the one who ran out of time.
+	if err := h.Move(bob, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{alice, bob} {
+		if _, err := h.WaitText(u, "Время вышло! alice слишком долго не делал ход."); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.WaitText(u, "Игра окончена"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Prompt(alice); err != nil {
+		t.Fatal(err)
+	}
+	alice.Send("/quit")
+	if _, err := h.WaitText(alice, "Вы покинули игру"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "alice покинул игру"); err != nil {
+		t.Fatal(err)
+	}
+}
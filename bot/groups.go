@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// groupRoutes are the routes that work in group chats; everything else is
+// for private chats only.
+var groupRoutes = []string{"/help", "/challenge", "/leaderboard", "/groupsettings", "callback:" + callback.Prefix(callback.ActionGroup)}
+
+const groupOnlyText = "Эта команда работает только в групповых чатах."
+
+// leaderboardSize is how many players the group leaderboard shows.
+const leaderboardSize = 10
+
+// handleGroupChallenge posts a challenge in a group chat as a match card the
+// whole group can follow. The game itself is played in private chats with the
+// bot, with the settings the group's admins picked.
+func (b *Bot) handleGroupChallenge(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	target, err := parseTarget(strings.TrimSpace(message.CommandArguments()))
+	if err != nil {
+		b.reply(chatID, challengeUsage, nil)
+		return
+	}
+	if target.Matches(message.From.ID, message.From.UserName) {
+		b.reply(chatID, "Нельзя вызвать на игру самого себя.", nil)
+		return
+	}
+	if b.manager.Busy(message.From.ID) {
+		b.reply(chatID, fmt.Sprintf("%s, вы уже в игре! Доиграйте ее или выйдите командой /quit в личном чате с ботом.", displayName(message.From)), nil)
+		return
+	}
+
+	settings, err := b.manager.GroupSettings(chatID)
+	if err != nil {
+		log.Printf("Error loading settings of chat %d: %v", chatID, err)
+	}
+	settings.Target = target
+	invite, err := b.manager.CreateGameInvite(message.From.ID, message.From.UserName, settings)
+	if errors.Is(err, game.ErrTooManyInvites) {
+		b.reply(chatID, fmt.Sprintf("%s, у вас уже слишком много открытых приглашений.", displayName(message.From)), nil)
+		return
+	}
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	url := b.inviteURL(invite.InviteID)
+
+	// Moves are made in private, so the inviter must be able to get messages
+	// from the bot. The private message doubles as their waiting room.
+	roomText := fmt.Sprintf("⚔️ Ваш вызов для %s опубликован в группе «%s».\n\n%s\n\n⏳ Ожидаем соперника. Вызов действует %s.",
+		invite.Target, message.Chat.Title, b.rulesText(invite.Payoff, invite.TurnTimeout), formatWait(b.manager.InviteTTL()))
+	room, err := b.post(message.From.ID, roomText, utils.InviteKeyboard(b.flow.Codec(), message.From.ID, invite.InviteID, url))
+	if err != nil {
+		b.manager.CancelInvite(message.From.ID, invite.InviteID)
+		b.reply(chatID, fmt.Sprintf("%s, сначала напишите боту в личные сообщения: ходы делаются там.\nhttps://t.me/%s?start",
+			displayName(message.From), b.api.Self.UserName), nil)
+		return
+	}
+	b.manager.SetInviteMessage(invite.InviteID, room.MessageID)
+
+	cardText := fmt.Sprintf("⚔️ %s вызывает %s на игру на %s!\n\n%s\n\nПринять вызов может только %s. Ходы делаются в личных сообщениях с ботом, а здесь будет видно, как идет игра.",
+		displayName(message.From), invite.Target, roundsText(invite.Rounds), b.rulesText(invite.Payoff, invite.TurnTimeout), invite.Target)
+	card, err := b.post(chatID, cardText, utils.ChallengeKeyboard(url))
+	if err != nil {
+		log.Printf("Failed to post match card in chat %d: %v", chatID, err)
+	} else {
+		b.manager.SetInviteCard(invite.InviteID, models.GroupCard{ChatID: card.ChatID, MessageID: card.MessageID})
+	}
+	if invite.Target.ID != 0 {
+		b.sendChallenge(invite, message.From)
+	}
+}
+
+// closeCard replaces the match card of an invite nobody accepted.
+func (b *Bot) closeCard(invite models.PendingInvite, text string) {
+	if invite.Card.IsZero() {
+		return
+	}
+	b.edit(messaging.MessageRef{ChatID: invite.Card.ChatID, MessageID: invite.Card.MessageID, InlineID: invite.Card.InlineMessageID}, text, nil)
+}
+
+// handleLeaderboard shows the standings of a group's players over the games challenged in it.
+func (b *Bot) handleLeaderboard(message *tgbotapi.Message) {
+	if message.Chat.IsPrivate() {
+		b.reply(message.Chat.ID, groupOnlyText, nil)
+		return
+	}
+	standings, err := b.manager.GroupLeaderboard(message.Chat.ID)
+	if err != nil {
+		b.reply(message.Chat.ID, err.Error(), nil)
+		return
+	}
+	if len(standings) == 0 {
+		b.reply(message.Chat.ID, "В этой группе еще не сыграно ни одной игры. Вызовите кого-нибудь командой /challenge @username!", nil)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🏆 Таблица лидеров группы")
+	if season, err := b.manager.CurrentSeason(); err == nil && season != nil && season.Running() {
+		fmt.Fprintf(&sb, ", сезон %d", season.Number)
+	}
+	sb.WriteString("\n")
+	for i, s := range standings {
+		if i == leaderboardSize {
+			break
+		}
+		name := s.Username
+		if name == "" {
+			name = "ID " + strconv.FormatInt(s.PlayerID, 10)
+		}
+		fmt.Fprintf(&sb, "\n%d. %s — побед: %d, ничьих: %d, поражений: %d (очков: %d)", i+1, name, s.Wins, s.Draws, s.Losses, s.Points)
+	}
+	b.reply(message.Chat.ID, sb.String(), nil)
+}
+
+// handleGroupSettings shows a group's admins the settings challenges in the group start with.
+func (b *Bot) handleGroupSettings(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.Chat.IsPrivate() {
+		b.reply(chatID, groupOnlyText, nil)
+		return
+	}
+	if !b.isGroupAdmin(chatID, message.From.ID) {
+		b.reply(chatID, "Настройки группы могут менять только ее администраторы.", nil)
+		return
+	}
+	settings, err := b.manager.GroupSettings(chatID)
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	form := utils.FormOf(settings)
+	b.reply(chatID, b.groupSettingsText(settings), utils.GroupSettingsKeyboard(b.flow.Codec(), message.From.ID, settings.Rounds, form))
+}
+
+// handleGroupSettingsChange saves a setting a group admin changed and redraws the settings.
+func (b *Bot) handleGroupSettingsChange(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	chatID := cb.Message.Chat.ID
+	roundsArg, formArg, _ := strings.Cut(data.Arg, "/")
+	rounds, err := strconv.Atoi(roundsArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	form, err := utils.ParseInviteForm(formArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	// Whoever opened the settings may have lost their admin rights since.
+	if !b.isGroupAdmin(chatID, cb.From.ID) {
+		b.edit(callbackRef(cb), "Настройки группы могут менять только ее администраторы.", nil)
+		return
+	}
+
+	settings := form.Settings(rounds)
+	if err := b.manager.SetGroupSettings(chatID, settings); err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	b.edit(callbackRef(cb), b.groupSettingsText(settings), utils.GroupSettingsKeyboard(b.flow.Codec(), cb.From.ID, rounds, form))
+}
+
+// groupSettingsText describes the settings challenges in a group start with.
+func (b *Bot) groupSettingsText(settings models.GameSettings) string {
+	spectators := "нет"
+	if settings.AllowSpectators {
+		spectators = "разрешены"
+	}
+	return fmt.Sprintf("⚙️ Настройки вызовов в этой группе\n\n🎲 Раундов: %d\n%s\n👁 Зрители: %s",
+		settings.Rounds, b.rulesText(settings.Payoff, settings.TurnTimeout), spectators)
+}
+
+// isGroupAdmin reports whether a user administers a group chat.
+func (b *Bot) isGroupAdmin(chatID, userID int64) bool {
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		log.Printf("Failed to check admin rights of user %d in chat %d: %v", userID, chatID, err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
@@ -0,0 +1,139 @@
+package bot_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupChallenge(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	g := h.Group(-500, "Клуб")
+	bob.Send("/start")
+	if _, err := h.WaitText(bob, "Добро пожаловать"); err != nil {
+		t.Fatal(err)
+	}
+
+	card, inviteID, err := h.GroupChallenge(alice, g, "@bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "вызывает вас на игру"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(bob, inviteID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == card.ID && strings.Contains(m.Text, "Идет раунд 1 из")
+	}); err != nil {
+		t.Fatalf("card at game start: %v", err)
+	}
+
+	// Moves stay secret until the round is over, then the card reveals them.
+	if err := h.PlayRound(alice, bob, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == card.ID && strings.Contains(m.Text, "Раунд 1: alice ⚔️ (+5) — bob 🤝 (+0)") && strings.Contains(m.Text, "Счет: alice 5 — 0 bob")
+	}); err != nil {
+		t.Fatalf("card after round 1: %v", err)
+	}
+	if err := playOut(h, alice, bob, gameRounds-1, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == card.ID && strings.Contains(m.Text, "alice победил")
+	}); err != nil {
+		t.Fatalf("card after the game: %v", err)
+	}
+
+	bob.SendIn(g, "/leaderboard")
+	if _, err := h.WaitGroupText(g, "1. alice — побед: 1, ничьих: 0, поражений: 0"); err != nil {
+		t.Fatal(err)
+	}
+	// The bot stays quiet in the group except for its group commands.
+	bob.SendIn(g, "всем привет")
+	bob.SendIn(g, "/lobby")
+	if _, err := h.WaitGroupText(g, "только в личных сообщениях"); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.CountGroupText(g, "Неизвестная команда"); n != 0 {
+		t.Fatalf("bot answered group chatter %d times", n)
+	}
+}
+
+func TestGroupSettings(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+	g := h.Group(-500, "Клуб")
+	g.MakeAdmin(carol)
+
+	bob.SendIn(g, "/groupsettings")
+	if _, err := h.WaitGroupText(g, "только ее администраторы"); err != nil {
+		t.Fatal(err)
+	}
+	carol.SendIn(g, "/groupsettings")
+	form, err := h.WaitGroupText(g, "Настройки вызовов")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, option := range []string{"5 Раундов", "Жесткая"} {
+		if _, err := carol.PressIn(g, form, option); err != nil {
+			t.Fatal(err)
+		}
+		id, edits := form.ID, form.Edits
+		form, err = g.WaitFor(h.Wait, func(m Message) bool {
+			button := m.Keyboard.ButtonByText(option)
+			return m.ID == id && m.Edits > edits && button != nil && strings.HasPrefix(button.Text, "✅")
+		})
+		if err != nil {
+			t.Fatalf("option %q: %v", option, err)
+		}
+	}
+	// The buttons are carol's: anyone else is turned away and the form stays.
+	cbID, err := bob.PressIn(g, form, "Классика")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waitAnswered(h, cbID, "не для вас"); err != nil {
+		t.Fatal(err)
+	}
+
+	// New challenges use the group's settings.
+	card, _, err := h.GroupChallenge(alice, g, "@bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(card.Text, "на 5 раундов") || !strings.Contains(card.Text, "Жесткая") {
+		t.Fatalf("challenge ignores the group settings:\n%s", card.Text)
+	}
+
+	// Players the bot can't message are asked to start a private chat first.
+	bob.Block()
+	bob.SendIn(g, "/challenge @alice")
+	if _, err := h.WaitGroupText(g, "сначала напишите боту"); err != nil {
+		t.Fatal(err)
+	}
+	if invites := h.Manager.OpenInvites(bob.ID); len(invites) != 0 {
+		t.Fatalf("bob has %d open invites after an undeliverable challenge", len(invites))
+	}
+}
+
+// waitAnswered waits for the callback query to be answered with text containing substr.
+func waitAnswered(h *Harness, callbackID, substr string) error {
+	deadline := time.Now().Add(h.Wait)
+	for time.Now().Before(deadline) {
+		if text, ok := h.Server.Answered(callbackID); ok {
+			if !strings.Contains(text, substr) {
+				return fmt.Errorf("callback %s answered with %q, want %q", callbackID, text, substr)
+			}
+			return nil
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return fmt.Errorf("callback %s was never answered", callbackID)
+}
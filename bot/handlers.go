@@ -2,64 +2,175 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
 	"prisoners-dilemma-bot/game"
-	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/messaging"
 	"prisoners-dilemma-bot/utils"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Config holds bot-level settings that do not belong to the game rules.
+type Config struct {
+	Admins []int64
+	Banned []int64
+	// CallbackSecret signs inline button payloads. When empty a random secret is
+	// used and buttons sent before a restart stop working.
+	CallbackSecret string
+	// Workers caps how many updates are handled at once; DefaultWorkers when zero.
+	Workers int
+	// RateLimit is how many updates per second a user may send, with bursts of
+	// up to RateBurst. DefaultRateLimit and DefaultRateBurst apply when zero.
+	RateLimit float64
+	RateBurst int
+	// InviteSweepInterval is how often expired invites are closed;
+	// DefaultInviteSweepInterval when zero.
+	InviteSweepInterval time.Duration
+	// TournamentInterval is how often tournaments are checked for rounds to
+	// start; DefaultTournamentInterval when zero.
+	TournamentInterval time.Duration
+}
+
+// Default per-user rate limit.
+const (
+	DefaultRateLimit = 3
+	DefaultRateBurst = 10
+)
+
+// Bot is the Telegram frontend. It receives updates from api and sends
+// everything through msg, leaving the game flow itself to flow.Flow.
 type Bot struct {
 	api     *tgbotapi.BotAPI
+	msg     messaging.Messenger
+	flow    *flow.Flow
 	manager *game.Manager
+	admins  map[int64]bool
+	workers int
+	router  *Router
+	sweep   time.Duration
+	tick    time.Duration
+
+	bansMu sync.RWMutex
+	banned map[int64]bool
+
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
-func NewBot(api *tgbotapi.BotAPI, manager *game.Manager) *Bot {
-	return &Bot{api: api, manager: manager}
+func NewBot(api *tgbotapi.BotAPI, msg messaging.Messenger, manager *game.Manager, cfg Config) *Bot {
+	admins := make(map[int64]bool, len(cfg.Admins))
+	for _, id := range cfg.Admins {
+		admins[id] = true
+	}
+	banned := make(map[int64]bool, len(cfg.Banned))
+	for _, id := range cfg.Banned {
+		banned[id] = true
+	}
+	b := &Bot{
+		api:      api,
+		msg:      msg,
+		flow:     flow.New(msg, manager, callback.NewCodec([]byte(cfg.CallbackSecret))),
+		manager:  manager,
+		admins:   admins,
+		banned:   banned,
+		workers:  cfg.Workers,
+		sweep:    cfg.InviteSweepInterval,
+		tick:     cfg.TournamentInterval,
+		stopping: make(chan struct{}),
+	}
+	if b.sweep <= 0 {
+		b.sweep = DefaultInviteSweepInterval
+	}
+	if b.tick <= 0 {
+		b.tick = DefaultTournamentInterval
+	}
+	rate, burst := cfg.RateLimit, cfg.RateBurst
+	if rate <= 0 {
+		rate = DefaultRateLimit
+	}
+	if burst <= 0 {
+		burst = DefaultRateBurst
+	}
+	b.router = b.routes(rate, burst)
+
+	if reporter, ok := msg.(messaging.FailureReporter); ok {
+		reporter.OnFailure(b.flow.DeliveryFailed)
+	}
+	return b
 }
 
+// Start receives updates and handles them until Stop is called. Updates from
+// the same user are handled in order; different users are served in parallel.
+// Meanwhile expired invites are swept every InviteSweepInterval, while
+// tournaments and seasons are moved along every TournamentInterval.
+// Start returns once every update that was already being handled is done.
 func (b *Bot) Start() {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updates := b.api.GetUpdatesChan(u)
+	d := newDispatcher(b.workers, b.router.Handle)
+
+	var background sync.WaitGroup
+	for _, run := range []func(){
+		func() { b.sweepInvites(b.sweep) },
+		func() { b.runTournaments(b.tick) },
+		func() { b.runSeasons(b.tick) },
+	} {
+		background.Add(1)
+		go func(run func()) {
+			defer background.Done()
+			run()
+		}(run)
+	}
+	defer background.Wait()
 
-	for update := range updates {
-		if update.Message != nil {
-			b.handleMessage(update.Message)
-		} else if update.CallbackQuery != nil {
-			b.handleCallbackQuery(update.CallbackQuery)
-		}
+	if _, err := b.api.Request(tgbotapi.NewSetMyCommands(b.router.BotCommands()...)); err != nil {
+		log.Printf("Failed to set bot commands: %v", err)
 	}
-}
 
-// handleMessage routes incoming text messages to the correct handler.
-func (b *Bot) handleMessage(message *tgbotapi.Message) {
-	// Route non-command text from main menu keyboard
-	if !message.IsCommand() {
-		switch message.Text {
-		case "🚀 Создать новую игру":
-			b.handleNewGame(message)
-			return
-		case "❓ Помощь":
-			b.handleHelp(message.Chat.ID)
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				d.wait()
+				return
+			}
+			d.dispatch(updateKey(update), update)
+		case <-b.stopping:
+			// Anything fetched but not dispatched yet is redelivered after a restart,
+			// because its offset was never confirmed.
+			d.wait()
 			return
 		}
 	}
+}
 
-	switch message.Command() {
-	case "start":
-		b.handleStart(message)
-	case "help":
-		b.handleHelp(message.Chat.ID)
-	case "quit":
-		b.handleQuit(message)
-	default:
-		b.reply(message.Chat.ID, "🤔 Неизвестная команда. Используйте меню ниже или введите /help.", false, nil)
+// Stop stops receiving updates. Start returns once in-flight updates are handled.
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopping)
+		b.api.StopReceivingUpdates()
+	})
+}
+
+// updateKey picks the key updates are serialized on: the user, or the chat
+// for updates without a sender.
+func updateKey(update tgbotapi.Update) int64 {
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	if chat := fromChat(update); chat != nil {
+		return chat.ID
 	}
+	return 0
 }
 
 func (b *Bot) handleStart(message *tgbotapi.Message) {
@@ -69,12 +180,19 @@ func (b *Bot) handleStart(message *tgbotapi.Message) {
 		b.handleAccept(inviteID, message)
 		return
 	}
+	if strings.HasPrefix(payload, "watch_") {
+		b.handleWatch(strings.TrimPrefix(payload, "watch_"), message)
+		return
+	}
+	if strings.HasPrefix(payload, "tour_") {
+		b.handleTournamentJoin(strings.TrimPrefix(payload, "tour_"), message)
+		return
+	}
 
 	// Standard start
 	msgText := "Добро пожаловать в бот \"Дилемма Заключенного\"!" +
 		"Используйте меню ниже, чтобы начать игру или изучить правила."
-	keyboard := utils.MainMenuKeyboard()
-	b.reply(message.Chat.ID, msgText, false, &keyboard)
+	b.reply(message.Chat.ID, msgText, utils.MainMenuKeyboard())
 }
 
 func (b *Bot) handleHelp(chatID int64) {
@@ -82,293 +200,228 @@ func (b *Bot) handleHelp(chatID int64) {
 		"Это игра на стратегию и доверие для двух игроков.\n\n" +
 		"Геймплей:\n" +
 		"1. Один игрок создает игру и отправляет ссылку-приглашение.\n" +
-		"2. В каждом раунде вы тайно выбираете: Сотрудничать или Предать.\n\n" +
-		"Подсчет очков:\n" +
+		"2. В каждом раунде вы тайно выбираете: Сотрудничать или Предать.\n" +
+		"Можно также сыграть против бота через «🤖 Играть с ботом» или присоединиться к чужой игре в «🌐 Открытые игры».\n\n" +
+		"Подсчет очков (классическая таблица):\n" +
 		"• Если оба Сотрудничают: +3 очка каждому 🤝\n" +
 		"• Если вы Предаете, а соперник Сотрудничает: +5 очков вам, 0 сопернику 😈\n" +
 		"• Если оба Предают: +1 очко каждому ⚔️\n\n" +
-		"Цель - набрать максимальное количество очков после всех раундов. Будете ли вы сотрудничать для взаимной выгоды или предавать ради личного преимущества?"
-	b.reply(chatID, helpText, false, nil)
+		"При создании игры можно выбрать другую таблицу выигрышей и время на ход.\n\n" +
+		"Во время игры /status покажет счет, сделал ли ход соперник и сколько осталось времени, " +
+		"и заново пришлет кнопки хода, а /history — все сыгранные раунды. " +
+		"После игры ее запись можно скачать в JSON, CSV или текстом — кнопками под итоговым счетом или командой /export.\n\n" +
+		"Цель - набрать максимальное количество очков после всех раундов. Будете ли вы сотрудничать для взаимной выгоды или предавать ради личного преимущества?\n\n" +
+		"Чтобы сыграть с конкретным человеком, вызовите его командой /challenge @username — " +
+		"принять такое приглашение сможет только этот игрок.\n\n" +
+		"Добавьте бота в группу, чтобы бросать вызовы прямо там: ход игры будет виден всей группе, " +
+		"ходы делаются в личных сообщениях, а /leaderboard покажет таблицу лидеров группы. " +
+		"Администраторы группы выбирают правила вызовов командой /groupsettings.\n\n" +
+		fmt.Sprintf("Пригласить соперника можно из любого чата: наберите @%s 15, чтобы отправить туда приглашение на 15 раундов.\n\n", b.api.Self.UserName) +
+		"Командой /tournament можно устроить турнир по швейцарской или круговой системе: " +
+		"бот сам составит пары каждого тура, а /standings покажет турнирную таблицу.\n\n" +
+		"Рейтинг разыгрывается по сезонам: /season покажет таблицу текущего сезона, а /season <номер> — итоги прошлых. " +
+		"Лучшие трое по итогам сезона получают титулы.\n\n" +
+		"Команда /profile покажет вашу статистику за все игры, а /profile @username — профиль другого игрока. " +
+		"Команда /style покажет, на какую классическую стратегию похож ваш стиль игры, " +
+		"а /analyze оценит вашу стратегию memory-one."
+	b.reply(chatID, helpText, nil)
 }
 
 func (b *Bot) handleNewGame(message *tgbotapi.Message) {
-	if _, inGame := b.manager.FindSessionByPlayerID(message.From.ID); inGame {
-		b.reply(message.Chat.ID, "Вы уже в игре! Введите /quit, чтобы покинуть текущую игру.", false, nil)
+	if b.manager.Busy(message.From.ID) {
+		b.reply(message.Chat.ID, "Вы уже в игре! Введите /quit, чтобы покинуть текущую игру.", nil)
 		return
 	}
 
-	msgText := "Сколько раундов вы хотите играть?"
-	keyboard := utils.RoundsKeyboard()
-	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
-	msg.ReplyMarkup = keyboard
-	b.api.Send(msg)
+	form := utils.NewInviteForm("")
+	b.reply(message.Chat.ID, b.newGameText(form), utils.RoundsKeyboard(b.flow.Codec(), message.From.ID, form))
 }
 
-func (b *Bot) handleQuit(message *tgbotapi.Message) {
-	_, winner, err := b.manager.ForfeitGame(message.From.ID)
+// newGameText describes the settings picked so far in the new game form.
+func (b *Bot) newGameText(form utils.InviteForm) string {
+	var sb strings.Builder
+	if form.Target != "" {
+		target, _ := parseTarget(form.Target)
+		fmt.Fprintf(&sb, "⚔️ Вызов для %s.\n\n", target)
+	}
+	sb.WriteString("Сколько раундов вы хотите играть?\n\n")
+	settings := form.Settings(0)
+	sb.WriteString(b.rulesText(settings.Payoff, settings.TurnTimeout))
+	if form.Spectators {
+		sb.WriteString("\n👁 Зрители: разрешены")
+	} else {
+		sb.WriteString("\n👁 Зрители: нет")
+	}
+	switch {
+	case form.Target != "":
+	case form.Public:
+		sb.WriteString("\n🌐 Доступ: открытая игра в лобби")
+	default:
+		sb.WriteString("\n🔒 Доступ: только по ссылке")
+	}
+	return sb.String()
+}
+
+// handleFormChange redraws the new game form after a setting was changed.
+func (b *Bot) handleFormChange(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	form, err := utils.ParseInviteForm(data.Arg)
 	if err != nil {
-		b.reply(message.From.ID, err.Error(), false, nil)
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
 		return
 	}
+	b.edit(callbackRef(cb), b.newGameText(form), utils.RoundsKeyboard(b.flow.Codec(), cb.From.ID, form))
+}
 
-	quitter := message.From
-
-	b.reply(quitter.ID, "Вы покинули игру.", false, nil)
-	b.reply(winner.ID, fmt.Sprintf("😢 %s покинул игру. Вы побеждаете по умолчанию!", quitter.UserName), false, nil)
+func (b *Bot) handleQuit(message *tgbotapi.Message) {
+	b.flow.Quit(message.From.ID, message.From.UserName)
 }
 
 func (b *Bot) handleAccept(inviteID string, message *tgbotapi.Message) {
-	accepterID := message.From.ID
-	accepterUsername := message.From.UserName
+	b.acceptInvite(inviteID, message.From, message.Chat.ID)
+}
 
-	if _, inGame := b.manager.FindSessionByPlayerID(accepterID); inGame {
-		b.reply(message.Chat.ID, "Вы уже в игре! Вы не можете принять другое приглашение.", false, nil)
-		return
+// acceptInvite starts the game of an invite accepted by user, reporting
+// failures to chatID. It reports whether the game started.
+func (b *Bot) acceptInvite(inviteID string, user *tgbotapi.User, chatID int64) bool {
+	if err := b.startInvitedGame(inviteID, user); err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return false
 	}
+	return true
+}
 
-	session, err := b.manager.AcceptInvite(inviteID, accepterID, accepterUsername)
+// startInvitedGame starts the game of an invite accepted by user. The error
+// says why the game couldn't start, in words fit for the user.
+func (b *Bot) startInvitedGame(inviteID string, user *tgbotapi.User) error {
+	session, invite, err := b.manager.AcceptInvite(inviteID, user.ID, user.UserName)
 	if err != nil {
-		b.reply(message.Chat.ID, err.Error(), false, nil)
-		return
+		return err
 	}
+	b.closeWaitingRoom(*invite, fmt.Sprintf("✅ Приглашение на %s принято. Игра началась!", roundsText(invite.Rounds)))
 
 	// Notify both players and start the game - using simple text without usernames first
-	msgToInviter := fmt.Sprintf("🎉 Ваше приглашение принято! Игра начинается сейчас.")
-	b.reply(session.PlayerA.ID, msgToInviter, false, nil)
+	rules := b.rulesText(session.Payoff, session.TurnTimeout)
+	if session.SpectateID != "" {
+		rules += "\n\n👁 Ссылка для зрителей: " + b.spectateURL(session.SpectateID)
+	}
+	msgToInviter := fmt.Sprintf("🎉 Ваше приглашение принято! Игра начинается сейчас.\n\n%s", rules)
+	b.reply(session.PlayerA.ID, msgToInviter, nil)
 
-	msgToAccepter := fmt.Sprintf("✅ Вы присоединились к игре! Игра начинается сейчас.")
-	b.reply(session.PlayerB.ID, msgToAccepter, false, nil)
+	msgToAccepter := fmt.Sprintf("✅ Вы присоединились к игре! Игра начинается сейчас.\n\n%s", rules)
+	b.reply(session.PlayerB.ID, msgToAccepter, nil)
 
-	b.promptNextRound(session)
+	b.flow.UpdateCard(session, "")
+	b.flow.PromptNextRound(session)
+	b.flow.SetupTurnTimer(session)
+	return nil
 }
 
-func (b *Bot) handleCallbackQuery(cb *tgbotapi.CallbackQuery) {
-	b.api.Send(tgbotapi.NewCallback(cb.ID, ""))
-
-	data := cb.Data
-
-	if strings.HasPrefix(data, "rounds_") {
-		b.handleRoundSelection(cb)
-	} else if data == string(models.ChoiceNegotiate) || data == string(models.ChoiceDefect) {
-		b.handleGameChoice(cb)
-	} else if strings.HasPrefix(data, "rematch_") {
-		b.handleRematchChoice(cb)
+func (b *Bot) handleGameChoice(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	choice, ok := utils.ChoiceFromArg(data.Arg)
+	if !ok {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
 	}
+	b.flow.HandleChoice(cb.From.ID, data.GameID, data.Round, choice, callbackRef(cb))
 }
 
-func (b *Bot) handleGameChoice(cb *tgbotapi.CallbackQuery) {
-	playerID := cb.From.ID
-	choice := models.PlayerChoice(cb.Data)
-
-	session, bothChose, err := b.manager.RecordChoice(playerID, choice)
+func (b *Bot) handleRoundSelection(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	roundsArg, formArg, _ := strings.Cut(data.Arg, "/")
+	rounds, err := strconv.Atoi(roundsArg)
 	if err != nil {
-		// This can happen if a player clicks an old button after a game ends
-		log.Printf("Error recording choice for player %d: %v", playerID, err)
-		editMsg := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Эта игра больше не активна.")
-		b.api.Send(editMsg)
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
 		return
 	}
-
-	var choiceText string
-	if choice == models.ChoiceNegotiate {
-		choiceText = "Сотрудничать"
-	} else {
-		choiceText = "Предать"
+	form, err := utils.ParseInviteForm(formArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
 	}
-	chosenText := fmt.Sprintf("Вы выбрали: %s. Ожидаем другого игрока...", choiceText)
-	editMsg := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, chosenText)
-	b.api.Send(editMsg)
-
-	if bothChose {
-		resultA, resultB := b.manager.ProcessRound(session)
-
-		scoreUpdateA := fmt.Sprintf("\n\nСчет:\n- Вы: %d\n- %s: %d", session.PlayerA.Score, session.PlayerB.Username, session.PlayerB.Score)
-		b.reply(session.PlayerA.ID, resultA+scoreUpdateA, false, nil)
-
-		scoreUpdateB := fmt.Sprintf("\n\nСчет:\n- Вы: %d\n- %s: %d", session.PlayerB.Score, session.PlayerA.Username, session.PlayerA.Score)
-		b.reply(session.PlayerB.ID, resultB+scoreUpdateB, false, nil)
-
-		if session.State == models.StateFinished {
-			b.announceWinner(session)
-		} else {
-			b.promptNextRound(session)
-			// NEW: Set up turn timer
-			b.setupTurnTimer(session)
+	settings := form.Settings(rounds)
+	challenge := form.Target != ""
+	if challenge {
+		if settings.Target, err = parseTarget(form.Target); err != nil {
+			b.edit(callbackRef(cb), flow.ExpiredText, nil)
+			return
 		}
 	}
-}
-
-func (b *Bot) handleRoundSelection(cb *tgbotapi.CallbackQuery) {
-	roundStr := strings.TrimPrefix(cb.Data, "rounds_")
-	rounds, _ := strconv.Atoi(roundStr)
 
 	inviterID := cb.From.ID
 	inviterUsername := cb.From.UserName
 
-	inviteID, err := b.manager.CreateInvite(inviterID, inviterUsername, rounds)
+	invite, err := b.manager.CreateGameInvite(inviterID, inviterUsername, settings)
+	if errors.Is(err, game.ErrTooManyInvites) {
+		b.edit(callbackRef(cb), tooManyInvitesText, nil)
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating invite: %v", err)
-		b.reply(inviterID, "Извините, произошла ошибка при создании игры. Попробуйте еще раз.", false, nil)
+		b.reply(inviterID, "Извините, произошла ошибка при создании игры. Попробуйте еще раз.", nil)
 		return
 	}
+	inviteID := invite.InviteID
 
-	botUsername := b.api.Self.UserName
-	inviteURL := fmt.Sprintf("https://t.me/%s?start=invite_%s", botUsername, inviteID)
-
-	var roundsText string
-	switch rounds {
-	case 1:
-		roundsText = "1 раунд"
-	case 2, 3, 4:
-		roundsText = fmt.Sprintf("%d раунда", rounds)
+	var msgText string
+	switch {
+	case invite.Public:
+		msgText = fmt.Sprintf(
+			"✅ Ваша игра на %s опубликована в лобби!\n\n"+
+				"Ее может принять любой игрок из «🌐 Открытые игры».\n"+
+				"Вы также можете переслать это сообщение или скопировать ссылку.", roundsText(rounds))
+	case !challenge:
+		msgText = fmt.Sprintf(
+			"✅ Ваша игра на %s готова!\n\n"+
+				"Поделитесь этим приглашением с другим игроком.\n"+
+				"Вы можете переслать это сообщение или скопировать ссылку.", roundsText(rounds))
+	case invite.Target.ID != 0:
+		b.sendChallenge(invite, cb.From)
+		msgText = fmt.Sprintf(
+			"✅ Вызов на игру на %s отправлен %s!\n\n"+
+				"Принять его может только %s.", roundsText(rounds), invite.Target, invite.Target)
 	default:
-		roundsText = fmt.Sprintf("%d раундов", rounds)
+		msgText = fmt.Sprintf(
+			"✅ Ваша игра на %s готова!\n\n"+
+				"%s еще не пользуется ботом, поэтому перешлите это приглашение сами.\n"+
+				"Принять его может только %s.", roundsText(rounds), invite.Target, invite.Target)
 	}
+	msgText += "\n\n" + b.rulesText(invite.Payoff, invite.TurnTimeout)
+	msgText += fmt.Sprintf("\n\n⏳ Ожидаем соперника. Приглашение действует %s.", formatWait(b.manager.InviteTTL()))
 
-	msgText := fmt.Sprintf(
-		"✅ Ваша игра на %s готова!\n\n"+
-			"Поделитесь этим приглашением с другим игроком.\n"+
-			"Вы можете переслать это сообщение или скопировать ссылку.", roundsText)
-
-	// Create a button with the invite link
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL("➡️ Принять приглашение", inviteURL),
-		),
-	)
-
-	editMsg := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, msgText)
-	editMsg.ReplyMarkup = &keyboard
-	b.api.Send(editMsg)
-}
-
-func (b *Bot) promptNextRound(session *models.Session) {
-	promptText := fmt.Sprintf("Раунд %d из %d\nВаш ход?", session.CurrentRound, session.TotalRounds)
-	keyboard := utils.ChoiceKeyboard()
-
-	msgA := tgbotapi.NewMessage(session.PlayerA.ID, promptText)
-	msgA.ReplyMarkup = keyboard
-	b.api.Send(msgA)
-
-	msgB := tgbotapi.NewMessage(session.PlayerB.ID, promptText)
-	msgB.ReplyMarkup = keyboard
-	b.api.Send(msgB)
-}
-
-func (b *Bot) announceWinner(session *models.Session) {
-	var winnerText string
-	pA := session.PlayerA
-	pB := session.PlayerB
-
-	switch {
-	case pA.Score > pB.Score:
-		winnerText = fmt.Sprintf("🏆 %s победил! 🏆", pA.Username)
-	case pB.Score > pA.Score:
-		winnerText = fmt.Sprintf("🏆 %s победил! 🏆", pB.Username)
-	default:
-		winnerText = "🤝 Ничья! 🤝"
-	}
-
-	finalMsg := fmt.Sprintf(
-		"🏁 Игра окончена! 🏁\n\n"+
-			"Итоговый счет:\n"+
-			"---------------------\n"+
-			"Игрок: %s\nОчки: %d\n\n"+
-			"Игрок: %s\nОчки: %d\n"+
-			"---------------------\n\n"+
-			"%s",
-		pA.Username, pA.Score, pB.Username, pB.Score, winnerText)
-	b.reply(pA.ID, finalMsg, false, nil)
-	b.reply(pB.ID, finalMsg, false, nil)
-
-	// Ask players if they want a rematch
-	rematchKeyboard := utils.RematchKeyboard()
-	b.reply(pA.ID, "Хотите реванш?", false, rematchKeyboard)
-	b.reply(pB.ID, "Хотите реванш?", false, rematchKeyboard)
+	// The invite message doubles as the inviter's waiting room.
+	b.manager.SetInviteMessage(inviteID, cb.Message.MessageID)
+	b.edit(callbackRef(cb), msgText, utils.InviteKeyboard(b.flow.Codec(), inviterID, inviteID, b.inviteURL(inviteID)))
 }
 
 // handleRematchChoice processes a player's rematch choice
-func (b *Bot) handleRematchChoice(cb *tgbotapi.CallbackQuery) {
-	wantsRematch := strings.TrimPrefix(cb.Data, "rematch_") == "yes"
-	playerID := cb.From.ID
-
-	session, bothWantRematch, err := b.manager.SetRematchPreference(playerID, wantsRematch)
-	if err != nil {
-		b.reply(playerID, err.Error(), false, nil)
-		return
-	}
-
-	var otherPlayer *models.Player
-	if playerID == session.PlayerA.ID {
-		otherPlayer = session.PlayerB
-	} else {
-		otherPlayer = session.PlayerA
-	}
-
-	keyboard := utils.MainMenuKeyboard()
-	welcomeText := "Добро пожаловать в бот \"Дилемма Заключенного\"!\n\nИспользуйте меню ниже, чтобы начать новую игру или изучить правила."
-
-	if !wantsRematch {
-		// This player chose "Main Menu"
-		editMsg := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Возвращаемся в главное меню...")
-		b.api.Send(editMsg)
+func (b *Bot) handleRematchChoice(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	b.flow.HandleRematch(cb.From.ID, data.GameID, data.Arg == callback.ArgYes, callbackRef(cb))
+}
 
-		b.reply(playerID, welcomeText, false, &keyboard)
-		b.reply(otherPlayer.ID, "Другой игрок не захотел играть реванш. Возвращаемся в главное меню...", false, nil)
-		b.reply(otherPlayer.ID, welcomeText, false, &keyboard)
-		return
+func (b *Bot) reply(chatID int64, text string, keyboard *messaging.Keyboard) {
+	if _, err := b.msg.SendText(chatID, text, keyboard); err != nil {
+		log.Printf("Failed to send message to %d: %v", chatID, err)
 	}
+}
 
-	// This player wants a rematch
-	editMsg := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Вы хотите реванш! Ждем другого игрока...")
-	b.api.Send(editMsg)
-
-	if bothWantRematch {
-		// Start the rematch
-		newSession, err := b.manager.StartRematch(session.ID)
-		if err != nil {
-			b.reply(session.PlayerA.ID, "Не удалось начать реванш: "+err.Error(), false, nil)
-			b.reply(session.PlayerB.ID, "Не удалось начать реванш: "+err.Error(), false, nil)
-			return
-		}
-
-		// Notify both players
-		b.reply(newSession.PlayerA.ID, "🎮 Реванш начинается!", false, nil)
-		b.reply(newSession.PlayerB.ID, "🎮 Реванш начинается!", false, nil)
-
-		b.promptNextRound(newSession)
-		b.setupTurnTimer(newSession)
+// post sends a message whose ID is needed later and reports whether it was
+// delivered. Messengers that queue their messages are waited on.
+func (b *Bot) post(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	if waiter, ok := b.msg.(messaging.Waiter); ok {
+		return waiter.SendAndWait(chatID, text, keyboard)
 	}
+	return b.msg.SendText(chatID, text, keyboard)
 }
 
-func (b *Bot) setupTurnTimer(session *models.Session) {
-	b.manager.SetTurnTimer(session.ID, func() {
-		session, winner, err := b.manager.HandleTimeout(session.ID)
-		if err != nil {
-			return // Session already ended or other error
-		}
-
-		// Notify players of timeout
-		timeoutMsg := fmt.Sprintf("⏰ Время вышло! %s слишком долго не делал ход.", winner.Username)
-		b.reply(session.PlayerA.ID, timeoutMsg, false, nil)
-		b.reply(session.PlayerB.ID, timeoutMsg, false, nil)
-
-		// If the game ended due to timeout, announce the winner
-		if session.State == models.StateFinished {
-			b.announceWinner(session)
-		}
-	})
+func (b *Bot) edit(ref messaging.MessageRef, text string, keyboard *messaging.Keyboard) {
+	if err := b.msg.EditMessage(ref, text, keyboard); err != nil {
+		log.Printf("Failed to edit message %d in chat %d: %v", ref.MessageID, ref.ChatID, err)
+	}
 }
 
-func (b *Bot) reply(chatID int64, text string, markdown bool, keyboard interface{}) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	if markdown {
-		msg.ParseMode = "Markdown"
-	}
-	if keyboard != nil {
-		msg.ReplyMarkup = keyboard
-	}
-	if _, err := b.api.Send(msg); err != nil {
-		log.Printf("Failed to send message to %d: %v", chatID, err)
+// callbackRef points at the message whose inline button was pressed.
+func callbackRef(cb *tgbotapi.CallbackQuery) messaging.MessageRef {
+	if cb.Message == nil {
+		return messaging.MessageRef{InlineID: cb.InlineMessageID}
 	}
+	return messaging.MessageRef{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.MessageID}
 }
@@ -0,0 +1,357 @@
+package bot_test
+
+// The harness runs the real Telegram handlers against the fake Bot API server
+// and drives complete games through simulated users.
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/bot"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging/telegram"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultWait bounds how long the harness waits for the bot to react.
+const DefaultWait = 5 * time.Second
+
+// Options configures the bot under test.
+type Options struct {
+	TurnTimeout time.Duration
+	Admins      []int64
+	// RateLimit and RateBurst override the per-user limit, which is lifted by default.
+	RateLimit float64
+	RateBurst int
+	// Queue overrides FastQueue for the bot's send queue.
+	Queue *telegram.QueueConfig
+	// InviteTTL and InviteSweep override the invite lifetime and how often expired invites are swept.
+	InviteTTL   time.Duration
+	InviteSweep time.Duration
+	// TournamentTick overrides how often tournaments are moved along.
+	TournamentTick time.Duration
+	// MaxSpectators overrides how many people may watch one game.
+	MaxSpectators int
+}
+
+// FastQueue keeps the send queue's ordering and retry logic but lifts the rate
+// limits, so scenarios don't have to wait out Telegram's pacing.
+func FastQueue() telegram.QueueConfig {
+	return telegram.QueueConfig{
+		GlobalRate: 1000,
+		ChatRate:   1000,
+		ChatBurst:  100,
+		MaxRetries: 2,
+		RetryDelay: 10 * time.Millisecond,
+	}
+}
+
+// Harness is a running bot wired to a fake Bot API server.
+type Harness struct {
+	Server    *Server
+	Bot       *bot.Bot
+	Manager   *game.Manager
+	Messenger *telegram.Messenger
+	Wait      time.Duration
+
+	done chan struct{}
+}
+
+// newHarness starts the bot against a fresh fake server and stops it when the
+// test is over.
+func newHarness(t *testing.T, opts Options) *Harness {
+	t.Helper()
+	server := NewServer()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, server.Endpoint())
+	if err != nil {
+		server.Close()
+		t.Fatalf("connect to fake server: %v", err)
+	}
+
+	manager := game.NewManager(game.Config{
+		Store:         storage.NewMemoryStore(),
+		Learner:       strategy.DefaultLearnerConfig(),
+		TurnTimeout:   opts.TurnTimeout,
+		InviteTTL:     opts.InviteTTL,
+		MaxSpectators: opts.MaxSpectators,
+	})
+	queue := FastQueue()
+	if opts.Queue != nil {
+		queue = *opts.Queue
+	}
+	msg := telegram.NewQueued(api, queue)
+	cfg := bot.Config{Admins: opts.Admins, RateLimit: 1000, RateBurst: 1000, InviteSweepInterval: opts.InviteSweep, TournamentInterval: opts.TournamentTick}
+	if opts.RateLimit > 0 {
+		cfg.RateLimit, cfg.RateBurst = opts.RateLimit, opts.RateBurst
+	}
+	b := bot.NewBot(api, msg, manager, cfg)
+
+	h := &Harness{
+		Server:    server,
+		Bot:       b,
+		Manager:   manager,
+		Messenger: msg,
+		Wait:      DefaultWait,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		b.Start()
+		close(h.done)
+	}()
+	t.Cleanup(h.Close)
+	return h
+}
+
+// Close stops the bot, lets queued messages go out and shuts the fake server down.
+func (h *Harness) Close() {
+	h.Bot.Stop()
+	h.Messenger.Drain(h.Wait)
+	h.Server.Close()
+	select {
+	case <-h.done:
+	case <-time.After(h.Wait):
+	}
+}
+
+// User adds a simulated user.
+func (h *Harness) User(id int64, username string) *User {
+	return h.Server.AddUser(id, username)
+}
+
+// Group adds a simulated group chat.
+func (h *Harness) Group(id int64, title string) *Group {
+	return h.Server.AddGroup(id, title)
+}
+
+// WaitGroupText waits for a message to g containing substr.
+func (h *Harness) WaitGroupText(g *Group, substr string) (Message, error) {
+	m, err := g.WaitFor(h.Wait, func(m Message) bool {
+		return strings.Contains(m.Text, substr)
+	})
+	if err != nil {
+		return m, fmt.Errorf("group %q never received %q: %v", g.Title, substr, err)
+	}
+	return m, nil
+}
+
+// GroupChallenge challenges target in group g as u and returns the match card
+// and the invite ID.
+func (h *Harness) GroupChallenge(u *User, g *Group, target string) (Message, string, error) {
+	u.SendIn(g, "/challenge "+target)
+	card, err := g.WaitFor(h.Wait, func(m Message) bool {
+		return strings.Contains(m.Text, "вызывает "+target) && len(m.Keyboard.URLs()) > 0
+	})
+	if err != nil {
+		return card, "", fmt.Errorf("match card: %v", err)
+	}
+	url := card.Keyboard.URLs()[0]
+	i := strings.Index(url, "start=invite_")
+	if i < 0 {
+		return card, "", fmt.Errorf("unexpected invite URL %q", url)
+	}
+	return card, url[i+len("start=invite_"):], nil
+}
+
+// WaitText waits for a message to u containing substr.
+func (h *Harness) WaitText(u *User, substr string) (Message, error) {
+	m, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return strings.Contains(m.Text, substr)
+	})
+	if err != nil {
+		return m, fmt.Errorf("%s never received %q: %v", u.Username, substr, err)
+	}
+	return m, nil
+}
+
+// WaitDocument waits for a file to u whose name ends with suffix.
+func (h *Harness) WaitDocument(u *User, suffix string) (Message, error) {
+	m, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.Document != "" && strings.HasSuffix(m.Document, suffix)
+	})
+	if err != nil {
+		return m, fmt.Errorf("%s never received a %q file: %v", u.Username, suffix, err)
+	}
+	return m, nil
+}
+
+// CountText returns how many messages to u contain substr.
+func (h *Harness) CountText(u *User, substr string) int {
+	n := 0
+	for _, m := range u.Messages() {
+		if strings.Contains(m.Text, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// CountGroupText returns how many messages to g contain substr.
+func (h *Harness) CountGroupText(g *Group, substr string) int {
+	n := 0
+	for _, m := range g.Messages() {
+		if strings.Contains(m.Text, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// CreateInvite walks u through the "new game" menu and returns the invite ID.
+// Each option, such as "В лобби" or "Жесткая", is picked in the form first.
+func (h *Harness) CreateInvite(u *User, rounds int, options ...string) (string, error) {
+	return h.invite(u, "🚀 Создать новую игру", rounds, options)
+}
+
+// Challenge challenges target, an @username or a user ID, as u and returns the invite ID.
+func (h *Harness) Challenge(u *User, target string, rounds int) (string, error) {
+	return h.invite(u, "/challenge "+target, rounds, nil)
+}
+
+// invite sends text to bring up the new game form, picks the options and the
+// number of rounds and returns the invite ID.
+func (h *Harness) invite(u *User, text string, rounds int, options []string) (string, error) {
+	form, err := h.fillForm(u, text, fmt.Sprintf("%d Раундов", rounds), options)
+	if err != nil {
+		return "", err
+	}
+	return linkID(form, "start=invite_")
+}
+
+// CreateTournament walks u through the /tournament form, with matches of the
+// given number of rounds, and returns the tournament ID. Each option, such as
+// "Круговая" or "По победам", is picked in the form first.
+func (h *Harness) CreateTournament(u *User, rounds int, options ...string) (string, error) {
+	form, err := h.fillForm(u, "/tournament", fmt.Sprintf("%d Раундов", rounds), options)
+	if err != nil {
+		return "", err
+	}
+	return linkID(form, "start=tour_")
+}
+
+// fillForm sends text to bring up a settings form, picks the options, presses
+// submit and returns the form once it was replaced with a link.
+func (h *Harness) fillForm(u *User, text, submit string, options []string) (Message, error) {
+	u.Send(text)
+
+	prompt, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.Edits == 0 && m.Keyboard.ButtonByText(submit) != nil
+	})
+	if err != nil {
+		return prompt, fmt.Errorf("form keyboard: %v", err)
+	}
+	for _, option := range options {
+		if _, err := u.PressText(prompt, option); err != nil {
+			return prompt, err
+		}
+		id, edits := prompt.ID, prompt.Edits
+		prompt, err = u.WaitFor(h.Wait, func(m Message) bool {
+			button := m.Keyboard.ButtonByText(option)
+			return m.ID == id && m.Edits > edits && button != nil && strings.HasPrefix(button.Text, "✅")
+		})
+		if err != nil {
+			return prompt, fmt.Errorf("option %q: %v", option, err)
+		}
+	}
+	if _, err := u.PressText(prompt, submit); err != nil {
+		return prompt, err
+	}
+
+	form, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == prompt.ID && len(m.Keyboard.URLs()) > 0
+	})
+	if err != nil {
+		return form, fmt.Errorf("link: %v", err)
+	}
+	return form, nil
+}
+
+// linkID is what follows prefix in the first link button of m.
+func linkID(m Message, prefix string) (string, error) {
+	url := m.Keyboard.URLs()[0]
+	i := strings.Index(url, prefix)
+	if i < 0 {
+		return "", fmt.Errorf("unexpected link %q", url)
+	}
+	return url[i+len(prefix):], nil
+}
+
+// Accept opens the invite link as u.
+func (h *Harness) Accept(u *User, inviteID string) error {
+	u.Send("/start invite_" + inviteID)
+	_, err := h.WaitText(u, "Вы присоединились к игре")
+	return err
+}
+
+// StartGame creates an invite as a and accepts it as b.
+func (h *Harness) StartGame(a, b *User, rounds int) error {
+	inviteID, err := h.CreateInvite(a, rounds)
+	if err != nil {
+		return err
+	}
+	return h.Accept(b, inviteID)
+}
+
+// Prompt waits for the open round prompt sent to u.
+func (h *Harness) Prompt(u *User) (Message, error) {
+	m, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.Edits == 0 && strings.HasPrefix(m.Text, "Раунд ") && m.Keyboard.ButtonByText("🤝") != nil
+	})
+	if err != nil {
+		return m, fmt.Errorf("%s has no open round prompt: %v", u.Username, err)
+	}
+	return m, nil
+}
+
+// Move answers u's open round prompt: cooperate when true, defect otherwise.
+func (h *Harness) Move(u *User, cooperate bool) error {
+	prompt, err := h.Prompt(u)
+	if err != nil {
+		return err
+	}
+	label := "⚔️"
+	if cooperate {
+		label = "🤝"
+	}
+	if _, err := u.PressText(prompt, label); err != nil {
+		return err
+	}
+	_, err = u.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == prompt.ID && m.Edits > 0
+	})
+	return err
+}
+
+// PlayRound makes both players move and waits for the round report.
+func (h *Harness) PlayRound(a, b *User, aCooperates, bCooperates bool) error {
+	reports := h.CountText(a, "Счет:")
+	if err := h.Move(a, aCooperates); err != nil {
+		return err
+	}
+	if err := h.Move(b, bCooperates); err != nil {
+		return err
+	}
+	_, err := a.WaitFor(h.Wait, func(Message) bool {
+		return h.CountText(a, "Счет:") > reports
+	})
+	return err
+}
+
+// Rematch answers u's open rematch prompt.
+func (h *Harness) Rematch(u *User, yes bool) error {
+	prompt, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.Edits == 0 && m.Text == "Хотите реванш?"
+	})
+	if err != nil {
+		return fmt.Errorf("%s has no open rematch prompt: %v", u.Username, err)
+	}
+	label := "Главное меню"
+	if yes {
+		label = "Играть снова"
+	}
+	_, err = u.PressText(prompt, label)
+	return err
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inlineRounds are the game lengths offered for an empty inline query.
+var inlineRounds = []int{10, 15, 20}
+
+// maxInlineRounds is the longest game that can be asked for in an inline query.
+const maxInlineRounds = 100
+
+// handleInlineQuery offers invites to share into any chat. "@botname 15" offers
+// a game of 15 rounds, "@botname 15 жесткая" one with the harsh payoff table,
+// and an empty query the usual lengths. Nothing is created until a result is
+// picked; see handleChosenInvite.
+func (b *Bot) handleInlineQuery(c *Context) {
+	query := c.InlineQuery
+	var results []interface{}
+	for _, settings := range inlineOffers(query.Query) {
+		preset := inlinePreset(settings.Payoff)
+		title := fmt.Sprintf("🎲 Игра на %s", roundsText(settings.Rounds))
+		article := tgbotapi.NewInlineQueryResultArticle(inlineResultID(settings.Rounds, preset), title,
+			inviteCardText(displayName(query.From), settings)+"\n\n⏳ Создаем приглашение...")
+		article.Description = b.rulesText(settings.Payoff, 0)
+		// Telegram only reports where the result was posted when it has a keyboard.
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("🎲 Открыть бота", fmt.Sprintf("https://t.me/%s", b.api.Self.UserName)),
+		))
+		article.ReplyMarkup = &markup
+		results = append(results, article)
+	}
+	if results == nil {
+		results = []interface{}{}
+	}
+
+	answer := tgbotapi.InlineConfig{InlineQueryID: query.ID, Results: results, IsPersonal: true}
+	if _, err := b.api.Request(answer); err != nil {
+		log.Printf("Failed to answer inline query from user %d: %v", query.From.ID, err)
+	}
+}
+
+// inlineOffers reads an inline query: an optional number of rounds followed by
+// an optional payoff table name. It returns nothing for queries it doesn't understand.
+func inlineOffers(query string) []models.GameSettings {
+	fields := strings.Fields(query)
+	rounds := inlineRounds
+	if len(fields) > 0 {
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			if n < 1 || n > maxInlineRounds {
+				return nil
+			}
+			rounds = []int{n}
+			fields = fields[1:]
+		}
+	}
+	payoff := models.ClassicPayoff
+	if len(fields) > 0 {
+		found := false
+		for _, preset := range models.PayoffPresets {
+			if strings.HasPrefix(strings.ToLower(preset.Name), strings.ToLower(fields[0])) {
+				payoff, found = preset.Payoff, true
+				break
+			}
+		}
+		if !found || len(fields) > 1 {
+			return nil
+		}
+	}
+
+	offers := make([]models.GameSettings, 0, len(rounds))
+	for _, n := range rounds {
+		offers = append(offers, models.GameSettings{Rounds: n, Payoff: payoff})
+	}
+	return offers
+}
+
+// inlinePreset is the key of the preset with the given payoff table.
+func inlinePreset(payoff models.Payoff) string {
+	for _, preset := range models.PayoffPresets {
+		if preset.Payoff == payoff {
+			return preset.Key
+		}
+	}
+	return models.PayoffPresets[0].Key
+}
+
+// inlineResultID names an offered invite as "<rounds>/<preset>".
+func inlineResultID(rounds int, preset string) string {
+	return strconv.Itoa(rounds) + "/" + preset
+}
+
+// parseInlineResult reads the settings of an offer back from its result ID.
+func parseInlineResult(id string) (models.GameSettings, bool) {
+	roundsArg, key, _ := strings.Cut(id, "/")
+	rounds, err := strconv.Atoi(roundsArg)
+	if err != nil || rounds < 1 || rounds > maxInlineRounds {
+		return models.GameSettings{}, false
+	}
+	preset, ok := models.PresetByKey(key)
+	if !ok {
+		return models.GameSettings{}, false
+	}
+	return models.GameSettings{Rounds: rounds, Payoff: preset.Payoff}, true
+}
+
+// inviteCardText is the invite card posted through inline mode.
+func inviteCardText(inviter string, settings models.GameSettings) string {
+	return fmt.Sprintf("⚔️ %s приглашает сыграть в «Дилемму заключенного» на %s!\n💰 Выигрыши: %s (%s)",
+		inviter, roundsText(settings.Rounds), models.PayoffName(settings.Payoff), settings.Payoff)
+}
+
+// handleChosenInvite creates the invite of an offer a user posted through
+// inline mode and turns the posted card into a live invite anyone in the chat
+// can accept.
+func (b *Bot) handleChosenInvite(c *Context) {
+	chosen := c.ChosenInline
+	if chosen.InlineMessageID == "" {
+		log.Printf("Inline result %q from user %d came without a message ID", chosen.ResultID, chosen.From.ID)
+		return
+	}
+	ref := messaging.MessageRef{InlineID: chosen.InlineMessageID}
+	settings, ok := parseInlineResult(chosen.ResultID)
+	if !ok {
+		b.edit(ref, flow.ExpiredText, nil)
+		return
+	}
+
+	invite, err := b.manager.CreateGameInvite(chosen.From.ID, chosen.From.UserName, settings)
+	if err != nil {
+		b.edit(ref, "❌ Не удалось создать приглашение: "+err.Error(), nil)
+		return
+	}
+	b.manager.SetInviteCard(invite.InviteID, models.GroupCard{InlineMessageID: chosen.InlineMessageID})
+
+	text := inviteCardText(displayName(chosen.From), settings) +
+		fmt.Sprintf("\n\nНажмите «Принять», и игра начнется в личных сообщениях с ботом. Приглашение действует %s.", formatWait(b.manager.InviteTTL()))
+	b.edit(ref, text, utils.InlineInviteKeyboard(b.flow.Codec(), invite.InviteID))
+}
+
+// handleInlineAccept starts the game of an invite shared through inline mode.
+// The press is answered with how it went, since the chat it came from may be
+// one the bot can't write to.
+func (b *Bot) handleInlineAccept(c *Context) {
+	cb := c.Callback
+	data, err := b.flow.Codec().Decode(callback.Anyone, cb.Data)
+	if err != nil {
+		log.Printf("Rejected button %q from user %d: %v", cb.Data, cb.From.ID, err)
+		c.Answer(flow.ExpiredText)
+		return
+	}
+	// The game is played in private, which the bot can't start on its own.
+	if !b.reachable(cb.From.ID) {
+		c.Answer(fmt.Sprintf("Сначала откройте чат с @%s и нажмите «Старт», затем примите приглашение.", b.api.Self.UserName))
+		return
+	}
+	if err := b.startInvitedGame(data.Arg, cb.From); err != nil {
+		c.Answer(err.Error())
+		return
+	}
+	c.Answer("Игра началась! Ходы делаются в личных сообщениях с ботом.")
+}
+
+// reachable reports whether the bot can write to a user in private.
+func (b *Bot) reachable(userID int64) bool {
+	_, err := b.api.Request(tgbotapi.NewChatAction(userID, tgbotapi.ChatTyping))
+	return err == nil
+}
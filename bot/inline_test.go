@@ -0,0 +1,77 @@
+package bot_test
+
+import (
+	"prisoners-dilemma-bot/models"
+	"strings"
+	"testing"
+)
+
+func TestInlineInvite(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+
+	for query, want := range map[string]int{"": 3, "15": 1, "что-то": 0} {
+		results, err := h.Server.InlineResults(alice.InlineQuery(query), h.Wait)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != want {
+			t.Fatalf("query %q offers %d results, want %d", query, len(results), want)
+		}
+	}
+	results, err := h.Server.InlineResults(alice.InlineQuery("15 жест"), h.Wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Title, "15 раундов") || !strings.Contains(results[0].Description, "Жесткая") {
+		t.Fatalf("query for a harsh game of 15 rounds offers %+v", results)
+	}
+
+	posted := alice.ChooseInlineResult("15 жест", results[0])
+	card, err := h.Server.WaitInline(posted.InlineID, h.Wait, func(m Message) bool {
+		return m.Keyboard.ButtonByText("Принять") != nil
+	})
+	if err != nil {
+		t.Fatalf("invite card: %v", err)
+	}
+
+	// Carol can't be written to, and alice can't accept her own invite.
+	carol.Block()
+	for _, press := range []struct {
+		user *User
+		want string
+	}{{carol, "Сначала откройте чат"}, {alice, "собственное приглашение"}, {bob, "Игра началась"}} {
+		cbID, err := press.user.PressInline(card, "Принять")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := waitAnswered(h, cbID, press.want); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.WaitText(bob, "Вы присоединились к игре"); err != nil {
+		t.Fatal(err)
+	}
+	session, ok := h.Manager.FindSessionByPlayerID(bob.ID)
+	if !ok || session.TotalRounds != 15 || session.Payoff != models.PayoffPresets[2].Payoff {
+		t.Fatalf("inline invite started %+v, want a harsh game of 15 rounds", session)
+	}
+
+	// The card follows the game like a group match card.
+	if err := h.PlayRound(alice, bob, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Server.WaitInline(card.InlineID, h.Wait, func(m Message) bool {
+		return strings.Contains(m.Text, "Раунд 1: alice 🤝 (+3) — bob 🤝 (+3)")
+	}); err != nil {
+		t.Fatalf("card after round 1: %v", err)
+	}
+	alice.Send("/quit")
+	_, err = h.Server.WaitInline(card.InlineID, h.Wait, func(m Message) bool {
+		return strings.Contains(m.Text, "alice покинул игру") && strings.Contains(m.Text, "bob побеждает")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
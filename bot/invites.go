@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultInviteSweepInterval is how often expired invites are cleaned up.
+const DefaultInviteSweepInterval = time.Minute
+
+const tooManyInvitesText = "У вас уже слишком много открытых приглашений. Отмените ненужные через /invites или дождитесь, пока их примут."
+
+// inviteURL is the deep link that accepts an invite.
+func (b *Bot) inviteURL(inviteID string) string {
+	return fmt.Sprintf("https://t.me/%s?start=invite_%s", b.api.Self.UserName, inviteID)
+}
+
+// handleInvites lists the user's open invites with a cancel button for each.
+func (b *Bot) handleInvites(message *tgbotapi.Message) {
+	text, keyboard := b.openInvites(message.From.ID)
+	b.reply(message.Chat.ID, text, keyboard)
+}
+
+// openInvites renders the list of a user's open invites.
+func (b *Bot) openInvites(userID int64) (string, *messaging.Keyboard) {
+	invites := b.manager.OpenInvites(userID)
+	if len(invites) == 0 {
+		return "У вас нет открытых приглашений. Нажмите «🚀 Создать новую игру», чтобы пригласить соперника.", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📨 Ваши открытые приглашения:\n")
+	ids := make([]string, len(invites))
+	for i, invite := range invites {
+		ids[i] = invite.InviteID
+		title := "Игра на " + roundsText(invite.Rounds)
+		if !invite.Target.IsZero() {
+			title += " для " + invite.Target.String()
+		}
+		fmt.Fprintf(&sb, "\n%d. %s, действует еще %s\n%s\n",
+			i+1, title, formatWait(time.Until(invite.ExpiresAt)), b.inviteURL(invite.InviteID))
+	}
+	return sb.String(), utils.OpenInvitesKeyboard(b.flow.Codec(), userID, ids)
+}
+
+// handleCancelInvite withdraws an invite, from its waiting room or from the /invites list.
+func (b *Bot) handleCancelInvite(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	invite, err := b.manager.CancelInvite(cb.From.ID, data.Arg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	text := fmt.Sprintf("❌ Приглашение на %s отменено.", roundsText(invite.Rounds))
+	b.closeWaitingRoom(*invite, text)
+	b.closeCard(*invite, text)
+	if cb.Message.MessageID != invite.MessageID {
+		// Pressed in the /invites list: show what is left.
+		text, keyboard := b.openInvites(cb.From.ID)
+		b.edit(callbackRef(cb), text, keyboard)
+	}
+}
+
+// closeWaitingRoom replaces the inviter's waiting-room message with the invite's final status.
+func (b *Bot) closeWaitingRoom(invite models.PendingInvite, text string) {
+	if invite.MessageID == 0 {
+		return
+	}
+	b.edit(messaging.MessageRef{ChatID: invite.InviterID, MessageID: invite.MessageID}, text, nil)
+}
+
+// sweepInvites expires stale invites every interval until the bot stops.
+func (b *Bot) sweepInvites(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, invite := range b.manager.ExpireInvites(now) {
+				text := fmt.Sprintf("⌛ Срок действия приглашения на %s истек.", roundsText(invite.Rounds))
+				b.closeWaitingRoom(invite, text)
+				b.closeCard(invite, text)
+			}
+		case <-b.stopping:
+			return
+		}
+	}
+}
+
+// roundsText is a number of rounds with the noun in the right form.
+func roundsText(rounds int) string {
+	switch {
+	case rounds%10 == 1 && rounds%100 != 11:
+		return fmt.Sprintf("%d раунд", rounds)
+	case rounds%10 >= 2 && rounds%10 <= 4 && (rounds%100 < 12 || rounds%100 > 14):
+		return fmt.Sprintf("%d раунда", rounds)
+	}
+	return fmt.Sprintf("%d раундов", rounds)
+}
+
+// rulesText describes the payoff table and move time limit of a game; a zero
+// timeout stands for the default.
+func (b *Bot) rulesText(payoff models.Payoff, timeout time.Duration) string {
+	if timeout <= 0 {
+		timeout = b.manager.TurnTimeout()
+	}
+	return fmt.Sprintf("💰 Выигрыши: %s (%s)\n⏱ Время на ход: %s", models.PayoffName(payoff), payoff, formatTurnTime(timeout))
+}
+
+// formatTurnTime is a move time limit, in seconds when it is under a minute.
+func formatTurnTime(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d сек", int((d+time.Second-1)/time.Second))
+	}
+	return formatWait(d)
+}
+
+// formatWait is a duration in hours and minutes, rounded up to a whole minute.
+func formatWait(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	switch {
+	case minutes < 60:
+		return fmt.Sprintf("%d мин", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d ч", minutes/60)
+	}
+	return fmt.Sprintf("%d ч %d мин", minutes/60, minutes%60)
+}
@@ -0,0 +1,161 @@
+package bot_test
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/game"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOwnInvite(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, _ := players(h)
+	inviteID, err := h.CreateInvite(alice, gameRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Send("/start invite_" + inviteID)
+	_, err = h.WaitText(alice, "не можете принять собственное приглашение")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitingRoom finds u's waiting-room message of an open invite.
+func waitingRoom(u *User, inviteID string) (int, error) {
+	for _, m := range u.Messages() {
+		for _, url := range m.Keyboard.URLs() {
+			if strings.HasSuffix(url, "invite_"+inviteID) {
+				return m.ID, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no waiting room for invite %s", inviteID)
+}
+
+// expectClosed waits for a waiting room to be closed with a status containing
+// substr, and checks its buttons are gone.
+func expectClosed(h *Harness, u *User, roomID int, substr string) error {
+	m, err := u.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == roomID && strings.Contains(m.Text, substr)
+	})
+	if err != nil {
+		return fmt.Errorf("waiting room never showed %q: %v", substr, err)
+	}
+	if len(m.Keyboard.Inline) > 0 {
+		return fmt.Errorf("closed waiting room still has buttons")
+	}
+	return nil
+}
+
+func TestInviteExpiry(t *testing.T) {
+	h := newHarness(t, Options{InviteTTL: 300 * time.Millisecond, InviteSweep: 20 * time.Millisecond})
+	alice, bob := players(h)
+	inviteID, err := h.CreateInvite(alice, gameRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := waitingRoom(alice, inviteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expectClosed(h, alice, room, "истек"); err != nil {
+		t.Fatal(err)
+	}
+	bob.Send("/start invite_" + inviteID)
+	_, err = h.WaitText(bob, "недействительно или истекло")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelInvite(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	inviteID, err := h.CreateInvite(alice, gameRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := h.WaitText(alice, "Ожидаем соперника")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(room, "Отменить приглашение"); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectClosed(h, alice, room.ID, "отменено"); err != nil {
+		t.Fatal(err)
+	}
+	bob.Send("/start invite_" + inviteID)
+	_, err = h.WaitText(bob, "недействительно или истекло")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenInvites(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	var ids []string
+	var rooms []int
+	for i := 0; i < game.DefaultMaxOpenInvites; i++ {
+		id, err := h.CreateInvite(alice, gameRounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		room, err := waitingRoom(alice, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		rooms = append(rooms, room)
+	}
+
+	// One more is over the limit.
+	alice.Send("🚀 Создать новую игру")
+	label := fmt.Sprintf("%d Раундов", gameRounds)
+	prompt, err := alice.WaitFor(h.Wait, func(m Message) bool {
+		return m.Edits == 0 && m.Keyboard.ButtonByText(label) != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(prompt, label); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "слишком много открытых приглашений"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel the second invite from the list.
+	alice.Send("/invites")
+	list, err := h.WaitText(alice, "Ваши открытые приглашения")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if !strings.Contains(list.Text, id) {
+			t.Fatalf("invite %s is missing from the list", id)
+		}
+	}
+	if _, err := alice.PressText(list, "Отменить №2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == list.ID && m.Edits > 0 && !strings.Contains(m.Text, ids[1])
+	}); err != nil {
+		t.Fatalf("list wasn't updated after the cancel: %v", err)
+	}
+	if err := expectClosed(h, alice, rooms[1], "отменено"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Accepting another one closes its waiting room.
+	if err := h.Accept(bob, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectClosed(h, alice, rooms[0], "принято"); err != nil {
+		t.Fatal(err)
+	}
+}
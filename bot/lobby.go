@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// lobbyPageSize is how many open games one page of the lobby lists.
+const lobbyPageSize = 5
+
+// handleLobby shows the first page of public games.
+func (b *Bot) handleLobby(message *tgbotapi.Message) {
+	text, keyboard := b.lobbyPage(message.From.ID, 0)
+	b.reply(message.Chat.ID, text, keyboard)
+}
+
+// handleLobbyPage turns the lobby to another page, or refreshes the current one.
+func (b *Bot) handleLobbyPage(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	page, err := strconv.Atoi(data.Arg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	text, keyboard := b.lobbyPage(cb.From.ID, page)
+	b.edit(callbackRef(cb), text, keyboard)
+}
+
+// handleJoin accepts a public invite picked in the lobby.
+func (b *Bot) handleJoin(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	if b.acceptInvite(data.Arg, cb.From, cb.Message.Chat.ID) {
+		b.edit(callbackRef(cb), "🎮 Вы присоединились к игре из лобби.", nil)
+		return
+	}
+	// The game is gone or can't be joined right now: show what is left.
+	text, keyboard := b.lobbyPage(cb.From.ID, 0)
+	b.edit(callbackRef(cb), text, keyboard)
+}
+
+// lobbyPage renders one page of the public games userID can join. Pages past
+// the end show the last one.
+func (b *Bot) lobbyPage(userID int64, page int) (string, *messaging.Keyboard) {
+	var invites []models.PendingInvite
+	for _, invite := range b.manager.PublicInvites() {
+		if invite.InviterID != userID {
+			invites = append(invites, invite)
+		}
+	}
+	if len(invites) == 0 {
+		return "🌐 Сейчас нет открытых игр.\n\nСоздайте свою через «🚀 Создать новую игру» и выберите «🌐 В лобби».",
+			utils.LobbyKeyboard(b.flow.Codec(), userID, nil, 1, 0, 1)
+	}
+
+	pages := (len(invites) + lobbyPageSize - 1) / lobbyPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	first := page * lobbyPageSize
+	last := first + lobbyPageSize
+	if last > len(invites) {
+		last = len(invites)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🌐 Открытые игры (стр. %d из %d):\n", page+1, pages)
+	ids := make([]string, 0, last-first)
+	for i, invite := range invites[first:last] {
+		ids = append(ids, invite.InviteID)
+		fmt.Fprintf(&sb, "\n%d. %s, ⭐ %s\n%s\n%s\n", first+i+1,
+			inviterName(invite), b.ratingText(invite.InviterID), roundsText(invite.Rounds),
+			b.rulesText(invite.Payoff, invite.TurnTimeout))
+	}
+	return sb.String(), utils.LobbyKeyboard(b.flow.Codec(), userID, ids, first+1, page, pages)
+}
+
+// ratingText is a player's rating for display, followed by the medal of
+// their latest season title, or a placeholder if it can't be loaded.
+func (b *Bot) ratingText(playerID int64) string {
+	rating, err := b.manager.PlayerRating(playerID)
+	if err != nil {
+		log.Printf("Failed to load rating of player %d: %v", playerID, err)
+		return "?"
+	}
+	if badge := rating.Badge(); badge != "" {
+		return strconv.Itoa(rating.Points()) + " " + badge
+	}
+	return strconv.Itoa(rating.Points())
+}
+
+// inviterName is how the author of an invite is shown in the lobby.
+func inviterName(invite models.PendingInvite) string {
+	if invite.InviterUsername != "" {
+		return "@" + invite.InviterUsername
+	}
+	return "Игрок " + strconv.FormatInt(invite.InviterID, 10)
+}
@@ -0,0 +1,126 @@
+package bot_test
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/game"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLobby(t *testing.T) {
+	h := newHarness(t, Options{})
+	carol := h.User(303, "carol")
+	// One more public game than fits on a page, plus a private one that stays out of the lobby.
+	var ids []string
+	var hosts []*User
+	for i := 0; i <= lobbyPageSize; i++ {
+		host := h.User(int64(1000+i), fmt.Sprintf("host%d", i))
+		id, err := h.CreateInvite(host, gameRounds, "В лобби")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		hosts = append(hosts, host)
+	}
+	if _, err := h.CreateInvite(h.User(2000, "hermit"), gameRounds); err != nil {
+		t.Fatal(err)
+	}
+
+	carol.Send("🌐 Открытые игры")
+	page, err := h.WaitText(carol, "стр. 1 из 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page.Text, "hermit") {
+		t.Fatalf("private invite is listed in the lobby:\n%s", page.Text)
+	}
+	if _, err := carol.PressText(page, "Вперед"); err != nil {
+		t.Fatal(err)
+	}
+	page, err = carol.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == page.ID && strings.Contains(m.Text, "стр. 2 из 2")
+	})
+	if err != nil {
+		t.Fatalf("second lobby page: %v", err)
+	}
+	// Newest first, so the last page holds the oldest game.
+	if !strings.Contains(page.Text, "@host0") {
+		t.Fatalf("oldest game is missing from the last page:\n%s", page.Text)
+	}
+	room, err := waitingRoom(hosts[0], ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := carol.PressText(page, fmt.Sprintf("Играть №%d", lobbyPageSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(carol, "Вы присоединились к игре"); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectClosed(h, hosts[0], room, "принято"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lobbyPageSize mirrors the bot's page size.
+const lobbyPageSize = 5
+
+func TestGameSettings(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	inviteID, err := h.CreateInvite(alice, gameRounds, "Жесткая", "30 сек")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(bob, inviteID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "Жесткая (3/-3/6/0)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "Время на ход: 30 сек"); err != nil {
+		t.Fatal(err)
+	}
+	// A lone defection scores the harsh table's temptation and sucker's payoff.
+	if err := h.PlayRound(alice, bob, false, true); err != nil {
+		t.Fatal(err)
+	}
+	session, ok := h.Manager.FindSessionByPlayerID(alice.ID)
+	if !ok {
+		t.Fatalf("alice is not in a game")
+	}
+	if session.PlayerA.Score != 6 || session.PlayerB.Score != -3 {
+		t.Fatalf("scores are %d:%d, want 6:-3", session.PlayerA.Score, session.PlayerB.Score)
+	}
+	if session.TurnTimeout != 30*time.Second {
+		t.Fatalf("turn timeout is %s, want 30s", session.TurnTimeout)
+	}
+}
+
+func TestRatings(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Хотите реванш?"); err != nil {
+		t.Fatal(err)
+	}
+	// Evenly rated players trade half of K.
+	for _, want := range []struct {
+		user   *User
+		points int
+	}{{alice, game.DefaultRating + 16}, {bob, game.DefaultRating - 16}} {
+		rating, err := h.Manager.PlayerRating(want.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rating.Points() != want.points || rating.Games != 1 {
+			t.Fatalf("%s is rated %d after %d games, want %d after 1", want.user.Username, rating.Points(), rating.Games, want.points)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Recovery turns a panicking handler into a log entry and a generic error
+// message, so one bad update doesn't take the whole bot down.
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				log.Printf("Panic while handling %s for user %d: %v\n%s", c.Route, c.UserID, r, debug.Stack())
+
+				const text = "Что-то пошло не так. Попробуйте еще раз."
+				if c.Callback != nil && !c.Answered() {
+					c.Answer(text)
+					return
+				}
+				if c.ChatID != 0 {
+					c.Reply(text, nil)
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// Logging logs every routed update and how long its handler took.
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			start := time.Now()
+			next(c)
+			log.Printf("Handled %s for user %d in %s", c.Route, c.UserID, time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+// Bans drops updates from users for whom banned returns true.
+func Bans(banned func(userID int64) bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			if banned(c.UserID) {
+				c.Answer("Доступ к боту ограничен.")
+				return
+			}
+			next(c)
+		}
+	}
+}
+
+// RateLimit lets each user through at most rate times per second, with bursts
+// of up to burst updates. Users over the limit are told once until they slow down.
+func RateLimit(rate float64, burst int) Middleware {
+	var mu sync.Mutex
+	type bucket struct {
+		tokens   float64
+		last     time.Time
+		notified bool
+	}
+	buckets := make(map[int64]*bucket)
+
+	allow := func(userID int64) (ok, notify bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		b, exists := buckets[userID]
+		if !exists {
+			b = &bucket{tokens: float64(burst)}
+			buckets[userID] = b
+		} else {
+			b.tokens += now.Sub(b.last).Seconds() * rate
+			if b.tokens > float64(burst) {
+				b.tokens = float64(burst)
+			}
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.notified = false
+			return true, false
+		}
+		notify = !b.notified
+		b.notified = true
+		return false, notify
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			ok, notify := allow(c.UserID)
+			if ok {
+				next(c)
+				return
+			}
+			const text = "Слишком много запросов. Подождите немного."
+			if c.Callback != nil {
+				c.Answer(text)
+			} else if notify && c.ChatID != 0 {
+				c.Reply(text, nil)
+			}
+		}
+	}
+}
+
+// Directory tells see about everyone who talks to the bot in private, so they
+// can later be found by username. Group members are left out: the bot can't
+// message them until they start a private chat.
+func Directory(see func(userID int64, username string)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			chat := fromChat(c.Update)
+			if user := c.Update.SentFrom(); user != nil && user.UserName != "" && chat != nil && chat.IsPrivate() {
+				see(user.ID, user.UserName)
+			}
+			next(c)
+		}
+	}
+}
+
+// GroupChats keeps the bot quiet in group chats: only the given routes are
+// handled there. Other commands are answered with a pointer to the private
+// chat, and everything else is ignored.
+func GroupChats(routes ...string) Middleware {
+	allowed := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		allowed[route] = true
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			chat := fromChat(c.Update)
+			if chat == nil || chat.IsPrivate() || allowed[c.Route] {
+				next(c)
+				return
+			}
+			if c.Message != nil && c.Message.IsCommand() {
+				c.Reply("Эта команда работает только в личных сообщениях с ботом.", nil)
+			}
+		}
+	}
+}
+
+// DedupeCallbacks drops callback queries whose ID was already seen, so a button
+// press Telegram delivers twice is only handled once. It remembers the last
+// capacity IDs.
+func DedupeCallbacks(capacity int) Middleware {
+	var mu sync.Mutex
+	seen := make(map[string]bool, capacity)
+	ring := make([]string, capacity)
+	pos := 0
+
+	firstTime := func(id string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if seen[id] {
+			return false
+		}
+		delete(seen, ring[pos])
+		ring[pos] = id
+		seen[id] = true
+		pos = (pos + 1) % capacity
+		return true
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) {
+			if c.Callback != nil && !firstTime(c.Callback.ID) {
+				log.Printf("Dropping duplicate callback %s from user %d", c.Callback.ID, c.UserID)
+				return
+			}
+			next(c)
+		}
+	}
+}
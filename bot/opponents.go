@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/strategy"
+	"prisoners-dilemma-bot/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleBotGame offers the list of bot opponents.
+func (b *Bot) handleBotGame(message *tgbotapi.Message) {
+	if b.manager.Busy(message.From.ID) {
+		b.reply(message.Chat.ID, "Вы уже в игре! Введите /quit, чтобы покинуть текущую игру.", nil)
+		return
+	}
+
+	msgText := "Выберите соперника.\n\n" +
+		"🧠 Обучающийся бот изучает ваш стиль игры и запоминает его между партиями."
+	b.reply(message.Chat.ID, msgText, utils.OpponentKeyboard(b.flow.Codec(), message.From.ID))
+}
+
+func (b *Bot) handleOpponentSelection(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	keyboard := utils.BotRoundsKeyboard(b.flow.Codec(), cb.From.ID, data.Arg)
+	b.edit(callbackRef(cb), "Сколько раундов вы хотите играть?", keyboard)
+}
+
+func (b *Bot) handleBotRoundsSelection(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	strategyName, roundsArg, ok := strings.Cut(data.Arg, "/")
+	if !ok {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	rounds, err := strconv.Atoi(roundsArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+
+	session, err := b.manager.CreateBotGame(cb.From.ID, cb.From.UserName, rounds, strategyName)
+	if err != nil {
+		log.Printf("Error creating bot game for player %d: %v", cb.From.ID, err)
+		b.reply(cb.From.ID, err.Error(), nil)
+		return
+	}
+
+	b.edit(callbackRef(cb), fmt.Sprintf("🎮 Игра против %s начинается!", session.PlayerB.Username), nil)
+
+	b.flow.PromptNextRound(session)
+	b.flow.SetupTurnTimer(session)
+}
+
+// handlePolicy shows an admin what the learning opponent has learned about a player.
+// Usage: /policy <user_id>
+func (b *Bot) handlePolicy(message *tgbotapi.Message) {
+	if !b.admins[message.From.ID] {
+		b.reply(message.Chat.ID, unknownCommandText, nil)
+		return
+	}
+
+	playerID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		b.reply(message.Chat.ID, "Использование: /policy <user_id>", nil)
+		return
+	}
+
+	policy, err := b.manager.LearnerPolicy(playerID)
+	if err != nil {
+		b.reply(message.Chat.ID, err.Error(), nil)
+		return
+	}
+
+	b.reply(message.Chat.ID, formatPolicy(playerID, policy), nil)
+}
+
+// formatPolicy renders the Q table and n-gram counts of a learned policy.
+// States read oldest move first; each pair is "bot move + player move".
+func formatPolicy(playerID int64, policy *strategy.Policy) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧠 Политика против игрока %d\n", playerID)
+	fmt.Fprintf(&sb, "Сыграно игр: %d\nИсследование (ε): %.3f\n\n", policy.Games, policy.Epsilon)
+
+	if len(policy.Q) == 0 {
+		sb.WriteString("Бот ещё ничему не научился.")
+		return sb.String()
+	}
+
+	states := make([]string, 0, len(policy.Q))
+	for state := range policy.Q {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	sb.WriteString("Q-таблица (состояние: Q(C) / Q(D) → ход):\n")
+	for _, state := range states {
+		values := policy.Q[state]
+		best := "C"
+		if values[1] > values[0] {
+			best = "D"
+		}
+		fmt.Fprintf(&sb, "%s: %.2f / %.2f → %s\n", state, values[0], values[1], best)
+	}
+
+	if len(policy.NGram) > 0 {
+		contexts := make([]string, 0, len(policy.NGram))
+		for context := range policy.NGram {
+			contexts = append(contexts, context)
+		}
+		sort.Strings(contexts)
+
+		sb.WriteString("\nN-граммы игрока (контекст: C / D):\n")
+		for _, context := range contexts {
+			counts := policy.NGram[context]
+			fmt.Fprintf(&sb, "%s: %d / %d\n", context, counts[0], counts[1])
+		}
+	}
+
+	return sb.String()
+}
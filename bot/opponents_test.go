@@ -0,0 +1,44 @@
+package bot_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBotOpponent(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, _ := players(h)
+	alice.Send("🤖 Играть с ботом")
+
+	menu, err := alice.WaitFor(h.Wait, func(m Message) bool {
+		return m.Keyboard.ButtonByText("Always Cooperate") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(menu, "Always Cooperate"); err != nil {
+		t.Fatal(err)
+	}
+	rounds, err := alice.WaitFor(h.Wait, func(m Message) bool {
+		return m.ID == menu.ID && m.Keyboard.ButtonByText("10 Раундов") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(rounds, "10 Раундов"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := h.Move(alice, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	final, err := h.WaitText(alice, "Игра окончена")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(final.Text, "Игрок: alice\nОчки: 50") {
+		t.Fatalf("defecting against Always Cooperate should score 50:\n%s", final.Text)
+	}
+}
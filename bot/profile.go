@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/game"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleProfile shows a player's lifetime statistics: their own, or anyone's
+// with /profile @username or /profile <user_id>.
+func (b *Bot) handleProfile(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	playerID := message.From.ID
+	own := true
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		target, err := parseTarget(arg)
+		if err != nil {
+			b.reply(chatID, "Использование: /profile, /profile @username или /profile <user_id>", nil)
+			return
+		}
+		playerID = target.ID
+		if target.Username != "" {
+			id, ok := b.manager.LookupUser(target.Username)
+			if !ok {
+				b.reply(chatID, fmt.Sprintf("Игрок @%s еще не пользовался ботом.", target.Username), nil)
+				return
+			}
+			playerID = id
+		}
+		own = playerID == message.From.ID
+	}
+
+	profile, err := b.manager.PlayerProfile(playerID)
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	if profile.Games == 0 {
+		if own {
+			b.reply(chatID, "Вы ещё не завершили ни одной игры.", nil)
+		} else {
+			b.reply(chatID, "Этот игрок ещё не завершил ни одной игры.", nil)
+		}
+		return
+	}
+	b.reply(chatID, b.profileText(playerID, profile), nil)
+}
+
+// profileText renders a profile along with the player's rating, season titles
+// and the classic strategy their style is closest to.
+func (b *Bot) profileText(playerID int64, p *game.Profile) string {
+	var sb strings.Builder
+	name := p.Username
+	if name == "" {
+		name = "ID " + strconv.FormatInt(playerID, 10)
+	}
+	fmt.Fprintf(&sb, "👤 Профиль игрока %s\n\n", name)
+
+	rating, err := b.manager.PlayerRating(playerID)
+	if err != nil {
+		log.Printf("Failed to load rating of player %d: %v", playerID, err)
+	} else {
+		fmt.Fprintf(&sb, "⭐ Рейтинг: %d\n", rating.Points())
+		for _, title := range rating.Titles {
+			sb.WriteString(title.String() + "\n")
+		}
+	}
+
+	fmt.Fprintf(&sb, "🎮 Игр: %d — побед: %d, ничьих: %d, поражений: %d, из них сдано: %d\n",
+		p.Games, p.Wins, p.Draws, p.Losses, p.Forfeits)
+	perRound, _ := p.PointsPerRound()
+	fmt.Fprintf(&sb, "💰 Очков: %d, в среднем %.2f за раунд (раундов: %d)\n", p.Points, perRound, p.Rounds)
+	fmt.Fprintf(&sb, "🤝 Сотрудничество: %s ходов, %s первых ходов\n",
+		rateText(p.CooperationRate()), rateText(p.OpeningRate()))
+	fmt.Fprintf(&sb, "⚔️ Ответ на предательство: %s\n", rateText(p.RetaliationRate()))
+	fmt.Fprintf(&sb, "🕊 Прощение: %s\n", rateText(p.ForgivenessRate()))
+	if response, ok := p.AverageResponse(); ok {
+		fmt.Fprintf(&sb, "⏱ Среднее время хода: %.1f сек\n", response.Seconds())
+	}
+
+	style, err := b.manager.PlayerStyle(playerID)
+	if err != nil {
+		log.Printf("Failed to load style of player %d: %v", playerID, err)
+	} else if fits := style.Fits.Ranked(); len(fits) > 0 {
+		fmt.Fprintf(&sb, "🧬 Стиль ближе всего к %s (%d%%)\n", fits[0].Name, fits[0].Percent())
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// rateText is a share as a percentage, or a dash when there is nothing to count.
+func rateText(r float64, ok bool) string {
+	if !ok {
+		return "—"
+	}
+	return formatProbability(r)
+}
@@ -0,0 +1,55 @@
+package bot_test
+
+import "testing"
+
+func TestProfile(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	// Bob opens with a betrayal, alice hits back once and both make peace.
+	if err := h.PlayRound(alice, bob, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PlayRound(alice, bob, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds-2, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Хотите реванш?"); err != nil {
+		t.Fatal(err)
+	}
+
+	carol.Send("/profile @alice")
+	for _, line := range []string{
+		"👤 Профиль игрока alice",
+		"🎮 Игр: 1 — побед: 0, ничьих: 1, поражений: 0, из них сдано: 0",
+		"💰 Очков: 29, в среднем 2.90 за раунд (раундов: 10)",
+		"🤝 Сотрудничество: 90% ходов, 100% первых ходов",
+		"⚔️ Ответ на предательство: 100%",
+		"🕊 Прощение: 100%",
+		"⏱ Среднее время хода",
+	} {
+		if _, err := h.WaitText(carol, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bob.Send("👤 Профиль")
+	for _, line := range []string{"🤝 Сотрудничество: 90% ходов, 0% первых ходов", "⚔️ Ответ на предательство: 0%"} {
+		if _, err := h.WaitText(bob, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	carol.Send("/profile")
+	if _, err := h.WaitText(carol, "Вы ещё не завершили ни одной игры"); err != nil {
+		t.Fatal(err)
+	}
+	carol.Send("/profile @nobody")
+	_, err := h.WaitText(carol, "Игрок @nobody еще не пользовался ботом")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/game"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const replayUsage = "Использование: /replay <ID игры> [номер раунда]"
+
+// handleReplay lets an admin rebuild a game from the event log, to settle a
+// dispute: /replay <game_id> shows it as it ended, /replay <game_id> <round>
+// as it stood once that round was scored.
+func (b *Bot) handleReplay(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if !b.admins[message.From.ID] {
+		b.reply(chatID, unknownCommandText, nil)
+		return
+	}
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		b.reply(chatID, replayUsage, nil)
+		return
+	}
+	round := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			b.reply(chatID, replayUsage, nil)
+			return
+		}
+		round = n
+	}
+
+	events, err := b.manager.GameEvents(args[0])
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	session, err := game.ReplayGame(events, round)
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⏪ Игра %s по журналу событий (%d)", session.GameID, len(events))
+	if round > 0 {
+		fmt.Fprintf(&sb, ", после раунда %d", round)
+	}
+	sb.WriteString("\n")
+	if !session.StartedAt.IsZero() {
+		fmt.Fprintf(&sb, "Начало: %s\n", session.StartedAt.Format("02.01.2006 15:04:05"))
+	}
+	note := ""
+	switch {
+	case session.BothTimedOut:
+		note = "⏰ Никто не успел сделать ход."
+	case session.TimedOut != 0:
+		late := session.PlayerA
+		if session.TimedOut == session.PlayerB.ID {
+			late = session.PlayerB
+		}
+		note = fmt.Sprintf("⏰ %s не успел сделать ход.", late.Username)
+	}
+	sb.WriteString("\n" + game.MatchCard(session, note))
+	b.reply(chatID, sb.String(), nil)
+}
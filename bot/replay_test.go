@@ -0,0 +1,52 @@
+package bot_test
+
+import "testing"
+
+func TestReplay(t *testing.T) {
+	h := newHarness(t, Options{Admins: []int64{999}})
+	admin := h.User(999, "admin")
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, 2, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds-2, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Игра окончена"); err != nil {
+		t.Fatal(err)
+	}
+	games, err := h.Manager.LastGames(alice.ID)
+	if err != nil || len(games) == 0 {
+		t.Fatalf("no game recorded for alice: %v", err)
+	}
+	gameID := games[0]
+
+	alice.Send("/replay " + gameID)
+	if _, err := h.WaitText(alice, "Неизвестная команда"); err != nil {
+		t.Fatal(err)
+	}
+	admin.Send("/replay " + gameID)
+	for _, line := range []string{"⏪ Игра " + gameID, "Счет: alice 24 — 34 bob", "🏆 bob победил!"} {
+		if _, err := h.WaitText(admin, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin.Send("/replay " + gameID + " 2")
+	for _, line := range []string{"после раунда 2", "Счет: alice 0 — 10 bob", "Идет раунд 3 из 10"} {
+		if _, err := h.WaitText(admin, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin.Send("/replay " + gameID + " 11")
+	if _, err := h.WaitText(admin, "в игре сыграно раундов: 10"); err != nil {
+		t.Fatal(err)
+	}
+	admin.Send("/replay nosuchgame")
+	_, err = h.WaitText(admin, "в журнале нет событий этой игры")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
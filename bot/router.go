@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"log"
+	"prisoners-dilemma-bot/messaging"
+	"sort"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Context carries one update through the middleware chain to its handler.
+type Context struct {
+	Update   tgbotapi.Update
+	Message  *tgbotapi.Message
+	Callback *tgbotapi.CallbackQuery
+	// InlineQuery and ChosenInline are set for updates from inline mode.
+	InlineQuery  *tgbotapi.InlineQuery
+	ChosenInline *tgbotapi.ChosenInlineResult
+	UserID       int64
+	ChatID       int64
+	// Route names the matched route, such as "/start", "text:❓ Помощь" or "callback:rounds_".
+	Route string
+
+	msg      messaging.Messenger
+	answerMu sync.Mutex
+	answered bool
+}
+
+// Reply sends a message to the chat the update came from.
+func (c *Context) Reply(text string, keyboard *messaging.Keyboard) {
+	if _, err := c.msg.SendText(c.ChatID, text, keyboard); err != nil {
+		log.Printf("Failed to send message to %d: %v", c.ChatID, err)
+	}
+}
+
+// Answer acknowledges the callback query. Only the first call reaches Telegram,
+// so middleware and handlers can both answer without stepping on each other.
+func (c *Context) Answer(text string) {
+	if c.Callback == nil {
+		return
+	}
+	c.answerMu.Lock()
+	defer c.answerMu.Unlock()
+	if c.answered {
+		return
+	}
+	c.answered = true
+	if err := c.msg.AnswerCallback(c.Callback.ID, text); err != nil {
+		log.Printf("Failed to answer callback %s: %v", c.Callback.ID, err)
+	}
+}
+
+// Answered reports whether the callback query has been acknowledged.
+func (c *Context) Answered() bool {
+	c.answerMu.Lock()
+	defer c.answerMu.Unlock()
+	return c.answered
+}
+
+// HandlerFunc handles a routed update.
+type HandlerFunc func(c *Context)
+
+// Middleware wraps a handler with behavior shared by every route.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Command is a registered slash command.
+type Command struct {
+	Name string
+	// Description is shown in Telegram's command menu. Commands without one are hidden.
+	Description string
+	Handler     HandlerFunc
+}
+
+type callbackRoute struct {
+	prefix  string
+	handler HandlerFunc
+}
+
+// Router maps commands, menu button texts and callback data prefixes to handlers.
+type Router struct {
+	msg        messaging.Messenger
+	commands   map[string]*Command
+	order      []string
+	texts      map[string]HandlerFunc
+	callbacks  []callbackRoute
+	inline     HandlerFunc
+	chosen     HandlerFunc
+	notFound   HandlerFunc
+	middleware []Middleware
+}
+
+// NewRouter creates an empty router that replies through msg.
+func NewRouter(msg messaging.Messenger) *Router {
+	return &Router{
+		msg:      msg,
+		commands: make(map[string]*Command),
+		texts:    make(map[string]HandlerFunc),
+	}
+}
+
+// Use appends middleware. The first one registered runs outermost.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Command registers a slash command. An empty description keeps it out of the command menu.
+func (r *Router) Command(name, description string, handler HandlerFunc) {
+	if _, exists := r.commands[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.commands[name] = &Command{Name: name, Description: description, Handler: handler}
+}
+
+// Text registers a handler for a menu button, matched on the exact message text.
+func (r *Router) Text(text string, handler HandlerFunc) {
+	r.texts[text] = handler
+}
+
+// Callback registers a handler for inline buttons whose data starts with prefix.
+// When several prefixes match, the longest one wins.
+func (r *Router) Callback(prefix string, handler HandlerFunc) {
+	r.callbacks = append(r.callbacks, callbackRoute{prefix: prefix, handler: handler})
+	sort.SliceStable(r.callbacks, func(i, j int) bool {
+		return len(r.callbacks[i].prefix) > len(r.callbacks[j].prefix)
+	})
+}
+
+// InlineQuery sets the handler for inline queries, typed as "@botname ..." in any chat.
+func (r *Router) InlineQuery(handler HandlerFunc) {
+	r.inline = handler
+}
+
+// ChosenInlineResult sets the handler for inline results a user picked and posted.
+func (r *Router) ChosenInlineResult(handler HandlerFunc) {
+	r.chosen = handler
+}
+
+// NotFound sets the handler for messages no route matches.
+func (r *Router) NotFound(handler HandlerFunc) {
+	r.notFound = handler
+}
+
+// Commands lists the registered commands in registration order.
+func (r *Router) Commands() []Command {
+	commands := make([]Command, 0, len(r.order))
+	for _, name := range r.order {
+		commands = append(commands, *r.commands[name])
+	}
+	return commands
+}
+
+// BotCommands is the public command menu for setMyCommands.
+func (r *Router) BotCommands() []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, command := range r.Commands() {
+		if command.Description == "" {
+			continue
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: command.Name, Description: command.Description})
+	}
+	return commands
+}
+
+// Handle routes an update through the middleware chain.
+func (r *Router) Handle(update tgbotapi.Update) {
+	c := &Context{
+		Update:       update,
+		Message:      update.Message,
+		Callback:     update.CallbackQuery,
+		InlineQuery:  update.InlineQuery,
+		ChosenInline: update.ChosenInlineResult,
+		msg:          r.msg,
+	}
+	if user := update.SentFrom(); user != nil {
+		c.UserID = user.ID
+	}
+	if chat := fromChat(update); chat != nil {
+		c.ChatID = chat.ID
+	}
+
+	handler := r.route(c)
+	if handler == nil {
+		c.Answer("")
+		return
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	handler(c)
+
+	// Every button press must be acknowledged, or the client keeps spinning.
+	c.Answer("")
+}
+
+// route finds the handler for the update and records the route on c.
+func (r *Router) route(c *Context) HandlerFunc {
+	switch {
+	case c.Message != nil:
+		if c.Message.IsCommand() {
+			if command, ok := r.commands[c.Message.Command()]; ok {
+				c.Route = "/" + command.Name
+				return command.Handler
+			}
+		} else if handler, ok := r.texts[c.Message.Text]; ok {
+			c.Route = "text:" + c.Message.Text
+			return handler
+		}
+		c.Route = "not found"
+		return r.notFound // nil drops the update
+
+	case c.Callback != nil:
+		for _, route := range r.callbacks {
+			if strings.HasPrefix(c.Callback.Data, route.prefix) {
+				c.Route = "callback:" + route.prefix
+				return route.handler
+			}
+		}
+		c.Route = "callback:unknown"
+
+	case c.InlineQuery != nil:
+		c.Route = "inline query"
+		return r.inline
+
+	case c.ChosenInline != nil:
+		c.Route = "inline result"
+		return r.chosen
+	}
+	return nil
+}
+
+// fromChat is the chat an update came from, or nil. Unlike
+// tgbotapi.Update.FromChat it copes with presses of buttons on messages posted
+// through inline mode, which belong to no chat.
+func fromChat(update tgbotapi.Update) *tgbotapi.Chat {
+	if update.CallbackQuery != nil && update.CallbackQuery.Message == nil {
+		return nil
+	}
+	return update.FromChat()
+}
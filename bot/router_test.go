@@ -0,0 +1,75 @@
+package bot_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandMenu(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, _ := players(h)
+	// Any reply means Start is past setMyCommands.
+	alice.Send("/help")
+	if _, err := h.WaitText(alice, "Правила игры"); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := make(map[string]bool)
+	for _, command := range h.Server.Commands() {
+		listed[command.Command] = true
+	}
+	for _, name := range []string{"start", "help", "quit", "status", "history", "lobby", "challenge", "invites", "leaderboard", "groupsettings", "tournament", "standings", "season", "profile", "export", "style", "analyze"} {
+		if !listed[name] {
+			t.Fatalf("/%s is missing from the command menu", name)
+		}
+	}
+	for _, name := range []string{"policy", "ban", "unban", "startseason", "endseason", "replay"} {
+		if listed[name] {
+			t.Fatalf("admin command /%s is in the public menu", name)
+		}
+	}
+}
+
+func TestUserRateLimit(t *testing.T) {
+	h := newHarness(t, Options{RateLimit: 1, RateBurst: 2})
+	alice, _ := players(h)
+	for i := 0; i < 5; i++ {
+		alice.Send("/help")
+	}
+	if _, err := h.WaitText(alice, "Слишком много запросов"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := h.CountText(alice, "Правила игры"); n != 2 {
+		t.Fatalf("expected 2 answered /help within the burst, got %d", n)
+	}
+	if n := h.CountText(alice, "Слишком много запросов"); n != 1 {
+		t.Fatalf("expected a single rate limit notice, got %d", n)
+	}
+}
+
+func TestBan(t *testing.T) {
+	h := newHarness(t, Options{Admins: []int64{999}})
+	admin := h.User(999, "admin")
+	alice, _ := players(h)
+
+	admin.Send("/ban 101")
+	if _, err := h.WaitText(admin, "Пользователь 101 заблокирован"); err != nil {
+		t.Fatal(err)
+	}
+	alice.Send("/help")
+	time.Sleep(200 * time.Millisecond)
+	if len(alice.Messages()) != 0 {
+		t.Fatalf("banned user got a reply")
+	}
+
+	admin.Send("/unban 101")
+	if _, err := h.WaitText(admin, "Пользователь 101 разблокирован"); err != nil {
+		t.Fatal(err)
+	}
+	alice.Send("/help")
+	_, err := h.WaitText(alice, "Правила игры")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const unknownCommandText = "🤔 Неизвестная команда. Используйте меню ниже или введите /help."
+
+// dedupeCapacity is how many recent callback query IDs are remembered.
+const dedupeCapacity = 4096
+
+// routes registers every command, menu button and inline button the bot understands.
+// Commands are listed in the order they should appear in Telegram's command menu.
+func (b *Bot) routes(rate float64, burst int) *Router {
+	r := NewRouter(b.msg)
+	r.Use(
+		Recovery(),
+		Logging(),
+		DedupeCallbacks(dedupeCapacity),
+		GroupChats(groupRoutes...),
+		Bans(b.isBanned),
+		Directory(b.manager.SeeUser),
+		RateLimit(rate, burst),
+	)
+
+	r.Command("start", "Главное меню", onMessage(b.handleStart))
+	r.Command("help", "Правила игры", onMessage(func(message *tgbotapi.Message) {
+		b.handleHelp(message.Chat.ID)
+	}))
+	r.Command("quit", "Покинуть текущую игру", onMessage(b.handleQuit))
+	r.Command("status", "Состояние текущей игры и кнопки хода", onMessage(b.handleStatus))
+	r.Command("history", "Раунды текущей игры", onMessage(b.handleHistory))
+	r.Command("lobby", "Открытые игры", onMessage(b.handleLobby))
+	r.Command("challenge", "Вызвать игрока на игру", onMessage(b.handleChallenge))
+	r.Command("invites", "Ваши открытые приглашения", onMessage(b.handleInvites))
+	r.Command("leaderboard", "Таблица лидеров группы", onMessage(b.handleLeaderboard))
+	r.Command("groupsettings", "Настройки вызовов в группе", onMessage(b.handleGroupSettings))
+	r.Command("tournament", "Создать турнир", onMessage(b.handleTournament))
+	r.Command("standings", "Таблица вашего турнира", onMessage(b.handleStandings))
+	r.Command("season", "Рейтинг сезона", onMessage(b.handleSeason))
+	r.Command("profile", "Ваша статистика или профиль другого игрока", onMessage(b.handleProfile))
+	r.Command("export", "Скачать запись последней игры", onMessage(b.handleExport))
+	r.Command("style", "На какую стратегию похож ваш стиль", onMessage(b.handleStyle))
+	r.Command("analyze", "Анализ вашей стратегии memory-one", onMessage(b.handleAnalyze))
+
+	// Admin commands stay out of the public menu.
+	r.Command("policy", "", onMessage(b.handlePolicy))
+	r.Command("ban", "", onMessage(b.handleBan))
+	r.Command("unban", "", onMessage(b.handleUnban))
+	r.Command("startseason", "", onMessage(b.handleStartSeason))
+	r.Command("endseason", "", onMessage(b.handleEndSeason))
+	r.Command("replay", "", onMessage(b.handleReplay))
+
+	r.Text("🚀 Создать новую игру", onMessage(b.handleNewGame))
+	r.Text("🌐 Открытые игры", onMessage(b.handleLobby))
+	r.Text("🤖 Играть с ботом", onMessage(b.handleBotGame))
+	r.Text("👤 Профиль", onMessage(b.handleProfile))
+	r.Text("❓ Помощь", onMessage(func(message *tgbotapi.Message) {
+		b.handleHelp(message.Chat.ID)
+	}))
+
+	r.Callback(callback.Prefix(callback.ActionRounds), b.onButton(b.handleRoundSelection))
+	r.Callback(callback.Prefix(callback.ActionForm), b.onButton(b.handleFormChange))
+	r.Callback(callback.Prefix(callback.ActionJoin), b.onButton(b.handleJoin))
+	r.Callback(callback.Prefix(callback.ActionLobby), b.onButton(b.handleLobbyPage))
+	r.Callback(callback.Prefix(callback.ActionUnwatch), b.onButton(b.handleUnwatch))
+	r.Callback(callback.Prefix(callback.ActionGroup), b.onButton(b.handleGroupSettingsChange))
+	r.Callback(callback.Prefix(callback.ActionAccept), b.handleInlineAccept)
+	r.Callback(callback.Prefix(callback.ActionTourForm), b.onButton(b.handleTournamentForm))
+	r.Callback(callback.Prefix(callback.ActionTourNew), b.onButton(b.handleTournamentCreate))
+	r.Callback(callback.Prefix(callback.ActionTourStart), b.onButton(b.handleTournamentStart))
+	r.Callback(callback.Prefix(callback.ActionTourStop), b.onButton(b.handleTournamentCancel))
+	r.Callback(callback.Prefix(callback.ActionTourLeave), b.onButton(b.handleTournamentLeave))
+	r.Callback(callback.Prefix(callback.ActionExport), b.onButton(b.handleExportButton))
+	r.Callback(callback.Prefix(callback.ActionCancel), b.onButton(b.handleCancelInvite))
+	r.Callback(callback.Prefix(callback.ActionMove), b.onButton(b.handleGameChoice))
+	r.Callback(callback.Prefix(callback.ActionRematch), b.onButton(b.handleRematchChoice))
+	r.Callback(callback.Prefix(callback.ActionOpponent), b.onButton(b.handleOpponentSelection))
+	r.Callback(callback.Prefix(callback.ActionBotRounds), b.onButton(b.handleBotRoundsSelection))
+	// Anything else is a button from an older version of the bot.
+	r.Callback("", onCallback(b.expireButton))
+
+	r.InlineQuery(b.handleInlineQuery)
+	r.ChosenInlineResult(b.handleChosenInvite)
+
+	r.NotFound(func(c *Context) {
+		c.Reply(unknownCommandText, nil)
+	})
+	return r
+}
+
+// onMessage adapts a message handler to the router.
+func onMessage(handle func(message *tgbotapi.Message)) HandlerFunc {
+	return func(c *Context) {
+		handle(c.Message)
+	}
+}
+
+// onCallback adapts an inline button handler to the router. The press is
+// acknowledged first so the client stops its loading indicator right away.
+func onCallback(handle func(cb *tgbotapi.CallbackQuery)) HandlerFunc {
+	return func(c *Context) {
+		c.Answer("")
+		handle(c.Callback)
+	}
+}
+
+// onButton is onCallback for signed buttons: the payload is verified and
+// decoded first, and buttons that fail verification are marked expired. In
+// group chats the buttons belong to whoever they were made for, so presses by
+// anyone else are turned away without touching the message.
+func (b *Bot) onButton(handle func(cb *tgbotapi.CallbackQuery, data callback.Data)) HandlerFunc {
+	return func(c *Context) {
+		cb := c.Callback
+		data, err := b.flow.Codec().Decode(cb.From.ID, cb.Data)
+		if err != nil {
+			log.Printf("Rejected button %q from user %d: %v", cb.Data, cb.From.ID, err)
+			if cb.Message != nil && !cb.Message.Chat.IsPrivate() {
+				c.Answer("Эта кнопка не для вас.")
+				return
+			}
+			c.Answer("")
+			b.expireButton(cb)
+			return
+		}
+		c.Answer("")
+		handle(cb, data)
+	}
+}
+
+func (b *Bot) expireButton(cb *tgbotapi.CallbackQuery) {
+	b.edit(callbackRef(cb), flow.ExpiredText, nil)
+}
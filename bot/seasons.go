@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/game"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleSeason shows the standings of the current season, or of season n with /season <n>.
+func (b *Bot) handleSeason(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	arg := strings.TrimSpace(message.CommandArguments())
+	var season *game.Season
+	var err error
+	if arg == "" {
+		season, err = b.manager.CurrentSeason()
+		if err == nil && season != nil {
+			season, err = b.manager.SeasonByNumber(season.Number)
+		}
+	} else {
+		n, convErr := strconv.Atoi(arg)
+		if convErr != nil || n <= 0 {
+			b.reply(chatID, "Использование: /season или /season <номер сезона>", nil)
+			return
+		}
+		season, err = b.manager.SeasonByNumber(n)
+	}
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	if season == nil {
+		b.reply(chatID, "Сезоны еще не начинались. Пока рейтинг считается за все время.", nil)
+		return
+	}
+	b.reply(chatID, seasonText(season), nil)
+}
+
+// seasonText shows a season's standings: the final ones with medals once it
+// is over, the standings so far while it runs.
+func seasonText(season *game.Season) string {
+	var sb strings.Builder
+	if season.Running() {
+		fmt.Fprintf(&sb, "📅 Сезон %d идет с %s", season.Number, season.StartedAt.Format("02.01.2006"))
+		if !season.EndsAt.IsZero() {
+			fmt.Fprintf(&sb, " до %s", season.EndsAt.Format("02.01.2006 15:04"))
+		}
+		sb.WriteString("\n")
+	} else {
+		fmt.Fprintf(&sb, "📜 Итоги сезона %d (%s — %s)\n", season.Number,
+			season.StartedAt.Format("02.01.2006"), season.EndedAt.Format("02.01.2006"))
+	}
+	if len(season.Standings) == 0 {
+		sb.WriteString("\nВ этом сезоне не сыграно ни одной рейтинговой игры.")
+		return sb.String()
+	}
+	for _, s := range season.Standings {
+		if s.Place > leaderboardSize {
+			break
+		}
+		place := strconv.Itoa(s.Place) + "."
+		if !season.Running() && s.Place <= game.SeasonPodium {
+			place = game.Title{Season: season.Number, Place: s.Place}.Medal()
+		}
+		fmt.Fprintf(&sb, "\n%s %s — ⭐ %d (побед: %d, ничьих: %d, поражений: %d)",
+			place, seasonName(s), s.Rating, s.Wins, s.Draws, s.Losses)
+	}
+	return sb.String()
+}
+
+// seasonName is how a player is shown in season standings.
+func seasonName(s game.SeasonStanding) string {
+	if s.Username == "" {
+		return "ID " + strconv.FormatInt(s.PlayerID, 10)
+	}
+	return s.Username
+}
+
+// handleStartSeason lets an admin start the next season, optionally on a
+// schedule: /startseason [weekly|monthly].
+func (b *Bot) handleStartSeason(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if !b.admins[message.From.ID] {
+		b.reply(chatID, unknownCommandText, nil)
+		return
+	}
+	schedule := strings.TrimSpace(message.CommandArguments())
+	if !game.ValidSchedule(schedule) {
+		b.reply(chatID, "Использование: /startseason [weekly|monthly]", nil)
+		return
+	}
+	season, err := b.manager.StartSeason(schedule, time.Now())
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	end := "до команды /endseason"
+	if !season.EndsAt.IsZero() {
+		end = "до " + season.EndsAt.Format("02.01.2006 15:04")
+	}
+	b.reply(chatID, fmt.Sprintf("📅 Сезон %d начался и продлится %s. Рейтинги игроков наполовину приближены к %d.",
+		season.Number, end, game.DefaultRating), nil)
+}
+
+// handleEndSeason lets an admin end the running season.
+func (b *Bot) handleEndSeason(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if !b.admins[message.From.ID] {
+		b.reply(chatID, unknownCommandText, nil)
+		return
+	}
+	season, err := b.manager.EndSeason(time.Now())
+	if err != nil {
+		b.reply(chatID, err.Error(), nil)
+		return
+	}
+	b.reply(chatID, seasonText(season), nil)
+	b.announceSeasonEnd(season)
+}
+
+// announceSeasonEnd congratulates the top finishers of a season on their titles.
+func (b *Bot) announceSeasonEnd(season *game.Season) {
+	for _, s := range season.Standings {
+		if s.Place > game.SeasonPodium {
+			break
+		}
+		title := game.Title{Season: season.Number, Place: s.Place}
+		b.reply(s.PlayerID, fmt.Sprintf("🏁 Сезон %d окончен! Вы заняли %d-е место с рейтингом %d и получаете титул «%s».",
+			season.Number, s.Place, s.Rating, title), nil)
+	}
+}
+
+// runSeasons ends scheduled seasons on time and starts the next ones, checking
+// every interval until the bot stops.
+func (b *Bot) runSeasons(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			ended, started, err := b.manager.SeasonTick(now)
+			if err != nil {
+				log.Printf("Failed to move seasons along: %v", err)
+				continue
+			}
+			if ended != nil {
+				b.announceSeasonEnd(ended)
+			}
+			if started != nil {
+				log.Printf("Season %d started", started.Number)
+			}
+		case <-b.stopping:
+			return
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package bot_test
+
+import (
+	"prisoners-dilemma-bot/game"
+	"testing"
+)
+
+func TestSeasons(t *testing.T) {
+	h := newHarness(t, Options{Admins: []int64{999}})
+	admin := h.User(999, "admin")
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+
+	alice.Send("/startseason")
+	if _, err := h.WaitText(alice, "Неизвестная команда"); err != nil {
+		t.Fatal(err)
+	}
+	admin.Send("/startseason")
+	if _, err := h.WaitText(admin, "Сезон 1 начался"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Хотите реванш?"); err != nil {
+		t.Fatal(err)
+	}
+	carol.Send("/season")
+	for _, line := range []string{"Сезон 1 идет", "1. alice — ⭐ 1216 (побед: 1, ничьих: 0, поражений: 0)", "2. bob — ⭐ 1184 (побед: 0, ничьих: 0, поражений: 1)"} {
+		if _, err := h.WaitText(carol, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin.Send("/endseason")
+	if _, err := h.WaitText(alice, "титул «🥇 Чемпион сезона 1»"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(bob, "титул «🥈 Серебряный призер сезона 1»"); err != nil {
+		t.Fatal(err)
+	}
+	carol.Send("/season 1")
+	if _, err := h.WaitText(carol, "🥇 alice — ⭐ 1216"); err != nil {
+		t.Fatal(err)
+	}
+	carol.Send("/season 7")
+	if _, err := h.WaitText(carol, "сезона 7 не было"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next season pulls ratings halfway back and starts the record over.
+	admin.Send("/startseason weekly")
+	if _, err := h.WaitText(admin, "Сезон 2 начался"); err != nil {
+		t.Fatal(err)
+	}
+	rating, err := h.Manager.PlayerRating(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating.Points() != game.DefaultRating+8 || rating.SeasonGames() != 0 || rating.Badge() != "🥇" {
+		t.Fatalf("alice is rated %d with %d season games and badge %q, want %d, 0 and 🥇",
+			rating.Points(), rating.SeasonGames(), rating.Badge(), game.DefaultRating+8)
+	}
+	carol.Send("/season")
+	_, err = h.WaitText(carol, "не сыграно ни одной рейтинговой игры")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// spectateURL is the deep link that starts watching a game.
+func (b *Bot) spectateURL(spectateID string) string {
+	return fmt.Sprintf("https://t.me/%s?start=watch_%s", b.api.Self.UserName, spectateID)
+}
+
+// handleWatch makes the user a spectator of the game behind a spectate link.
+func (b *Bot) handleWatch(spectateID string, message *tgbotapi.Message) {
+	session, err := b.manager.Spectate(spectateID, message.From.ID)
+	if err != nil {
+		b.reply(message.Chat.ID, err.Error(), nil)
+		return
+	}
+
+	pA, pB := session.PlayerA, session.PlayerB
+	text := fmt.Sprintf("👁 Вы смотрите игру %s — %s.\n\nРаунд %d из %d, счет %d:%d.\n"+
+		"Результаты раундов будут приходить сюда, как только оба игрока сделают ход.",
+		pA.Username, pB.Username, session.CurrentRound, session.TotalRounds, pA.Score, pB.Score)
+	b.reply(message.Chat.ID, text, utils.SpectatorKeyboard(b.flow.Codec(), message.From.ID, spectateID))
+}
+
+// handleUnwatch stops sending a game's results to a spectator.
+func (b *Bot) handleUnwatch(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	if err := b.manager.StopSpectating(data.Arg, cb.From.ID); err != nil {
+		b.edit(callbackRef(cb), err.Error(), nil)
+		return
+	}
+	b.edit(callbackRef(cb), "🚪 Вы больше не смотрите эту игру.", nil)
+}
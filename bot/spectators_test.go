@@ -0,0 +1,80 @@
+package bot_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpectators(t *testing.T) {
+	h := newHarness(t, Options{MaxSpectators: 1})
+	alice, bob := players(h)
+	carol, dave := h.User(303, "carol"), h.User(404, "dave")
+	inviteID, err := h.CreateInvite(alice, gameRounds, "Зрители")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(bob, inviteID); err != nil {
+		t.Fatal(err)
+	}
+	start, err := h.WaitText(bob, "Ссылка для зрителей")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.Index(start.Text, "start=")
+	if i < 0 {
+		t.Fatalf("no spectate link in %q", start.Text)
+	}
+	watch := "/start " + strings.Fields(start.Text[i+len("start="):])[0]
+
+	carol.Send(watch)
+	watching, err := h.WaitText(carol, "Вы смотрите игру")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave.Send(watch)
+	if _, err := h.WaitText(dave, "максимальное число зрителей"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A move alone reveals nothing; the report comes once both are in.
+	if err := h.Move(alice, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.CountText(carol, "👁 Раунд 1 из"); n != 0 {
+		t.Fatalf("spectator saw round 1 before both moves")
+	}
+	if err := h.Move(bob, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(carol, "Счет: alice 5 — 0 bob"); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := h.Prompt(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt.Text, "Зрителей: 1") {
+		t.Fatalf("round prompt doesn't show the spectators: %q", prompt.Text)
+	}
+
+	// Carol leaves, which makes room for dave.
+	if _, err := carol.PressText(watching, "Перестать смотреть"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(carol, "больше не смотрите"); err != nil {
+		t.Fatal(err)
+	}
+	dave.Send(watch)
+	if _, err := h.WaitText(dave, "Вы смотрите игру"); err != nil {
+		t.Fatal(err)
+	}
+	if err := playOut(h, alice, bob, gameRounds-1, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(dave, "Игра окончена"); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.CountText(carol, "👁 Раунд"); n != 1 {
+		t.Fatalf("carol got %d round reports, want only the one before she left", n)
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const notInGameText = "Вы сейчас не в игре."
+
+// handleHistory shows the rounds played so far in the player's current game.
+func (b *Bot) handleHistory(message *tgbotapi.Message) {
+	session, ok := b.manager.FindSessionByPlayerID(message.From.ID)
+	if !ok {
+		b.reply(message.Chat.ID, notInGameText, nil)
+		return
+	}
+	player, _ := sessionPlayers(session, message.From.ID)
+	b.reply(message.Chat.ID, strings.TrimSuffix(session.GetHistorySummary(message.From.ID), "\n")+game.ScoreLine(session, player), nil)
+}
+
+// handleStatus shows where the player's current game stands. A player who
+// hasn't moved in the current round gets the move buttons again, in case
+// they lost the prompt.
+func (b *Bot) handleStatus(message *tgbotapi.Message) {
+	session, ok := b.manager.FindSessionByPlayerID(message.From.ID)
+	if !ok {
+		b.reply(message.Chat.ID, notInGameText, nil)
+		return
+	}
+	player, _ := sessionPlayers(session, message.From.ID)
+	text := statusText(session, message.From.ID, time.Now())
+	if session.State == models.StateInProgress && player.CurrentChoice == models.ChoiceNone {
+		keyboard := utils.ChoiceKeyboard(b.flow.Codec(), player.ID, session.GameID, session.CurrentRound)
+		b.reply(message.Chat.ID, text+"\n\nВаш ход?", keyboard)
+		return
+	}
+	b.reply(message.Chat.ID, text, nil)
+}
+
+// statusText is where a game stands for the given player at now: the round,
+// the score, whether the opponent has moved and how long is left to move.
+func statusText(session *models.Session, playerID int64, now time.Time) string {
+	player, opponent := sessionPlayers(session, playerID)
+	if session.State != models.StateInProgress {
+		return "🏁 Игра окончена." + game.ScoreLine(session, player)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🎲 Раунд %d из %d\n", session.CurrentRound, session.TotalRounds)
+	if player.CurrentChoice != models.ChoiceNone {
+		fmt.Fprintf(&sb, "Ваш ход: %s\n", game.ChoiceName(player.CurrentChoice))
+	}
+	if opponent.CurrentChoice != models.ChoiceNone {
+		fmt.Fprintf(&sb, "✅ %s уже сделал ход.\n", opponent.Username)
+	} else {
+		fmt.Fprintf(&sb, "⏳ %s еще не сделал ход.\n", opponent.Username)
+	}
+	left := session.TurnDeadline.Sub(now)
+	if left < 0 {
+		left = 0
+	}
+	fmt.Fprintf(&sb, "⏰ До конца хода: %s", formatLeft(left))
+	return sb.String() + game.ScoreLine(session, player)
+}
+
+// sessionPlayers returns the player with the given ID and their opponent.
+func sessionPlayers(session *models.Session, playerID int64) (*models.Player, *models.Player) {
+	if session.PlayerB.ID == playerID {
+		return session.PlayerB, session.PlayerA
+	}
+	return session.PlayerA, session.PlayerB
+}
+
+// formatLeft is the time left to move, to the second.
+func formatLeft(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds < 60 {
+		return fmt.Sprintf("%d сек", seconds)
+	}
+	return fmt.Sprintf("%d мин %d сек", seconds/60, seconds%60)
+}
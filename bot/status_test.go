@@ -0,0 +1,73 @@
+package bot_test
+
+import (
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirstRoundTimeout(t *testing.T) {
+	h := newHarness(t, Options{TurnTimeout: 300 * time.Millisecond})
+	alice, bob := players(h)
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	// The clock runs from the first prompt, not from the first move.
+	if err := h.Move(alice, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Время вышло! bob слишком долго не делал ход."); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusAndHistory(t *testing.T) {
+	h := newHarness(t, Options{})
+	alice, bob := players(h)
+	carol := h.User(303, "carol")
+	if err := h.StartGame(alice, bob, gameRounds); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PlayRound(alice, bob, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(bob, true); err != nil {
+		t.Fatal(err)
+	}
+
+	bob.Send("/status")
+	for _, line := range []string{"🎲 Раунд 2 из 10", "Ваш ход: " + game.ChoiceName(models.ChoiceNegotiate), "⏳ alice еще не сделал ход", "- Вы: 0"} {
+		if _, err := h.WaitText(bob, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Alice lost her prompt; the status brings the buttons back.
+	alice.Send("/status")
+	status, err := h.WaitText(alice, "✅ bob уже сделал ход")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status.Text, "⏰ До конца хода") || status.Keyboard.ButtonByText("🤝") == nil {
+		t.Fatalf("status %q has no time left or move buttons", status.Text)
+	}
+	if _, err := alice.PressText(status, "🤝"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "Вы оба выбрали сотрудничество"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice.Send("/history")
+	for _, line := range []string{"Р1: вы 😈 +5, соперник 😇 +0", "Р2: вы 😇 +3, соперник 😇 +3", "- Вы: 8"} {
+		if _, err := h.WaitText(alice, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	carol.Send("/status")
+	_, err = h.WaitText(carol, "Вы сейчас не в игре")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
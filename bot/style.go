@@ -0,0 +1,24 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/game"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleStyle shows the player's playing style across all finished games.
+func (b *Bot) handleStyle(message *tgbotapi.Message) {
+	style, err := b.manager.PlayerStyle(message.From.ID)
+	if err != nil {
+		b.reply(message.Chat.ID, err.Error(), nil)
+		return
+	}
+	if style.Games == 0 {
+		b.reply(message.Chat.ID, "Вы ещё не завершили ни одной игры.", nil)
+		return
+	}
+
+	header := fmt.Sprintf("🧬 Ваш стиль игры (игр: %d)\n\n", style.Games)
+	b.reply(message.Chat.ID, header+game.FormatFits(style.Fits.Ranked()), nil)
+}
@@ -0,0 +1,284 @@
+package bot
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultTournamentInterval is how often tournaments are checked for rounds to start.
+const DefaultTournamentInterval = 10 * time.Second
+
+// tournamentURL is the deep link that registers a player for a tournament.
+func (b *Bot) tournamentURL(id string) string {
+	return fmt.Sprintf("https://t.me/%s?start=tour_%s", b.api.Self.UserName, id)
+}
+
+// handleTournament opens the new tournament form.
+func (b *Bot) handleTournament(message *tgbotapi.Message) {
+	form := utils.NewTournamentForm()
+	b.reply(message.Chat.ID, b.tournamentFormText(form), utils.TournamentFormKeyboard(b.flow.Codec(), message.From.ID, form))
+}
+
+// tournamentFormText describes the settings picked so far in the new tournament form.
+func (b *Bot) tournamentFormText(form utils.TournamentForm) string {
+	settings := form.Settings(0, time.Now())
+	start := "вручную, кнопкой организатора"
+	if form.StartIn > 0 {
+		start = "через " + formatWait(form.StartIn) + " после создания"
+	}
+	return fmt.Sprintf("🏆 Новый турнир\n\n%s\n%s\n%s\n🕒 Начало: %s\n\nСколько раундов длится каждый матч?",
+		formatText(settings.Format), scoringText(settings.Scoring), b.rulesText(settings.Payoff, settings.TurnTimeout), start)
+}
+
+// handleTournamentForm redraws the new tournament form after a setting was changed.
+func (b *Bot) handleTournamentForm(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	form, err := utils.ParseTournamentForm(data.Arg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	b.edit(callbackRef(cb), b.tournamentFormText(form), utils.TournamentFormKeyboard(b.flow.Codec(), cb.From.ID, form))
+}
+
+// handleTournamentCreate opens registration for a tournament with the settings
+// of the form and turns the form into the organizer's control panel.
+func (b *Bot) handleTournamentCreate(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	roundsArg, formArg, _ := strings.Cut(data.Arg, "/")
+	rounds, err := strconv.Atoi(roundsArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+	form, err := utils.ParseTournamentForm(formArg)
+	if err != nil {
+		b.edit(callbackRef(cb), flow.ExpiredText, nil)
+		return
+	}
+
+	t, err := b.manager.CreateTournament(cb.From.ID, cb.From.UserName, form.Settings(rounds, time.Now()))
+	if err != nil {
+		b.reply(cb.From.ID, "❌ Не удалось создать турнир: "+err.Error(), nil)
+		return
+	}
+	text := fmt.Sprintf("🏆 Турнир #%s создан!\n\n%s\n\nПерешлите игрокам ссылку для регистрации:\n%s",
+		t.ID, b.tournamentText(t), b.tournamentURL(t.ID))
+	b.edit(callbackRef(cb), text, utils.TournamentKeyboard(b.flow.Codec(), cb.From.ID, t.ID, b.tournamentURL(t.ID)))
+}
+
+// tournamentText describes the settings of a tournament.
+func (b *Bot) tournamentText(t *models.Tournament) string {
+	start := "когда организатор нажмет «Начать турнир»"
+	if !t.StartAt.IsZero() {
+		start = t.StartAt.Format("15:04") + " (через " + formatWait(time.Until(t.StartAt)) + ")"
+	}
+	return fmt.Sprintf("%s\n%s\n🎲 Матчи на %s\n%s\n🕒 Начало: %s",
+		formatText(t.Format), scoringText(t.Scoring), roundsText(t.Rounds), b.rulesText(t.Payoff, t.TurnTimeout), start)
+}
+
+func formatText(format models.TournamentFormat) string {
+	if format == models.FormatRoundRobin {
+		return "🔁 Формат: круговой, каждый играет с каждым"
+	}
+	return "🇨🇭 Формат: швейцарская система"
+}
+
+func scoringText(scoring models.TournamentScoring) string {
+	if scoring == models.ScoreByWins {
+		return "🏅 Места: по числу побед в матчах"
+	}
+	return "💯 Места: по сумме очков"
+}
+
+// handleTournamentJoin registers the user who opened a tournament's link.
+func (b *Bot) handleTournamentJoin(id string, message *tgbotapi.Message) {
+	t, err := b.manager.JoinTournament(id, message.From.ID, message.From.UserName)
+	if err != nil {
+		b.reply(message.Chat.ID, err.Error(), nil)
+		return
+	}
+	text := fmt.Sprintf("✅ Вы зарегистрированы в турнире #%s!\n\n%s\n\nКогда турнир начнется, бот сам пришлет вам соперника для каждого тура.",
+		t.ID, b.tournamentText(t))
+	b.reply(message.Chat.ID, text, utils.TournamentEntryKeyboard(b.flow.Codec(), message.From.ID, t.ID))
+	if t.OrganizerID != message.From.ID {
+		b.reply(t.OrganizerID, fmt.Sprintf("➕ %s зарегистрировался в турнире #%s. Игроков: %d.",
+			displayName(message.From), t.ID, len(t.Players)), nil)
+	}
+}
+
+// handleTournamentLeave withdraws a player before the tournament starts.
+func (b *Bot) handleTournamentLeave(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	t, err := b.manager.LeaveTournament(data.Arg, cb.From.ID)
+	if err != nil {
+		b.edit(callbackRef(cb), err.Error(), nil)
+		return
+	}
+	b.edit(callbackRef(cb), fmt.Sprintf("🚪 Вы отказались от участия в турнире #%s.", t.ID), nil)
+	if t.OrganizerID != cb.From.ID {
+		b.reply(t.OrganizerID, fmt.Sprintf("➖ %s отказался от участия в турнире #%s. Игроков: %d.",
+			displayName(cb.From), t.ID, len(t.Players)), nil)
+	}
+}
+
+// handleTournamentStart starts a tournament at its organizer's request.
+func (b *Bot) handleTournamentStart(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	update, err := b.manager.StartTournament(data.Arg, cb.From.ID)
+	if err != nil {
+		b.edit(callbackRef(cb), err.Error(), nil)
+		return
+	}
+	if update.Tournament.State == models.TournamentCancelled {
+		b.edit(callbackRef(cb), fmt.Sprintf("❌ Турнир #%s отменен: зарегистрировалось меньше двух игроков.", update.Tournament.ID), nil)
+	} else {
+		b.edit(callbackRef(cb), fmt.Sprintf("▶️ Турнир #%s начался! Игроков: %d.", update.Tournament.ID, len(update.Tournament.Players)), nil)
+	}
+	b.announceTournament(*update)
+}
+
+// handleTournamentCancel calls off a tournament at its organizer's request.
+func (b *Bot) handleTournamentCancel(cb *tgbotapi.CallbackQuery, data callback.Data) {
+	t, err := b.manager.CancelTournament(data.Arg, cb.From.ID)
+	if err != nil {
+		b.edit(callbackRef(cb), err.Error(), nil)
+		return
+	}
+	text := fmt.Sprintf("❌ Турнир #%s отменен организатором.", t.ID)
+	b.edit(callbackRef(cb), text, nil)
+	for _, p := range t.Players {
+		if p.ID != t.OrganizerID {
+			b.reply(p.ID, text, nil)
+		}
+	}
+}
+
+// handleStandings shows the standings of the latest tournament the user takes part in.
+func (b *Bot) handleStandings(message *tgbotapi.Message) {
+	t, ok := b.manager.PlayerTournament(message.From.ID)
+	if !ok {
+		b.reply(message.Chat.ID, "Вы не участвуете ни в одном турнире. Создайте свой командой /tournament!", nil)
+		return
+	}
+	var header string
+	switch t.State {
+	case models.TournamentRegistering:
+		header = fmt.Sprintf("📝 Турнир #%s еще не начался. Игроков: %d.\n\n%s", t.ID, len(t.Players), b.tournamentText(t))
+		b.reply(message.Chat.ID, header, nil)
+		return
+	case models.TournamentCancelled:
+		b.reply(message.Chat.ID, fmt.Sprintf("❌ Турнир #%s отменен.", t.ID), nil)
+		return
+	case models.TournamentFinished:
+		header = fmt.Sprintf("🏁 Турнир #%s завершен. Итоговая таблица:", t.ID)
+	default:
+		header = fmt.Sprintf("🏆 Турнир #%s, идет тур %d из %d.", t.ID, t.Round, t.TotalRounds)
+	}
+	b.reply(message.Chat.ID, header+"\n\n"+standingsText(t.Scoring, t.Standings()), nil)
+}
+
+// standingsText lists a tournament's players from first place down.
+func standingsText(scoring models.TournamentScoring, standings []models.TournamentPlayer) string {
+	var sb strings.Builder
+	sb.WriteString(scoringText(scoring))
+	for i, p := range standings {
+		fmt.Fprintf(&sb, "\n%d. %s — побед: %d, ничьих: %d, поражений: %d (очков: %d)",
+			i+1, tournamentName(p), p.Wins, p.Draws, p.Losses, p.Points)
+	}
+	return sb.String()
+}
+
+func tournamentName(p models.TournamentPlayer) string {
+	if p.Username == "" {
+		return "ID " + strconv.FormatInt(p.ID, 10)
+	}
+	return p.Username
+}
+
+// runTournaments moves tournaments along every interval until the bot stops.
+func (b *Bot) runTournaments(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, update := range b.manager.TournamentTick(now) {
+				b.announceTournament(update)
+			}
+		case <-b.stopping:
+			return
+		}
+	}
+}
+
+// announceTournament tells everyone in a tournament what changed: standings
+// after a pairing round, the final result, or the pairings of the next round.
+// Players of new matches get their first move prompt.
+func (b *Bot) announceTournament(u game.TournamentUpdate) {
+	t := u.Tournament
+	everyone := func(text string) {
+		organizerPlays := false
+		for _, p := range t.Players {
+			b.reply(p.ID, text, nil)
+			organizerPlays = organizerPlays || p.ID == t.OrganizerID
+		}
+		if !organizerPlays {
+			b.reply(t.OrganizerID, text, nil)
+		}
+	}
+
+	if t.State == models.TournamentCancelled {
+		everyone(fmt.Sprintf("❌ Турнир #%s отменен: к началу зарегистрировалось меньше двух игроков.", t.ID))
+		return
+	}
+	if u.Completed > 0 {
+		if t.State == models.TournamentFinished {
+			everyone(fmt.Sprintf("🏁 Турнир #%s завершен! Победитель — %s 🏆\n\n%s",
+				t.ID, tournamentName(u.Standings[0]), standingsText(t.Scoring, u.Standings)))
+		} else {
+			everyone(fmt.Sprintf("📊 Турнир #%s: таблица после тура %d из %d\n\n%s",
+				t.ID, u.Completed, t.TotalRounds, standingsText(t.Scoring, u.Standings)))
+		}
+	}
+	if u.Started == 0 {
+		return
+	}
+
+	names := make(map[int64]string, len(t.Players))
+	for _, p := range t.Players {
+		names[p.ID] = tournamentName(p)
+	}
+	tour := fmt.Sprintf("🏆 Турнир #%s, тур %d из %d", t.ID, u.Started, t.TotalRounds)
+	for _, p := range t.RoundPairings(u.Started) {
+		switch {
+		case p.IsBye():
+			b.reply(p.PlayerA, tour+": в этом туре у вас нет соперника — вам засчитана победа.", nil)
+		case p.Done:
+			// Seated against a player who was busy in another game.
+			for _, side := range []struct {
+				id, opponent int64
+				forfeit      bool
+			}{{p.PlayerA, p.PlayerB, p.ForfeitA}, {p.PlayerB, p.PlayerA, p.ForfeitB}} {
+				if side.forfeit {
+					b.reply(side.id, tour+": к началу тура вы были заняты в другой игре, поэтому вам засчитано поражение.", nil)
+				} else {
+					b.reply(side.id, fmt.Sprintf("%s: %s был занят в другой игре — вам засчитана победа.", tour, names[side.opponent]), nil)
+				}
+			}
+		}
+	}
+	for _, session := range u.Matches {
+		rules := fmt.Sprintf("Игра на %s начинается!\n\n%s", roundsText(session.TotalRounds), b.rulesText(session.Payoff, session.TurnTimeout))
+		b.reply(session.PlayerA.ID, fmt.Sprintf("%s: ваш соперник — %s. %s", tour, names[session.PlayerB.ID], rules), nil)
+		b.reply(session.PlayerB.ID, fmt.Sprintf("%s: ваш соперник — %s. %s", tour, names[session.PlayerA.ID], rules), nil)
+		b.flow.PromptNextRound(session)
+		// A player who never shows up loses the match when their move time runs out.
+		b.flow.SetupTurnTimer(session)
+	}
+}
@@ -0,0 +1,176 @@
+package bot_test
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTournament(t *testing.T) {
+	h := newHarness(t, Options{TournamentTick: 20 * time.Millisecond})
+	alice, bob := players(h)
+	carol, dave := h.User(303, "carol"), h.User(404, "dave")
+	id, err := h.CreateTournament(alice, 5, "Круговая", "По победам")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{alice, bob, carol, dave} {
+		u.Send("/start tour_" + id)
+		if _, err := h.WaitText(u, "Вы зарегистрированы"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// dave changes his mind before the start.
+	entry, err := h.WaitText(dave, "Вы зарегистрированы")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dave.PressText(entry, "Отказаться"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(alice, "dave отказался"); err != nil {
+		t.Fatal(err)
+	}
+
+	panel, err := h.WaitText(alice, "Турнир #"+id+" создан")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PressText(panel, "Начать турнир"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three players play three tours, each sitting out once. Of the two players
+	// in a match, the one registered first defects and the other cooperates.
+	users := map[int64]*User{alice.ID: alice, bob.ID: bob, carol.ID: carol}
+	for tour := 1; tour <= 3; tour++ {
+		var state *models.Tournament
+		_, err := alice.WaitFor(h.Wait, func(Message) bool {
+			state, _ = h.Manager.Tournament(id)
+			return state.Round == tour
+		})
+		if err != nil {
+			t.Fatalf("tour %d never started: %v", tour, err)
+		}
+		for _, p := range state.RoundPairings(tour) {
+			a, b := users[p.PlayerA], users[p.PlayerB]
+			if p.IsBye() {
+				if _, err := h.WaitText(a, fmt.Sprintf("тур %d из 3: в этом туре у вас нет соперника", tour)); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			if _, err := h.WaitText(a, fmt.Sprintf("тур %d из 3: ваш соперник — %s", tour, b.Username)); err != nil {
+				t.Fatal(err)
+			}
+			if a.ID > b.ID {
+				a, b = b, a
+			}
+			if err := playOut(h, a, b, 5, false, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tour < 3 {
+			for _, u := range users {
+				if _, err := h.WaitText(u, fmt.Sprintf("таблица после тура %d из 3", tour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	for _, u := range users {
+		if _, err := h.WaitText(u, "Турнир #"+id+" завершен! Победитель — alice"); err != nil {
+			t.Fatal(err)
+		}
+		if n := h.CountText(u, "Хотите реванш?"); n != 0 {
+			t.Fatalf("%s was offered %d rematches of tournament games", u.Username, n)
+		}
+	}
+	if n := h.CountText(dave, "Турнир #"+id+" завершен"); n != 0 {
+		t.Fatalf("dave withdrew but got the final standings")
+	}
+	carol.Send("/standings")
+	standings, err := h.WaitText(carol, "Итоговая таблица")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"1. alice — побед: 3", "2. bob — побед: 2", "3. carol — побед: 1"} {
+		if !strings.Contains(standings.Text, line) {
+			t.Fatalf("standings miss %q:\n%s", line, standings.Text)
+		}
+	}
+}
+
+func TestTournamentNoShow(t *testing.T) {
+	h := newHarness(t, Options{TurnTimeout: 300 * time.Millisecond, TournamentTick: 20 * time.Millisecond})
+	organizer, bob := players(h)
+	carol, dave, erin, frank := h.User(303, "carol"), h.User(404, "dave"), h.User(505, "erin"), h.User(606, "frank")
+	id, err := h.CreateTournament(organizer, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{bob, carol, dave, erin} {
+		u.Send("/start tour_" + id)
+		if _, err := h.WaitText(u, "Вы зарегистрированы"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// erin is still busy in another game when the tournament starts; it has
+	// its own move time so it outlasts the tournament's.
+	inviteID, err := h.CreateInvite(erin, gameRounds, "30 сек")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Accept(frank, inviteID); err != nil {
+		t.Fatal(err)
+	}
+	panel, err := h.WaitText(organizer, "Турнир #"+id+" создан")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := organizer.PressText(panel, "Начать турнир"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tour one pairs bob with carol and dave with erin, in registration order.
+	if _, err := h.WaitText(erin, "тур 1 из 2: к началу тура вы были заняты"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(dave, "тур 1 из 2: erin был занят"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(carol, "тур 1 из 2: ваш соперник — bob"); err != nil {
+		t.Fatal(err)
+	}
+	// carol never moves and loses on time.
+	if err := h.Move(bob, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.WaitText(carol, "Время вышло"); err != nil {
+		t.Fatal(err)
+	}
+	standings, err := h.WaitText(organizer, "таблица после тура 1 из 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"bob — побед: 1", "carol — побед: 0, ничьих: 0, поражений: 1", "dave — побед: 1", "erin — побед: 0, ничьих: 0, поражений: 1"} {
+		if !strings.Contains(standings.Text, line) {
+			t.Fatalf("standings miss %q:\n%s", line, standings.Text)
+		}
+	}
+
+	// Tour two pairs bob with erin, still busy, and dave with carol. Nobody
+	// moves, so dave and carol both lose on time.
+	final, err := h.WaitText(organizer, "Турнир #"+id+" завершен! Победитель — bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"bob — побед: 2", "dave — побед: 1, ничьих: 0, поражений: 1", "carol — побед: 0, ничьих: 0, поражений: 2"} {
+		if !strings.Contains(final.Text, line) {
+			t.Fatalf("standings miss %q:\n%s", line, final.Text)
+		}
+	}
+}
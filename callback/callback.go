@@ -0,0 +1,142 @@
+// Package callback encodes inline button payloads. Each payload names an
+// action, the game and round it belongs to and an argument, and is signed with
+// a short HMAC bound to the user it was sent to, so buttons from old rounds,
+// old games or other chats, and hand-crafted payloads, can all be rejected.
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxLen is Telegram's limit on callback data, in bytes.
+const MaxLen = 64
+
+// Actions understood by the bot.
+const (
+	ActionMove      = "mv" // Arg is a move: ArgCooperate or ArgDefect
+	ActionRematch   = "rm" // Arg is ArgYes or ArgNo
+	ActionRounds    = "rd" // Arg is "<rounds>/<form>", see utils.InviteForm
+	ActionForm      = "nf" // Arg is the new game form with one setting changed
+	ActionOpponent  = "op" // Arg is a bot strategy name
+	ActionBotRounds = "br" // Arg is "<strategy>/<rounds>"
+	ActionCancel    = "ci" // Arg is the ID of the invite to cancel
+	ActionJoin      = "jn" // Arg is the ID of a public invite to accept
+	ActionLobby     = "lb" // Arg is the lobby page to show
+	ActionUnwatch   = "uw" // Arg is the spectate link key of the game to stop watching
+	ActionGroup     = "gs" // Arg is the group settings with one changed, as "<rounds>/<form>"
+	ActionAccept    = "ac" // Arg is the ID of an invite shared through inline mode; signed for Anyone
+	ActionTourForm  = "tf" // Arg is the new tournament form with one setting changed
+	ActionTourNew   = "tn" // Arg is "<rounds>/<form>", see utils.TournamentForm
+	ActionTourStart = "ts" // Arg is the ID of the tournament to start
+	ActionTourStop  = "tx" // Arg is the ID of the tournament to cancel
+	ActionTourLeave = "tl" // Arg is the ID of the tournament to withdraw from
+	ActionExport    = "xp" // Arg is one of game.ExportFormats
+)
+
+// Anyone is the user ID that buttons anyone may press are signed for, such as
+// those on messages shared through inline mode.
+const Anyone int64 = 0
+
+// Arguments shared by several actions.
+const (
+	ArgCooperate = "c"
+	ArgDefect    = "d"
+	ArgYes       = "y"
+	ArgNo        = "n"
+)
+
+// macLen is how many bytes of the HMAC are kept. Eight bytes make a forged
+// payload practically impossible to guess while keeping buttons compact.
+const macLen = 8
+
+const separator = ":"
+
+// ErrInvalid is returned for payloads that are malformed or whose signature doesn't match.
+var ErrInvalid = errors.New("кнопка устарела")
+
+// Data is the decoded content of a button.
+type Data struct {
+	Action string
+	// GameID and Round tie the button to one round of one game; empty and zero
+	// for buttons that don't belong to a game.
+	GameID string
+	Round  int
+	Arg    string
+}
+
+// Codec signs and verifies button payloads.
+type Codec struct {
+	key []byte
+}
+
+// NewCodec creates a codec with the given secret. With an empty key a random
+// one is generated, so buttons stop working when the process restarts.
+func NewCodec(key []byte) *Codec {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("callback: generate key: %v", err))
+		}
+	}
+	return &Codec{key: key}
+}
+
+// Encode builds the payload of a button shown to userID. It panics if the
+// result doesn't fit in MaxLen or a field contains the separator, both of
+// which are programming errors.
+func (c *Codec) Encode(userID int64, d Data) string {
+	for _, field := range []string{d.Action, d.GameID, d.Arg} {
+		if strings.Contains(field, separator) {
+			panic(fmt.Sprintf("callback: %q contains %q", field, separator))
+		}
+	}
+	body := strings.Join([]string{d.Action, d.GameID, strconv.Itoa(d.Round), d.Arg}, separator)
+	payload := body + separator + c.mac(userID, body)
+	if len(payload) > MaxLen {
+		panic(fmt.Sprintf("callback: payload %q is %d bytes, over the limit of %d", payload, len(payload), MaxLen))
+	}
+	return payload
+}
+
+// Decode verifies a payload pressed by userID and returns its content.
+// Payloads over MaxLen were never produced by Encode and are rejected.
+func (c *Codec) Decode(userID int64, payload string) (Data, error) {
+	i := strings.LastIndex(payload, separator)
+	if len(payload) > MaxLen || i < 0 {
+		return Data{}, ErrInvalid
+	}
+	body, mac := payload[:i], payload[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(c.mac(userID, body))) {
+		return Data{}, ErrInvalid
+	}
+
+	fields := strings.Split(body, separator)
+	if len(fields) != 4 {
+		return Data{}, ErrInvalid
+	}
+	round, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return Data{}, ErrInvalid
+	}
+	return Data{Action: fields[0], GameID: fields[1], Round: round, Arg: fields[3]}, nil
+}
+
+// Prefix is what every payload for action starts with, for routing by prefix.
+func Prefix(action string) string {
+	return action + separator
+}
+
+func (c *Codec) mac(userID int64, body string) string {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(strconv.FormatInt(userID, 10)))
+	h.Write([]byte(separator))
+	h.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:macLen])
+}
@@ -0,0 +1,142 @@
+package callback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestRoundTrip(t *testing.T) {
+	c := NewCodec(testKey)
+	tests := []struct {
+		name   string
+		userID int64
+		data   Data
+	}{
+		{"move", 101, Data{Action: ActionMove, GameID: "1a2b3c4d", Round: 3, Arg: ArgCooperate}},
+		{"no game", 101, Data{Action: ActionRounds, Arg: "10"}},
+		{"empty argument", 101, Data{Action: ActionRematch, GameID: "1a2b3c4d"}},
+		{"argument with a slash", 101, Data{Action: ActionBotRounds, Arg: "tft/10"}},
+		{"signed for anyone", Anyone, Data{Action: ActionAccept, Arg: "abcdef"}},
+		{"group chat user", -1001234567890, Data{Action: ActionGroup, Arg: "10/c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := c.Encode(tt.userID, tt.data)
+			if !strings.HasPrefix(payload, Prefix(tt.data.Action)) {
+				t.Errorf("payload %q doesn't start with %q", payload, Prefix(tt.data.Action))
+			}
+			got, err := c.Decode(tt.userID, payload)
+			if err != nil {
+				t.Fatalf("Decode(%q) error = %v", payload, err)
+			}
+			if got != tt.data {
+				t.Errorf("Decode(%q) = %+v, want %+v", payload, got, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	c := NewCodec(testKey)
+	const user int64 = 101
+	valid := c.Encode(user, Data{Action: ActionMove, GameID: "1a2b3c4d", Round: 3, Arg: ArgCooperate})
+	macAt := strings.LastIndex(valid, separator) + 1
+	// signed builds a payload with a correct signature around any body.
+	signed := func(body string) string { return body + separator + c.mac(user, body) }
+
+	tests := []struct {
+		name    string
+		userID  int64
+		payload string
+	}{
+		{"another user", 202, valid},
+		{"user payload pressed as anyone", Anyone, valid},
+		{"another key", user, NewCodec([]byte("another key")).Encode(user, Data{Action: ActionMove, GameID: "1a2b3c4d", Round: 3, Arg: ArgCooperate})},
+		{"changed action", user, ActionRematch + valid[len(ActionMove):]},
+		{"changed round", user, strings.Replace(valid, ":3:", ":4:", 1)},
+		{"changed argument", user, strings.Replace(valid, ":c:", ":d:", 1)},
+		{"changed signature", user, valid[:macAt] + flip(valid[macAt]) + valid[macAt+1:]},
+		{"truncated signature", user, valid[:len(valid)-1]},
+		{"no signature", user, valid[:macAt]},
+		{"no separator", user, "garbage"},
+		{"empty", user, ""},
+		{"too few fields", user, signed("mv:1a2b3c4d:3")},
+		{"too many fields", user, signed("mv:1a2b3c4d:3:c:x")},
+		{"round not a number", user, signed("mv:1a2b3c4d:three:c")},
+		{"over the size limit", user, signed("mv:1a2b3c4d:3:" + strings.Repeat("c", MaxLen))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Decode(tt.userID, tt.payload)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Decode(%q) = %+v, %v, want ErrInvalid", tt.payload, got, err)
+			}
+		})
+	}
+}
+
+// flip replaces a signature character with another one from its alphabet.
+func flip(b byte) string {
+	if b == 'A' {
+		return "B"
+	}
+	return "A"
+}
+
+func TestAnyone(t *testing.T) {
+	c := NewCodec(testKey)
+	payload := c.Encode(Anyone, Data{Action: ActionAccept, Arg: "abcdef"})
+	if _, err := c.Decode(Anyone, payload); err != nil {
+		t.Errorf("Decode as anyone: %v", err)
+	}
+	// The bot decodes shared buttons as Anyone; for a user they are forged.
+	if _, err := c.Decode(101, payload); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decode as a user = %v, want ErrInvalid", err)
+	}
+}
+
+func TestEncodeLimit(t *testing.T) {
+	c := NewCodec(testKey)
+	// "xp:<game>:0:" with an empty argument, then ":" and 11 base64 characters of signature.
+	overhead := len(Prefix(ActionExport)) + len(":0:") + len(separator) + 11
+	fits := Data{Action: ActionExport, GameID: strings.Repeat("g", MaxLen-overhead)}
+	payload := c.Encode(101, fits)
+	if len(payload) != MaxLen {
+		t.Fatalf("payload is %d bytes, want exactly %d", len(payload), MaxLen)
+	}
+	if _, err := c.Decode(101, payload); err != nil {
+		t.Errorf("Decode of a payload at the limit: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data Data
+	}{
+		{"one byte over the limit", Data{Action: ActionExport, GameID: fits.GameID + "g"}},
+		{"separator in the argument", Data{Action: ActionMove, Arg: "a:b"}},
+		{"separator in the game", Data{Action: ActionMove, GameID: "a:b"}},
+		{"separator in the action", Data{Action: "m:v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Encode(%+v) didn't panic", tt.data)
+				}
+			}()
+			c.Encode(101, tt.data)
+		})
+	}
+}
+
+func TestRandomKeys(t *testing.T) {
+	data := Data{Action: ActionMove, GameID: "1a2b3c4d", Round: 1, Arg: ArgDefect}
+	payload := NewCodec(nil).Encode(101, data)
+	// Buttons signed before a restart without a configured key stop working.
+	if _, err := NewCodec(nil).Decode(101, payload); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decode with another random key = %v, want ErrInvalid", err)
+	}
+}
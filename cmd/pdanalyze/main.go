@@ -0,0 +1,163 @@
+// Command pdanalyze computes long-run payoffs of memory-one strategies and
+// constructs zero-determinant strategies.
+//
+//	pdanalyze -x tft -y 0.9,0.1,0.9,0.1      expected payoffs of one pairing
+//	pdanalyze -table                          payoffs of every library pairing
+//	pdanalyze -zd extort -chi 3               print a ZD strategy vector
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/strategy"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	x := flag.String("x", "", "first strategy: library name or p_CC,p_CD,p_DC,p_DD[,initial]")
+	y := flag.String("y", "", "second strategy, same format as -x")
+	payoffFlag := flag.String("payoff", "3,0,5,1", "payoff matrix as R,S,T,P")
+	table := flag.Bool("table", false, "print expected payoffs for every pair of library strategies")
+	zd := flag.String("zd", "", "construct a zero-determinant strategy: extort or generous")
+	chi := flag.Float64("chi", 3, "ZD extortion factor (>= 1)")
+	phi := flag.Float64("phi", 0.5, "ZD scale as a share of the largest valid value, in (0, 1]")
+	flag.Parse()
+
+	payoff, err := parsePayoff(*payoffFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case *zd != "":
+		s, err := buildZD(*zd, payoff, *chi, *phi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printVector(s)
+	case *table:
+		printTable(payoff)
+	case *x != "" && *y != "":
+		sx, err := parseStrategy(*x, payoff)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sy, err := parseStrategy(*y, payoff)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printPairing(sx, sy, payoff)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func library(payoff models.Payoff) map[string]strategy.MemoryOne {
+	lib := map[string]strategy.MemoryOne{
+		"zd_extort":   strategy.Extortioner(payoff),
+		"zd_generous": strategy.GenerousZD(payoff),
+	}
+	keys := []string{"tft", "grudger", "pavlov", "alld", "allc", "random"}
+	for i, s := range strategy.MemoryOneLibrary() {
+		lib[keys[i]] = s
+	}
+	return lib
+}
+
+func parsePayoff(raw string) (models.Payoff, error) {
+	values, err := parseFloats(raw)
+	if err != nil || len(values) != 4 {
+		return models.Payoff{}, fmt.Errorf("invalid payoff %q: want R,S,T,P", raw)
+	}
+	p := models.Payoff{Reward: int(values[0]), Sucker: int(values[1]), Temptation: int(values[2]), Punishment: int(values[3])}
+	if !(p.Temptation > p.Reward && p.Reward > p.Punishment && p.Punishment > p.Sucker) {
+		log.Printf("warning: %q is not a prisoner's dilemma (need T > R > P > S)", raw)
+	}
+	return p, nil
+}
+
+func parseStrategy(raw string, payoff models.Payoff) (strategy.MemoryOne, error) {
+	if s, ok := library(payoff)[strings.ToLower(raw)]; ok {
+		return s, nil
+	}
+
+	values, err := parseFloats(raw)
+	if err != nil || (len(values) != 4 && len(values) != 5) {
+		return strategy.MemoryOne{}, fmt.Errorf("invalid strategy %q: want a library name or 4-5 probabilities", raw)
+	}
+	s := strategy.MemoryOne{Label: raw, Initial: values[0]}
+	copy(s.P[:], values[:4])
+	if len(values) == 5 {
+		s.Initial = values[4]
+	}
+	for _, p := range values {
+		if p < 0 || p > 1 {
+			return strategy.MemoryOne{}, fmt.Errorf("invalid strategy %q: probabilities must be in [0, 1]", raw)
+		}
+	}
+	return s, nil
+}
+
+func parseFloats(raw string) ([]float64, error) {
+	var values []float64
+	for _, part := range strings.Split(raw, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func buildZD(kind string, payoff models.Payoff, chi, phi float64) (strategy.MemoryOne, error) {
+	switch kind {
+	case "extort":
+		return strategy.ZeroDeterminant("extortionate ZD", payoff, chi, float64(payoff.Punishment), phi)
+	case "generous":
+		return strategy.ZeroDeterminant("generous ZD", payoff, chi, float64(payoff.Reward), phi)
+	}
+	return strategy.MemoryOne{}, fmt.Errorf("unknown ZD kind %q: want extort or generous", kind)
+}
+
+func printVector(s strategy.MemoryOne) {
+	fmt.Printf("%s\n", s.Name())
+	fmt.Printf("  p_CC=%.4f p_CD=%.4f p_DC=%.4f p_DD=%.4f initial=%.4f\n", s.P[0], s.P[1], s.P[2], s.P[3], s.Initial)
+}
+
+func printPairing(x, y strategy.MemoryOne, payoff models.Payoff) {
+	v := strategy.Stationary(x, y)
+	px, py := strategy.ExpectedPayoffs(x, y, payoff)
+
+	printVector(x)
+	printVector(y)
+	fmt.Printf("\nstationary distribution (x's view): CC=%.4f CD=%.4f DC=%.4f DD=%.4f\n", v[0], v[1], v[2], v[3])
+	fmt.Printf("expected payoff per round: x=%.4f y=%.4f\n", px, py)
+}
+
+func printTable(payoff models.Payoff) {
+	lib := library(payoff)
+	names := []string{"tft", "grudger", "pavlov", "alld", "allc", "random", "zd_extort", "zd_generous"}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "row vs col\t")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t", name)
+	}
+	fmt.Fprintln(w)
+	for _, row := range names {
+		fmt.Fprintf(w, "%s\t", row)
+		for _, col := range names {
+			px, _ := strategy.ExpectedPayoffs(lib[row], lib[col], payoff)
+			fmt.Fprintf(w, "%.2f\t", px)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
@@ -0,0 +1,213 @@
+// Command pdconsole plays the prisoner's dilemma in a terminal, either as two
+// players sharing one keyboard or as one player against a bot strategy. It runs
+// the same game flow as the Telegram bot, with the terminal as the messenger.
+//
+//	pdconsole -rounds 15 -a Alice -b Bob -payoff h -timeout 30s
+//	pdconsole -rounds 10 -bot learner -data data
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/flow"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"prisoners-dilemma-bot/utils"
+	"strconv"
+	"strings"
+)
+
+const (
+	playerAID int64 = 1
+	playerBID int64 = 2
+)
+
+type console struct {
+	flow    *flow.Flow
+	manager *game.Manager
+	term    *terminal
+	in      *bufio.Scanner
+	hotSeat bool
+}
+
+func main() {
+	rounds := flag.Int("rounds", 10, "number of rounds")
+	nameA := flag.String("a", "Игрок 1", "name of the first player")
+	nameB := flag.String("b", "Игрок 2", "name of the second player (ignored against a bot)")
+	botName := flag.String("bot", "", "play against this bot strategy instead of a second player: "+
+		strings.Join(append(strategy.Names(), strategy.LearnerName), ", "))
+	dataDir := flag.String("data", "", "directory for persistent data such as learned policies (default: in memory)")
+	payoffKey := flag.String("payoff", models.PayoffPresets[0].Key, "payoff table: "+presetKeys()+" (bot games always use the classic one)")
+	turnTimeout := flag.Duration("timeout", game.DefaultTurnTimeout, "time each player has to move")
+	flag.Parse()
+
+	if *rounds < 1 {
+		log.Fatal("rounds must be positive")
+	}
+	preset, ok := models.PresetByKey(*payoffKey)
+	if !ok {
+		log.Fatalf("unknown payoff table %q, use one of %s", *payoffKey, presetKeys())
+	}
+	if *botName != "" && preset.Payoff != models.ClassicPayoff {
+		log.Fatal("bot games are played with the classic payoff table")
+	}
+	if *turnTimeout <= 0 {
+		log.Fatal("timeout must be positive")
+	}
+
+	var store storage.Store = storage.NewMemoryStore()
+	if *dataDir != "" {
+		fileStore, err := storage.NewFileStore(*dataDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = fileStore
+	}
+
+	hotSeat := *botName == ""
+	manager := game.NewManager(game.Config{Store: store, Learner: strategy.DefaultLearnerConfig(), TurnTimeout: *turnTimeout})
+	term := newTerminal(os.Stdout, hotSeat)
+	c := &console{
+		flow:    flow.New(term, manager, callback.NewCodec(nil)),
+		manager: manager,
+		term:    term,
+		in:      bufio.NewScanner(os.Stdin),
+		hotSeat: hotSeat,
+	}
+
+	settings := models.GameSettings{Rounds: *rounds, Payoff: preset.Payoff, TurnTimeout: *turnTimeout}
+	session, err := c.start(settings, *nameA, *nameB, *botName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	term.setName(session.PlayerA.ID, session.PlayerA.Username)
+	term.setName(session.PlayerB.ID, session.PlayerB.Username)
+
+	fmt.Printf("🎮 Игра начинается! Выигрыши: %s (%s), время на ход: %s\n",
+		models.PayoffName(session.Payoff), session.Payoff, *turnTimeout)
+	c.flow.PromptNextRound(session)
+	c.flow.SetupTurnTimer(session)
+	c.run()
+}
+
+func (c *console) start(settings models.GameSettings, nameA, nameB, botName string) (*models.Session, error) {
+	if botName != "" {
+		return c.manager.CreateBotGame(playerAID, nameA, settings.Rounds, botName)
+	}
+
+	invite, err := c.manager.CreateGameInvite(playerAID, nameA, settings)
+	if err != nil {
+		return nil, err
+	}
+	session, _, err := c.manager.AcceptInvite(invite.InviteID, playerBID, nameB)
+	return session, err
+}
+
+// presetKeys lists the keys of the payoff presets for flag help and errors.
+func presetKeys() string {
+	keys := make([]string, len(models.PayoffPresets))
+	for i, preset := range models.PayoffPresets {
+		keys[i] = fmt.Sprintf("%s (%s %s)", preset.Key, preset.Name, preset.Payoff)
+	}
+	return strings.Join(keys, ", ")
+}
+
+// run answers pending prompts from the keyboard until none are left.
+func (c *console) run() {
+	for {
+		p, ok := c.term.nextPrompt()
+		if !ok {
+			return
+		}
+		if c.stale(p) {
+			continue
+		}
+
+		data, ok := c.ask(p)
+		if c.hotSeat {
+			clearScreen()
+		}
+		if !ok {
+			c.flow.Quit(p.ref.ChatID, c.term.name(p.ref.ChatID))
+			continue
+		}
+		c.dispatch(p, data)
+	}
+}
+
+// stale reports whether a prompt no longer applies, e.g. a move prompt after
+// the game was forfeited or a rematch prompt after the other player declined.
+func (c *console) stale(p prompt) bool {
+	session, ok := c.manager.FindSessionByPlayerID(p.ref.ChatID)
+	if !ok {
+		return true
+	}
+	return c.isMovePrompt(p) && session.State != models.StateInProgress
+}
+
+func (c *console) isMovePrompt(p prompt) bool {
+	for _, row := range p.keyboard.Rows {
+		for _, b := range row {
+			if data, err := c.flow.Codec().Decode(p.ref.ChatID, b.Data); err == nil && data.Action == callback.ActionMove {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ask shows the prompt's buttons as numbered options and returns the data of the
+// chosen one. It returns false when the player quits or input ends.
+func (c *console) ask(p prompt) (string, bool) {
+	var buttons []messaging.Button
+	for _, row := range p.keyboard.Rows {
+		buttons = append(buttons, row...)
+	}
+
+	for {
+		fmt.Printf("%s:", c.term.name(p.ref.ChatID))
+		for i, b := range buttons {
+			fmt.Printf("  [%d] %s", i+1, b.Text)
+		}
+		fmt.Print("  [q] выйти > ")
+
+		if !c.in.Scan() {
+			return "", false
+		}
+		input := strings.TrimSpace(c.in.Text())
+		if strings.EqualFold(input, "q") {
+			return "", false
+		}
+		if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(buttons) {
+			return buttons[n-1].Data, true
+		}
+	}
+}
+
+// dispatch routes a pressed button to the game flow, like the bot's callback handler.
+func (c *console) dispatch(p prompt, payload string) {
+	playerID := p.ref.ChatID
+	data, err := c.flow.Codec().Decode(playerID, payload)
+	if err != nil {
+		return
+	}
+	switch data.Action {
+	case callback.ActionMove:
+		if choice, ok := utils.ChoiceFromArg(data.Arg); ok {
+			c.flow.HandleChoice(playerID, data.GameID, data.Round, choice, p.ref)
+		}
+	case callback.ActionRematch:
+		c.flow.HandleRematch(playerID, data.GameID, data.Arg == callback.ArgYes, p.ref)
+	}
+}
+
+func clearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
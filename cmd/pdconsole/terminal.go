@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"prisoners-dilemma-bot/messaging"
+	"sync"
+)
+
+// prompt is a choice message waiting for a player's answer.
+type prompt struct {
+	ref      messaging.MessageRef
+	text     string
+	keyboard *messaging.Keyboard
+}
+
+// terminal is a messaging.Messenger that prints every message to one shared
+// screen, labelled with the player it is addressed to.
+type terminal struct {
+	mu      sync.Mutex
+	out     io.Writer
+	names   map[int64]string
+	nextID  int
+	prompts []prompt
+	// hideEdits keeps edited prompts such as "you chose: defect" off the shared
+	// screen, so players taking turns at one keyboard cannot see each other's moves.
+	hideEdits bool
+}
+
+func newTerminal(out io.Writer, hideEdits bool) *terminal {
+	return &terminal{out: out, names: make(map[int64]string), hideEdits: hideEdits}
+}
+
+func (t *terminal) setName(chatID int64, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.names[chatID] = name
+}
+
+func (t *terminal) name(chatID int64) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.names[chatID]
+}
+
+func (t *terminal) print(chatID int64, text string) {
+	fmt.Fprintf(t.out, "\n— %s —\n%s\n", t.names[chatID], text)
+}
+
+func (t *terminal) SendText(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	if keyboard != nil && !keyboard.Menu {
+		return t.SendChoice(chatID, text, keyboard)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	t.print(chatID, text)
+	return messaging.MessageRef{ChatID: chatID, MessageID: t.nextID}, nil
+}
+
+func (t *terminal) SendChoice(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	ref := messaging.MessageRef{ChatID: chatID, MessageID: t.nextID}
+	t.print(chatID, text)
+	t.prompts = append(t.prompts, prompt{ref: ref, text: text, keyboard: keyboard})
+	return ref, nil
+}
+
+func (t *terminal) EditMessage(ref messaging.MessageRef, text string, keyboard *messaging.Keyboard) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.hideEdits {
+		text = "✅ Принято."
+	}
+	t.print(ref.ChatID, text)
+	return nil
+}
+
+func (t *terminal) AnswerCallback(callbackID, text string) error {
+	return nil
+}
+
+// nextPrompt pops the oldest unanswered prompt.
+func (t *terminal) nextPrompt() (prompt, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.prompts) == 0 {
+		return prompt{}, false
+	}
+	p := t.prompts[0]
+	t.prompts = t.prompts[1:]
+	return p, true
+}
@@ -0,0 +1,294 @@
+// Package flow drives a game from the players' point of view: prompting for
+// moves, reporting round results, announcing winners and handling rematches.
+// It talks to players only through messaging.Messenger, so every frontend
+// shares the same game flow.
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+)
+
+// Flow orchestrates games on top of a game.Manager.
+type Flow struct {
+	msg     messaging.Messenger
+	manager *game.Manager
+	codec   *callback.Codec
+}
+
+// New creates a game flow that reaches players through msg and signs its
+// buttons with codec.
+func New(msg messaging.Messenger, manager *game.Manager, codec *callback.Codec) *Flow {
+	return &Flow{msg: msg, manager: manager, codec: codec}
+}
+
+// Manager exposes the underlying game manager.
+func (f *Flow) Manager() *game.Manager {
+	return f.manager
+}
+
+// Codec exposes the codec the flow signs its buttons with.
+func (f *Flow) Codec() *callback.Codec {
+	return f.codec
+}
+
+// ExpiredText replaces a button message that belongs to a round or game that is over.
+const ExpiredText = "⌛ Эта кнопка устарела."
+
+// PromptNextRound asks both players for their move in the current round.
+func (f *Flow) PromptNextRound(session *models.Session) {
+	promptText := game.RoundPrompt(session)
+	for _, player := range []*models.Player{session.PlayerA, session.PlayerB} {
+		if player.IsBot {
+			continue
+		}
+		keyboard := utils.ChoiceKeyboard(f.codec, player.ID, session.GameID, session.CurrentRound)
+		if _, err := f.msg.SendChoice(player.ID, promptText, keyboard); err != nil {
+			log.Printf("Failed to send round prompt to %d: %v", player.ID, err)
+		}
+	}
+}
+
+// HandleChoice records a move made from the prompt message at ref for the given
+// round of the given game and, once the round is resolved, reports it and moves the game on.
+func (f *Flow) HandleChoice(playerID int64, gameID string, round int, choice models.PlayerChoice, ref messaging.MessageRef) {
+	outcome, err := f.manager.SubmitChoice(playerID, gameID, round, choice)
+	if errors.Is(err, game.ErrExpired) {
+		f.edit(ref, ExpiredText)
+		return
+	}
+	if errors.Is(err, game.ErrAlreadyMoved) {
+		// A double tap: the first move already edited the prompt.
+		return
+	}
+	if err != nil {
+		// This can happen if a player clicks an old button after a game ends
+		log.Printf("Error recording choice for player %d: %v", playerID, err)
+		f.edit(ref, "Эта игра больше не активна.")
+		return
+	}
+
+	f.edit(ref, fmt.Sprintf("Вы выбрали: %s. Ожидаем другого игрока...", game.ChoiceName(choice)))
+
+	if !outcome.RoundResolved {
+		return
+	}
+
+	session := outcome.Session
+	f.Notify(session.PlayerA, outcome.ResultA, nil)
+	f.Notify(session.PlayerB, outcome.ResultB, nil)
+	// Spectators only ever hear about a round once both moves are in.
+	f.NotifySpectators(session, game.SpectatorReport(session))
+	f.UpdateCard(session, "")
+
+	if outcome.Finished {
+		f.AnnounceWinner(session)
+	} else {
+		f.PromptNextRound(session)
+		f.SetupTurnTimer(session)
+	}
+}
+
+// AnnounceWinner sends the final scoreboard, each player's style and the rematch offer.
+// Where the messenger can send files, the scoreboard offers the game's record for download.
+func (f *Flow) AnnounceWinner(session *models.Session) {
+	pA := session.PlayerA
+	pB := session.PlayerB
+
+	finalMsg := game.FinalSummary(session)
+	_, exports := f.msg.(messaging.DocumentSender)
+	for _, player := range []*models.Player{pA, pB} {
+		var keyboard *messaging.Keyboard
+		if exports && !player.IsBot {
+			keyboard = utils.ExportKeyboard(f.codec, player.ID, session.GameID)
+		}
+		f.Notify(player, finalMsg, keyboard)
+	}
+	f.NotifySpectators(session, finalMsg)
+
+	for _, player := range []*models.Player{pA, pB} {
+		if text := game.GameStyle(session, player); text != "" {
+			f.Notify(player, text, nil)
+		}
+	}
+
+	// A tournament decides who plays whom next.
+	if session.TournamentID != "" {
+		for _, player := range []*models.Player{pA, pB} {
+			f.Notify(player, "🏆 Результат записан в таблицу турнира. Следующий тур начнется, когда закончатся все игры этого тура.", nil)
+		}
+		return
+	}
+
+	// Ask players if they want a rematch
+	for _, player := range []*models.Player{pA, pB} {
+		if player.IsBot {
+			continue
+		}
+		keyboard := utils.RematchKeyboard(f.codec, player.ID, session.GameID)
+		if _, err := f.msg.SendChoice(player.ID, "Хотите реванш?", keyboard); err != nil {
+			log.Printf("Failed to send rematch prompt to %d: %v", player.ID, err)
+		}
+	}
+}
+
+// WelcomeText is shown whenever a player lands back in the main menu.
+const WelcomeText = "Добро пожаловать в бот \"Дилемма Заключенного\"!\n\nИспользуйте меню ниже, чтобы начать новую игру или изучить правила."
+
+// HandleRematch processes a player's answer to the rematch prompt at ref,
+// which was offered after the given game.
+func (f *Flow) HandleRematch(playerID int64, gameID string, wantsRematch bool, ref messaging.MessageRef) {
+	session, bothWantRematch, err := f.manager.SetRematchPreference(playerID, gameID, wantsRematch)
+	if errors.Is(err, game.ErrExpired) {
+		f.edit(ref, ExpiredText)
+		return
+	}
+	if err != nil {
+		f.send(playerID, err.Error(), nil)
+		return
+	}
+
+	var otherPlayer *models.Player
+	if playerID == session.PlayerA.ID {
+		otherPlayer = session.PlayerB
+	} else {
+		otherPlayer = session.PlayerA
+	}
+
+	if !wantsRematch {
+		// This player chose "Main Menu"
+		f.edit(ref, "Возвращаемся в главное меню...")
+
+		f.send(playerID, WelcomeText, utils.MainMenuKeyboard())
+		f.Notify(otherPlayer, "Другой игрок не захотел играть реванш. Возвращаемся в главное меню...", nil)
+		f.Notify(otherPlayer, WelcomeText, utils.MainMenuKeyboard())
+		f.NotifySpectators(session, "👁 Реванша не будет. Трансляция окончена.")
+		return
+	}
+
+	// This player wants a rematch
+	f.edit(ref, "Вы хотите реванш! Ждем другого игрока...")
+
+	if bothWantRematch {
+		// Start the rematch
+		newSession, err := f.manager.StartRematch(session.ID)
+		if err != nil {
+			f.Notify(session.PlayerA, "Не удалось начать реванш: "+err.Error(), nil)
+			f.Notify(session.PlayerB, "Не удалось начать реванш: "+err.Error(), nil)
+			return
+		}
+
+		// Notify both players
+		f.Notify(newSession.PlayerA, "🎮 Реванш начинается!", nil)
+		f.Notify(newSession.PlayerB, "🎮 Реванш начинается!", nil)
+		f.NotifySpectators(newSession, "👁 Реванш начинается!")
+
+		f.PromptNextRound(newSession)
+		f.SetupTurnTimer(newSession)
+	}
+}
+
+// Quit forfeits the player's current game.
+func (f *Flow) Quit(playerID int64, quitterName string) {
+	session, winner, err := f.manager.ForfeitGame(playerID)
+	if err != nil {
+		f.send(playerID, err.Error(), nil)
+		return
+	}
+
+	f.send(playerID, "Вы покинули игру.", nil)
+	f.Notify(winner, fmt.Sprintf("😢 %s покинул игру. Вы побеждаете по умолчанию!", quitterName), nil)
+	f.NotifySpectators(session, fmt.Sprintf("👁 %s покинул игру. %s побеждает по умолчанию.", quitterName, winner.Username))
+	f.UpdateCard(session, fmt.Sprintf("🏳️ %s покинул игру.", quitterName))
+}
+
+// DeliveryFailed is called when a message to chatID could not be delivered.
+// A player the bot can no longer reach forfeits a game in progress, so the
+// opponent isn't left waiting for moves that will never come.
+func (f *Flow) DeliveryFailed(chatID int64, err error) {
+	if !errors.Is(err, messaging.ErrUnreachable) {
+		return
+	}
+	session, winner, err := f.manager.ForfeitGame(chatID)
+	if err != nil {
+		return // Not in a game in progress
+	}
+	loser := session.PlayerA
+	if loser.ID == winner.ID {
+		loser = session.PlayerB
+	}
+	log.Printf("Player %d is unreachable, forfeiting session %d", chatID, session.ID)
+	f.Notify(winner, fmt.Sprintf("😢 %s больше недоступен. Вы побеждаете по умолчанию!", loser.Username), nil)
+	f.NotifySpectators(session, fmt.Sprintf("👁 %s больше недоступен. %s побеждает по умолчанию.", loser.Username, winner.Username))
+	f.UpdateCard(session, fmt.Sprintf("📵 %s больше недоступен.", loser.Username))
+}
+
+// SetupTurnTimer arms the move timer for the current round.
+func (f *Flow) SetupTurnTimer(session *models.Session) {
+	f.manager.SetTurnTimer(session.ID, func(session *models.Session, winner *models.Player) {
+		timeoutMsg, note := "⏰ Время вышло! Никто из игроков не сделал ход.", "⏰ Никто не успел сделать ход."
+		if winner != nil {
+			late := session.PlayerA
+			if late.ID == winner.ID {
+				late = session.PlayerB
+			}
+			timeoutMsg = fmt.Sprintf("⏰ Время вышло! %s слишком долго не делал ход.", late.Username)
+			note = fmt.Sprintf("⏰ %s не успел сделать ход.", late.Username)
+		}
+		// Notify players of timeout
+		f.Notify(session.PlayerA, timeoutMsg, nil)
+		f.Notify(session.PlayerB, timeoutMsg, nil)
+		f.NotifySpectators(session, timeoutMsg)
+		f.UpdateCard(session, note)
+
+		// If the game ended due to timeout, announce the winner
+		if session.State == models.StateFinished {
+			f.AnnounceWinner(session)
+		}
+	})
+}
+
+// Notify sends a message to a session participant, skipping bot opponents.
+func (f *Flow) Notify(player *models.Player, text string, keyboard *messaging.Keyboard) {
+	if player.IsBot {
+		return
+	}
+	f.send(player.ID, text, keyboard)
+}
+
+// NotifySpectators sends a message to everyone watching the session.
+func (f *Flow) NotifySpectators(session *models.Session, text string) {
+	for _, spectatorID := range session.Spectators {
+		f.send(spectatorID, text, nil)
+	}
+}
+
+// UpdateCard redraws the group match card of a session, if it has one. note
+// is passed on to game.MatchCard.
+func (f *Flow) UpdateCard(session *models.Session, note string) {
+	if session.Card.IsZero() {
+		return
+	}
+	ref := messaging.MessageRef{ChatID: session.Card.ChatID, MessageID: session.Card.MessageID, InlineID: session.Card.InlineMessageID}
+	if err := f.msg.EditMessage(ref, game.MatchCard(session, note), nil); err != nil {
+		log.Printf("Failed to update match card %d in chat %d: %v", ref.MessageID, ref.ChatID, err)
+	}
+}
+
+func (f *Flow) send(chatID int64, text string, keyboard *messaging.Keyboard) {
+	if _, err := f.msg.SendText(chatID, text, keyboard); err != nil {
+		log.Printf("Failed to send message to %d: %v", chatID, err)
+	}
+}
+
+func (f *Flow) edit(ref messaging.MessageRef, text string) {
+	if err := f.msg.EditMessage(ref, text, nil); err != nil {
+		log.Printf("Failed to edit message %d in chat %d: %v", ref.MessageID, ref.ChatID, err)
+	}
+}
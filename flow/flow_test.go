@@ -0,0 +1,284 @@
+package flow
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging"
+	"prisoners-dilemma-bot/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	alice int64 = 101
+	bob   int64 = 202
+)
+
+// startGame starts a game of the given length between alice and bob and
+// prompts them for the first round.
+func startGame(t *testing.T, cfg game.Config, rounds int) (*Flow, *messaging.Fake, *models.Session) {
+	t.Helper()
+	fake := messaging.NewFake()
+	f := New(fake, game.NewManager(cfg), callback.NewCodec(nil))
+	inviteID, err := f.Manager().CreateInvite(alice, "alice", rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := f.Manager().AcceptInvite(inviteID, bob, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.PromptNextRound(session)
+	f.SetupTurnTimer(session)
+	return f, fake, session
+}
+
+// lastChoice is the latest button message sent to a chat.
+func lastChoice(t *testing.T, fake *messaging.Fake, chatID int64) messaging.Sent {
+	t.Helper()
+	messages := fake.Messages(chatID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Choice {
+			return messages[i]
+		}
+	}
+	t.Fatalf("chat %d has no button message", chatID)
+	return messaging.Sent{}
+}
+
+// button decodes the button of m whose text starts with label.
+func button(t *testing.T, f *Flow, m messaging.Sent, userID int64, label string) callback.Data {
+	t.Helper()
+	if m.Keyboard != nil {
+		for _, row := range m.Keyboard.Rows {
+			for _, b := range row {
+				if strings.HasPrefix(b.Text, label) {
+					data, err := f.Codec().Decode(userID, b.Data)
+					if err != nil {
+						t.Fatalf("button %q: %v", b.Text, err)
+					}
+					return data
+				}
+			}
+		}
+	}
+	t.Fatalf("no %q button on %q", label, m.Text)
+	return callback.Data{}
+}
+
+// move presses a move button on the latest prompt of the player.
+func move(t *testing.T, f *Flow, fake *messaging.Fake, playerID int64, cooperate bool) messaging.Sent {
+	t.Helper()
+	prompt := lastChoice(t, fake, playerID)
+	label := "⚔️"
+	if cooperate {
+		label = "🤝"
+	}
+	data := button(t, f, prompt, playerID, label)
+	choice := models.ChoiceDefect
+	if data.Arg == callback.ArgCooperate {
+		choice = models.ChoiceNegotiate
+	}
+	f.HandleChoice(playerID, data.GameID, data.Round, choice, prompt.Ref)
+	return prompt
+}
+
+// findText is the first message sent to a chat that contains text.
+func findText(fake *messaging.Fake, chatID int64, text string) (messaging.Sent, bool) {
+	for _, m := range fake.Messages(chatID) {
+		if strings.Contains(m.Text, text) {
+			return m, true
+		}
+	}
+	return messaging.Sent{}, false
+}
+
+func mustFind(t *testing.T, fake *messaging.Fake, chatID int64, text string) messaging.Sent {
+	t.Helper()
+	m, ok := findText(fake, chatID, text)
+	if !ok {
+		t.Fatalf("chat %d never got %q", chatID, text)
+	}
+	return m
+}
+
+// waitText waits for a message sent from another goroutine, such as the turn timer.
+func waitText(t *testing.T, fake *messaging.Fake, chatID int64, text string) messaging.Sent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if m, ok := findText(fake, chatID, text); ok {
+			return m
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("chat %d never got %q", chatID, text)
+	return messaging.Sent{}
+}
+
+func TestGameFlow(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{}, 2)
+
+	prompt := move(t, f, fake, alice, true)
+	if got := fake.Messages(alice)[0]; got.Ref != prompt.Ref || got.Edits != 1 || !strings.HasPrefix(got.Text, "Вы выбрали") {
+		t.Errorf("the prompt was not answered in place: %+v", got)
+	}
+	move(t, f, fake, bob, false)
+	// The round is reported and the next prompt sent.
+	if p := lastChoice(t, fake, bob); !strings.HasPrefix(p.Text, "Раунд 2") {
+		t.Fatalf("bob's latest prompt is %q, want round 2", p.Text)
+	}
+
+	move(t, f, fake, alice, false)
+	move(t, f, fake, bob, false)
+	for _, id := range []int64{alice, bob} {
+		final := mustFind(t, fake, id, "Игра окончена")
+		if !strings.Contains(final.Text, "bob победил") {
+			t.Errorf("final message of %d:\n%s", id, final.Text)
+		}
+		// The fake can send files, so the final message offers the record.
+		data := button(t, f, final, id, "📦")
+		if data.Action != callback.ActionExport {
+			t.Errorf("export button of %d has action %q", id, data.Action)
+		}
+		exportRecord(t, f, fake, id, data)
+		if p := lastChoice(t, fake, id); p.Text != "Хотите реванш?" {
+			t.Errorf("last button message of %d is %q, want the rematch offer", id, p.Text)
+		}
+	}
+}
+
+// exportRecord sends the record an export button asks for, the way frontends
+// that can send files answer it.
+func exportRecord(t *testing.T, f *Flow, fake *messaging.Fake, playerID int64, data callback.Data) {
+	t.Helper()
+	record, err := f.Manager().GameRecord(data.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Played(playerID) {
+		t.Fatalf("record of %s doesn't list player %d", data.GameID, playerID)
+	}
+	name, body, err := record.Export(data.Arg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.SendDocument(playerID, name, body, "record"); err != nil {
+		t.Fatal(err)
+	}
+	sent, _ := fake.Last(playerID)
+	if sent.Document != name || !strings.HasSuffix(name, "."+data.Arg) || !strings.Contains(string(sent.Data), data.GameID) {
+		t.Errorf("player %d got document %q with %d bytes", playerID, sent.Document, len(sent.Data))
+	}
+}
+
+// textOnly hides the document support of a messenger.
+type textOnly struct {
+	messaging.Messenger
+}
+
+func TestNoExportWithoutDocuments(t *testing.T) {
+	fake := messaging.NewFake()
+	f := New(textOnly{fake}, game.NewManager(game.Config{}), callback.NewCodec(nil))
+	inviteID, err := f.Manager().CreateInvite(alice, "alice", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := f.Manager().AcceptInvite(inviteID, bob, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.PromptNextRound(session)
+	move(t, f, fake, alice, true)
+	move(t, f, fake, bob, true)
+	if final := mustFind(t, fake, alice, "Игра окончена"); final.Keyboard != nil {
+		t.Errorf("final message offers %d rows of buttons without document support", len(final.Keyboard.Rows))
+	}
+}
+
+func TestStaleMove(t *testing.T) {
+	f, fake, session := startGame(t, game.Config{}, 3)
+	move(t, f, fake, alice, true)
+	move(t, f, fake, bob, true)
+
+	// A button of round one pressed again once round two is under way.
+	first := fake.Messages(bob)[0]
+	f.HandleChoice(bob, session.GameID, 1, models.ChoiceDefect, first.Ref)
+	if got := fake.Messages(bob)[0].Text; got != ExpiredText {
+		t.Errorf("stale prompt reads %q, want %q", got, ExpiredText)
+	}
+}
+
+func TestRematch(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{}, 1)
+	move(t, f, fake, alice, true)
+	move(t, f, fake, bob, true)
+
+	for _, id := range []int64{alice, bob} {
+		offer := lastChoice(t, fake, id)
+		data := button(t, f, offer, id, "")
+		f.HandleRematch(id, data.GameID, true, offer.Ref)
+	}
+	for _, id := range []int64{alice, bob} {
+		mustFind(t, fake, id, "Реванш начинается")
+		if p := lastChoice(t, fake, id); !strings.HasPrefix(p.Text, "Раунд 1") {
+			t.Errorf("latest button message of %d is %q, want a new round one", id, p.Text)
+		}
+	}
+}
+
+func TestDeclineRematch(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{}, 1)
+	move(t, f, fake, alice, true)
+	move(t, f, fake, bob, true)
+
+	offer := lastChoice(t, fake, bob)
+	f.HandleRematch(bob, button(t, f, offer, bob, "").GameID, false, offer.Ref)
+	mustFind(t, fake, alice, "Другой игрок не захотел играть реванш")
+	if _, ok := f.Manager().FindSessionByPlayerID(alice); ok {
+		t.Error("alice is still in a game")
+	}
+}
+
+func TestQuit(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{}, 3)
+	f.Quit(alice, "alice")
+	mustFind(t, fake, alice, "Вы покинули игру.")
+	mustFind(t, fake, bob, "alice покинул игру. Вы побеждаете по умолчанию!")
+
+	// There is nothing left to quit.
+	f.Quit(alice, "alice")
+	if last, _ := fake.Last(alice); last.Text == "Вы покинули игру." {
+		t.Error("quitting twice succeeded")
+	}
+}
+
+func TestDeliveryFailed(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{}, 3)
+	f.DeliveryFailed(bob, fmt.Errorf("flood wait"))
+	if _, ok := findText(fake, alice, "больше недоступен"); ok {
+		t.Fatal("a temporary failure forfeited the game")
+	}
+	f.DeliveryFailed(bob, fmt.Errorf("blocked: %w", messaging.ErrUnreachable))
+	mustFind(t, fake, alice, "bob больше недоступен. Вы побеждаете по умолчанию!")
+}
+
+func TestTurnTimeout(t *testing.T) {
+	f, fake, _ := startGame(t, game.Config{TurnTimeout: 50 * time.Millisecond}, 3)
+	// Only alice moves, so bob is the one who runs out of time.
+	move(t, f, fake, alice, true)
+	for _, id := range []int64{alice, bob} {
+		waitText(t, fake, id, "Время вышло! bob слишком долго не делал ход.")
+		waitText(t, fake, id, "Игра окончена")
+	}
+}
+
+func TestTurnTimeoutNobodyMoved(t *testing.T) {
+	_, fake, _ := startGame(t, game.Config{TurnTimeout: 50 * time.Millisecond}, 3)
+	for _, id := range []int64{alice, bob} {
+		waitText(t, fake, id, "Время вышло! Никто из игроков не сделал ход.")
+		waitText(t, fake, id, "Игра окончена")
+	}
+}
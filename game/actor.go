@@ -0,0 +1,117 @@
+package game
+
+import (
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/strategy"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessionLinger is how long a finished session stays around so its players can
+// still answer the rematch offer.
+const sessionLinger = 5 * time.Minute
+
+// actor owns one session. The session, its bot opponent and its timers are
+// only ever touched on the actor's goroutine; everyone else sends it commands.
+//
+// Commands may take the manager's routing lock, but nothing may wait for an
+// actor while holding that lock, and a command must never wait for its own actor.
+type actor struct {
+	id      int64
+	players [2]int64
+	// spectateID is the session's spectate link key, empty without spectators.
+	spectateID string
+
+	inbox    chan func()
+	quit     chan struct{}
+	stopOnce sync.Once
+
+	// registered is set once the actor runs; until then unlogged collects the
+	// events of its session (see Manager.emitFor).
+	registered bool
+	unlogged   []GameEvent
+
+	// active is set while the session's game hasn't ended, so the manager can
+	// tell under its routing lock whether the players are free (see
+	// Manager.busy). It is only ever raised with that lock held.
+	active atomic.Bool
+
+	// Owned by the actor goroutine.
+	session  *models.Session
+	opponent strategy.Strategy
+	timer    *time.Timer
+	linger   *time.Timer
+}
+
+// newActor creates the actor of session. It doesn't run until registered, so
+// until then its creator may work on the session directly.
+func newActor(session *models.Session, opponent strategy.Strategy) *actor {
+	a := &actor{
+		id:         session.ID,
+		players:    [2]int64{session.PlayerA.ID, session.PlayerB.ID},
+		spectateID: session.SpectateID,
+		inbox:      make(chan func()),
+		quit:       make(chan struct{}),
+		session:    session,
+		opponent:   opponent,
+	}
+	return a
+}
+
+func (a *actor) loop() {
+	defer a.stopTimers()
+	for {
+		select {
+		case cmd := <-a.inbox:
+			cmd()
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// do runs fn on the actor's goroutine and waits for it to finish.
+// It reports false if the actor has stopped.
+func (a *actor) do(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case a.inbox <- func() { fn(); close(done) }:
+		<-done
+		return true
+	case <-a.quit:
+		return false
+	}
+}
+
+// stop makes the actor exit after the command it is running, if any.
+// It never blocks, so it is safe to call from anywhere, the actor itself included.
+func (a *actor) stop() {
+	a.stopOnce.Do(func() { close(a.quit) })
+}
+
+func (a *actor) stopTimers() {
+	a.stopTurnTimer()
+	a.stopLinger()
+}
+
+// stopTurnTimer cancels the turn timer. Actor goroutine only.
+func (a *actor) stopTurnTimer() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+// stopLinger cancels the cleanup of a finished session. Actor goroutine only.
+func (a *actor) stopLinger() {
+	if a.linger != nil {
+		a.linger.Stop()
+		a.linger = nil
+	}
+}
+
+// snapshot is a copy of the session safe to hand out. Actor goroutine only.
+func (a *actor) snapshot() *models.Session {
+	return a.session.Clone()
+}
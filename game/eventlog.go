@@ -0,0 +1,324 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"time"
+)
+
+// EventKind names what a GameEvent records.
+type EventKind string
+
+const (
+	KindInviteCreated  EventKind = "invite-created"  // a player opened an invite
+	KindInviteAccepted EventKind = "invite-accepted" // someone took it up, starting a game
+	KindGameStarted    EventKind = "game-started"    // the first round of a game began
+	KindChoice         EventKind = "choice"          // a player moved
+	KindRound          EventKind = "round"           // both moves were in and the round was scored
+	KindTimeout        EventKind = "timeout"         // a player ran out of time and was made to defect
+	KindForfeit        EventKind = "forfeit"         // a player quit the game
+	KindRematch        EventKind = "rematch"         // a new game started between the same players
+)
+
+// GameEvent is one change to a game, appended to the event log as it happens
+// and never changed afterwards. Which fields are set depends on Kind.
+type GameEvent struct {
+	Time      time.Time `json:"time"`
+	Kind      EventKind `json:"kind"`
+	SessionID int64     `json:"session_id,omitempty"`
+	GameID    string    `json:"game_id,omitempty"`
+	InviteID  string    `json:"invite_id,omitempty"`
+	// PlayerID is who acted: the inviter, the accepter, the player who moved,
+	// ran out of time or forfeited.
+	PlayerID int64               `json:"player_id,omitempty"`
+	Round    int                 `json:"round,omitempty"`
+	Choice   models.PlayerChoice `json:"choice,omitempty"`
+	// Settings are those of a new invite, Setup those of a game that started
+	// and Result the outcome of a scored round.
+	Settings *models.GameSettings `json:"settings,omitempty"`
+	Setup    *GameSetup           `json:"setup,omitempty"`
+	Result   *models.RoundResult  `json:"result,omitempty"`
+}
+
+// GameSetup is how a game started: who played it and by which rules.
+type GameSetup struct {
+	Players [2]RecordPlayer `json:"players"`
+	Rounds  int             `json:"rounds"`
+	Payoff  models.Payoff   `json:"payoff"`
+	// TurnTimeout is zero when the game uses the manager's default.
+	TurnTimeout     time.Duration `json:"turn_timeout,omitempty"`
+	TournamentID    string        `json:"tournament_id,omitempty"`
+	TournamentRound int           `json:"tournament_round,omitempty"`
+}
+
+// emit appends events to the event log. A failure to log doesn't stop the
+// game; it is only reported. Appending may wait for the disk, so emit is never
+// called with the routing lock held.
+func (m *Manager) emit(events ...GameEvent) {
+	for _, e := range events {
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		if err := m.events.Append(logKey(e), e); err != nil {
+			log.Printf("Failed to log %s event of game %s: %v", e.Kind, e.GameID, err)
+		}
+	}
+}
+
+// logKey files an event under its game, or under its invite while there is
+// no game yet, so the events of one game are read back together.
+func logKey(e GameEvent) string {
+	if e.GameID != "" {
+		return "game:" + e.GameID
+	}
+	return "invite:" + e.InviteID
+}
+
+// emitFor emits an event of the session of a. The creator of an actor that
+// isn't registered yet holds the routing lock, so the event is kept in
+// a.unlogged for the creator to emit once it lets go.
+func (m *Manager) emitFor(a *actor, e GameEvent) {
+	if !a.registered {
+		a.unlogged = append(a.unlogged, e)
+		return
+	}
+	m.emit(e)
+}
+
+// startEvent records the start of the game session has just entered.
+func startEvent(kind EventKind, session *models.Session) GameEvent {
+	pA, pB := session.PlayerA, session.PlayerB
+	return GameEvent{
+		Time:      session.StartedAt,
+		Kind:      kind,
+		SessionID: session.ID,
+		GameID:    session.GameID,
+		Setup: &GameSetup{
+			Players: [2]RecordPlayer{
+				{ID: pA.ID, Username: pA.Username, Bot: pA.IsBot},
+				{ID: pB.ID, Username: pB.Username, Bot: pB.IsBot},
+			},
+			Rounds:          session.TotalRounds,
+			Payoff:          session.Payoff,
+			TurnTimeout:     session.TurnTimeout,
+			TournamentID:    session.TournamentID,
+			TournamentRound: session.TournamentRound,
+		},
+	}
+}
+
+// choiceEvent records a move player has just made in the current round.
+func choiceEvent(session *models.Session, player *models.Player) GameEvent {
+	return GameEvent{
+		Time:      player.LastMoveTime,
+		Kind:      KindChoice,
+		SessionID: session.ID,
+		GameID:    session.GameID,
+		PlayerID:  player.ID,
+		Round:     session.CurrentRound,
+		Choice:    player.CurrentChoice,
+	}
+}
+
+// GameEvents reads the events of a game from the log, oldest first, starting
+// with the invite the game was created from, if any.
+func (m *Manager) GameEvents(gameID string) ([]GameEvent, error) {
+	events, err := m.scanEvents(logKey(GameEvent{GameID: gameID}))
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("в журнале нет событий этой игры")
+	}
+	var inviteID string
+	for _, e := range events {
+		if e.Kind == KindInviteAccepted {
+			inviteID = e.InviteID
+		}
+	}
+	if inviteID == "" {
+		return events, nil
+	}
+
+	// The invite was logged before the game had an ID.
+	created, err := m.scanEvents(logKey(GameEvent{InviteID: inviteID}))
+	if err != nil {
+		return nil, err
+	}
+	return append(created, events...), nil
+}
+
+// scanEvents reads the events filed under key.
+func (m *Manager) scanEvents(key string) ([]GameEvent, error) {
+	var events []GameEvent
+	err := m.events.Scan(key, func(record []byte) error {
+		var e GameEvent
+		if err := json.Unmarshal(record, &e); err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать журнал событий: %v", err)
+	}
+	return events, nil
+}
+
+// ReplayGame rebuilds a game by folding its events, as returned by
+// GameEvents. With round > 0 it stops once that round is scored, giving the
+// game as it stood then. Events that contradict the game so far, such as a
+// round scored differently from the moves made, are an error.
+//
+// The session it returns is a view for inspecting a game, such as settling a
+// dispute; it is not live. The manager doesn't restore games from the log, so
+// games in progress are still lost when the bot restarts.
+func ReplayGame(events []GameEvent, round int) (*models.Session, error) {
+	var session *models.Session
+	for _, e := range events {
+		switch e.Kind {
+		case KindInviteCreated, KindInviteAccepted:
+			continue
+		case KindGameStarted, KindRematch:
+			if e.Setup == nil {
+				return nil, fmt.Errorf("событие %s без настроек игры", e.Kind)
+			}
+			session = replayStart(e)
+			continue
+		}
+		if session == nil {
+			return nil, fmt.Errorf("журнал игры %s не начинается с ее начала", e.GameID)
+		}
+		if err := replayEvent(session, e); err != nil {
+			return nil, fmt.Errorf("событие %s в %s: %v", e.Kind, e.Time.Format(transcriptTime), err)
+		}
+		if round > 0 && e.Kind == KindRound && e.Result.Round == round {
+			return session, nil
+		}
+	}
+	if session == nil {
+		return nil, fmt.Errorf("в журнале нет начала игры")
+	}
+	if round > 0 {
+		return nil, fmt.Errorf("в игре сыграно раундов: %d", len(session.History))
+	}
+	return session, nil
+}
+
+// replayStart is the session of a game as it started.
+func replayStart(e GameEvent) *models.Session {
+	setup := e.Setup
+	a, b := setup.Players[0], setup.Players[1]
+	return &models.Session{
+		ID:              e.SessionID,
+		GameID:          e.GameID,
+		PlayerA:         &models.Player{ID: a.ID, Username: a.Username, IsBot: a.Bot},
+		PlayerB:         &models.Player{ID: b.ID, Username: b.Username, IsBot: b.Bot},
+		TotalRounds:     setup.Rounds,
+		CurrentRound:    1,
+		State:           models.StateInProgress,
+		History:         make([]models.RoundResult, 0),
+		StartedAt:       e.Time,
+		Payoff:          setup.Payoff,
+		TurnTimeout:     setup.TurnTimeout,
+		TournamentID:    setup.TournamentID,
+		TournamentRound: setup.TournamentRound,
+	}
+}
+
+// replayEvent applies an event to a game that has started.
+func replayEvent(session *models.Session, e GameEvent) error {
+	// When neither player moved, the first timeout ends the game and the
+	// second one follows it.
+	if e.Kind == KindTimeout && session.State == models.StateFinished && session.TimedOut != 0 &&
+		!session.BothTimedOut && e.Round == session.CurrentRound {
+		if player := replayPlayer(session, e.PlayerID); player != nil && player.CurrentChoice == models.ChoiceNone {
+			player.CurrentChoice = models.ChoiceDefect
+			session.BothTimedOut = true
+			return nil
+		}
+	}
+	if session.State != models.StateInProgress {
+		return fmt.Errorf("игра уже окончена")
+	}
+	switch e.Kind {
+	case KindChoice:
+		player := replayPlayer(session, e.PlayerID)
+		if player == nil {
+			return fmt.Errorf("игрок %d не участвует в игре", e.PlayerID)
+		}
+		if e.Round != session.CurrentRound {
+			return fmt.Errorf("ход в раунде %d, а идет раунд %d", e.Round, session.CurrentRound)
+		}
+		if player.CurrentChoice != models.ChoiceNone {
+			return fmt.Errorf("игрок %d уже сделал ход", e.PlayerID)
+		}
+		player.CurrentChoice = e.Choice
+		if !player.IsBot {
+			player.LastMoveTime = e.Time
+		}
+	case KindRound:
+		r := e.Result
+		if r == nil || r.Round != session.CurrentRound {
+			return fmt.Errorf("итог не того раунда")
+		}
+		pA, pB := session.PlayerA, session.PlayerB
+		if r.PlayerAChoice != pA.CurrentChoice || r.PlayerBChoice != pB.CurrentChoice {
+			return fmt.Errorf("ходы раунда %d не совпадают со сделанными", r.Round)
+		}
+		if a, b := session.Payoff.Scores(r.PlayerAChoice, r.PlayerBChoice); a != r.PlayerAScore || b != r.PlayerBScore {
+			return fmt.Errorf("раунд %d оценен в %d:%d вместо %d:%d", r.Round, r.PlayerAScore, r.PlayerBScore, a, b)
+		}
+		pA.Score += r.PlayerAScore
+		pB.Score += r.PlayerBScore
+		session.History = append(session.History, *r)
+		session.CurrentRound++
+		pA.CurrentChoice = models.ChoiceNone
+		pB.CurrentChoice = models.ChoiceNone
+		// A round scored when time ran out is the last one.
+		if session.CurrentRound > session.TotalRounds || session.TimedOut != 0 {
+			session.State = models.StateFinished
+		}
+	case KindTimeout:
+		player := replayPlayer(session, e.PlayerID)
+		if player == nil {
+			return fmt.Errorf("игрок %d не участвует в игре", e.PlayerID)
+		}
+		player.CurrentChoice = models.ChoiceDefect
+		session.TimedOut = player.ID
+		// If the opponent had moved, the round is scored next and ends the game.
+		if replayOpponent(session, player).CurrentChoice == models.ChoiceNone {
+			session.State = models.StateFinished
+		}
+	case KindForfeit:
+		if replayPlayer(session, e.PlayerID) == nil {
+			return fmt.Errorf("игрок %d не участвует в игре", e.PlayerID)
+		}
+		session.ForfeitedBy = e.PlayerID
+		session.State = models.StateAbandoned
+	default:
+		return fmt.Errorf("неизвестное событие")
+	}
+	return nil
+}
+
+// replayPlayer is the player of session with the given ID, or nil.
+func replayPlayer(session *models.Session, id int64) *models.Player {
+	switch id {
+	case session.PlayerA.ID:
+		return session.PlayerA
+	case session.PlayerB.ID:
+		return session.PlayerB
+	}
+	return nil
+}
+
+// replayOpponent is the other player of session.
+func replayOpponent(session *models.Session, player *models.Player) *models.Player {
+	if player == session.PlayerA {
+		return session.PlayerB
+	}
+	return session.PlayerA
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"sync"
+	"testing"
+)
+
+// lockCheckLog is an in-memory log that notes every event appended while the
+// manager's routing lock is held.
+type lockCheckLog struct {
+	*storage.MemoryLog
+	m *Manager
+
+	mu     sync.Mutex
+	locked []EventKind
+}
+
+func (l *lockCheckLog) Append(key string, v interface{}) error {
+	if l.m.mu.TryLock() {
+		l.m.mu.Unlock()
+	} else {
+		l.mu.Lock()
+		l.locked = append(l.locked, v.(GameEvent).Kind)
+		l.mu.Unlock()
+	}
+	return l.MemoryLog.Append(key, v)
+}
+
+func TestEventsAreLoggedOutsideTheLock(t *testing.T) {
+	log := &lockCheckLog{MemoryLog: storage.NewMemoryLog()}
+	m := NewManager(Config{EventLog: log})
+	log.m = m
+
+	inviteID, err := m.CreateInvite(1, "alice", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := m.AcceptInvite(inviteID, 2, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateBotGame(3, "carol", 2, "alld"); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.locked) > 0 {
+		t.Errorf("logged under the lock: %v", log.locked)
+	}
+
+	events, err := m.GameEvents(session.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []EventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	want := []EventKind{KindInviteCreated, KindInviteAccepted, KindGameStarted}
+	if len(kinds) != len(want) {
+		t.Fatalf("events = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("events = %v, want %v", kinds, want)
+		}
+	}
+}
+
+func TestReplayGame(t *testing.T) {
+	m := NewManager(Config{})
+	inviteID, err := m.CreateInvite(1, "alice", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := m.AcceptInvite(inviteID, 2, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := [][2]models.PlayerChoice{
+		{models.ChoiceNegotiate, models.ChoiceDefect},
+		{models.ChoiceDefect, models.ChoiceDefect},
+	}
+	for round, move := range moves {
+		if _, err := m.SubmitChoice(1, session.GameID, round+1, move[0]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.SubmitChoice(2, session.GameID, round+1, move[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := m.GameEvents(session.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := ReplayGame(events, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.State != models.StateFinished || final.PlayerA.Score != 1 || final.PlayerB.Score != 6 {
+		t.Errorf("replayed game is %s at %d:%d, want finished at 1:6", final.State, final.PlayerA.Score, final.PlayerB.Score)
+	}
+
+	first, err := ReplayGame(events, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.State != models.StateInProgress || len(first.History) != 1 || first.PlayerB.Score != 5 {
+		t.Errorf("after round one the game is %s with %d rounds, bob at %d", first.State, len(first.History), first.PlayerB.Score)
+	}
+	if _, err := ReplayGame(events, 3); err == nil {
+		t.Error("replaying a round that was never played succeeded")
+	}
+
+	// A round scored differently from the moves made is caught.
+	tampered := append([]GameEvent(nil), events...)
+	for i, e := range tampered {
+		if e.Kind == KindRound {
+			r := *e.Result
+			r.PlayerAScore = 3
+			tampered[i].Result = &r
+			break
+		}
+	}
+	if _, err := ReplayGame(tampered, 0); err == nil {
+		t.Error("a tampered round replayed without an error")
+	}
+}
@@ -0,0 +1,206 @@
+package game
+
+import (
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/strategy"
+	"strings"
+)
+
+// MoveOutcome describes what happened after a player submitted a move.
+// Frontends turn it into messages; it carries no transport-specific data.
+type MoveOutcome struct {
+	Session *models.Session
+	// RoundResolved is set once both players have moved and the round was scored.
+	RoundResolved bool
+	// ResultA and ResultB are the round reports for each player, including the score line.
+	ResultA string
+	ResultB string
+	// Finished is set when the resolved round was the last one.
+	Finished bool
+}
+
+// SubmitChoice records a move for the given round of the given game and, once
+// both players have moved, scores the round. Recording and scoring are one
+// command on the session's goroutine, so however many taps race each other,
+// every round is scored exactly once and only the first move of each player counts.
+func (m *Manager) SubmitChoice(playerID int64, gameID string, round int, choice models.PlayerChoice) (*MoveOutcome, error) {
+	a, ok := m.actorFor(playerID)
+	if !ok {
+		return nil, ErrExpired
+	}
+
+	var (
+		outcome *MoveOutcome
+		err     error
+	)
+	ran := a.do(func() {
+		var bothChose bool
+		bothChose, err = m.recordChoice(a, playerID, gameID, round, choice)
+		if err != nil {
+			return
+		}
+		outcome = &MoveOutcome{}
+		if bothChose {
+			resultA, resultB := m.resolveRound(a)
+			outcome.RoundResolved = true
+			outcome.ResultA = resultA
+			outcome.ResultB = resultB
+			outcome.Finished = a.session.State == models.StateFinished
+		}
+		outcome.Session = a.snapshot()
+	})
+	if !ran {
+		return nil, ErrExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if outcome.RoundResolved {
+		outcome.ResultA += ScoreLine(outcome.Session, outcome.Session.PlayerA)
+		outcome.ResultB += ScoreLine(outcome.Session, outcome.Session.PlayerB)
+	}
+	return outcome, nil
+}
+
+// ChoiceName is the human-readable name of a move.
+func ChoiceName(choice models.PlayerChoice) string {
+	if choice == models.ChoiceNegotiate {
+		return "Сотрудничать"
+	}
+	return "Предать"
+}
+
+// RoundPrompt is the text shown to both players when a round starts.
+func RoundPrompt(session *models.Session) string {
+	prompt := fmt.Sprintf("Раунд %d из %d\nВаш ход?", session.CurrentRound, session.TotalRounds)
+	if n := len(session.Spectators); n > 0 {
+		prompt += fmt.Sprintf("\n👁 Зрителей: %d", n)
+	}
+	return prompt
+}
+
+// SpectatorReport is the last round's result as spectators see it: both
+// moves, what they scored and the running score.
+func SpectatorReport(session *models.Session) string {
+	if len(session.History) == 0 {
+		return ""
+	}
+	round := session.History[len(session.History)-1]
+	pA, pB := session.PlayerA, session.PlayerB
+	return fmt.Sprintf("👁 Раунд %d из %d\n%s: %s (%+d)\n%s: %s (%+d)\n\nСчет: %s %d — %d %s",
+		round.Round, session.TotalRounds,
+		pA.Username, ChoiceName(round.PlayerAChoice), round.PlayerAScore,
+		pB.Username, ChoiceName(round.PlayerBChoice), round.PlayerBScore,
+		pA.Username, pA.Score, pB.Score, pB.Username)
+}
+
+// MatchCard is the public card of a game challenged in a group chat: the moves
+// of every round so far, the score and where the game stands. A note, when
+// given, tells how the game was cut short.
+func MatchCard(session *models.Session, note string) string {
+	pA, pB := session.PlayerA, session.PlayerB
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⚔️ %s против %s\n", pA.Username, pB.Username)
+	for _, round := range session.History {
+		fmt.Fprintf(&sb, "\nРаунд %d: %s %s (%+d) — %s %s (%+d)",
+			round.Round, pA.Username, choiceEmoji(round.PlayerAChoice), round.PlayerAScore,
+			pB.Username, choiceEmoji(round.PlayerBChoice), round.PlayerBScore)
+	}
+	fmt.Fprintf(&sb, "\n\nСчет: %s %d — %d %s\n", pA.Username, pA.Score, pB.Score, pB.Username)
+	if note != "" {
+		sb.WriteString("\n" + note)
+	}
+
+	switch {
+	case session.State == models.StateWaitingForPlayerB || session.State == models.StateInProgress || session.State == models.StateResolvingRound:
+		fmt.Fprintf(&sb, "\n⏳ Идет раунд %d из %d. Ходы делаются в личных сообщениях с ботом.", session.CurrentRound, session.TotalRounds)
+	case session.ForfeitedBy == pA.ID:
+		fmt.Fprintf(&sb, "\n🏁 Игра окончена. %s побеждает по умолчанию.", pB.Username)
+	case session.ForfeitedBy == pB.ID:
+		fmt.Fprintf(&sb, "\n🏁 Игра окончена. %s побеждает по умолчанию.", pA.Username)
+	case pA.Score > pB.Score:
+		fmt.Fprintf(&sb, "\n🏁 Игра окончена. 🏆 %s победил!", pA.Username)
+	case pB.Score > pA.Score:
+		fmt.Fprintf(&sb, "\n🏁 Игра окончена. 🏆 %s победил!", pB.Username)
+	default:
+		sb.WriteString("\n🏁 Игра окончена. 🤝 Ничья!")
+	}
+	return sb.String()
+}
+
+// choiceEmoji is a move as shown on match cards.
+func choiceEmoji(choice models.PlayerChoice) string {
+	if choice == models.ChoiceNegotiate {
+		return "🤝"
+	}
+	return "⚔️"
+}
+
+// ScoreLine is the running score as seen by the given player.
+func ScoreLine(session *models.Session, player *models.Player) string {
+	opponent := session.PlayerB
+	if player == session.PlayerB {
+		opponent = session.PlayerA
+	}
+	return fmt.Sprintf("\n\nСчет:\n- Вы: %d\n- %s: %d", player.Score, opponent.Username, opponent.Score)
+}
+
+// FinalSummary is the end-of-game scoreboard sent to both players.
+func FinalSummary(session *models.Session) string {
+	var winnerText string
+	pA := session.PlayerA
+	pB := session.PlayerB
+
+	switch {
+	case pA.Score > pB.Score:
+		winnerText = fmt.Sprintf("🏆 %s победил! 🏆", pA.Username)
+	case pB.Score > pA.Score:
+		winnerText = fmt.Sprintf("🏆 %s победил! 🏆", pB.Username)
+	default:
+		winnerText = "🤝 Ничья! 🤝"
+	}
+
+	return fmt.Sprintf(
+		"🏁 Игра окончена! 🏁\n\n"+
+			"Итоговый счет:\n"+
+			"---------------------\n"+
+			"Игрок: %s\nОчки: %d\n\n"+
+			"Игрок: %s\nОчки: %d\n"+
+			"---------------------\n\n"+
+			"%s",
+		pA.Username, pA.Score, pB.Username, pB.Score, winnerText)
+}
+
+// styleMatches is how many of the best-fitting strategies are shown to a player.
+const styleMatches = 3
+
+// GameStyle tells a player which classic strategies their moves in this game resembled.
+// It returns an empty string when there is nothing to report.
+func GameStyle(session *models.Session, player *models.Player) string {
+	if player.IsBot || len(session.History) == 0 {
+		return ""
+	}
+	fits := strategy.Classify(strategy.FromHistory(session.History, player == session.PlayerA))
+	return "🧬 Ваш стиль в этой игре\n\n" + FormatFits(fits)
+}
+
+// FormatFits lists the best matching strategies and explains the closest one.
+func FormatFits(fits []strategy.Fit) string {
+	if len(fits) == 0 {
+		return "Недостаточно данных."
+	}
+
+	var sb strings.Builder
+	for i, fit := range fits {
+		if i == styleMatches {
+			break
+		}
+		fmt.Fprintf(&sb, "%d. %s — %d%%\n", i+1, fit.Name, fit.Percent())
+	}
+
+	best := fits[0]
+	fmt.Fprintf(&sb, "\nБольше всего вы похожи на %s: эта стратегия %s.", best.Name, strategy.Describe(best.Name))
+	return sb.String()
+}
@@ -0,0 +1,176 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"sort"
+	"strconv"
+)
+
+// Group chat collections, both keyed by chat ID.
+const (
+	// groupSettingsCollection stores the defaults for challenges made in a group.
+	groupSettingsCollection = "group_settings"
+	// leaderboardsCollection stores each group's standings over the games challenged there.
+	leaderboardsCollection = "leaderboards"
+	// leaderboardArchiveCollection keeps the leaderboards of past seasons,
+	// keyed by chat ID and season number.
+	leaderboardArchiveCollection = "leaderboard_archive"
+)
+
+// DefaultGroupRounds is how many rounds challenges in a group last until its admins choose otherwise.
+const DefaultGroupRounds = 10
+
+// GroupSettings loads the settings challenges made in a group chat start with.
+func (m *Manager) GroupSettings(chatID int64) (models.GameSettings, error) {
+	settings := models.GameSettings{Rounds: DefaultGroupRounds, Payoff: models.ClassicPayoff}
+	err := m.store.Load(groupSettingsCollection, strconv.FormatInt(chatID, 10), &settings)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return settings, fmt.Errorf("не удалось загрузить настройки группы: %v", err)
+	}
+	return settings, nil
+}
+
+// SetGroupSettings saves the settings challenges made in a group chat start
+// with. Only the rules of the game are kept: who may accept is up to each challenge.
+func (m *Manager) SetGroupSettings(chatID int64, settings models.GameSettings) error {
+	if settings.Rounds <= 0 {
+		return fmt.Errorf("неверное количество раундов: %d", settings.Rounds)
+	}
+	if settings.Payoff == (models.Payoff{}) {
+		settings.Payoff = models.ClassicPayoff
+	}
+	settings.Public, settings.Target = false, models.InviteTarget{}
+	if err := m.store.Save(groupSettingsCollection, strconv.FormatInt(chatID, 10), settings); err != nil {
+		return fmt.Errorf("не удалось сохранить настройки группы: %v", err)
+	}
+	return nil
+}
+
+// Standing is a player's record in one group's leaderboard.
+type Standing struct {
+	PlayerID int64  `json:"player_id"`
+	Username string `json:"username"`
+	Wins     int    `json:"wins"`
+	Draws    int    `json:"draws"`
+	Losses   int    `json:"losses"`
+	// Points is the total score over all of the player's games in the group.
+	Points int `json:"points"`
+}
+
+// Games is how many games the standing counts.
+func (s Standing) Games() int {
+	return s.Wins + s.Draws + s.Losses
+}
+
+type leaderboard struct {
+	// Season is the season the standings were counted in.
+	Season  int                  `json:"season,omitempty"`
+	Players map[string]*Standing `json:"players"`
+}
+
+// GroupLeaderboard ranks the players of a group chat by wins, then draws,
+// then the fewest losses. While a season is running, only its games count.
+func (m *Manager) GroupLeaderboard(chatID int64) ([]Standing, error) {
+	season, running := m.runningSeason()
+	m.groupsMu.Lock()
+	board, err := m.loadLeaderboard(chatID)
+	m.groupsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if running && board.Season != season {
+		return nil, nil
+	}
+
+	standings := make([]Standing, 0, len(board.Players))
+	for _, standing := range board.Players {
+		standings = append(standings, *standing)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		switch {
+		case a.Wins != b.Wins:
+			return a.Wins > b.Wins
+		case a.Draws != b.Draws:
+			return a.Draws > b.Draws
+		case a.Losses != b.Losses:
+			return a.Losses < b.Losses
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	return standings, nil
+}
+
+// loadLeaderboard loads a group's leaderboard. The caller must hold m.groupsMu.
+func (m *Manager) loadLeaderboard(chatID int64) (*leaderboard, error) {
+	board := &leaderboard{}
+	err := m.store.Load(leaderboardsCollection, strconv.FormatInt(chatID, 10), board)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("не удалось загрузить таблицу лидеров: %v", err)
+	}
+	if board.Players == nil {
+		board.Players = make(map[string]*Standing)
+	}
+	return board, nil
+}
+
+// recordLeaderboard adds a game challenged in a group chat to that group's
+// leaderboard. Whoever forfeited loses; otherwise the score decides.
+func (m *Manager) recordLeaderboard(session *models.Session) {
+	chatID := session.Card.ChatID
+	pA, pB := session.PlayerA, session.PlayerB
+	if chatID == 0 || pA.IsBot || pB.IsBot || (len(session.History) == 0 && session.ForfeitedBy == 0) {
+		return
+	}
+
+	season, running := m.runningSeason()
+	m.groupsMu.Lock()
+	defer m.groupsMu.Unlock()
+	board, err := m.loadLeaderboard(chatID)
+	if err != nil {
+		log.Printf("Failed to update leaderboard of chat %d: %v", chatID, err)
+		return
+	}
+	if running && board.Season != season {
+		// The first game of a season puts last season's standings away.
+		if len(board.Players) > 0 {
+			key := fmt.Sprintf("%d_%d", chatID, board.Season)
+			if err := m.store.Save(leaderboardArchiveCollection, key, board); err != nil {
+				log.Printf("Failed to archive leaderboard of chat %d: %v", chatID, err)
+				return
+			}
+		}
+		board = &leaderboard{Season: season, Players: make(map[string]*Standing)}
+	}
+	standing := func(player *models.Player) *Standing {
+		key := strconv.FormatInt(player.ID, 10)
+		s, ok := board.Players[key]
+		if !ok {
+			s = &Standing{PlayerID: player.ID}
+			board.Players[key] = s
+		}
+		s.Username = player.Username
+		s.Points += player.Score
+		return s
+	}
+	a, b := standing(pA), standing(pB)
+
+	switch {
+	case session.ForfeitedBy == pB.ID || session.ForfeitedBy == 0 && pA.Score > pB.Score:
+		a.Wins++
+		b.Losses++
+	case session.ForfeitedBy == pA.ID || pB.Score > pA.Score:
+		b.Wins++
+		a.Losses++
+	default:
+		a.Draws++
+		b.Draws++
+	}
+	if err := m.store.Save(leaderboardsCollection, strconv.FormatInt(chatID, 10), board); err != nil {
+		log.Printf("Failed to save leaderboard of chat %d: %v", chatID, err)
+	}
+}
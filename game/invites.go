@@ -0,0 +1,274 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Invite defaults.
+const (
+	DefaultInviteTTL      = time.Hour
+	DefaultMaxOpenInvites = 3
+)
+
+// ErrTooManyInvites is returned when a player already has as many open invites as allowed.
+var ErrTooManyInvites = errors.New("у вас слишком много открытых приглашений")
+
+// ErrInviteGone is returned for invites that were accepted, cancelled or have expired.
+var ErrInviteGone = errors.New("это приглашение недействительно или истекло")
+
+// ErrNotInvited is returned when someone other than the invited player tries to accept a targeted invite.
+var ErrNotInvited = errors.New("это приглашение адресовано другому игроку")
+
+// InviteTTL is how long a new invite can be accepted.
+func (m *Manager) InviteTTL() time.Duration {
+	return m.inviteTTL
+}
+
+// CreateInvite creates a pending invitation anyone can accept and returns the invite ID.
+func (m *Manager) CreateInvite(inviterID int64, inviterUsername string, rounds int) (string, error) {
+	invite, err := m.CreateGameInvite(inviterID, inviterUsername, models.GameSettings{Rounds: rounds})
+	if err != nil {
+		return "", err
+	}
+	return invite.InviteID, nil
+}
+
+// CreateGameInvite creates a pending invitation with the given settings and
+// returns it. The classic payoff table applies unless another one is given.
+// A target given by username is resolved to a player ID when the player is in
+// the user directory.
+func (m *Manager) CreateGameInvite(inviterID int64, inviterUsername string, settings models.GameSettings) (*models.PendingInvite, error) {
+	if settings.Rounds <= 0 {
+		return nil, fmt.Errorf("неверное количество раундов: %d", settings.Rounds)
+	}
+	if settings.Payoff == (models.Payoff{}) {
+		settings.Payoff = models.ClassicPayoff
+	}
+	target := settings.Target
+	if target.ID == 0 && target.Username != "" {
+		target.Username = strings.TrimPrefix(target.Username, "@")
+		target.ID, _ = m.LookupUser(target.Username)
+	}
+	if !target.IsZero() {
+		if target.Matches(inviterID, inviterUsername) {
+			return nil, fmt.Errorf("нельзя пригласить самого себя")
+		}
+		if settings.Public {
+			return nil, fmt.Errorf("приглашение для конкретного игрока нельзя опубликовать в лобби")
+		}
+	}
+	settings.Target = target
+
+	var events []GameEvent
+	// Appending to the log may wait for the disk, so it happens once the lock is released.
+	defer func() { m.emit(events...) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if len(m.openInvites(inviterID, now)) >= m.maxInvites {
+		return nil, ErrTooManyInvites
+	}
+
+	// Generate a unique invite ID
+	inviteID, err := utils.GenerateID(8)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сгенерировать ID приглашения: %v", err)
+	}
+
+	invite := &models.PendingInvite{
+		GameSettings:    settings,
+		InviteID:        inviteID,
+		InviterID:       inviterID,
+		InviterUsername: inviterUsername,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(m.inviteTTL),
+	}
+
+	m.pendingByID[inviteID] = invite
+	events = append(events, GameEvent{
+		Time:     now,
+		Kind:     KindInviteCreated,
+		InviteID: inviteID,
+		PlayerID: inviterID,
+		Settings: &settings,
+	})
+	created := *invite
+	return &created, nil
+}
+
+// SetInviteMessage remembers the inviter's waiting-room message of an invite,
+// so it can be updated when the invite is accepted, cancelled or expires.
+func (m *Manager) SetInviteMessage(inviteID string, messageID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if invite, ok := m.pendingByID[inviteID]; ok {
+		invite.MessageID = messageID
+	}
+}
+
+// SetInviteCard remembers the group match card of an invite, so it can follow
+// the game once the invite is accepted.
+func (m *Manager) SetInviteCard(inviteID string, card models.GroupCard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if invite, ok := m.pendingByID[inviteID]; ok {
+		invite.Card = card
+	}
+}
+
+// AcceptInvite checks for a pending invite and creates a new game session if
+// one exists. It returns the session and the invite it was created from.
+func (m *Manager) AcceptInvite(inviteID string, accepterID int64, accepterUsername string) (*models.Session, *models.PendingInvite, error) {
+	gameID, err := newGameID()
+	if err != nil {
+		return nil, nil, err
+	}
+	spectateID, err := utils.GenerateID(6)
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось сгенерировать ссылку для зрителей: %v", err)
+	}
+
+	var events []GameEvent
+	// Appending to the log may wait for the disk, so it happens once the lock is released.
+	defer func() { m.emit(events...) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invite, ok := m.pendingByID[inviteID]
+	if ok && !invite.Target.Matches(accepterID, accepterUsername) {
+		return nil, nil, ErrNotInvited
+	}
+	if !ok || !time.Now().Before(invite.ExpiresAt) {
+		return nil, nil, ErrInviteGone
+	}
+
+	if invite.InviterID == accepterID {
+		return nil, nil, fmt.Errorf("вы не можете принять собственное приглашение")
+	}
+	// The inviter may have started another game since; the invite stays open
+	// for when they are done. Both checks are made under the lock the game is
+	// registered with, so two invites can't start games for the same player.
+	if m.busy(invite.InviterID) {
+		return nil, nil, fmt.Errorf("пригласивший вас игрок сейчас в другой игре. Попробуйте позже")
+	}
+	if m.busy(accepterID) {
+		return nil, nil, fmt.Errorf("вы уже в игре! Вы не можете принять другое приглашение")
+	}
+
+	session := &models.Session{
+		ID:     invite.InviterID,
+		GameID: gameID,
+		PlayerA: &models.Player{
+			ID:       invite.InviterID,
+			Username: invite.InviterUsername,
+		},
+		PlayerB: &models.Player{
+			ID:       accepterID,
+			Username: accepterUsername,
+		},
+		TotalRounds:  invite.Rounds,
+		CurrentRound: 1,
+		State:        models.StateWaitingForPlayerB,
+		History:      make([]models.RoundResult, 0),
+		Payoff:       invite.Payoff,
+		TurnTimeout:  invite.TurnTimeout,
+		Card:         invite.Card,
+	}
+	if invite.AllowSpectators {
+		session.SpectateID = spectateID
+	}
+	a := newActor(session, nil)
+	m.mustFire(a, EventStart, nil)
+	snapshot := session.Clone()
+
+	if err := m.register(a); err != nil {
+		return nil, nil, err
+	}
+	events = append(events, GameEvent{
+		Kind:      KindInviteAccepted,
+		SessionID: session.ID,
+		GameID:    gameID,
+		InviteID:  inviteID,
+		PlayerID:  accepterID,
+	})
+	events = append(events, a.unlogged...)
+	delete(m.pendingByID, inviteID)
+	accepted := *invite
+	return snapshot, &accepted, nil
+}
+
+// CancelInvite withdraws one of the inviter's open invites and returns it.
+func (m *Manager) CancelInvite(inviterID int64, inviteID string) (*models.PendingInvite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invite, ok := m.pendingByID[inviteID]
+	if !ok || invite.InviterID != inviterID || !time.Now().Before(invite.ExpiresAt) {
+		return nil, ErrInviteGone
+	}
+	delete(m.pendingByID, inviteID)
+	cancelled := *invite
+	return &cancelled, nil
+}
+
+// OpenInvites lists the inviter's invites that can still be accepted, oldest first.
+func (m *Manager) OpenInvites(inviterID int64) []models.PendingInvite {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.openInvites(inviterID, time.Now())
+}
+
+// PublicInvites lists the invites open to anyone in the lobby, newest first.
+func (m *Manager) PublicInvites() []models.PendingInvite {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var invites []models.PendingInvite
+	for _, invite := range m.pendingByID {
+		if invite.Public && now.Before(invite.ExpiresAt) {
+			invites = append(invites, *invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+	return invites
+}
+
+// openInvites is OpenInvites for a caller that holds m.mu.
+func (m *Manager) openInvites(inviterID int64, now time.Time) []models.PendingInvite {
+	var invites []models.PendingInvite
+	for _, invite := range m.pendingByID {
+		if invite.InviterID == inviterID && now.Before(invite.ExpiresAt) {
+			invites = append(invites, *invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.Before(invites[j].CreatedAt)
+	})
+	return invites
+}
+
+// ExpireInvites removes the invites that expired by now and returns them, so
+// their waiting rooms can be closed. It is meant to be called periodically.
+func (m *Manager) ExpireInvites(now time.Time) []models.PendingInvite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []models.PendingInvite
+	for id, invite := range m.pendingByID {
+		if !now.Before(invite.ExpiresAt) {
+			expired = append(expired, *invite)
+			delete(m.pendingByID, id)
+		}
+	}
+	return expired
+}
@@ -1,190 +1,356 @@
 package game
 
 import (
+	"errors"
 	"fmt"
 	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
 	"prisoners-dilemma-bot/utils"
 	"sync"
 	"time"
 )
 
-// Manager handles all active game sessions and pending invitations.
+// Config holds the dependencies and tunables of a Manager.
+type Config struct {
+	Store   storage.Store
+	Learner strategy.LearnerConfig
+	// TurnTimeout is how long a player has to move; it defaults to DefaultTurnTimeout.
+	TurnTimeout time.Duration
+	// InviteTTL is how long an invite can be accepted; it defaults to DefaultInviteTTL.
+	InviteTTL time.Duration
+	// MaxOpenInvites caps the open invites of one player; it defaults to DefaultMaxOpenInvites.
+	MaxOpenInvites int
+	// MaxSpectators caps the spectators of one game; it defaults to DefaultMaxSpectators.
+	MaxSpectators int
+	// SeasonSchedule is ScheduleWeekly or ScheduleMonthly to run seasons back
+	// to back (see SeasonTick); by default admins start and end them by hand.
+	SeasonSchedule string
+	// EventLog receives every change to every game (see eventlog.go); it
+	// defaults to an in-memory log.
+	EventLog storage.Log
+}
+
+// DefaultTurnTimeout is the time a player has to make a move.
+const DefaultTurnTimeout = 2 * time.Minute
+
+// ErrExpired is returned for moves and answers meant for a round or game that is already over.
+var ErrExpired = errors.New("эта кнопка устарела")
+
+// ErrAlreadyMoved is returned when a player moves twice in the same round; the first move stands.
+var ErrAlreadyMoved = errors.New("вы уже сделали ход в этом раунде")
+
+// ErrBusy is returned when a game can't start because one of its players is
+// still in another game that hasn't ended.
+var ErrBusy = errors.New("игрок уже в другой игре")
+
+// newGameID generates the ID that tells one game in a session from the next.
+func newGameID() (string, error) {
+	id, err := utils.GenerateID(4)
+	if err != nil {
+		return "", fmt.Errorf("не удалось сгенерировать ID игры: %v", err)
+	}
+	return id, nil
+}
+
+// Manager routes commands to game sessions. Each session is owned by an actor
+// goroutine (see actor.go); the manager itself only keeps track of pending
+// invites and of which actor a player belongs to. Sessions returned by its
+// methods are snapshots and may be read freely.
 type Manager struct {
-	sessions        map[int64]*models.Session
+	actors          map[int64]*actor
 	pendingByID     map[string]*models.PendingInvite
 	playerToSession map[int64]int64
+	spectateLinks   map[string]int64
 	mu              sync.RWMutex
-	timerCallbacks  map[int64]func()
+	store           storage.Store
+	events          storage.Log
+	learnerConfig   strategy.LearnerConfig
+	turnTimeout     time.Duration
+	inviteTTL       time.Duration
+	maxInvites      int
+	maxSpectators   int
+
+	// usersMu guards the cache of the user directory (see users.go).
+	usersMu   sync.Mutex
+	userIDs   map[string]int64
+	usernames map[int64]string
+
+	// groupsMu serializes updates to the group leaderboards (see groups.go).
+	groupsMu sync.Mutex
+
+	// ratingsMu serializes updates to the ratings (see ratings.go).
+	ratingsMu sync.Mutex
+
+	// seasonsMu guards the cache of the latest season (see seasons.go).
+	seasonsMu      sync.Mutex
+	seasonLoaded   bool
+	season         *Season
+	seasonSchedule string
+
+	// tournamentsMu guards the tournaments; tournamentsRun serializes starting
+	// their pairing rounds, which waits for actors (see tournaments.go).
+	tournamentsMu  sync.Mutex
+	tournamentsRun sync.Mutex
+	tournaments    map[string]*models.Tournament
 }
 
 // NewManager creates a new game manager.
-func NewManager() *Manager {
+func NewManager(cfg Config) *Manager {
+	store := cfg.Store
+	if store == nil {
+		store = storage.NewMemoryStore()
+	}
+	turnTimeout := cfg.TurnTimeout
+	if turnTimeout <= 0 {
+		turnTimeout = DefaultTurnTimeout
+	}
+	inviteTTL := cfg.InviteTTL
+	if inviteTTL <= 0 {
+		inviteTTL = DefaultInviteTTL
+	}
+	maxInvites := cfg.MaxOpenInvites
+	if maxInvites <= 0 {
+		maxInvites = DefaultMaxOpenInvites
+	}
+	events := cfg.EventLog
+	if events == nil {
+		events = storage.NewMemoryLog()
+	}
+	maxSpectators := cfg.MaxSpectators
+	if maxSpectators <= 0 {
+		maxSpectators = DefaultMaxSpectators
+	}
 	return &Manager{
-		sessions:        make(map[int64]*models.Session),
+		actors:          make(map[int64]*actor),
 		pendingByID:     make(map[string]*models.PendingInvite),
 		playerToSession: make(map[int64]int64),
-		timerCallbacks:  make(map[int64]func()),
+		spectateLinks:   make(map[string]int64),
+		store:           store,
+		events:          events,
+		learnerConfig:   cfg.Learner,
+		turnTimeout:     turnTimeout,
+		inviteTTL:       inviteTTL,
+		maxInvites:      maxInvites,
+		maxSpectators:   maxSpectators,
+		seasonSchedule:  cfg.SeasonSchedule,
+		userIDs:         make(map[string]int64),
+		usernames:       make(map[int64]string),
+		tournaments:     make(map[string]*models.Tournament),
 	}
 }
 
-// CreateInvite creates a pending invitation and returns the invite ID.
-func (m *Manager) CreateInvite(inviterID int64, inviterUsername string, rounds int) (string, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Generate a unique invite ID
-	inviteID, err := utils.GenerateID(8)
-	if err != nil {
-		return "", fmt.Errorf("не удалось сгенерировать ID приглашения: %v", err)
+// register makes a the owner of its session, routes its players to it and
+// starts it, retiring whatever finished actor held the session before. It
+// fails with ErrBusy if one of the players is still in a game that hasn't
+// ended, so checking the players and starting the game is one step. The
+// caller must hold m.mu.
+func (m *Manager) register(a *actor) error {
+	for _, playerID := range a.players {
+		if m.busy(playerID) {
+			return ErrBusy
+		}
 	}
-
-	invite := &models.PendingInvite{
-		InviteID:        inviteID,
-		InviterID:       inviterID,
-		InviterUsername: inviterUsername,
-		Rounds:          rounds,
+	if old, ok := m.actors[a.id]; ok {
+		if old.active.Load() {
+			return ErrBusy
+		}
+		m.unroute(old)
+		old.stop()
 	}
-
-	m.pendingByID[inviteID] = invite
-	return inviteID, nil
+	m.actors[a.id] = a
+	for _, playerID := range a.players {
+		m.playerToSession[playerID] = a.id
+	}
+	if a.spectateID != "" {
+		m.spectateLinks[a.spectateID] = a.id
+	}
+	a.registered = true
+	go a.loop()
+	return nil
 }
 
-// AcceptInvite checks for a pending invite and creates a new game session if one exists.
-func (m *Manager) AcceptInvite(inviteID string, accepterID int64, accepterUsername string) (*models.Session, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Busy reports whether a player is in a game that hasn't ended. Finished
+// games waiting for a rematch answer don't count. It is the check every new
+// game makes of its players.
+func (m *Manager) Busy(playerID int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.busy(playerID)
+}
 
-	invite, ok := m.pendingByID[inviteID]
+// busy is Busy for a caller that holds m.mu.
+func (m *Manager) busy(playerID int64) bool {
+	sessionID, ok := m.playerToSession[playerID]
 	if !ok {
-		return nil, fmt.Errorf("это приглашение недействительно или истекло")
+		return false
 	}
+	a, ok := m.actors[sessionID]
+	return ok && a.active.Load()
+}
 
-	if invite.InviterID == accepterID {
-		return nil, fmt.Errorf("вы не можете принять собственное приглашение")
+// claim marks the finished game of a as going again, like register does for a
+// new one, unless a was retired or one of its players has since gone on to
+// another game. The caller runs on a's goroutine.
+func (m *Manager) claim(a *actor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.actors[a.id] != a {
+		return fmt.Errorf("исходная сессия не найдена")
 	}
+	for _, playerID := range a.players {
+		if m.playerToSession[playerID] != a.id {
+			return fmt.Errorf("другой игрок уже начал новую игру")
+		}
+	}
+	a.active.Store(true)
+	return nil
+}
 
-	session := &models.Session{
-		ID: invite.InviterID,
-		PlayerA: &models.Player{
-			ID:       invite.InviterID,
-			Username: invite.InviterUsername,
-		},
-		PlayerB: &models.Player{
-			ID:       accepterID,
-			Username: accepterUsername,
-		},
-		TotalRounds:  invite.Rounds,
-		CurrentRound: 1,
-		State:        models.StateInProgress,
-		History:      make([]models.RoundResult, 0),
-		TurnDeadline: time.Now().Add(2 * time.Minute),
+// unroute forgets a and every player still routed to it. The caller must hold m.mu.
+func (m *Manager) unroute(a *actor) {
+	if m.actors[a.id] != a {
+		return
 	}
+	delete(m.actors, a.id)
+	for _, playerID := range a.players {
+		if m.playerToSession[playerID] == a.id {
+			delete(m.playerToSession, playerID)
+		}
+	}
+	if a.spectateID != "" {
+		delete(m.spectateLinks, a.spectateID)
+	}
+}
 
-	m.sessions[session.ID] = session
-	m.playerToSession[session.PlayerA.ID] = session.ID
-	m.playerToSession[session.PlayerB.ID] = session.ID
+// retire removes a from the routing tables and stops it. It may be called from
+// one of a's own commands.
+func (m *Manager) retire(a *actor) {
+	m.mu.Lock()
+	m.unroute(a)
+	m.mu.Unlock()
+	a.stop()
+}
 
-	delete(m.pendingByID, inviteID)
-	return session, nil
+// actorFor returns the actor of the session a player is in.
+func (m *Manager) actorFor(playerID int64) (*actor, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessionID, ok := m.playerToSession[playerID]
+	if !ok {
+		return nil, false
+	}
+	a, ok := m.actors[sessionID]
+	return a, ok
 }
 
+// ForfeitGame ends a player's game in progress and awards it to their opponent.
+// The session is abandoned, so both players are free to start another game.
 func (m *Manager) ForfeitGame(playerID int64) (*models.Session, *models.Player, error) {
-	session, ok := m.FindSessionByPlayerID(playerID)
+	a, ok := m.actorFor(playerID)
 	if !ok {
 		return nil, nil, fmt.Errorf("вы не находитесь в активной игре")
 	}
 
-	session.Mutex.Lock()
-	defer session.Mutex.Unlock()
-
-	if session.State != models.StateInProgress {
-		return nil, nil, fmt.Errorf("эта игра уже завершена")
+	var (
+		snapshot *models.Session
+		err      error
+	)
+	ran := a.do(func() {
+		err = m.fire(a, EventForfeit, func() {
+			a.session.ForfeitedBy = playerID
+			m.emit(GameEvent{
+				Kind:      KindForfeit,
+				SessionID: a.session.ID,
+				GameID:    a.session.GameID,
+				PlayerID:  playerID,
+				Round:     a.session.CurrentRound,
+			})
+		})
+		if err == nil {
+			snapshot = a.snapshot()
+		}
+	})
+	if !ran {
+		return nil, nil, fmt.Errorf("вы не находитесь в активной игре")
 	}
-
-	var winner *models.Player
-	if playerID == session.PlayerA.ID {
-		winner = session.PlayerB
-	} else {
-		winner = session.PlayerA
+	if err != nil {
+		return nil, nil, err
 	}
 
-	session.State = models.StateFinished
-	m.endGame(session.ID)
-
-	return session, winner, nil
+	winner := snapshot.PlayerA
+	if playerID == snapshot.PlayerA.ID {
+		winner = snapshot.PlayerB
+	}
+	return snapshot, winner, nil
 }
 
-// FindSessionByPlayerID retrieves the session a player is currently in.
+// FindSessionByPlayerID returns a snapshot of the session a player is currently in.
 func (m *Manager) FindSessionByPlayerID(playerID int64) (*models.Session, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	sessionID, ok := m.playerToSession[playerID]
+	a, ok := m.actorFor(playerID)
 	if !ok {
 		return nil, false
 	}
-	session, ok := m.sessions[sessionID]
-	return session, ok
+	var snapshot *models.Session
+	if !a.do(func() { snapshot = a.snapshot() }) {
+		return nil, false
+	}
+	return snapshot, true
 }
 
-// RecordChoice records a player's move for the current round.
-// It returns true if both players have now made their choice for the round.
-func (m *Manager) RecordChoice(playerID int64, choice models.PlayerChoice) (*models.Session, bool, error) {
-	session, ok := m.FindSessionByPlayerID(playerID)
-	if !ok {
-		return nil, false, fmt.Errorf("активная игра не найдена")
+// recordChoice records a player's move for the given round of the given game.
+// It returns true if both players have now made their choice for the round,
+// and ErrExpired if the game or round has moved on since the move was offered.
+// Moves lock in: a second move in the same round fails with ErrAlreadyMoved.
+// Actor goroutine only.
+func (m *Manager) recordChoice(a *actor, playerID int64, gameID string, round int, choice models.PlayerChoice) (bool, error) {
+	session := a.session
+	if session.GameID != gameID || session.CurrentRound != round {
+		return false, ErrExpired
 	}
-
-	session.Mutex.Lock()
-	defer session.Mutex.Unlock()
-
-	if session.State != models.StateInProgress {
-		return nil, false, fmt.Errorf("игра не в процессе")
+	if err := m.fire(a, EventMove, nil); err != nil {
+		return false, err
 	}
 
 	player := session.PlayerA
 	if playerID == session.PlayerB.ID {
 		player = session.PlayerB
 	}
+	if player.CurrentChoice != models.ChoiceNone {
+		return false, ErrAlreadyMoved
+	}
 
 	player.CurrentChoice = choice
 	player.LastMoveTime = time.Now()
+	m.emit(choiceEvent(session, player))
 
-	bothPlayersChose := session.PlayerA.CurrentChoice != models.ChoiceNone && session.PlayerB.CurrentChoice != models.ChoiceNone
-
-	if bothPlayersChose {
-		m.clearTimer(session.ID)
-	}
-
-	return session, bothPlayersChose, nil
+	return allMoved(session) == nil, nil
 }
 
-func (m *Manager) ProcessRound(session *models.Session) (string, string) {
-	session.Mutex.Lock()
-	defer session.Mutex.Unlock()
-
+// resolveRound scores the current round once both players have moved and
+// moves on to the next round or ends the game. Actor goroutine only.
+func (m *Manager) resolveRound(a *actor) (string, string) {
+	m.mustFire(a, EventAllMoved, nil)
+	session := a.session
 	pA := session.PlayerA
 	pB := session.PlayerB
 	choiceA := pA.CurrentChoice
 	choiceB := pB.CurrentChoice
 
 	var resultA, resultB string
-	var scoreA, scoreB int
+	scoreA, scoreB := session.Payoff.Scores(choiceA, choiceB)
 
 	switch {
 	case choiceA == models.ChoiceNegotiate && choiceB == models.ChoiceNegotiate:
-		scoreA, scoreB = 3, 3
 		resultA = "Вы оба выбрали сотрудничество 🤝."
 		resultB = resultA
 	case choiceA == models.ChoiceNegotiate && choiceB == models.ChoiceDefect:
-		scoreA, scoreB = 0, 5
 		resultA = fmt.Sprintf("Вы сотрудничали 😇, но %s предал 😈.", pB.Username)
 		resultB = fmt.Sprintf("%s сотрудничал 😇, но вы предали 😈.", pA.Username)
 	case choiceA == models.ChoiceDefect && choiceB == models.ChoiceNegotiate:
-		scoreA, scoreB = 5, 0
 		resultA = fmt.Sprintf("Вы предали 😈, пока %s сотрудничал 😇.", pB.Username)
 		resultB = fmt.Sprintf("Вы сотрудничали 😇, но %s предал 😈.", pA.Username)
 	case choiceA == models.ChoiceDefect && choiceB == models.ChoiceDefect:
-		scoreA, scoreB = 1, 1
 		resultA = "Вы оба выбрали предательство ⚔️."
 		resultB = resultA
 	}
@@ -193,15 +359,30 @@ func (m *Manager) ProcessRound(session *models.Session) (string, string) {
 	pB.Score += scoreB
 
 	// NEW: Store round result in history
+	roundStart := session.TurnDeadline.Add(-m.turnTimeoutOf(session))
 	roundResult := models.RoundResult{
-		Round:         session.CurrentRound,
-		PlayerAChoice: choiceA,
-		PlayerBChoice: choiceB,
-		PlayerAScore:  scoreA,
-		PlayerBScore:  scoreB,
-		Timestamp:     time.Now(),
+		Round:           session.CurrentRound,
+		PlayerAChoice:   choiceA,
+		PlayerBChoice:   choiceB,
+		PlayerAScore:    scoreA,
+		PlayerBScore:    scoreB,
+		Timestamp:       time.Now(),
+		PlayerAResponse: responseTime(pA, roundStart),
+		PlayerBResponse: responseTime(pB, roundStart),
 	}
 	session.History = append(session.History, roundResult)
+	m.emit(GameEvent{
+		Time:      roundResult.Timestamp,
+		Kind:      KindRound,
+		SessionID: session.ID,
+		GameID:    session.GameID,
+		Round:     roundResult.Round,
+		Result:    &roundResult,
+	})
+
+	if learner, ok := a.opponent.(strategy.Learner); ok {
+		learner.Observe(strategy.FromHistory(session.History, false))
+	}
 
 	roundSummaryA := fmt.Sprintf("Вы получили %d очков. Соперник получил %d очков.", scoreA, scoreB)
 	roundSummaryB := fmt.Sprintf("Вы получили %d очков. Соперник получил %d очков.", scoreB, scoreA)
@@ -215,179 +396,261 @@ func (m *Manager) ProcessRound(session *models.Session) (string, string) {
 	pB.CurrentChoice = models.ChoiceNone
 
 	if session.CurrentRound > session.TotalRounds {
-		session.State = models.StateFinished
+		m.mustFire(a, EventGameOver, nil)
 	} else {
-		session.TurnDeadline = time.Now().Add(2 * time.Minute)
+		m.mustFire(a, EventNextRound, nil)
 	}
 
 	return resultMsgA, resultMsgB
 }
 
-func (m *Manager) SetRematchPreference(playerID int64, wantsRematch bool) (*models.Session, bool, error) {
-	m.mu.RLock()
-	sessionID, hasSession := m.playerToSession[playerID]
-	m.mu.RUnlock()
-
-	if !hasSession {
-		return nil, false, fmt.Errorf("вы не находитесь в игре")
+// responseTime is how long a player took to move in a round that started at
+// roundStart. It is zero for bots and for players whose move was made for
+// them when their time ran out, whose last move is from an earlier round.
+func responseTime(player *models.Player, roundStart time.Time) time.Duration {
+	if player.IsBot || player.LastMoveTime.Before(roundStart) {
+		return 0
 	}
+	return player.LastMoveTime.Sub(roundStart)
+}
 
-	m.mu.RLock()
-	session, ok := m.sessions[sessionID]
-	m.mu.RUnlock()
-
+// SetRematchPreference records a player's answer to the rematch offer after the given game.
+func (m *Manager) SetRematchPreference(playerID int64, gameID string, wantsRematch bool) (*models.Session, bool, error) {
+	a, ok := m.actorFor(playerID)
 	if !ok {
-		return nil, false, fmt.Errorf("сессия не найдена")
+		return nil, false, fmt.Errorf("вы не находитесь в игре")
 	}
 
-	session.Mutex.Lock()
-	defer session.Mutex.Unlock()
+	var (
+		snapshot *models.Session
+		bothWant bool
+		err      error
+	)
+	ran := a.do(func() {
+		session := a.session
+		if session.GameID != gameID {
+			err = ErrExpired
+			return
+		}
 
-	if session.State != models.StateFinished {
-		return nil, false, fmt.Errorf("игра еще не завершена")
-	}
+		if !wantsRematch {
+			if err = m.fire(a, EventDecline, nil); err == nil {
+				snapshot = a.snapshot()
+			}
+			return
+		}
 
-	if playerID == session.PlayerA.ID {
-		session.PlayerA.WantsRematch = wantsRematch
-	} else {
-		session.PlayerB.WantsRematch = wantsRematch
+		player := session.PlayerA
+		if playerID == session.PlayerB.ID {
+			player = session.PlayerB
+		}
+		wantedBefore := bothWantRematch(session) == nil
+		err = m.fire(a, EventRematchWanted, func() {
+			player.WantsRematch = true
+			// A bot opponent is always up for another game.
+			if session.PlayerB.IsBot {
+				session.PlayerB.WantsRematch = true
+			}
+		})
+		if err != nil {
+			return
+		}
+		// Only the answer that completes the pair reports it, so the rematch starts once.
+		bothWant = !wantedBefore && bothWantRematch(session) == nil
+		snapshot = a.snapshot()
+	})
+	if !ran {
+		return nil, false, fmt.Errorf("сессия не найдена")
 	}
-
-	if !wantsRematch {
-		m.ClearPlayerSession(session.PlayerA.ID)
-		m.ClearPlayerSession(session.PlayerB.ID)
-		return session, false, nil
+	if err != nil {
+		return nil, false, err
 	}
-
-	bothWantRematch := session.PlayerA.WantsRematch && session.PlayerB.WantsRematch
-
-	return session, bothWantRematch, nil
-}
-
-func (m *Manager) ClearPlayerSession(playerID int64) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.playerToSession, playerID)
+	return snapshot, bothWant, nil
 }
 
+// StartRematch starts a new game between the players of a finished session
+// once both of them asked for it.
 func (m *Manager) StartRematch(sessionID int64) (*models.Session, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	oldSession, ok := m.sessions[sessionID]
+	m.mu.RLock()
+	a, ok := m.actors[sessionID]
+	m.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("исходная сессия не найдена")
 	}
 
-	newSession := &models.Session{
-		ID: oldSession.ID,
-		PlayerA: &models.Player{
-			ID:            oldSession.PlayerA.ID,
-			Username:      oldSession.PlayerA.Username,
-			Score:         0,
-			CurrentChoice: models.ChoiceNone,
-			WantsRematch:  false,
-		},
-		PlayerB: &models.Player{
-			ID:            oldSession.PlayerB.ID,
-			Username:      oldSession.PlayerB.Username,
-			Score:         0,
-			CurrentChoice: models.ChoiceNone,
-			WantsRematch:  false,
-		},
-		TotalRounds:  oldSession.TotalRounds,
-		CurrentRound: 1,
-		State:        models.StateInProgress,
-		History:      make([]models.RoundResult, 0),
-		TurnDeadline: time.Now().Add(2 * time.Minute),
+	gameID, err := newGameID()
+	if err != nil {
+		return nil, err
 	}
 
-	m.sessions[sessionID] = newSession
-	m.playerToSession[newSession.PlayerA.ID] = sessionID
-	m.playerToSession[newSession.PlayerB.ID] = sessionID
-
-	return newSession, nil
+	var snapshot *models.Session
+	ran := a.do(func() {
+		// The players may have been taken by another game meanwhile.
+		if err = m.claim(a); err != nil {
+			return
+		}
+		err = m.fire(a, EventRematch, func() {
+			a.session = nextGame(a.session, gameID)
+		})
+		if err != nil {
+			a.active.Store(inPlay(a.session.State))
+			return
+		}
+		snapshot = a.snapshot()
+	})
+	if !ran {
+		return nil, fmt.Errorf("исходная сессия не найдена")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
 }
 
-func (m *Manager) SetTurnTimer(sessionID int64, onTimeout func()) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if callback, exists := m.timerCallbacks[sessionID]; exists {
-
-		_ = callback
+// SetTurnTimer (re)starts the turn timer of the session's current round. If the
+// round is still open when the timer fires, whoever hasn't moved defects and
+// the game ends; onTimeout is then called, off the session's goroutine, with
+// the finished session and the player who did move in time, or nil if neither did.
+func (m *Manager) SetTurnTimer(sessionID int64, onTimeout func(session *models.Session, winner *models.Player)) {
+	m.mu.RLock()
+	a, ok := m.actors[sessionID]
+	m.mu.RUnlock()
+	if !ok {
+		return
 	}
-	m.timerCallbacks[sessionID] = onTimeout
-	go func() {
-		time.Sleep(2 * time.Minute)
-		m.mu.RLock()
-		callback, exists := m.timerCallbacks[sessionID]
-		m.mu.RUnlock()
 
-		if exists && callback != nil {
-			callback()
-		}
-	}()
-}
-
-func (m *Manager) clearTimer(sessionID int64) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.timerCallbacks, sessionID)
+	a.do(func() {
+		gameID, round := a.session.GameID, a.session.CurrentRound
+		a.stopTurnTimer()
+		a.timer = time.AfterFunc(m.turnTimeoutOf(a.session), func() {
+			var snapshot *models.Session
+			var winner *models.Player
+			a.do(func() {
+				session := a.session
+				if session.GameID != gameID || session.CurrentRound != round || session.State != models.StateInProgress {
+					return
+				}
+				snapshot, winner = m.timeout(a)
+			})
+			if snapshot != nil {
+				onTimeout(snapshot, winner)
+			}
+		})
+	})
 }
 
-func (m *Manager) HandleTimeout(sessionID int64) (*models.Session, *models.Player, error) {
-	session, ok := m.FindSessionByPlayerID(sessionID)
-	if !ok {
-		return nil, nil, fmt.Errorf("сессия не найдена")
+// turnTimeoutOf is how long each player of session has to move.
+func (m *Manager) turnTimeoutOf(session *models.Session) time.Duration {
+	if session.TurnTimeout > 0 {
+		return session.TurnTimeout
 	}
+	return m.turnTimeout
+}
 
-	session.Mutex.Lock()
-	defer session.Mutex.Unlock()
+// TurnTimeout is how long players have to move in games that don't set their own limit.
+func (m *Manager) TurnTimeout() time.Duration {
+	return m.turnTimeout
+}
 
-	if session.State != models.StateInProgress {
-		return nil, nil, fmt.Errorf("игра не в процессе")
-	}
+// timeout makes whoever hasn't moved defect and ends the game. It returns a
+// snapshot of the session and the player who moved in time, nil if neither
+// did. Actor goroutine only.
+func (m *Manager) timeout(a *actor) (*models.Session, *models.Player) {
+	session := a.session
 
-	var timeoutPlayer, activePlayer *models.Player
-	if session.PlayerA.CurrentChoice == models.ChoiceNone {
-		timeoutPlayer = session.PlayerA
-		activePlayer = session.PlayerB
-	} else {
-		timeoutPlayer = session.PlayerB
-		activePlayer = session.PlayerA
+	timeoutPlayerIsA := session.PlayerA.CurrentChoice == models.ChoiceNone
+	timeoutPlayer, activePlayer := session.PlayerB, session.PlayerA
+	if timeoutPlayerIsA {
+		timeoutPlayer, activePlayer = session.PlayerA, session.PlayerB
 	}
 
 	timeoutPlayer.CurrentChoice = models.ChoiceDefect
+	session.TimedOut = timeoutPlayer.ID
+	m.emit(GameEvent{
+		Kind:      KindTimeout,
+		SessionID: session.ID,
+		GameID:    session.GameID,
+		PlayerID:  timeoutPlayer.ID,
+		Round:     session.CurrentRound,
+	})
 
 	if activePlayer.CurrentChoice != models.ChoiceNone {
-		m.ProcessRound(session)
+		m.resolveRound(a)
+	} else {
+		// Neither player showed up, so both lose on time.
+		activePlayer.CurrentChoice = models.ChoiceDefect
+		session.BothTimedOut = true
+		m.emit(GameEvent{
+			Kind:      KindTimeout,
+			SessionID: session.ID,
+			GameID:    session.GameID,
+			PlayerID:  activePlayer.ID,
+			Round:     session.CurrentRound,
+		})
 	}
 
-	session.State = models.StateFinished
-	m.clearTimer(sessionID)
+	if session.State == models.StateInProgress {
+		m.mustFire(a, EventTimeout, nil)
+	}
 
-	return session, activePlayer, nil
+	snapshot := a.snapshot()
+	if snapshot.BothTimedOut {
+		return snapshot, nil
+	}
+	if timeoutPlayerIsA {
+		return snapshot, snapshot.PlayerB
+	}
+	return snapshot, snapshot.PlayerA
 }
 
-func (m *Manager) endGame(sessionID int64) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	_, ok := m.sessions[sessionID]
-	if !ok {
-		return
-	}
+// recordGame runs the bookkeeping for a game that has just ended. Actor goroutine only.
+func (m *Manager) recordGame(a *actor) {
+	m.finishBotGame(a)
+	m.saveGameRecord(a.session)
+	m.recordStyles(a.session)
+	m.recordProfiles(a.session)
+	m.recordRatings(a.session)
+	m.recordLeaderboard(a.session)
+	m.recordTournamentGame(a.session)
+}
 
-	m.clearTimer(sessionID)
+// armLinger keeps a finished session around for sessionLinger so its players
+// can still answer the rematch offer, and abandons it after that.
+// Actor goroutine only.
+func (m *Manager) armLinger(a *actor) {
+	a.stopLinger()
+	gameID := a.session.GameID
+	a.linger = time.AfterFunc(sessionLinger, func() {
+		a.do(func() {
+			if a.session.GameID == gameID {
+				// Fails harmlessly if the rematch has started meanwhile.
+				m.fire(a, EventExpire, nil)
+			}
+		})
+	})
+}
 
-	go func() {
-		time.Sleep(5 * time.Minute)
-		m.mu.Lock()
-		defer m.mu.Unlock()
-		if currentSession, exists := m.sessions[sessionID]; exists && currentSession.State == models.StateFinished {
-			delete(m.playerToSession, currentSession.PlayerA.ID)
-			delete(m.playerToSession, currentSession.PlayerB.ID)
-			delete(m.sessions, sessionID)
-		}
-	}()
+// nextGame is a fresh game between the players of session.
+func nextGame(session *models.Session, gameID string) *models.Session {
+	return &models.Session{
+		ID:     session.ID,
+		GameID: gameID,
+		PlayerA: &models.Player{
+			ID:       session.PlayerA.ID,
+			Username: session.PlayerA.Username,
+		},
+		PlayerB: &models.Player{
+			ID:       session.PlayerB.ID,
+			Username: session.PlayerB.Username,
+			IsBot:    session.PlayerB.IsBot,
+		},
+		TotalRounds:  session.TotalRounds,
+		CurrentRound: 1,
+		State:        session.State,
+		History:      make([]models.RoundResult, 0),
+		Payoff:       session.Payoff,
+		TurnTimeout:  session.TurnTimeout,
+		SpectateID:   session.SpectateID,
+		Spectators:   session.Spectators,
+	}
 }
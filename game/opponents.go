@@ -0,0 +1,124 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"strconv"
+)
+
+// policiesCollection is where learned Q-learning policies are stored, keyed by human player ID.
+const policiesCollection = "policies"
+
+// CreateBotGame starts a game between a player and a bot running the named strategy.
+// The bot always takes the PlayerB seat and uses the negated player ID so it never
+// collides with a real Telegram user.
+func (m *Manager) CreateBotGame(playerID int64, username string, rounds int, strategyName string) (*models.Session, error) {
+	if rounds <= 0 {
+		return nil, fmt.Errorf("неверное количество раундов: %d", rounds)
+	}
+	opponent, err := m.newOpponent(playerID, strategyName)
+	if err != nil {
+		return nil, err
+	}
+
+	gameID, err := newGameID()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []GameEvent
+	// Appending to the log may wait for the disk, so it happens once the lock is released.
+	defer func() { m.emit(events...) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.busy(playerID) {
+		return nil, fmt.Errorf("вы уже в игре")
+	}
+
+	session := &models.Session{
+		ID:     playerID,
+		GameID: gameID,
+		PlayerA: &models.Player{
+			ID:       playerID,
+			Username: username,
+		},
+		PlayerB: &models.Player{
+			ID:       -playerID,
+			Username: "🤖 " + opponent.Name(),
+			IsBot:    true,
+		},
+		TotalRounds:  rounds,
+		CurrentRound: 1,
+		State:        models.StateWaitingForPlayerB,
+		History:      make([]models.RoundResult, 0),
+		Payoff:       models.ClassicPayoff,
+	}
+	a := newActor(session, opponent)
+	m.mustFire(a, EventStart, nil)
+	snapshot := session.Clone()
+
+	if err := m.register(a); err != nil {
+		return nil, err
+	}
+	events = append(events, a.unlogged...)
+	return snapshot, nil
+}
+
+func (m *Manager) newOpponent(playerID int64, name string) (strategy.Strategy, error) {
+	if name == strategy.LearnerName {
+		policy, err := m.LearnerPolicy(playerID)
+		if err != nil {
+			return nil, err
+		}
+		return strategy.NewQLearner(m.learnerConfig, policy), nil
+	}
+
+	opponent, ok := strategy.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("неизвестная стратегия: %s", name)
+	}
+	return opponent, nil
+}
+
+// LearnerPolicy loads the policy the learning opponent has built up against a player.
+// A fresh policy is returned for players it has never met.
+func (m *Manager) LearnerPolicy(playerID int64) (*strategy.Policy, error) {
+	var policy strategy.Policy
+	err := m.store.Load(policiesCollection, strconv.FormatInt(playerID, 10), &policy)
+	if errors.Is(err, storage.ErrNotFound) {
+		return strategy.NewPolicy(m.learnerConfig), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить политику: %v", err)
+	}
+	return &policy, nil
+}
+
+// playBotMove lets the bot commit its move for the current round in advance.
+// Actor goroutine only.
+func (m *Manager) playBotMove(a *actor) {
+	if a.opponent == nil {
+		return
+	}
+	a.session.PlayerB.CurrentChoice = a.opponent.Next(strategy.FromHistory(a.session.History, false))
+	m.emitFor(a, choiceEvent(a.session, a.session.PlayerB))
+}
+
+// finishBotGame lets a learning opponent wrap up the game and persists what it learned.
+// Actor goroutine only.
+func (m *Manager) finishBotGame(a *actor) {
+	session := a.session
+	learner, ok := a.opponent.(strategy.Learner)
+	if !ok {
+		return
+	}
+	learner.EndGame()
+	if err := m.store.Save(policiesCollection, strconv.FormatInt(session.PlayerA.ID, 10), learner.Policy()); err != nil {
+		log.Printf("Failed to save policy for player %d: %v", session.PlayerA.ID, err)
+	}
+}
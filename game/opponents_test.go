@@ -0,0 +1,35 @@
+package game
+
+import (
+	"prisoners-dilemma-bot/models"
+	"testing"
+)
+
+func TestCreateBotGame(t *testing.T) {
+	m := NewManager(Config{})
+	for _, rounds := range []int{0, -1} {
+		if _, err := m.CreateBotGame(1, "alice", rounds, "allc"); err == nil {
+			t.Errorf("a bot game of %d rounds started", rounds)
+		}
+	}
+
+	session, err := m.CreateBotGame(1, "alice", 1, "allc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateBotGame(1, "alice", 1, "allc"); err == nil {
+		t.Error("a second bot game started while the first is on")
+	}
+
+	// Once the game is over, a pending rematch offer doesn't keep alice from
+	// starting another one.
+	if _, err := m.SubmitChoice(1, session.GameID, 1, models.ChoiceDefect); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := m.FindSessionByPlayerID(1); !ok || s.State != models.StateFinished {
+		t.Fatal("the game is not waiting for a rematch answer")
+	}
+	if _, err := m.CreateBotGame(1, "alice", 1, "allc"); err != nil {
+		t.Errorf("a new bot game after a finished one: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"strconv"
+	"time"
+)
+
+// profilesCollection stores each player's lifetime statistics, keyed by player ID.
+const profilesCollection = "profiles"
+
+// Profile is what a player's finished games add up to.
+type Profile struct {
+	Username string `json:"username,omitempty"`
+	Games    int    `json:"games"`
+	Wins     int    `json:"wins"`
+	Draws    int    `json:"draws"`
+	Losses   int    `json:"losses"`
+	// Forfeits counts the games the player quit or lost on time.
+	Forfeits int `json:"forfeits"`
+	Rounds   int `json:"rounds"`
+	Points   int `json:"points"`
+	// Cooperations counts the rounds the player cooperated in.
+	Cooperations int `json:"cooperations"`
+	// Openings counts the games with at least one round, and
+	// OpeningCooperations those the player opened by cooperating.
+	Openings            int `json:"openings"`
+	OpeningCooperations int `json:"opening_cooperations"`
+	// Provoked counts the moves made right after the opponent defected, and
+	// Retaliations those that defected back.
+	Provoked     int `json:"provoked"`
+	Retaliations int `json:"retaliations"`
+	// Reconciliations counts the moves made right after the opponent went
+	// back to cooperating following a defection, and Forgiven those that
+	// cooperated in turn.
+	Reconciliations int `json:"reconciliations"`
+	Forgiven        int `json:"forgiven"`
+	// TimedMoves counts the moves with a known response time, which took
+	// ResponseTime altogether.
+	TimedMoves   int           `json:"timed_moves"`
+	ResponseTime time.Duration `json:"response_time"`
+}
+
+// rate is part out of whole, and false when whole is zero.
+func rate(part, whole int) (float64, bool) {
+	if whole == 0 {
+		return 0, false
+	}
+	return float64(part) / float64(whole), true
+}
+
+// PointsPerRound is the average score of a round.
+func (p *Profile) PointsPerRound() (float64, bool) {
+	return rate(p.Points, p.Rounds)
+}
+
+// CooperationRate is the share of rounds the player cooperated in.
+func (p *Profile) CooperationRate() (float64, bool) {
+	return rate(p.Cooperations, p.Rounds)
+}
+
+// OpeningRate is the share of games the player opened by cooperating.
+func (p *Profile) OpeningRate() (float64, bool) {
+	return rate(p.OpeningCooperations, p.Openings)
+}
+
+// RetaliationRate is how often the player defected right after being betrayed.
+func (p *Profile) RetaliationRate() (float64, bool) {
+	return rate(p.Retaliations, p.Provoked)
+}
+
+// ForgivenessRate is how often the player cooperated once a betrayer went
+// back to cooperating.
+func (p *Profile) ForgivenessRate() (float64, bool) {
+	return rate(p.Forgiven, p.Reconciliations)
+}
+
+// AverageResponse is how long the player takes to move, on average.
+func (p *Profile) AverageResponse() (time.Duration, bool) {
+	if p.TimedMoves == 0 {
+		return 0, false
+	}
+	return p.ResponseTime / time.Duration(p.TimedMoves), true
+}
+
+// PlayerProfile loads the lifetime statistics of a player.
+func (m *Manager) PlayerProfile(playerID int64) (*Profile, error) {
+	profile := &Profile{}
+	err := m.store.Load(profilesCollection, strconv.FormatInt(playerID, 10), profile)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("не удалось загрузить профиль: %v", err)
+	}
+	return profile, nil
+}
+
+// recordProfiles adds the finished game to the profiles of both human
+// players. Whoever forfeited loses; otherwise the score decides.
+func (m *Manager) recordProfiles(session *models.Session) {
+	if len(session.History) == 0 && session.ForfeitedBy == 0 {
+		return
+	}
+	for _, player := range []*models.Player{session.PlayerA, session.PlayerB} {
+		if player.IsBot {
+			continue
+		}
+		profile, err := m.PlayerProfile(player.ID)
+		if err != nil {
+			log.Printf("Failed to update profile for player %d: %v", player.ID, err)
+			continue
+		}
+		opponent := session.PlayerB
+		if player == session.PlayerB {
+			opponent = session.PlayerA
+		}
+		profile.add(session, player, opponent)
+		if err := m.store.Save(profilesCollection, strconv.FormatInt(player.ID, 10), profile); err != nil {
+			log.Printf("Failed to save profile for player %d: %v", player.ID, err)
+		}
+	}
+}
+
+// add counts one game of player against opponent.
+func (p *Profile) add(session *models.Session, player, opponent *models.Player) {
+	p.Username = player.Username
+	p.Games++
+	forfeited := func(id int64) bool {
+		return session.ForfeitedBy == id || session.RanOutOfTime(id)
+	}
+	switch {
+	case forfeited(player.ID):
+		p.Forfeits++
+		p.Losses++
+	case forfeited(opponent.ID) || player.Score > opponent.Score:
+		p.Wins++
+	case player.Score == opponent.Score:
+		p.Draws++
+	default:
+		p.Losses++
+	}
+
+	asPlayerA := player == session.PlayerA
+	rounds := strategy.FromHistory(session.History, asPlayerA)
+	for i, r := range rounds {
+		cooperated := r.Own == models.ChoiceNegotiate
+		p.Rounds++
+		p.Points += r.OwnScore
+		if cooperated {
+			p.Cooperations++
+		}
+		response := session.History[i].PlayerAResponse
+		if !asPlayerA {
+			response = session.History[i].PlayerBResponse
+		}
+		if response > 0 {
+			p.TimedMoves++
+			p.ResponseTime += response
+		}
+
+		switch {
+		case i == 0:
+			p.Openings++
+			if cooperated {
+				p.OpeningCooperations++
+			}
+		case rounds[i-1].Opponent == models.ChoiceDefect:
+			p.Provoked++
+			if !cooperated {
+				p.Retaliations++
+			}
+		case i >= 2 && rounds[i-2].Opponent == models.ChoiceDefect:
+			p.Reconciliations++
+			if cooperated {
+				p.Forgiven++
+			}
+		}
+	}
+}
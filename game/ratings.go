@@ -0,0 +1,162 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"strconv"
+)
+
+// ratingsCollection stores each player's Elo rating, keyed by player ID.
+const ratingsCollection = "ratings"
+
+// Elo parameters.
+const (
+	// DefaultRating is the rating of a player who hasn't finished a rated game yet.
+	DefaultRating = 1200
+	// ratingK is how far a single game can move a rating.
+	ratingK = 32
+)
+
+// Rating is a player's Elo rating over their games against other people.
+type Rating struct {
+	Rating float64 `json:"rating"`
+	// Games counts every rated game, across seasons.
+	Games int `json:"games"`
+	// Username is the name of the player in their last rated game.
+	Username string `json:"username,omitempty"`
+	// Season is the season Wins, Draws and Losses were counted in.
+	Season int `json:"season,omitempty"`
+	Wins   int `json:"wins,omitempty"`
+	Draws  int `json:"draws,omitempty"`
+	Losses int `json:"losses,omitempty"`
+	// Titles are the player's podium finishes, oldest first.
+	Titles []Title `json:"titles,omitempty"`
+}
+
+// Points is the rating rounded for display.
+func (r Rating) Points() int {
+	return int(math.Round(r.Rating))
+}
+
+// SeasonGames is how many rated games the player finished in r.Season.
+func (r Rating) SeasonGames() int {
+	return r.Wins + r.Draws + r.Losses
+}
+
+// Badge is the medal of the player's latest title, if they have one.
+func (r Rating) Badge() string {
+	if len(r.Titles) == 0 {
+		return ""
+	}
+	return r.Titles[len(r.Titles)-1].Medal()
+}
+
+// PlayerRating loads the rating of a player. While a season is running, a
+// player who hasn't played in it yet is shown softly reset, the way their
+// first game of the season will find them.
+func (m *Manager) PlayerRating(playerID int64) (*Rating, error) {
+	season, running := m.runningSeason()
+	rating, err := m.loadRating(playerID)
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		carryOver(rating, season)
+	}
+	return rating, nil
+}
+
+// loadRating loads a rating as it was saved.
+func (m *Manager) loadRating(playerID int64) (*Rating, error) {
+	rating := &Rating{Rating: DefaultRating}
+	err := m.store.Load(ratingsCollection, strconv.FormatInt(playerID, 10), rating)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("не удалось загрузить рейтинг: %v", err)
+	}
+	return rating, nil
+}
+
+// carryOver moves a rating last played in an earlier season into season: it
+// is pulled halfway back to DefaultRating and the season record starts over.
+func carryOver(rating *Rating, season int) {
+	if rating.Season == season {
+		return
+	}
+	if rating.Games > 0 {
+		rating.Rating = DefaultRating + (rating.Rating-DefaultRating)/2
+	}
+	rating.Season = season
+	rating.Wins, rating.Draws, rating.Losses = 0, 0, 0
+}
+
+// recordRatings updates the ratings of both players after a game between two
+// people. Whoever forfeited loses; otherwise the score decides.
+func (m *Manager) recordRatings(session *models.Session) {
+	pA, pB := session.PlayerA, session.PlayerB
+	if pA.IsBot || pB.IsBot || (len(session.History) == 0 && session.ForfeitedBy == 0) {
+		return
+	}
+
+	var scoreA float64
+	switch {
+	case session.ForfeitedBy == pB.ID:
+		scoreA = 1
+	case session.ForfeitedBy == pA.ID:
+		scoreA = 0
+	case pA.Score > pB.Score:
+		scoreA = 1
+	case pA.Score == pB.Score:
+		scoreA = 0.5
+	}
+
+	// The season is looked up first: ending a season takes m.seasonsMu and
+	// then m.ratingsMu to hand out titles.
+	season, running := m.runningSeason()
+	m.ratingsMu.Lock()
+	defer m.ratingsMu.Unlock()
+	ratingA, err := m.loadRating(pA.ID)
+	if err != nil {
+		log.Printf("Failed to update rating for player %d: %v", pA.ID, err)
+		return
+	}
+	ratingB, err := m.loadRating(pB.ID)
+	if err != nil {
+		log.Printf("Failed to update rating for player %d: %v", pB.ID, err)
+		return
+	}
+	if running {
+		carryOver(ratingA, season)
+		carryOver(ratingB, season)
+	}
+
+	expectedA := 1 / (1 + math.Pow(10, (ratingB.Rating-ratingA.Rating)/400))
+	delta := ratingK * (scoreA - expectedA)
+	ratingA.Rating += delta
+	ratingB.Rating -= delta
+	ratingA.Games++
+	ratingB.Games++
+	ratingA.Username, ratingB.Username = pA.Username, pB.Username
+	if running {
+		switch scoreA {
+		case 1:
+			ratingA.Wins++
+			ratingB.Losses++
+		case 0:
+			ratingB.Wins++
+			ratingA.Losses++
+		default:
+			ratingA.Draws++
+			ratingB.Draws++
+		}
+	}
+
+	for id, rating := range map[int64]*Rating{pA.ID: ratingA, pB.ID: ratingB} {
+		if err := m.store.Save(ratingsCollection, strconv.FormatInt(id, 10), rating); err != nil {
+			log.Printf("Failed to save rating for player %d: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package game
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// recordsCollection keeps a record of every finished game, keyed by game ID.
+	recordsCollection = "games"
+	// playerGamesCollection lists the latest games of each player, keyed by player ID.
+	playerGamesCollection = "player_games"
+	// recentGames is how many games a player's list keeps.
+	recentGames = 20
+)
+
+// RecordVersion is the version of the GameRecord schema. It changes whenever
+// a field is renamed or changes meaning.
+const RecordVersion = 1
+
+// Move names used in game records, which are meant for other programs and
+// so don't use the players' language.
+const (
+	RecordCooperate = "cooperate"
+	RecordDefect    = "defect"
+)
+
+// GameRecord is everything there is to know about a finished game.
+type GameRecord struct {
+	Version   int       `json:"version"`
+	GameID    string    `json:"game_id"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	// Rounds is how many rounds the game was set to last; fewer are played
+	// when a player forfeits.
+	Rounds int           `json:"rounds"`
+	Payoff models.Payoff `json:"payoff"`
+	// TurnTimeoutSeconds is how long each player had to move.
+	TurnTimeoutSeconds int    `json:"turn_timeout_seconds"`
+	TournamentID       string `json:"tournament_id,omitempty"`
+	// Players are player A, who created the game, and player B.
+	Players [2]RecordPlayer `json:"players"`
+	// WinnerID is zero for a draw. ForfeitedBy and TimedOut are set when the
+	// game ended because a player quit or ran out of time; BothTimedOut when
+	// neither player moved in time, with TimedOut then player A.
+	WinnerID     int64         `json:"winner_id,omitempty"`
+	ForfeitedBy  int64         `json:"forfeited_by,omitempty"`
+	TimedOut     int64         `json:"timed_out,omitempty"`
+	BothTimedOut bool          `json:"both_timed_out,omitempty"`
+	History      []RecordRound `json:"history"`
+}
+
+// RecordPlayer is a player of a recorded game.
+type RecordPlayer struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot,omitempty"`
+	Score    int    `json:"score"`
+}
+
+// RecordRound is a played round, with the moves in the order of Players.
+type RecordRound struct {
+	Round    int           `json:"round"`
+	Resolved time.Time     `json:"resolved_at"`
+	Moves    [2]RecordMove `json:"moves"`
+}
+
+// RecordMove is one player's move in a round.
+type RecordMove struct {
+	Move   string `json:"move"`
+	Points int    `json:"points"`
+	// ResponseMillis is how long the player took to move, zero when unknown.
+	ResponseMillis int64 `json:"response_ms,omitempty"`
+}
+
+// newGameRecord records a session whose game has just ended.
+func newGameRecord(session *models.Session, turnTimeout time.Duration, now time.Time) *GameRecord {
+	pA, pB := session.PlayerA, session.PlayerB
+	record := &GameRecord{
+		Version:            RecordVersion,
+		GameID:             session.GameID,
+		StartedAt:          session.StartedAt,
+		EndedAt:            now,
+		Rounds:             session.TotalRounds,
+		Payoff:             session.Payoff,
+		TurnTimeoutSeconds: int(turnTimeout / time.Second),
+		TournamentID:       session.TournamentID,
+		Players: [2]RecordPlayer{
+			{ID: pA.ID, Username: pA.Username, Bot: pA.IsBot, Score: pA.Score},
+			{ID: pB.ID, Username: pB.Username, Bot: pB.IsBot, Score: pB.Score},
+		},
+		ForfeitedBy:  session.ForfeitedBy,
+		TimedOut:     session.TimedOut,
+		BothTimedOut: session.BothTimedOut,
+		History:      make([]RecordRound, 0, len(session.History)),
+	}
+	switch {
+	case session.ForfeitedBy == pB.ID || session.ForfeitedBy == 0 && pA.Score > pB.Score:
+		record.WinnerID = pA.ID
+	case session.ForfeitedBy == pA.ID || pB.Score > pA.Score:
+		record.WinnerID = pB.ID
+	}
+	for _, r := range session.History {
+		record.History = append(record.History, RecordRound{
+			Round:    r.Round,
+			Resolved: r.Timestamp,
+			Moves: [2]RecordMove{
+				{Move: recordMove(r.PlayerAChoice), Points: r.PlayerAScore, ResponseMillis: r.PlayerAResponse.Milliseconds()},
+				{Move: recordMove(r.PlayerBChoice), Points: r.PlayerBScore, ResponseMillis: r.PlayerBResponse.Milliseconds()},
+			},
+		})
+	}
+	return record
+}
+
+func recordMove(choice models.PlayerChoice) string {
+	if choice == models.ChoiceNegotiate {
+		return RecordCooperate
+	}
+	return RecordDefect
+}
+
+// Export formats of game records, which double as file extensions.
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+	ExportText = "txt"
+)
+
+// ExportFormats lists the export formats in the order they are offered.
+var ExportFormats = []string{ExportJSON, ExportCSV, ExportText}
+
+// Export encodes the record in one of the export formats and names the file.
+func (r *GameRecord) Export(format string) (string, []byte, error) {
+	name := fmt.Sprintf("game-%s.%s", r.GameID, format)
+	switch format {
+	case ExportJSON:
+		data, err := r.JSON()
+		return name, data, err
+	case ExportCSV:
+		data, err := r.CSV()
+		return name, data, err
+	case ExportText:
+		return name, []byte(r.Transcript()), nil
+	}
+	return "", nil, fmt.Errorf("неизвестный формат: %q", format)
+}
+
+// Played reports whether the player with the given ID played the game.
+func (r *GameRecord) Played(playerID int64) bool {
+	return r.Players[0].ID == playerID || r.Players[1].ID == playerID
+}
+
+// JSON encodes the record as indented JSON.
+func (r *GameRecord) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// csvHeader names the columns of CSV exports: one row per player per round.
+var csvHeader = []string{"game_id", "round", "resolved_at", "player_id", "username", "move", "points", "total", "opponent_move", "response_ms"}
+
+// CSV encodes the record as a table with one row per player per round.
+func (r *GameRecord) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	var totals [2]int
+	for _, round := range r.History {
+		for i, move := range round.Moves {
+			totals[i] += move.Points
+			err := w.Write([]string{
+				r.GameID,
+				strconv.Itoa(round.Round),
+				round.Resolved.UTC().Format(time.RFC3339),
+				strconv.FormatInt(r.Players[i].ID, 10),
+				r.Players[i].Username,
+				move.Move,
+				strconv.Itoa(move.Points),
+				strconv.Itoa(totals[i]),
+				round.Moves[1-i].Move,
+				strconv.FormatInt(move.ResponseMillis, 10),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// transcriptTime is how times are shown in transcripts.
+const transcriptTime = "02.01.2006 15:04:05 MST"
+
+// Transcript tells the game round by round in plain text.
+func (r *GameRecord) Transcript() string {
+	a, b := r.Players[0], r.Players[1]
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Дилемма заключенного — игра %s\n", r.GameID)
+	fmt.Fprintf(&sb, "Начало: %s\nКонец: %s\n", r.StartedAt.Format(transcriptTime), r.EndedAt.Format(transcriptTime))
+	fmt.Fprintf(&sb, "Игроки: %s и %s\n", a.Username, b.Username)
+	fmt.Fprintf(&sb, "Раундов: %d, выигрыши: %s (%s), время на ход: %d сек\n",
+		r.Rounds, models.PayoffName(r.Payoff), r.Payoff, r.TurnTimeoutSeconds)
+	if r.TournamentID != "" {
+		fmt.Fprintf(&sb, "Матч турнира #%s\n", r.TournamentID)
+	}
+	sb.WriteString("\n")
+
+	var scoreA, scoreB int
+	for _, round := range r.History {
+		scoreA += round.Moves[0].Points
+		scoreB += round.Moves[1].Points
+		fmt.Fprintf(&sb, "Раунд %d: %s %s (%+d), %s %s (%+d). Счет %d:%d\n", round.Round,
+			a.Username, transcriptMove(round.Moves[0].Move), round.Moves[0].Points,
+			b.Username, transcriptMove(round.Moves[1].Move), round.Moves[1].Points,
+			scoreA, scoreB)
+	}
+	if len(r.History) == 0 {
+		sb.WriteString("Ни одного раунда не сыграно.\n")
+	}
+
+	sb.WriteString("\n")
+	for _, p := range r.Players {
+		switch {
+		case p.ID == r.ForfeitedBy:
+			fmt.Fprintf(&sb, "%s покинул игру.\n", p.Username)
+		case p.ID == r.TimedOut || r.BothTimedOut:
+			fmt.Fprintf(&sb, "%s не успел сделать ход.\n", p.Username)
+		}
+	}
+	fmt.Fprintf(&sb, "Итог: %s %d — %d %s. ", a.Username, a.Score, b.Score, b.Username)
+	switch r.WinnerID {
+	case a.ID:
+		fmt.Fprintf(&sb, "Победил %s.\n", a.Username)
+	case b.ID:
+		fmt.Fprintf(&sb, "Победил %s.\n", b.Username)
+	default:
+		sb.WriteString("Ничья.\n")
+	}
+	return sb.String()
+}
+
+func transcriptMove(move string) string {
+	if move == RecordCooperate {
+		return "сотрудничал"
+	}
+	return "предал"
+}
+
+// GameRecord loads the record of a finished game.
+func (m *Manager) GameRecord(gameID string) (*GameRecord, error) {
+	record := &GameRecord{}
+	err := m.store.Load(recordsCollection, gameID, record)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("запись этой игры не найдена")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить запись игры: %v", err)
+	}
+	return record, nil
+}
+
+// LastGames returns the IDs of a player's latest finished games, newest first.
+func (m *Manager) LastGames(playerID int64) ([]string, error) {
+	var games []string
+	err := m.store.Load(playerGamesCollection, strconv.FormatInt(playerID, 10), &games)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("не удалось загрузить список игр: %v", err)
+	}
+	return games, nil
+}
+
+// saveGameRecord saves the record of a game that has just ended and adds
+// it to its human players' lists of games.
+func (m *Manager) saveGameRecord(session *models.Session) {
+	if len(session.History) == 0 && session.ForfeitedBy == 0 {
+		return
+	}
+	record := newGameRecord(session, m.turnTimeoutOf(session), time.Now())
+	if err := m.store.Save(recordsCollection, record.GameID, record); err != nil {
+		log.Printf("Failed to save record of game %s: %v", record.GameID, err)
+		return
+	}
+	for _, p := range record.Players {
+		if p.Bot {
+			continue
+		}
+		games, err := m.LastGames(p.ID)
+		if err != nil {
+			log.Printf("Failed to list game %s for player %d: %v", record.GameID, p.ID, err)
+			continue
+		}
+		games = append([]string{record.GameID}, games...)
+		if len(games) > recentGames {
+			games = games[:recentGames]
+		}
+		if err := m.store.Save(playerGamesCollection, strconv.FormatInt(p.ID, 10), games); err != nil {
+			log.Printf("Failed to list game %s for player %d: %v", record.GameID, p.ID, err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/storage"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// seasonsCollection stores every season, keyed by its number. Seasons that
+// ended keep their final standings.
+const seasonsCollection = "seasons"
+
+// Season schedules.
+const (
+	// ScheduleManual seasons run until an admin ends them.
+	ScheduleManual = ""
+	ScheduleWeekly = "weekly"
+	// ScheduleMonthly seasons end with the calendar month.
+	ScheduleMonthly = "monthly"
+)
+
+// SeasonPodium is how many top finishers of a season earn a title.
+const SeasonPodium = 3
+
+// ErrNoSeason is returned when a season is needed and none is running.
+var ErrNoSeason = errors.New("сейчас не идет ни один сезон")
+
+// Season is a stretch of rated games with standings of its own. At the start
+// of a season every rating is pulled halfway back to DefaultRating.
+type Season struct {
+	Number    int       `json:"number"`
+	Schedule  string    `json:"schedule,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// EndsAt is when a scheduled season ends on its own.
+	EndsAt time.Time `json:"ends_at,omitempty"`
+	// EndedAt is set once the season is over, along with its final standings.
+	EndedAt   time.Time        `json:"ended_at,omitempty"`
+	Standings []SeasonStanding `json:"standings,omitempty"`
+}
+
+// Running reports whether the season is still going.
+func (s *Season) Running() bool {
+	return s.EndedAt.IsZero()
+}
+
+// SeasonStanding is a player's place in a season, by rating.
+type SeasonStanding struct {
+	Place    int    `json:"place"`
+	PlayerID int64  `json:"player_id"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	Wins     int    `json:"wins"`
+	Draws    int    `json:"draws"`
+	Losses   int    `json:"losses"`
+}
+
+// Title is a podium finish in a past season.
+type Title struct {
+	Season int `json:"season"`
+	Place  int `json:"place"`
+}
+
+// Medal is the emoji of the place.
+func (t Title) Medal() string {
+	switch t.Place {
+	case 1:
+		return "🥇"
+	case 2:
+		return "🥈"
+	}
+	return "🥉"
+}
+
+func (t Title) String() string {
+	switch t.Place {
+	case 1:
+		return fmt.Sprintf("%s Чемпион сезона %d", t.Medal(), t.Season)
+	case 2:
+		return fmt.Sprintf("%s Серебряный призер сезона %d", t.Medal(), t.Season)
+	}
+	return fmt.Sprintf("%s Бронзовый призер сезона %d", t.Medal(), t.Season)
+}
+
+// ValidSchedule reports whether schedule is one of the season schedules.
+func ValidSchedule(schedule string) bool {
+	switch schedule {
+	case ScheduleManual, ScheduleWeekly, ScheduleMonthly:
+		return true
+	}
+	return false
+}
+
+// seasonEnd is when a season started at start ends on schedule: the next
+// Monday or the first of the next month, at midnight. Manual seasons have no end.
+func seasonEnd(schedule string, start time.Time) time.Time {
+	y, mo, d := start.Date()
+	switch schedule {
+	case ScheduleWeekly:
+		days := (8 - int(start.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(y, mo, d+days, 0, 0, 0, 0, start.Location())
+	case ScheduleMonthly:
+		return time.Date(y, mo+1, 1, 0, 0, 0, 0, start.Location())
+	}
+	return time.Time{}
+}
+
+// latestSeason returns the season with the highest number, running or not,
+// or nil before the first one. The caller must hold m.seasonsMu.
+func (m *Manager) latestSeason() (*Season, error) {
+	if m.seasonLoaded {
+		return m.season, nil
+	}
+	keys, err := m.store.List(seasonsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить сезоны: %v", err)
+	}
+	latest := 0
+	for _, key := range keys {
+		if n, err := strconv.Atoi(key); err == nil && n > latest {
+			latest = n
+		}
+	}
+	if latest > 0 {
+		season := &Season{}
+		if err := m.store.Load(seasonsCollection, strconv.Itoa(latest), season); err != nil {
+			return nil, fmt.Errorf("не удалось загрузить сезон %d: %v", latest, err)
+		}
+		m.season = season
+	}
+	m.seasonLoaded = true
+	return m.season, nil
+}
+
+// runningSeason is the number of the season being played, if one is.
+func (m *Manager) runningSeason() (int, bool) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	season, err := m.latestSeason()
+	if err != nil {
+		log.Printf("Failed to look up the current season: %v", err)
+		return 0, false
+	}
+	if season == nil || !season.Running() {
+		return 0, false
+	}
+	return season.Number, true
+}
+
+// CurrentSeason returns the latest season, which may have ended already, or
+// nil before the first one.
+func (m *Manager) CurrentSeason() (*Season, error) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	season, err := m.latestSeason()
+	if err != nil || season == nil {
+		return nil, err
+	}
+	c := *season
+	return &c, nil
+}
+
+// SeasonByNumber returns a season with its standings: the final ones of a
+// season that ended, the standings so far of the running one.
+func (m *Manager) SeasonByNumber(n int) (*Season, error) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	latest, err := m.latestSeason()
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.Number == n && latest.Running() {
+		season := *latest
+		season.Standings, err = m.seasonStandings(n)
+		if err != nil {
+			return nil, err
+		}
+		return &season, nil
+	}
+
+	season := &Season{}
+	err = m.store.Load(seasonsCollection, strconv.Itoa(n), season)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("сезона %d не было", n)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить сезон %d: %v", n, err)
+	}
+	return season, nil
+}
+
+// StartSeason starts the next season on the given schedule.
+func (m *Manager) StartSeason(schedule string, now time.Time) (*Season, error) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	return m.startSeason(schedule, now)
+}
+
+// startSeason is StartSeason for a caller that holds m.seasonsMu.
+func (m *Manager) startSeason(schedule string, now time.Time) (*Season, error) {
+	if !ValidSchedule(schedule) {
+		return nil, fmt.Errorf("неизвестное расписание сезонов: %q", schedule)
+	}
+	latest, err := m.latestSeason()
+	if err != nil {
+		return nil, err
+	}
+	season := &Season{Number: 1, Schedule: schedule, StartedAt: now, EndsAt: seasonEnd(schedule, now)}
+	if latest != nil {
+		if latest.Running() {
+			return nil, fmt.Errorf("сезон %d еще идет", latest.Number)
+		}
+		season.Number = latest.Number + 1
+	}
+	if err := m.store.Save(seasonsCollection, strconv.Itoa(season.Number), season); err != nil {
+		return nil, fmt.Errorf("не удалось сохранить сезон: %v", err)
+	}
+	m.season = season
+	c := *season
+	return &c, nil
+}
+
+// EndSeason ends the running season: its standings are archived and its top
+// finishers get their titles.
+func (m *Manager) EndSeason(now time.Time) (*Season, error) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	return m.endSeason(now)
+}
+
+// endSeason is EndSeason for a caller that holds m.seasonsMu.
+func (m *Manager) endSeason(now time.Time) (*Season, error) {
+	latest, err := m.latestSeason()
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil || !latest.Running() {
+		return nil, ErrNoSeason
+	}
+	standings, err := m.seasonStandings(latest.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	season := *latest
+	season.EndedAt, season.Standings = now, standings
+	if err := m.store.Save(seasonsCollection, strconv.Itoa(season.Number), &season); err != nil {
+		return nil, fmt.Errorf("не удалось сохранить итоги сезона: %v", err)
+	}
+	m.season = &season
+	for _, s := range standings {
+		if s.Place > SeasonPodium {
+			break
+		}
+		m.awardTitle(s.PlayerID, Title{Season: season.Number, Place: s.Place})
+	}
+	c := season
+	return &c, nil
+}
+
+// SeasonTick ends a scheduled season whose time is up and, when seasons run
+// on a schedule, starts the next one. It returns the seasons that ended and
+// started, either of which may be nil, and is meant to be called periodically.
+func (m *Manager) SeasonTick(now time.Time) (ended, started *Season, err error) {
+	m.seasonsMu.Lock()
+	defer m.seasonsMu.Unlock()
+	latest, err := m.latestSeason()
+	if err != nil {
+		return nil, nil, err
+	}
+	schedule := m.seasonSchedule
+	if latest != nil && latest.Running() {
+		if latest.EndsAt.IsZero() || now.Before(latest.EndsAt) {
+			return nil, nil, nil
+		}
+		if ended, err = m.endSeason(now); err != nil {
+			return nil, nil, err
+		}
+		schedule = latest.Schedule
+	}
+	if schedule == ScheduleManual {
+		return ended, nil, nil
+	}
+	started, err = m.startSeason(schedule, now)
+	return ended, started, err
+}
+
+// seasonStandings ranks the players who played rated games in season n by
+// rating, then by wins.
+func (m *Manager) seasonStandings(n int) ([]SeasonStanding, error) {
+	keys, err := m.store.List(ratingsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить рейтинги: %v", err)
+	}
+	var standings []SeasonStanding
+	for _, key := range keys {
+		playerID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		rating, err := m.loadRating(playerID)
+		if err != nil {
+			return nil, err
+		}
+		if rating.Season != n || rating.SeasonGames() == 0 {
+			continue
+		}
+		standings = append(standings, SeasonStanding{
+			PlayerID: playerID,
+			Username: rating.Username,
+			Rating:   rating.Points(),
+			Wins:     rating.Wins,
+			Draws:    rating.Draws,
+			Losses:   rating.Losses,
+		})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		switch {
+		case a.Rating != b.Rating:
+			return a.Rating > b.Rating
+		case a.Wins != b.Wins:
+			return a.Wins > b.Wins
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	for i := range standings {
+		standings[i].Place = i + 1
+	}
+	return standings, nil
+}
+
+// awardTitle adds a season title to a player's record.
+func (m *Manager) awardTitle(playerID int64, title Title) {
+	m.ratingsMu.Lock()
+	defer m.ratingsMu.Unlock()
+	rating, err := m.loadRating(playerID)
+	if err == nil {
+		rating.Titles = append(rating.Titles, title)
+		err = m.store.Save(ratingsCollection, strconv.FormatInt(playerID, 10), rating)
+	}
+	if err != nil {
+		log.Printf("Failed to award %q to player %d: %v", title, playerID, err)
+	}
+}
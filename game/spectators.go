@@ -0,0 +1,92 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"prisoners-dilemma-bot/models"
+)
+
+// DefaultMaxSpectators is how many people may watch one game.
+const DefaultMaxSpectators = 20
+
+// ErrNoSpectating is returned for spectate links of games that are over or don't allow spectators.
+var ErrNoSpectating = errors.New("эту игру нельзя посмотреть: она закончилась или закрыта для зрителей")
+
+// ErrTooManySpectators is returned when a game already has as many spectators as allowed.
+var ErrTooManySpectators = errors.New("у этой игры уже максимальное число зрителей")
+
+// Spectate adds userID to the spectators of the game behind a spectate link
+// and returns a snapshot of the game.
+func (m *Manager) Spectate(spectateID string, userID int64) (*models.Session, error) {
+	a, ok := m.spectated(spectateID)
+	if !ok {
+		return nil, ErrNoSpectating
+	}
+
+	var (
+		snapshot *models.Session
+		err      error
+	)
+	ran := a.do(func() {
+		session := a.session
+		switch {
+		case session.State == models.StateAbandoned:
+			err = ErrNoSpectating
+		case userID == session.PlayerA.ID || userID == session.PlayerB.ID:
+			err = fmt.Errorf("вы играете в этой игре")
+		case watching(session, userID):
+			err = fmt.Errorf("вы уже смотрите эту игру")
+		case len(session.Spectators) >= m.maxSpectators:
+			err = ErrTooManySpectators
+		default:
+			session.Spectators = append(session.Spectators, userID)
+			snapshot = a.snapshot()
+		}
+	})
+	if !ran {
+		return nil, ErrNoSpectating
+	}
+	return snapshot, err
+}
+
+// StopSpectating removes userID from the spectators of the game behind a spectate link.
+func (m *Manager) StopSpectating(spectateID string, userID int64) error {
+	a, ok := m.spectated(spectateID)
+	if !ok {
+		return ErrNoSpectating
+	}
+
+	err := fmt.Errorf("вы не смотрите эту игру")
+	a.do(func() {
+		session := a.session
+		for i, id := range session.Spectators {
+			if id == userID {
+				session.Spectators = append(session.Spectators[:i:i], session.Spectators[i+1:]...)
+				err = nil
+				return
+			}
+		}
+	})
+	return err
+}
+
+// spectated returns the actor of the game behind a spectate link.
+func (m *Manager) spectated(spectateID string) (*actor, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessionID, ok := m.spectateLinks[spectateID]
+	if !ok {
+		return nil, false
+	}
+	a, ok := m.actors[sessionID]
+	return a, ok
+}
+
+func watching(session *models.Session, userID int64) bool {
+	for _, id := range session.Spectators {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
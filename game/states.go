@@ -0,0 +1,217 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"prisoners-dilemma-bot/models"
+	"time"
+)
+
+// Event is something that happens to a session and may move it to another state.
+type Event string
+
+// Session events.
+const (
+	EventStart         Event = "start"          // both players are seated
+	EventMove          Event = "move"           // a player moved; the round stays open
+	EventAllMoved      Event = "all-moved"      // both players moved and the round is scored
+	EventNextRound     Event = "next-round"     // the scored round was not the last one
+	EventGameOver      Event = "game-over"      // the scored round was the last one
+	EventTimeout       Event = "timeout"        // a player ran out of time
+	EventForfeit       Event = "forfeit"        // a player left or can't be reached
+	EventRematchWanted Event = "rematch-wanted" // a player asked for a rematch
+	EventRematch       Event = "rematch"        // both players want a rematch
+	EventDecline       Event = "decline"        // a player turned the rematch down
+	EventExpire        Event = "expire"         // nobody answered the rematch offer in time
+)
+
+// TransitionError is returned when an event is not allowed in the session's
+// current state, either because the transition table has no such transition
+// or because its guard refused it.
+type TransitionError struct {
+	From  models.GameState
+	Event Event
+	// Err is why the guard refused the transition; nil if there is no transition at all.
+	Err error
+}
+
+func (e *TransitionError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	switch e.From {
+	case models.StateWaitingForPlayerB:
+		return "игра еще не началась"
+	case models.StateInProgress, models.StateResolvingRound:
+		return "игра еще не завершена"
+	case models.StateFinished, models.StateWaitingRematch:
+		return "эта игра уже завершена"
+	}
+	return "эта игра больше не активна"
+}
+
+func (e *TransitionError) Unwrap() error { return e.Err }
+
+// Reasons guards give for refusing a transition.
+var (
+	errNotAllMoved     = errors.New("не все игроки сделали ход")
+	errNoRoundsLeft    = errors.New("все раунды уже сыграны")
+	errRoundsLeft      = errors.New("в игре еще остались раунды")
+	errRematchUnwanted = errors.New("не все игроки хотят реванш")
+)
+
+// transition is one row of the session state machine. A transition whose from
+// and to states are the same is internal: it runs no exit or entry hooks.
+type transition struct {
+	from  models.GameState
+	event Event
+	to    models.GameState
+	guard func(session *models.Session) error
+}
+
+var transitionTable = []transition{
+	{models.StateWaitingForPlayerB, EventStart, models.StateInProgress, nil},
+	{models.StateWaitingForPlayerB, EventForfeit, models.StateAbandoned, nil},
+
+	{models.StateInProgress, EventMove, models.StateInProgress, nil},
+	{models.StateInProgress, EventAllMoved, models.StateResolvingRound, allMoved},
+	{models.StateInProgress, EventTimeout, models.StateFinished, nil},
+	{models.StateInProgress, EventForfeit, models.StateAbandoned, nil},
+
+	{models.StateResolvingRound, EventNextRound, models.StateInProgress, roundsLeft},
+	{models.StateResolvingRound, EventGameOver, models.StateFinished, noRoundsLeft},
+
+	{models.StateFinished, EventRematchWanted, models.StateWaitingRematch, nil},
+	{models.StateFinished, EventRematch, models.StateInProgress, bothWantRematch},
+	{models.StateFinished, EventDecline, models.StateAbandoned, nil},
+	{models.StateFinished, EventExpire, models.StateAbandoned, nil},
+
+	{models.StateWaitingRematch, EventRematchWanted, models.StateWaitingRematch, nil},
+	{models.StateWaitingRematch, EventRematch, models.StateInProgress, bothWantRematch},
+	{models.StateWaitingRematch, EventDecline, models.StateAbandoned, nil},
+	{models.StateWaitingRematch, EventExpire, models.StateAbandoned, nil},
+}
+
+type transitionKey struct {
+	from  models.GameState
+	event Event
+}
+
+var transitions = func() map[transitionKey]transition {
+	byKey := make(map[transitionKey]transition, len(transitionTable))
+	for _, t := range transitionTable {
+		byKey[transitionKey{t.from, t.event}] = t
+	}
+	return byKey
+}()
+
+// exit runs when a session leaves a state, on the session's goroutine.
+func (m *Manager) exit(a *actor, t transition) {
+	switch t.from {
+	case models.StateInProgress:
+		a.stopTurnTimer()
+	}
+}
+
+// enter runs when a session enters a state, on the session's goroutine.
+func (m *Manager) enter(a *actor, t transition) {
+	switch t.to {
+	case models.StateInProgress:
+		a.stopLinger()
+		if a.session.StartedAt.IsZero() {
+			a.session.StartedAt = time.Now()
+		}
+		a.session.TurnDeadline = time.Now().Add(m.turnTimeoutOf(a.session))
+		switch t.event {
+		case EventStart:
+			m.emitFor(a, startEvent(KindGameStarted, a.session))
+		case EventRematch:
+			m.emitFor(a, startEvent(KindRematch, a.session))
+		}
+		m.playBotMove(a)
+	case models.StateFinished:
+		m.recordGame(a)
+		m.armLinger(a)
+	case models.StateAbandoned:
+		if t.from == models.StateInProgress {
+			// A forfeited game still counts towards the players' statistics.
+			m.recordGame(a)
+		}
+		m.retire(a)
+	}
+}
+
+// fire applies event to the session of a: it checks the transition table and
+// the guard, runs the exit hooks of the old state, then action if it isn't nil,
+// then moves to the new state and runs its entry hooks. Actor goroutine only.
+func (m *Manager) fire(a *actor, event Event, action func()) error {
+	from := a.session.State
+	t, ok := transitions[transitionKey{from, event}]
+	if !ok {
+		return &TransitionError{From: from, Event: event}
+	}
+	if t.guard != nil {
+		if err := t.guard(a.session); err != nil {
+			return &TransitionError{From: from, Event: event, Err: err}
+		}
+	}
+
+	internal := t.to == from
+	if !internal {
+		m.exit(a, t)
+	}
+	if action != nil {
+		action()
+	}
+	a.session.State = t.to
+	a.active.Store(inPlay(t.to))
+	if !internal {
+		m.enter(a, t)
+	}
+	return nil
+}
+
+// inPlay reports whether a session in state has a game that hasn't ended.
+func inPlay(state models.GameState) bool {
+	switch state {
+	case models.StateWaitingForPlayerB, models.StateInProgress, models.StateResolvingRound:
+		return true
+	}
+	return false
+}
+
+func allMoved(session *models.Session) error {
+	if session.PlayerA.CurrentChoice == models.ChoiceNone || session.PlayerB.CurrentChoice == models.ChoiceNone {
+		return errNotAllMoved
+	}
+	return nil
+}
+
+func roundsLeft(session *models.Session) error {
+	if session.CurrentRound > session.TotalRounds {
+		return errNoRoundsLeft
+	}
+	return nil
+}
+
+func noRoundsLeft(session *models.Session) error {
+	if session.CurrentRound <= session.TotalRounds {
+		return errRoundsLeft
+	}
+	return nil
+}
+
+func bothWantRematch(session *models.Session) error {
+	if !session.PlayerA.WantsRematch || !session.PlayerB.WantsRematch {
+		return errRematchUnwanted
+	}
+	return nil
+}
+
+// mustFire is fire for transitions the caller has already made sure are
+// allowed; a refusal there is a bug in the manager.
+func (m *Manager) mustFire(a *actor, event Event, action func()) {
+	if err := m.fire(a, event, action); err != nil {
+		panic(fmt.Sprintf("game: session %d: %s in state %s: %v", a.id, event, a.session.State, err))
+	}
+}
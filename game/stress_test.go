@@ -0,0 +1,747 @@
+package game_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/strategy"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The stress tests hammer game.Manager from many goroutines at once and check
+// that every session stays consistent. They are meant for the race detector:
+//
+//	go test -race -run TestStress ./game
+//	go test -race -run TestStressTurnTimeouts -count 10 ./game
+
+const (
+	// stressSessions is how many games are played side by side.
+	stressSessions = 64
+	// stressTappers is how many goroutines submit moves for each player at once.
+	stressTappers = 4
+	// stressRounds is the length of every game.
+	stressRounds = 10
+	// stressRematches is how many rematches each session goes through.
+	stressRematches = 3
+)
+
+// pair is the two players of one stress game.
+type pair struct {
+	sessionID int64
+	players   [2]int64
+}
+
+// playerBase keeps stress players clear of anything else in the manager.
+const playerBase = 1_000_000
+
+// startGames opens n human games through the invite flow.
+func startGames(t *testing.T, m *game.Manager, n, rounds int) []pair {
+	t.Helper()
+	pairs := make([]pair, n)
+	for i := range pairs {
+		a, b := int64(playerBase+2*i), int64(playerBase+2*i+1)
+		inviteID, err := m.CreateInvite(a, fmt.Sprintf("a%d", i), rounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, _, err := m.AcceptInvite(inviteID, b, fmt.Sprintf("b%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs[i] = pair{sessionID: session.ID, players: [2]int64{a, b}}
+	}
+	return pairs
+}
+
+// tap keeps submitting moves for player until their game is over. It scribbles
+// on every snapshot it gets, which the race detector catches if snapshots
+// share memory with the live session. onResolve runs for every round the tap
+// scored.
+func tap(t *testing.T, m *game.Manager, rng *rand.Rand, player int64, onResolve func(outcome *game.MoveOutcome)) {
+	for {
+		session, ok := m.FindSessionByPlayerID(player)
+		if !ok || session.State != models.StateInProgress {
+			return
+		}
+		gameID, round := session.GameID, session.CurrentRound
+		session.PlayerA.Score = -1
+		session.History = append(session.History, models.RoundResult{})
+
+		choice := models.ChoiceNegotiate
+		if rng.Intn(2) == 0 {
+			choice = models.ChoiceDefect
+		}
+		outcome, err := m.SubmitChoice(player, gameID, round, choice)
+		switch {
+		case err == nil:
+			if outcome.RoundResolved && onResolve != nil {
+				onResolve(outcome)
+			}
+		case errors.Is(err, game.ErrAlreadyMoved), errors.Is(err, game.ErrExpired):
+			// Lost the race to another tap, or waiting for the opponent.
+			runtime.Gosched()
+		default:
+			// The game ended between the lookup and the move.
+			if s, ok := m.FindSessionByPlayerID(player); ok && s.State == models.StateInProgress && s.GameID == gameID && s.CurrentRound == round {
+				t.Errorf("player %d: unexpected error in an open round: %v", player, err)
+				return
+			}
+		}
+	}
+}
+
+// tapAll starts tappers for both players of every pair and waits until all
+// games are over.
+func tapAll(t *testing.T, m *game.Manager, pairs []pair, onResolve func(i int, outcome *game.MoveOutcome)) {
+	var wg sync.WaitGroup
+	for i, p := range pairs {
+		i := i
+		var resolve func(outcome *game.MoveOutcome)
+		if onResolve != nil {
+			resolve = func(outcome *game.MoveOutcome) { onResolve(i, outcome) }
+		}
+		for _, player := range p.players {
+			for k := 0; k < stressTappers; k++ {
+				wg.Add(1)
+				go func(player int64, seed int64) {
+					defer wg.Done()
+					tap(t, m, rand.New(rand.NewSource(seed)), player, resolve)
+				}(player, player*100+int64(k))
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// checkSession verifies a game that is over: it is in the wanted state, the
+// scores add up to its history and no round was scored twice or skipped.
+func checkSession(session *models.Session, state models.GameState, maxRounds int) error {
+	if session.State != state {
+		return fmt.Errorf("session %d: state %v, want %v", session.ID, session.State, state)
+	}
+	if len(session.History) > maxRounds {
+		return fmt.Errorf("session %d: %d rounds in history, at most %d expected", session.ID, len(session.History), maxRounds)
+	}
+	var scoreA, scoreB int
+	for i, r := range session.History {
+		if r.Round != i+1 {
+			return fmt.Errorf("session %d: history entry %d is round %d", session.ID, i, r.Round)
+		}
+		a, b := models.ClassicPayoff.Scores(r.PlayerAChoice, r.PlayerBChoice)
+		if a != r.PlayerAScore || b != r.PlayerBScore {
+			return fmt.Errorf("session %d: round %d scored %d:%d, want %d:%d", session.ID, r.Round, r.PlayerAScore, r.PlayerBScore, a, b)
+		}
+		scoreA += a
+		scoreB += b
+	}
+	if session.PlayerA.Score != scoreA || session.PlayerB.Score != scoreB {
+		return fmt.Errorf("session %d: score %d:%d, history adds up to %d:%d", session.ID, session.PlayerA.Score, session.PlayerB.Score, scoreA, scoreB)
+	}
+	return nil
+}
+
+// checkReplay verifies that folding the logged events of a game that is over
+// rebuilds the session the manager ended up with, and that rewinding it to
+// an earlier round keeps only the rounds played so far.
+func checkReplay(m *game.Manager, session *models.Session) error {
+	events, err := m.GameEvents(session.GameID)
+	if err != nil {
+		return fmt.Errorf("session %d: %v", session.ID, err)
+	}
+	replayed, err := game.ReplayGame(events, 0)
+	if err != nil {
+		return fmt.Errorf("session %d: replay: %v", session.ID, err)
+	}
+	if replayed.State != session.State || replayed.CurrentRound != session.CurrentRound ||
+		replayed.ForfeitedBy != session.ForfeitedBy || replayed.TimedOut != session.TimedOut || replayed.BothTimedOut != session.BothTimedOut ||
+		!replayed.StartedAt.Equal(session.StartedAt) {
+		return fmt.Errorf("session %d: replayed as %v in round %d (forfeit %d, timeout %d), live %v in round %d (forfeit %d, timeout %d)",
+			session.ID, replayed.State, replayed.CurrentRound, replayed.ForfeitedBy, replayed.TimedOut,
+			session.State, session.CurrentRound, session.ForfeitedBy, session.TimedOut)
+	}
+	for _, p := range [][2]*models.Player{{replayed.PlayerA, session.PlayerA}, {replayed.PlayerB, session.PlayerB}} {
+		if p[0].ID != p[1].ID || p[0].Score != p[1].Score || p[0].CurrentChoice != p[1].CurrentChoice {
+			return fmt.Errorf("session %d: player replayed as %+v, live %+v", session.ID, *p[0], *p[1])
+		}
+	}
+	if len(replayed.History) != len(session.History) {
+		return fmt.Errorf("session %d: %d rounds replayed, %d played", session.ID, len(replayed.History), len(session.History))
+	}
+	for i, r := range replayed.History {
+		live := session.History[i]
+		if !r.Timestamp.Equal(live.Timestamp) {
+			return fmt.Errorf("session %d: round %d replayed at %v, played at %v", session.ID, r.Round, r.Timestamp, live.Timestamp)
+		}
+		r.Timestamp = live.Timestamp
+		if r != live {
+			return fmt.Errorf("session %d: round replayed as %+v, played as %+v", session.ID, r, live)
+		}
+	}
+	if n := len(session.History) / 2; n > 0 {
+		rewound, err := game.ReplayGame(events, n)
+		if err != nil {
+			return fmt.Errorf("session %d: rewind to round %d: %v", session.ID, n, err)
+		}
+		if len(rewound.History) != n || rewound.CurrentRound != n+1 {
+			return fmt.Errorf("session %d: rewound to round %d, got %d rounds", session.ID, n, len(rewound.History))
+		}
+	}
+	return nil
+}
+
+// finalSession returns the finished session of p.
+func finalSession(m *game.Manager, p pair) (*models.Session, error) {
+	session, ok := m.FindSessionByPlayerID(p.players[0])
+	if !ok {
+		return nil, fmt.Errorf("session %d is gone", p.sessionID)
+	}
+	return session, nil
+}
+
+// acceptBoth accepts two invites at once, one by each accepter, and returns
+// how many games that started.
+func acceptBoth(m *game.Manager, invites [2]string, accepters [2]int64) int {
+	var started int32
+	var wg sync.WaitGroup
+	for k := range invites {
+		wg.Add(1)
+		go func(inviteID string, accepter int64) {
+			defer wg.Done()
+			if _, _, err := m.AcceptInvite(inviteID, accepter, fmt.Sprintf("b%d", accepter)); err == nil {
+				atomic.AddInt32(&started, 1)
+			}
+		}(invites[k], accepters[k])
+	}
+	wg.Wait()
+	return int(started)
+}
+
+// TestStressConcurrentAccepts races the accepts that would put one player in
+// two games: two invites of the same inviter, and two inviters' invites taken
+// by the same accepter. Only one game may start each time.
+func TestStressConcurrentAccepts(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{})
+
+	invite := func(inviter int64) string {
+		inviteID, err := m.CreateInvite(inviter, fmt.Sprintf("a%d", inviter), stressRounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inviteID
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressSessions; i++ {
+		base := int64(playerBase + 6*i)
+		// base invites base+1 and base+2; base+4 and base+5 both invite base+3.
+		sameInviter := [2]string{invite(base), invite(base)}
+		sameAccepter := [2]string{invite(base + 4), invite(base + 5)}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if n := acceptBoth(m, sameInviter, [2]int64{base + 1, base + 2}); n != 1 {
+				t.Errorf("inviter %d: %d games started from two invites at once, want 1", base, n)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if n := acceptBoth(m, sameAccepter, [2]int64{base + 3, base + 3}); n != 1 {
+				t.Errorf("accepter %d: %d games started from two invites at once, want 1", base+3, n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Everyone is in at most one game, and that game has them as a player.
+	games := make(map[int64]int64)
+	for i := 0; i < stressSessions; i++ {
+		for id := int64(playerBase + 6*i); id < int64(playerBase+6*i+6); id++ {
+			session, ok := m.FindSessionByPlayerID(id)
+			if !ok {
+				continue
+			}
+			if session.PlayerA.ID != id && session.PlayerB.ID != id {
+				t.Errorf("player %d is routed to session %d of %d and %d", id, session.ID, session.PlayerA.ID, session.PlayerB.ID)
+			}
+			if session.State != models.StateInProgress {
+				t.Errorf("player %d: session %d is %v", id, session.ID, session.State)
+			}
+			games[session.ID]++
+		}
+	}
+	for sessionID, players := range games {
+		if players != 2 {
+			t.Errorf("session %d has %d players routed to it", sessionID, players)
+		}
+	}
+}
+
+// TestStressConcurrentMoves has several goroutines per player race to move in
+// every round; each round must be scored exactly once.
+func TestStressConcurrentMoves(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{})
+	pairs := startGames(t, m, stressSessions, stressRounds)
+
+	resolved := make([]int32, len(pairs))
+	finished := make([]int32, len(pairs))
+	tapAll(t, m, pairs, func(i int, outcome *game.MoveOutcome) {
+		atomic.AddInt32(&resolved[i], 1)
+		if outcome.Finished {
+			atomic.AddInt32(&finished[i], 1)
+		}
+	})
+
+	for i, p := range pairs {
+		session, err := finalSession(m, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkSession(session, models.StateFinished, stressRounds); err != nil {
+			t.Fatal(err)
+		}
+		if len(session.History) != stressRounds || int(resolved[i]) != stressRounds {
+			t.Fatalf("session %d: %d rounds in history, %d reported resolved, want %d", p.sessionID, len(session.History), resolved[i], stressRounds)
+		}
+		if finished[i] != 1 {
+			t.Fatalf("session %d: reported finished %d times", p.sessionID, finished[i])
+		}
+		if err := checkReplay(m, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestStressForfeitDuringMoves has both players quit at a random moment while
+// moves are still coming in; at most one forfeit may win, no round is scored
+// after it and the abandoned session lets go of its players.
+func TestStressForfeitDuringMoves(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{})
+	pairs := startGames(t, m, stressSessions, stressRounds)
+
+	forfeits := make([]int32, len(pairs))
+	forfeited := make([]*models.Session, len(pairs))
+	var wg sync.WaitGroup
+	for i, p := range pairs {
+		for _, player := range p.players {
+			wg.Add(1)
+			go func(i int, player int64) {
+				defer wg.Done()
+				time.Sleep(time.Duration(rand.Intn(2000)) * time.Microsecond)
+				session, winner, err := m.ForfeitGame(player)
+				if err != nil {
+					return
+				}
+				if atomic.AddInt32(&forfeits[i], 1) == 1 {
+					forfeited[i] = session
+				}
+				if winner.ID == player {
+					t.Errorf("player %d won their own forfeit", player)
+				}
+			}(i, player)
+		}
+	}
+	tapAll(t, m, pairs, nil)
+	wg.Wait()
+
+	for i, p := range pairs {
+		switch forfeits[i] {
+		case 0:
+			session, err := finalSession(m, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkSession(session, models.StateFinished, stressRounds); err != nil {
+				t.Fatal(err)
+			}
+			if len(session.History) != stressRounds {
+				t.Fatalf("session %d: finished after %d rounds without a forfeit", p.sessionID, len(session.History))
+			}
+			if err := checkReplay(m, session); err != nil {
+				t.Fatal(err)
+			}
+		case 1:
+			if err := checkSession(forfeited[i], models.StateAbandoned, stressRounds); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkReplay(m, forfeited[i]); err != nil {
+				t.Fatal(err)
+			}
+			if len(forfeited[i].History) == stressRounds {
+				t.Fatalf("session %d: forfeited after the last round", p.sessionID)
+			}
+			for _, player := range p.players {
+				if _, ok := m.FindSessionByPlayerID(player); ok {
+					t.Fatalf("player %d is still in session %d after a forfeit", player, p.sessionID)
+				}
+			}
+		default:
+			t.Fatalf("session %d: forfeited %d times", p.sessionID, forfeits[i])
+		}
+	}
+}
+
+// TestStressTurnTimeouts uses a turn timer shorter than the players' thinking
+// time, so timeouts race with moves and with the re-arming of the timer.
+func TestStressTurnTimeouts(t *testing.T) {
+	t.Parallel()
+	const turnTimeout = 3 * time.Millisecond
+	m := game.NewManager(game.Config{TurnTimeout: turnTimeout})
+	pairs := startGames(t, m, stressSessions, stressRounds)
+
+	timeouts := make([]int32, len(pairs))
+	for i, p := range pairs {
+		i := i
+		onTimeout := func(session *models.Session, winner *models.Player) {
+			atomic.AddInt32(&timeouts[i], 1)
+			if session.State != models.StateFinished {
+				t.Errorf("session %d: still %v after a timeout", session.ID, session.State)
+			}
+			switch {
+			case winner == nil:
+				if !session.BothTimedOut {
+					t.Errorf("session %d: timeout without a winner though a player moved", session.ID)
+				}
+			case winner.ID != session.PlayerA.ID && winner.ID != session.PlayerB.ID:
+				t.Errorf("session %d: timeout winner %d is not a player", session.ID, winner.ID)
+			}
+		}
+		m.SetTurnTimer(p.sessionID, onTimeout)
+
+		for _, player := range p.players {
+			go func(sessionID, player int64) {
+				rng := rand.New(rand.NewSource(player))
+				for {
+					session, ok := m.FindSessionByPlayerID(player)
+					if !ok || session.State != models.StateInProgress {
+						return
+					}
+					time.Sleep(time.Duration(rng.Intn(int(turnTimeout/time.Microsecond))) * time.Microsecond)
+					outcome, err := m.SubmitChoice(player, session.GameID, session.CurrentRound, models.ChoiceNegotiate)
+					if err == nil && outcome.RoundResolved && !outcome.Finished {
+						m.SetTurnTimer(sessionID, onTimeout)
+					}
+				}
+			}(p.sessionID, player)
+		}
+	}
+
+	// Every game ends, by playing out or by a timeout.
+	deadline := time.Now().Add(10 * time.Second)
+	for _, p := range pairs {
+		for {
+			session, err := finalSession(m, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.State == models.StateFinished {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("session %d: still in round %d after 10s", p.sessionID, session.CurrentRound)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// Give timers armed around the end of a game the chance to misfire.
+	time.Sleep(5 * turnTimeout)
+
+	for i, p := range pairs {
+		session, err := finalSession(m, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkSession(session, models.StateFinished, stressRounds); err != nil {
+			t.Fatal(err)
+		}
+		n := atomic.LoadInt32(&timeouts[i])
+		if n > 1 {
+			t.Fatalf("session %d: timed out %d times", p.sessionID, n)
+		}
+		if n == 0 && len(session.History) != stressRounds {
+			t.Fatalf("session %d: finished after %d rounds without a timeout", p.sessionID, len(session.History))
+		}
+		if err := checkReplay(m, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// playOut plays the game of p to the end from a single goroutine.
+func playOut(m *game.Manager, p pair) error {
+	for {
+		session, ok := m.FindSessionByPlayerID(p.players[0])
+		if !ok {
+			return fmt.Errorf("session %d is gone", p.sessionID)
+		}
+		if session.State != models.StateInProgress {
+			return nil
+		}
+		for _, player := range p.players {
+			if _, err := m.SubmitChoice(player, session.GameID, session.CurrentRound, models.ChoiceDefect); err != nil {
+				return fmt.Errorf("player %d: %v", player, err)
+			}
+		}
+	}
+}
+
+// TestStressRematches has both players accept the rematch at the same time,
+// over and over; exactly one of them must see that both want it. The last
+// offer is declined by one player while the other accepts.
+func TestStressRematches(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{})
+	pairs := startGames(t, m, stressSessions, stressRounds)
+
+	var wg sync.WaitGroup
+	for _, p := range pairs {
+		wg.Add(1)
+		go func(p pair) {
+			defer wg.Done()
+			if err := rematchSeries(m, p, stressRematches); err != nil {
+				t.Error(err)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+func rematchSeries(m *game.Manager, p pair, rematches int) error {
+	seen := make(map[string]bool)
+	for n := 0; ; n++ {
+		if err := playOut(m, p); err != nil {
+			return err
+		}
+		session, err := finalSession(m, p)
+		if err != nil {
+			return err
+		}
+		if seen[session.GameID] {
+			return fmt.Errorf("session %d: game ID %s reused", p.sessionID, session.GameID)
+		}
+		seen[session.GameID] = true
+		if err := checkReplay(m, session); err != nil {
+			return err
+		}
+		last := n == rematches
+
+		var both int32
+		var wg sync.WaitGroup
+		for k, player := range p.players {
+			wants := !last || k == 0
+			wg.Add(1)
+			go func(player int64, wants bool) {
+				defer wg.Done()
+				_, bothWant, err := m.SetRematchPreference(player, session.GameID, wants)
+				if err == nil && bothWant {
+					atomic.AddInt32(&both, 1)
+				}
+			}(player, wants)
+		}
+		wg.Wait()
+
+		if last {
+			if both != 0 {
+				return fmt.Errorf("session %d: rematch started after a decline", p.sessionID)
+			}
+			for _, player := range p.players {
+				if _, ok := m.FindSessionByPlayerID(player); ok {
+					return fmt.Errorf("player %d is still in a session after a decline", player)
+				}
+			}
+			return nil
+		}
+		if both != 1 {
+			return fmt.Errorf("session %d: both players wanted a rematch %d times", p.sessionID, both)
+		}
+		next, err := m.StartRematch(p.sessionID)
+		if err != nil {
+			return err
+		}
+		// The rematch can't be answered while it is being played.
+		var transitionErr *game.TransitionError
+		if _, _, err := m.SetRematchPreference(p.players[1], next.GameID, true); !errors.As(err, &transitionErr) || transitionErr.From != models.StateInProgress {
+			return fmt.Errorf("session %d: rematch answer during a game returned %v", p.sessionID, err)
+		}
+		// An answer to the previous offer must not count for the new game.
+		if _, _, err := m.SetRematchPreference(p.players[0], session.GameID, true); !errors.Is(err, game.ErrExpired) {
+			return fmt.Errorf("session %d: stale rematch answer returned %v, want %v", p.sessionID, err, game.ErrExpired)
+		}
+	}
+}
+
+// TestStressBotGames plays many games against bot opponents, the learner
+// included, while other goroutines read the sessions.
+func TestStressBotGames(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{Learner: strategy.DefaultLearnerConfig()})
+	names := append(strategy.Names(), strategy.LearnerName)
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressSessions; i++ {
+		playerID := int64(playerBase + i)
+		username := fmt.Sprintf("p%d", i)
+		name := names[i%len(names)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := m.CreateBotGame(playerID, username, stressRounds, name)
+			if err != nil {
+				t.Errorf("player %d: %v", playerID, err)
+				return
+			}
+
+			var readers sync.WaitGroup
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					s, ok := m.FindSessionByPlayerID(playerID)
+					if !ok || s.State != models.StateInProgress {
+						return
+					}
+					s.PlayerB.CurrentChoice = models.ChoiceNone
+					runtime.Gosched()
+				}
+			}()
+			tap(t, m, rand.New(rand.NewSource(playerID)), playerID, nil)
+			readers.Wait()
+
+			final, ok := m.FindSessionByPlayerID(playerID)
+			if !ok {
+				t.Errorf("player %d: bot game is gone", playerID)
+				return
+			}
+			if final.GameID != session.GameID || len(final.History) != stressRounds {
+				t.Errorf("player %d: bot game against %s ended after %d rounds", playerID, name, len(final.History))
+				return
+			}
+			if err := checkSession(final, models.StateFinished, stressRounds); err != nil {
+				t.Error(err)
+			}
+			if err := checkReplay(m, final); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestStressTournament runs a Swiss tournament while ticks race with players
+// moving in their matches and now and then quitting them. Every player must
+// end up with one scored match per pairing round, and records that add up to
+// the pairings.
+func TestStressTournament(t *testing.T) {
+	t.Parallel()
+	m := game.NewManager(game.Config{})
+	organizer := int64(playerBase - 1)
+	tour, err := m.CreateTournament(organizer, "organizer", models.TournamentSettings{
+		Format:  models.FormatSwiss,
+		Scoring: models.ScoreByPoints,
+		Rounds:  stressRounds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An odd field, so every round has a bye.
+	n := 2*stressSessions + 1
+	if n > game.MaxTournamentPlayers {
+		n = game.MaxTournamentPlayers - 1 + game.MaxTournamentPlayers%2
+	}
+	players := make([]int64, n)
+	for i := range players {
+		players[i] = int64(playerBase + i)
+		if _, err := m.JoinTournament(tour.ID, players[i], fmt.Sprintf("p%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.StartTournament(tour.ID, organizer); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := func() bool {
+		tour, _ := m.Tournament(tour.ID)
+		return tour.State == models.TournamentFinished
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !finished() {
+			m.TournamentTick(time.Now())
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for i, player := range players {
+		for j := 0; j < stressTappers; j++ {
+			wg.Add(1)
+			go func(player int64, seed int64) {
+				defer wg.Done()
+				rng := rand.New(rand.NewSource(seed))
+				for !finished() {
+					if rng.Intn(200) == 0 {
+						m.ForfeitGame(player)
+					}
+					tap(t, m, rng, player, nil)
+					time.Sleep(time.Millisecond)
+				}
+			}(player, int64(i*stressTappers+j))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("tournament did not finish within a minute")
+	}
+	if t.Failed() {
+		return
+	}
+
+	tour, _ = m.Tournament(tour.ID)
+	if tour.Round != tour.TotalRounds {
+		t.Fatalf("finished after %d of %d pairing rounds", tour.Round, tour.TotalRounds)
+	}
+	points := make(map[int64]int)
+	for round := 1; round <= tour.TotalRounds; round++ {
+		seated := make(map[int64]bool)
+		for _, p := range tour.RoundPairings(round) {
+			if !p.Done {
+				t.Fatalf("round %d: match %d-%d was never scored", round, p.PlayerA, p.PlayerB)
+			}
+			for _, id := range []int64{p.PlayerA, p.PlayerB} {
+				if id != 0 && seated[id] {
+					t.Fatalf("round %d: player %d paired twice", round, id)
+				}
+				seated[id] = true
+			}
+			points[p.PlayerA] += p.ScoreA
+			points[p.PlayerB] += p.ScoreB
+		}
+		if len(seated) != len(players)+1 {
+			t.Fatalf("round %d: %d players seated, want %d and a bye", round, len(seated)-1, len(players))
+		}
+	}
+	for _, p := range tour.Players {
+		if games := p.Wins + p.Draws + p.Losses; games != tour.TotalRounds {
+			t.Errorf("player %d: %d matches scored, want %d", p.ID, games, tour.TotalRounds)
+		}
+		if p.Points != points[p.ID] {
+			t.Errorf("player %d: %d points, pairings add up to %d", p.ID, p.Points, points[p.ID])
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"strconv"
+)
+
+// stylesCollection stores each player's lifetime strategy fits, keyed by player ID.
+const stylesCollection = "styles"
+
+// LifetimeStyle is how a player's moves compare to the classic strategies over all their games.
+type LifetimeStyle struct {
+	Games       int                  `json:"games"`
+	Fits        strategy.Style       `json:"fits"`
+	Transitions strategy.Transitions `json:"transitions"`
+}
+
+// PlayerStyle loads the lifetime playing style of a player.
+func (m *Manager) PlayerStyle(playerID int64) (*LifetimeStyle, error) {
+	style := &LifetimeStyle{Fits: make(strategy.Style)}
+	err := m.store.Load(stylesCollection, strconv.FormatInt(playerID, 10), style)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("не удалось загрузить статистику: %v", err)
+	}
+	if style.Fits == nil {
+		style.Fits = make(strategy.Style)
+	}
+	return style, nil
+}
+
+// recordStyles adds the finished game to the lifetime style of both human players.
+func (m *Manager) recordStyles(session *models.Session) {
+	if len(session.History) == 0 {
+		return
+	}
+	for _, player := range []*models.Player{session.PlayerA, session.PlayerB} {
+		if player.IsBot {
+			continue
+		}
+		style, err := m.PlayerStyle(player.ID)
+		if err != nil {
+			log.Printf("Failed to update style for player %d: %v", player.ID, err)
+			continue
+		}
+		rounds := strategy.FromHistory(session.History, player == session.PlayerA)
+		style.Games++
+		style.Fits.Add(strategy.Classify(rounds))
+		style.Transitions.Add(rounds)
+		if err := m.store.Save(stylesCollection, strconv.FormatInt(player.ID, 10), style); err != nil {
+			log.Printf("Failed to save style for player %d: %v", player.ID, err)
+		}
+	}
+}
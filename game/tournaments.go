@@ -0,0 +1,551 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/models"
+	"prisoners-dilemma-bot/utils"
+	"sort"
+	"time"
+)
+
+// Tournament limits.
+const (
+	MaxTournamentPlayers = 64
+	// tournamentRetention is how long a tournament that ended can still be looked up.
+	tournamentRetention = 24 * time.Hour
+)
+
+// ErrTournamentGone is returned for tournaments that don't exist or were forgotten.
+var ErrTournamentGone = errors.New("турнир не найден")
+
+// TournamentUpdate reports progress of a tournament: the pairing round that
+// just ended and the one that just started, either of which may be missing.
+type TournamentUpdate struct {
+	Tournament *models.Tournament
+	// Completed is the pairing round that ended, zero when none did, and
+	// Standings are the standings it ended with.
+	Completed int
+	Standings []models.TournamentPlayer
+	// Started is the pairing round that started, zero when none did.
+	Started int
+	// Matches are the games started for the new pairing round. Pairings left
+	// out were byes or walkovers and are already scored.
+	Matches []*models.Session
+}
+
+// CreateTournament opens registration for a tournament organized by
+// organizerID. An organizer runs one tournament at a time.
+func (m *Manager) CreateTournament(organizerID int64, organizerName string, settings models.TournamentSettings) (*models.Tournament, error) {
+	switch {
+	case settings.Format != models.FormatSwiss && settings.Format != models.FormatRoundRobin:
+		return nil, fmt.Errorf("неизвестный формат турнира: %q", settings.Format)
+	case settings.Scoring != models.ScoreByPoints && settings.Scoring != models.ScoreByWins:
+		return nil, fmt.Errorf("неизвестный способ подсчета: %q", settings.Scoring)
+	case settings.Rounds <= 0:
+		return nil, fmt.Errorf("неверное количество раундов: %d", settings.Rounds)
+	}
+	if settings.Payoff == (models.Payoff{}) {
+		settings.Payoff = models.ClassicPayoff
+	}
+	id, err := utils.GenerateID(3)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сгенерировать ID турнира: %v", err)
+	}
+
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	for _, t := range m.tournaments {
+		if t.OrganizerID == organizerID && (t.State == models.TournamentRegistering || t.State == models.TournamentRunning) {
+			return nil, fmt.Errorf("у вас уже есть незавершенный турнир #%s", t.ID)
+		}
+	}
+	t := &models.Tournament{
+		TournamentSettings: settings,
+		ID:                 id,
+		OrganizerID:        organizerID,
+		OrganizerName:      organizerName,
+		CreatedAt:          time.Now(),
+		State:              models.TournamentRegistering,
+	}
+	m.tournaments[id] = t
+	return t.Clone(), nil
+}
+
+// Tournament returns a snapshot of a tournament.
+func (m *Manager) Tournament(id string) (*models.Tournament, bool) {
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	t, ok := m.tournaments[id]
+	if !ok {
+		return nil, false
+	}
+	return t.Clone(), true
+}
+
+// PlayerTournament returns a snapshot of the latest tournament a player
+// registered for or organizes.
+func (m *Manager) PlayerTournament(playerID int64) (*models.Tournament, bool) {
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	var latest *models.Tournament
+	for _, t := range m.tournaments {
+		if _, registered := t.Player(playerID); !registered && t.OrganizerID != playerID {
+			continue
+		}
+		if latest == nil || t.CreatedAt.After(latest.CreatedAt) {
+			latest = t
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	return latest.Clone(), true
+}
+
+// JoinTournament registers a player for a tournament that hasn't started yet.
+func (m *Manager) JoinTournament(id string, playerID int64, username string) (*models.Tournament, error) {
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	t, ok := m.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentGone
+	}
+	switch {
+	case t.State != models.TournamentRegistering:
+		return nil, fmt.Errorf("регистрация на турнир #%s закрыта", t.ID)
+	case len(t.Players) >= MaxTournamentPlayers:
+		return nil, fmt.Errorf("в турнире #%s уже %d игроков — мест больше нет", t.ID, MaxTournamentPlayers)
+	}
+	if _, registered := t.Player(playerID); registered {
+		return nil, fmt.Errorf("вы уже зарегистрированы в турнире #%s", t.ID)
+	}
+	t.Players = append(t.Players, models.TournamentPlayer{ID: playerID, Username: username})
+	return t.Clone(), nil
+}
+
+// LeaveTournament withdraws a player from a tournament that hasn't started yet.
+func (m *Manager) LeaveTournament(id string, playerID int64) (*models.Tournament, error) {
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	t, ok := m.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentGone
+	}
+	if t.State != models.TournamentRegistering {
+		return nil, fmt.Errorf("турнир #%s уже начался, покинуть его нельзя", t.ID)
+	}
+	for i, p := range t.Players {
+		if p.ID == playerID {
+			t.Players = append(t.Players[:i], t.Players[i+1:]...)
+			return t.Clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("вы не зарегистрированы в турнире #%s", t.ID)
+}
+
+// CancelTournament calls off a tournament that hasn't started yet. Only its
+// organizer may cancel it.
+func (m *Manager) CancelTournament(id string, organizerID int64) (*models.Tournament, error) {
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	t, ok := m.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentGone
+	}
+	switch {
+	case t.OrganizerID != organizerID:
+		return nil, fmt.Errorf("отменить турнир может только его организатор")
+	case t.State != models.TournamentRegistering:
+		return nil, fmt.Errorf("турнир #%s уже начался, отменить его нельзя", t.ID)
+	}
+	t.State, t.EndedAt = models.TournamentCancelled, time.Now()
+	return t.Clone(), nil
+}
+
+// StartTournament closes registration and starts the first pairing round
+// before the scheduled time. Only the organizer may start a tournament; one
+// with fewer than two players is cancelled instead.
+func (m *Manager) StartTournament(id string, organizerID int64) (*TournamentUpdate, error) {
+	m.tournamentsRun.Lock()
+	defer m.tournamentsRun.Unlock()
+
+	m.tournamentsMu.Lock()
+	t, ok := m.tournaments[id]
+	var err error
+	switch {
+	case !ok:
+		err = ErrTournamentGone
+	case t.OrganizerID != organizerID:
+		err = fmt.Errorf("начать турнир может только его организатор")
+	case t.State != models.TournamentRegistering:
+		err = fmt.Errorf("турнир #%s уже начался или завершен", t.ID)
+	}
+	m.tournamentsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	update := m.beginTournament(id, time.Now())
+	return &update, nil
+}
+
+// TournamentTick moves every tournament along: tournaments whose start time
+// has come start, and those whose pairing round is over either start the next
+// one or finish. It returns what changed so players can be told, and is meant
+// to be called periodically.
+func (m *Manager) TournamentTick(now time.Time) []TournamentUpdate {
+	m.tournamentsRun.Lock()
+	defer m.tournamentsRun.Unlock()
+
+	var due, over []string
+	m.tournamentsMu.Lock()
+	for id, t := range m.tournaments {
+		switch t.State {
+		case models.TournamentRegistering:
+			if !t.StartAt.IsZero() && !now.Before(t.StartAt) {
+				due = append(due, id)
+			}
+		case models.TournamentRunning:
+			if roundOver(t) {
+				over = append(over, id)
+			}
+		default:
+			if now.Sub(t.EndedAt) > tournamentRetention {
+				delete(m.tournaments, id)
+			}
+		}
+	}
+	m.tournamentsMu.Unlock()
+	sort.Strings(due)
+	sort.Strings(over)
+
+	var updates []TournamentUpdate
+	for _, id := range due {
+		updates = append(updates, m.beginTournament(id, now))
+	}
+	for _, id := range over {
+		updates = append(updates, m.advanceTournament(id, now))
+	}
+	return updates
+}
+
+// roundOver reports whether every match of the current pairing round is scored.
+func roundOver(t *models.Tournament) bool {
+	for _, p := range t.Pairings {
+		if p.Round == t.Round && !p.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// beginTournament closes registration of a tournament and starts its first
+// pairing round. The caller must hold m.tournamentsRun.
+func (m *Manager) beginTournament(id string, now time.Time) TournamentUpdate {
+	m.tournamentsMu.Lock()
+	t := m.tournaments[id]
+	if len(t.Players) < 2 {
+		t.State, t.EndedAt = models.TournamentCancelled, now
+		snapshot := t.Clone()
+		m.tournamentsMu.Unlock()
+		return TournamentUpdate{Tournament: snapshot}
+	}
+	t.State = models.TournamentRunning
+	ids := make([]int64, 0, len(t.Players))
+	for _, p := range t.Players {
+		ids = append(ids, p.ID)
+	}
+	if t.Format == models.FormatRoundRobin {
+		t.Pairings = roundRobinPairings(ids)
+		t.TotalRounds = len(ids) - 1 + len(ids)%2
+	} else {
+		t.TotalRounds = swissRounds(len(ids))
+	}
+	m.tournamentsMu.Unlock()
+	return m.startPairingRound(id)
+}
+
+// advanceTournament starts the next pairing round of a tournament whose round
+// is over, or finishes it after the last one. The caller must hold m.tournamentsRun.
+func (m *Manager) advanceTournament(id string, now time.Time) TournamentUpdate {
+	m.tournamentsMu.Lock()
+	t := m.tournaments[id]
+	// Byes and walkovers of the next round are scored as soon as it starts.
+	completed, standings := t.Round, t.Standings()
+	if t.Round >= t.TotalRounds {
+		t.State, t.EndedAt = models.TournamentFinished, now
+		snapshot := t.Clone()
+		m.tournamentsMu.Unlock()
+		return TournamentUpdate{Tournament: snapshot, Completed: completed, Standings: standings}
+	}
+	m.tournamentsMu.Unlock()
+
+	update := m.startPairingRound(id)
+	update.Completed, update.Standings = completed, standings
+	return update
+}
+
+// startPairingRound pairs the next round of a running tournament and starts
+// its matches. Byes are scored right away, and so are matches with a player
+// who is busy in another game: they forfeit. The caller must hold m.tournamentsRun.
+func (m *Manager) startPairingRound(id string) TournamentUpdate {
+	m.tournamentsMu.Lock()
+	t := m.tournaments[id]
+	t.Round++
+	if t.Format == models.FormatSwiss {
+		t.Pairings = append(t.Pairings, swissPairings(t, t.Round)...)
+	}
+	var matches []models.Pairing
+	for i := range t.Pairings {
+		p := &t.Pairings[i]
+		if p.Round != t.Round {
+			continue
+		}
+		if p.IsBye() {
+			p.ScoreA = walkoverPoints(t)
+			scoreMatch(t, p)
+			continue
+		}
+		matches = append(matches, *p)
+	}
+	round, settings := t.Round, t.TournamentSettings
+	names := make(map[int64]string, len(t.Players))
+	for _, p := range t.Players {
+		names[p.ID] = p.Username
+	}
+	m.tournamentsMu.Unlock()
+
+	// The matches start without m.tournamentsMu: an actor recording a
+	// tournament game may be waiting for it.
+	var sessions []*models.Session
+	forfeits := make(map[int64]bool)
+	for _, p := range matches {
+		session, busyA, busyB, err := m.startMatch(id, round, p, names, settings)
+		if session != nil {
+			sessions = append(sessions, session)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to start match of tournament %s between %d and %d: %v", id, p.PlayerA, p.PlayerB, err)
+			busyA, busyB = true, true
+		}
+		forfeits[p.PlayerA], forfeits[p.PlayerB] = busyA, busyB
+	}
+
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	for i := range t.Pairings {
+		p := &t.Pairings[i]
+		if p.Round != round || p.Done || p.IsBye() {
+			continue
+		}
+		forfeitA, seated := forfeits[p.PlayerA]
+		if !seated {
+			continue
+		}
+		p.ForfeitA, p.ForfeitB = forfeitA, forfeits[p.PlayerB]
+		// Whoever showed up against a busy opponent gets a walkover.
+		if !p.ForfeitA {
+			p.ScoreA = walkoverPoints(t)
+		}
+		if !p.ForfeitB {
+			p.ScoreB = walkoverPoints(t)
+		}
+		scoreMatch(t, p)
+	}
+	return TournamentUpdate{Tournament: t.Clone(), Started: round, Matches: sessions}
+}
+
+// startMatch starts the game of a tournament pairing. If either player is
+// still busy in another game it starts nothing and reports which of them are;
+// the check and the start are one step under m.mu.
+func (m *Manager) startMatch(id string, round int, p models.Pairing, names map[int64]string, settings models.TournamentSettings) (*models.Session, bool, bool, error) {
+	gameID, err := newGameID()
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	var events []GameEvent
+	// Appending to the log may wait for the disk, so it happens once the lock is released.
+	defer func() { m.emit(events...) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if busyA, busyB := m.busy(p.PlayerA), m.busy(p.PlayerB); busyA || busyB {
+		return nil, busyA, busyB, nil
+	}
+	session := &models.Session{
+		ID:     p.PlayerA,
+		GameID: gameID,
+		PlayerA: &models.Player{
+			ID:       p.PlayerA,
+			Username: names[p.PlayerA],
+		},
+		PlayerB: &models.Player{
+			ID:       p.PlayerB,
+			Username: names[p.PlayerB],
+		},
+		TotalRounds:     settings.Rounds,
+		CurrentRound:    1,
+		State:           models.StateWaitingForPlayerB,
+		History:         make([]models.RoundResult, 0),
+		Payoff:          settings.Payoff,
+		TurnTimeout:     settings.TurnTimeout,
+		TournamentID:    id,
+		TournamentRound: round,
+	}
+	a := newActor(session, nil)
+	m.mustFire(a, EventStart, nil)
+	snapshot := session.Clone()
+
+	if err := m.register(a); err != nil {
+		return nil, false, false, err
+	}
+	events = append(events, a.unlogged...)
+	return snapshot, false, false, nil
+}
+
+// recordTournamentGame scores the match of a tournament game that has just
+// ended. Players who forfeited or ran out of move time lose the match.
+func (m *Manager) recordTournamentGame(session *models.Session) {
+	if session.TournamentID == "" {
+		return
+	}
+
+	m.tournamentsMu.Lock()
+	defer m.tournamentsMu.Unlock()
+	t, ok := m.tournaments[session.TournamentID]
+	if !ok || t.State != models.TournamentRunning {
+		return
+	}
+	pA, pB := session.PlayerA, session.PlayerB
+	for i := range t.Pairings {
+		p := &t.Pairings[i]
+		if p.Round != session.TournamentRound || p.Done || p.PlayerA != pA.ID || p.PlayerB != pB.ID {
+			continue
+		}
+		p.ScoreA, p.ScoreB = pA.Score, pB.Score
+		p.ForfeitA = session.ForfeitedBy == pA.ID || session.RanOutOfTime(pA.ID)
+		p.ForfeitB = session.ForfeitedBy == pB.ID || session.RanOutOfTime(pB.ID)
+		scoreMatch(t, p)
+		return
+	}
+	log.Printf("Game %s of tournament %s matches no open pairing", session.GameID, t.ID)
+}
+
+// scoreMatch marks a pairing done and adds it to its players' records. A
+// player who forfeited loses; otherwise the score decides, and a bye is a win.
+func scoreMatch(t *models.Tournament, p *models.Pairing) {
+	p.Done = true
+	a, _ := t.Player(p.PlayerA)
+	a.Points += p.ScoreA
+	if p.IsBye() {
+		a.HadBye = true
+		a.Wins++
+		return
+	}
+	b, _ := t.Player(p.PlayerB)
+	b.Points += p.ScoreB
+
+	switch {
+	case p.ForfeitA && p.ForfeitB:
+		a.Losses++
+		b.Losses++
+	case p.ForfeitB || !p.ForfeitA && p.ScoreA > p.ScoreB:
+		a.Wins++
+		b.Losses++
+	case p.ForfeitA || p.ScoreB > p.ScoreA:
+		b.Wins++
+		a.Losses++
+	default:
+		a.Draws++
+		b.Draws++
+	}
+}
+
+// walkoverPoints is what a bye or a walkover is worth: the score of a match
+// cooperated through to the end.
+func walkoverPoints(t *models.Tournament) int {
+	return t.Rounds * t.Payoff.Reward
+}
+
+// swissRounds is how many pairing rounds a Swiss tournament of n players
+// lasts: enough for a single winner to emerge, log2(n) rounded up, but no more
+// than there are opponents to meet.
+func swissRounds(n int) int {
+	rounds := 0
+	for 1<<rounds < n {
+		rounds++
+	}
+	if rounds > n-1 {
+		rounds = n - 1
+	}
+	if rounds < 1 {
+		rounds = 1
+	}
+	return rounds
+}
+
+// swissPairings pairs a Swiss round: going down the standings, each player
+// meets the best-placed player left whom they haven't met yet. With an odd
+// number of players the lowest-placed one without a bye so far sits out.
+func swissPairings(t *models.Tournament, round int) []models.Pairing {
+	standings := t.Standings()
+	ids := make([]int64, 0, len(standings))
+	for _, p := range standings {
+		ids = append(ids, p.ID)
+	}
+
+	var pairings []models.Pairing
+	if len(ids)%2 == 1 {
+		bye := len(ids) - 1
+		for i := len(ids) - 1; i >= 0; i-- {
+			if !standings[i].HadBye {
+				bye = i
+				break
+			}
+		}
+		pairings = append(pairings, models.Pairing{Round: round, PlayerA: ids[bye]})
+		ids = append(ids[:bye], ids[bye+1:]...)
+	}
+
+	for len(ids) > 0 {
+		// Everyone left may have been met already; then the next in line plays again.
+		opponent := 1
+		for i := 1; i < len(ids); i++ {
+			if !t.Met(ids[0], ids[i]) {
+				opponent = i
+				break
+			}
+		}
+		pairings = append(pairings, models.Pairing{Round: round, PlayerA: ids[0], PlayerB: ids[opponent]})
+		ids = append(ids[1:opponent], ids[opponent+1:]...)
+	}
+	return pairings
+}
+
+// roundRobinPairings schedules every round of a round robin with the circle
+// method: the first player stays put while the rest rotate around them. With
+// an odd number of players, whoever is paired with the empty seat has a bye.
+func roundRobinPairings(ids []int64) []models.Pairing {
+	seats := append([]int64(nil), ids...)
+	if len(seats)%2 == 1 {
+		seats = append(seats, 0)
+	}
+	n := len(seats)
+
+	var pairings []models.Pairing
+	for round := 1; round < n; round++ {
+		for i := 0; i < n/2; i++ {
+			a, b := seats[i], seats[n-1-i]
+			if a == 0 {
+				a, b = b, a
+			}
+			pairings = append(pairings, models.Pairing{Round: round, PlayerA: a, PlayerB: b})
+		}
+		rotated := make([]int64, 0, n)
+		rotated = append(rotated, seats[0], seats[n-1])
+		seats = append(rotated, seats[1:n-1]...)
+	}
+	return pairings
+}
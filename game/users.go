@@ -0,0 +1,76 @@
+package game
+
+import (
+	"errors"
+	"log"
+	"prisoners-dilemma-bot/storage"
+	"strings"
+)
+
+// usersCollection maps usernames, lowercased, to the players who use them, so
+// players can be challenged by username.
+const usersCollection = "users"
+
+type knownUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// normalizeUsername drops the leading @ and lowercases a username, since
+// Telegram usernames are case-insensitive.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// SeeUser records that a player uses the bot under the given username. It is
+// cheap to call on every update: the store is only written when the username changes.
+func (m *Manager) SeeUser(playerID int64, username string) {
+	key := normalizeUsername(username)
+	if key == "" {
+		return
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	old, seen := m.usernames[playerID]
+	if seen && old == key {
+		return
+	}
+	// The old username may have been taken by someone else since.
+	if seen && m.userIDs[old] == playerID {
+		delete(m.userIDs, old)
+		if err := m.store.Delete(usersCollection, old); err != nil {
+			log.Printf("Failed to forget username %q of player %d: %v", old, playerID, err)
+		}
+	}
+	user := knownUser{ID: playerID, Username: strings.TrimPrefix(strings.TrimSpace(username), "@")}
+	if err := m.store.Save(usersCollection, key, user); err != nil {
+		log.Printf("Failed to save username %q of player %d: %v", key, playerID, err)
+	}
+	m.userIDs[key] = playerID
+	m.usernames[playerID] = key
+}
+
+// LookupUser returns the ID of the player who last used the bot under username.
+func (m *Manager) LookupUser(username string) (int64, bool) {
+	key := normalizeUsername(username)
+	if key == "" {
+		return 0, false
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	if id, ok := m.userIDs[key]; ok {
+		return id, true
+	}
+	var user knownUser
+	if err := m.store.Load(usersCollection, key, &user); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to look up username %q: %v", key, err)
+		}
+		return 0, false
+	}
+	m.userIDs[key] = user.ID
+	m.usernames[user.ID] = key
+	return user.ID, true
+}
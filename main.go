@@ -3,8 +3,17 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"prisoners-dilemma-bot/bot"
 	"prisoners-dilemma-bot/game"
+	"prisoners-dilemma-bot/messaging/telegram"
+	"prisoners-dilemma-bot/storage"
+	"prisoners-dilemma-bot/strategy"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
@@ -27,8 +36,143 @@ func main() {
 
 	log.Printf("Authorized on account %s", api.Self.UserName)
 
-	gameManager := game.NewManager()
-	telegramBot := bot.NewBot(api, gameManager)
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	store, err := storage.NewFileStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to open data directory %s: %v", dataDir, err)
+	}
+	// Every change to every game is appended to the event log, so admins can
+	// replay games. Games in progress are not restored from it on restart.
+	eventLog, err := storage.OpenFileLog(filepath.Join(dataDir, "events.jsonl"))
+	if err != nil {
+		log.Fatalf("Failed to open event log: %v", err)
+	}
+	defer eventLog.Close()
+
+	gameConfig := game.Config{
+		Store:    store,
+		Learner:  learnerConfigFromEnv(),
+		EventLog: eventLog,
+	}
+	envDuration("INVITE_TTL", &gameConfig.InviteTTL)
+	envInt("MAX_OPEN_INVITES", &gameConfig.MaxOpenInvites)
+	envInt("MAX_SPECTATORS", &gameConfig.MaxSpectators)
+	// SEASON_SCHEDULE=weekly or monthly runs seasons back to back.
+	gameConfig.SeasonSchedule = os.Getenv("SEASON_SCHEDULE")
+	if !game.ValidSchedule(gameConfig.SeasonSchedule) {
+		log.Fatalf("Invalid SEASON_SCHEDULE %q: use weekly or monthly", gameConfig.SeasonSchedule)
+	}
+	gameManager := game.NewManager(gameConfig)
+	botConfig := bot.Config{
+		Admins: parseIDs("ADMIN_IDS"),
+		Banned: parseIDs("BANNED_IDS"),
+		// Set CALLBACK_SECRET to keep buttons working across restarts.
+		CallbackSecret: os.Getenv("CALLBACK_SECRET"),
+	}
+	envInt("BOT_WORKERS", &botConfig.Workers)
+	envFloat("BOT_RATE_LIMIT", &botConfig.RateLimit)
+	envInt("BOT_RATE_BURST", &botConfig.RateBurst)
+	envDuration("INVITE_SWEEP_INTERVAL", &botConfig.InviteSweepInterval)
+	envDuration("TOURNAMENT_INTERVAL", &botConfig.TournamentInterval)
+	messenger := telegram.NewQueued(api, telegram.DefaultQueueConfig())
+	telegramBot := bot.NewBot(api, messenger, gameManager, botConfig)
+
+	// On SIGINT or SIGTERM stop taking updates, finish the ones in flight and
+	// flush the send queue before exiting.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down...", sig)
+		telegramBot.Stop()
+	}()
 
 	telegramBot.Start()
+	if !messenger.Drain(shutdownTimeout) {
+		log.Printf("Send queue not empty after %s, exiting anyway", shutdownTimeout)
+	}
+	log.Printf("Bot stopped")
+}
+
+// shutdownTimeout bounds how long queued messages may hold up exit.
+const shutdownTimeout = 10 * time.Second
+
+// learnerConfigFromEnv overrides the default learning opponent settings with
+// LEARNER_ALPHA, LEARNER_GAMMA, LEARNER_EPSILON, LEARNER_EPSILON_DECAY,
+// LEARNER_MIN_EPSILON, LEARNER_MEMORY and LEARNER_NGRAM when they are set.
+func learnerConfigFromEnv() strategy.LearnerConfig {
+	cfg := strategy.DefaultLearnerConfig()
+	envFloat("LEARNER_ALPHA", &cfg.Alpha)
+	envFloat("LEARNER_GAMMA", &cfg.Gamma)
+	envFloat("LEARNER_EPSILON", &cfg.Epsilon)
+	envFloat("LEARNER_EPSILON_DECAY", &cfg.EpsilonDecay)
+	envFloat("LEARNER_MIN_EPSILON", &cfg.MinEpsilon)
+	envInt("LEARNER_MEMORY", &cfg.Memory)
+	envInt("LEARNER_NGRAM", &cfg.NGram)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid LEARNER_* settings: %v", err)
+	}
+	return cfg
+}
+
+func envFloat(name string, target *float64) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, raw, err)
+		return
+	}
+	*target = value
+}
+
+func envInt(name string, target *int) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, raw, err)
+		return
+	}
+	*target = value
+}
+
+// envDuration reads a duration such as "30m" or "2h".
+func envDuration(name string, target *time.Duration) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", name, raw, err)
+		return
+	}
+	*target = value
+}
+
+// parseIDs reads a comma-separated list of Telegram user IDs from the
+// environment variable name.
+func parseIDs(name string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(os.Getenv(name), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid ID %q in %s: %v", part, name, err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
 }
@@ -0,0 +1,108 @@
+package messaging
+
+import "sync"
+
+// Sent is a message recorded by Fake, with its latest text and keyboard.
+// Documents have their caption as Text.
+type Sent struct {
+	Ref      MessageRef
+	Text     string
+	Keyboard *Keyboard
+	Choice   bool
+	Edits    int
+	Document string
+	Data     []byte
+}
+
+// Fake is an in-memory Messenger that records everything it is asked to send.
+type Fake struct {
+	mu        sync.Mutex
+	nextID    int
+	messages  []*Sent
+	callbacks []string
+}
+
+// NewFake creates an empty recording messenger.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) record(chatID int64, text string, keyboard *Keyboard, choice bool) MessageRef {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	ref := MessageRef{ChatID: chatID, MessageID: f.nextID}
+	f.messages = append(f.messages, &Sent{Ref: ref, Text: text, Keyboard: keyboard, Choice: choice})
+	return ref
+}
+
+func (f *Fake) SendText(chatID int64, text string, keyboard *Keyboard) (MessageRef, error) {
+	return f.record(chatID, text, keyboard, false), nil
+}
+
+func (f *Fake) SendChoice(chatID int64, text string, keyboard *Keyboard) (MessageRef, error) {
+	return f.record(chatID, text, keyboard, true), nil
+}
+
+func (f *Fake) SendDocument(chatID int64, name string, data []byte, caption string) (MessageRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	ref := MessageRef{ChatID: chatID, MessageID: f.nextID}
+	f.messages = append(f.messages, &Sent{Ref: ref, Text: caption, Document: name, Data: data})
+	return ref, nil
+}
+
+func (f *Fake) EditMessage(ref MessageRef, text string, keyboard *Keyboard) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, m := range f.messages {
+		if m.Ref == ref {
+			m.Text = text
+			m.Keyboard = keyboard
+			m.Edits++
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *Fake) AnswerCallback(callbackID, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.callbacks = append(f.callbacks, callbackID)
+	return nil
+}
+
+// Messages returns copies of all messages sent to a chat, oldest first.
+func (f *Fake) Messages(chatID int64) []Sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var sent []Sent
+	for _, m := range f.messages {
+		if m.Ref.ChatID == chatID {
+			sent = append(sent, *m)
+		}
+	}
+	return sent
+}
+
+// Last returns the most recent message sent to a chat.
+func (f *Fake) Last(chatID int64) (Sent, bool) {
+	messages := f.Messages(chatID)
+	if len(messages) == 0 {
+		return Sent{}, false
+	}
+	return messages[len(messages)-1], true
+}
+
+// Answered returns the IDs of all acknowledged callbacks.
+func (f *Fake) Answered() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.callbacks...)
+}
@@ -0,0 +1,97 @@
+package messaging
+
+import "errors"
+
+// ErrUnreachable is reported when a chat can no longer receive messages, for
+// example because the user blocked the bot.
+var ErrUnreachable = errors.New("получатель недоступен")
+
+// Button is a single keyboard button. Data is returned to the bot when an inline
+// button is pressed; URL turns it into a link button. Menu buttons only use Text.
+type Button struct {
+	Text string
+	Data string
+	URL  string
+}
+
+// Keyboard is a grid of buttons. Inline keyboards are attached to a message;
+// menu keyboards replace the user's persistent reply keyboard.
+type Keyboard struct {
+	Rows [][]Button
+	Menu bool
+}
+
+// MessageRef identifies a message that was sent earlier, so it can be edited.
+type MessageRef struct {
+	ChatID    int64
+	MessageID int
+	// InlineID identifies a message users posted through the bot's inline
+	// mode. Such messages belong to no chat the bot knows, so ChatID and
+	// MessageID are zero.
+	InlineID string
+}
+
+// Messenger is everything the game flow needs from a chat transport.
+// Messengers that deliver asynchronously return a MessageRef without a
+// MessageID and report failed deliveries through FailureReporter.
+type Messenger interface {
+	// SendText sends a message, optionally with an inline or menu keyboard.
+	SendText(chatID int64, text string, keyboard *Keyboard) (MessageRef, error)
+	// SendChoice sends a prompt the player answers by pressing one of the inline buttons.
+	SendChoice(chatID int64, text string, keyboard *Keyboard) (MessageRef, error)
+	// EditMessage replaces the text and inline keyboard of a sent message.
+	EditMessage(ref MessageRef, text string, keyboard *Keyboard) error
+	// AnswerCallback acknowledges a button press, optionally with a short notice.
+	AnswerCallback(callbackID, text string) error
+}
+
+// FailureReporter is implemented by messengers that can only find out later
+// that a message was never delivered.
+type FailureReporter interface {
+	// OnFailure registers fn to be called for every message that was given up on.
+	OnFailure(fn func(chatID int64, err error))
+}
+
+// Waiter is implemented by asynchronous messengers that can also wait for a
+// message to be delivered, for the few messages whose ID is needed later.
+type Waiter interface {
+	// SendAndWait sends a message like SendText and returns once it is
+	// delivered, with the MessageID filled in.
+	SendAndWait(chatID int64, text string, keyboard *Keyboard) (MessageRef, error)
+}
+
+// DocumentSender is implemented by messengers that can deliver files.
+type DocumentSender interface {
+	// SendDocument sends data as a file with the given name and caption.
+	SendDocument(chatID int64, name string, data []byte, caption string) (MessageRef, error)
+}
+
+// Inline builds an inline keyboard from rows of buttons.
+func Inline(rows ...[]Button) *Keyboard {
+	return &Keyboard{Rows: rows}
+}
+
+// Menu builds a persistent menu keyboard from rows of buttons.
+func Menu(rows ...[]Button) *Keyboard {
+	return &Keyboard{Rows: rows, Menu: true}
+}
+
+// Row groups buttons into one keyboard row.
+func Row(buttons ...Button) []Button {
+	return buttons
+}
+
+// DataButton is an inline button that reports data back when pressed.
+func DataButton(text, data string) Button {
+	return Button{Text: text, Data: data}
+}
+
+// URLButton is an inline button that opens a link.
+func URLButton(text, url string) Button {
+	return Button{Text: text, URL: url}
+}
+
+// TextButton is a menu button that sends its own text when pressed.
+func TextButton(text string) Button {
+	return Button{Text: text}
+}
@@ -0,0 +1,158 @@
+package telegram
+
+import (
+	"prisoners-dilemma-bot/messaging"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Messenger delivers messages through the Telegram Bot API.
+type Messenger struct {
+	api   *tgbotapi.BotAPI
+	queue *Queue
+}
+
+// New creates a Telegram messenger on top of an authorized bot API client.
+// Every call waits for Telegram's answer.
+func New(api *tgbotapi.BotAPI) *Messenger {
+	return &Messenger{api: api}
+}
+
+// NewQueued creates a messenger that hands messages and edits to a rate-limited
+// send queue and returns immediately. Failed deliveries are reported through OnFailure.
+func NewQueued(api *tgbotapi.BotAPI, cfg QueueConfig) *Messenger {
+	return &Messenger{api: api, queue: NewQueue(api, cfg)}
+}
+
+// OnFailure registers fn for messages the send queue gave up on.
+// It does nothing for a messenger without a queue, whose calls report errors directly.
+func (m *Messenger) OnFailure(fn func(chatID int64, err error)) {
+	if m.queue != nil {
+		m.queue.OnFailure(fn)
+	}
+}
+
+// Drain waits up to timeout for the send queue to empty.
+func (m *Messenger) Drain(timeout time.Duration) bool {
+	if m.queue == nil {
+		return true
+	}
+	return m.queue.Drain(timeout)
+}
+
+func (m *Messenger) SendText(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = replyMarkup(keyboard)
+	}
+	if m.queue != nil {
+		m.queue.Enqueue(chatID, msg)
+		return messaging.MessageRef{ChatID: chatID}, nil
+	}
+	sent, err := m.api.Send(msg)
+	if err != nil {
+		return messaging.MessageRef{}, err
+	}
+	return messaging.MessageRef{ChatID: chatID, MessageID: sent.MessageID}, nil
+}
+
+// SendAndWait sends a message like SendText, but waits for a queued message
+// to be delivered so the returned MessageRef carries its ID.
+func (m *Messenger) SendAndWait(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	if m.queue == nil {
+		return m.SendText(chatID, text, keyboard)
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = replyMarkup(keyboard)
+	}
+	sent, err := m.queue.EnqueueWait(chatID, msg)
+	if err != nil {
+		return messaging.MessageRef{}, err
+	}
+	return messaging.MessageRef{ChatID: chatID, MessageID: sent.MessageID}, nil
+}
+
+func (m *Messenger) SendChoice(chatID int64, text string, keyboard *messaging.Keyboard) (messaging.MessageRef, error) {
+	return m.SendText(chatID, text, keyboard)
+}
+
+// SendDocument uploads data as a file with the given name and caption.
+func (m *Messenger) SendDocument(chatID int64, name string, data []byte, caption string) (messaging.MessageRef, error) {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	if m.queue != nil {
+		m.queue.Enqueue(chatID, doc)
+		return messaging.MessageRef{ChatID: chatID}, nil
+	}
+	sent, err := m.api.Send(doc)
+	if err != nil {
+		return messaging.MessageRef{}, err
+	}
+	return messaging.MessageRef{ChatID: chatID, MessageID: sent.MessageID}, nil
+}
+
+func (m *Messenger) EditMessage(ref messaging.MessageRef, text string, keyboard *messaging.Keyboard) error {
+	edit := tgbotapi.NewEditMessageText(ref.ChatID, ref.MessageID, text)
+	if ref.InlineID != "" {
+		edit = tgbotapi.EditMessageTextConfig{BaseEdit: tgbotapi.BaseEdit{InlineMessageID: ref.InlineID}, Text: text}
+	}
+	if keyboard != nil && !keyboard.Menu {
+		markup := inlineMarkup(keyboard)
+		edit.ReplyMarkup = &markup
+	}
+	if m.queue != nil {
+		// Inline messages have no chat and share the queue of chat 0.
+		m.queue.Enqueue(ref.ChatID, edit)
+		return nil
+	}
+	_, err := send(m.api, edit)
+	return err
+}
+
+func (m *Messenger) AnswerCallback(callbackID, text string) error {
+	_, err := m.api.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+// InlineMarkup is the Bot API form of an inline keyboard, for results of inline queries.
+func InlineMarkup(keyboard *messaging.Keyboard) *tgbotapi.InlineKeyboardMarkup {
+	markup := inlineMarkup(keyboard)
+	return &markup
+}
+
+func replyMarkup(keyboard *messaging.Keyboard) interface{} {
+	if keyboard.Menu {
+		return menuMarkup(keyboard)
+	}
+	return inlineMarkup(keyboard)
+}
+
+func inlineMarkup(keyboard *messaging.Keyboard) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(keyboard.Rows))
+	for _, row := range keyboard.Rows {
+		buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			if b.URL != "" {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(b.Text, b.URL))
+			} else {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+			}
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func menuMarkup(keyboard *messaging.Keyboard) tgbotapi.ReplyKeyboardMarkup {
+	rows := make([][]tgbotapi.KeyboardButton, 0, len(keyboard.Rows))
+	for _, row := range keyboard.Rows {
+		buttons := make([]tgbotapi.KeyboardButton, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, tgbotapi.NewKeyboardButton(b.Text))
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
@@ -0,0 +1,316 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prisoners-dilemma-bot/messaging"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// QueueConfig sets the outbound limits. Telegram allows about 30 messages per
+// second overall and one per second in a single chat, with short bursts tolerated.
+type QueueConfig struct {
+	GlobalRate float64 // messages per second across all chats
+	ChatRate   float64 // messages per second within one chat
+	ChatBurst  int     // messages a quiet chat may receive back to back
+	MaxRetries int     // attempts after network and server errors before giving up
+	RetryDelay time.Duration
+}
+
+// DefaultQueueConfig returns limits that stay within Telegram's published ones.
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		GlobalRate: 30,
+		ChatRate:   1,
+		ChatBurst:  3,
+		MaxRetries: 5,
+		RetryDelay: time.Second,
+	}
+}
+
+// sender is the part of tgbotapi.BotAPI the queue uses.
+type sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// Queue delivers outgoing requests in the background. Requests to the same chat
+// are sent one at a time in the order they were queued; different chats are
+// served in parallel under a shared global rate limit. Inline messages belong
+// to no chat, so edits of each one are queued and limited on their own.
+type Queue struct {
+	api sender
+	cfg QueueConfig
+
+	mu        sync.Mutex
+	global    *limiter
+	chats     map[chatKey]*chatQueue // only chats with recent traffic
+	onFailure func(chatID int64, err error)
+	pending   sync.WaitGroup
+}
+
+// chatKey identifies a chat queue: a chat, or an inline message for edits of one.
+type chatKey struct {
+	chatID int64
+	inline string
+}
+
+// keyOf is the queue a request to chatID goes to.
+func keyOf(chatID int64, c tgbotapi.Chattable) chatKey {
+	if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok && edit.InlineMessageID != "" {
+		return chatKey{inline: edit.InlineMessageID}
+	}
+	return chatKey{chatID: chatID}
+}
+
+type chatQueue struct {
+	jobs    []job
+	limiter *limiter
+	running bool
+}
+
+// job is one queued request. When done is set, the outcome is sent on it
+// instead of going to the failure callback.
+type job struct {
+	c    tgbotapi.Chattable
+	done chan<- delivery
+}
+
+type delivery struct {
+	msg tgbotapi.Message
+	err error
+}
+
+// NewQueue creates a send queue on top of api.
+func NewQueue(api sender, cfg QueueConfig) *Queue {
+	defaults := DefaultQueueConfig()
+	if cfg.GlobalRate <= 0 {
+		cfg.GlobalRate = defaults.GlobalRate
+	}
+	if cfg.ChatRate <= 0 {
+		cfg.ChatRate = defaults.ChatRate
+	}
+	if cfg.ChatBurst <= 0 {
+		cfg.ChatBurst = 1
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaults.RetryDelay
+	}
+	return &Queue{
+		api:    api,
+		cfg:    cfg,
+		global: newLimiter(cfg.GlobalRate, cfg.GlobalRate),
+		chats:  make(map[chatKey]*chatQueue),
+	}
+}
+
+// OnFailure registers fn to be called for every request the queue gives up on.
+// Errors for chats that cannot be reached wrap messaging.ErrUnreachable.
+func (q *Queue) OnFailure(fn func(chatID int64, err error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onFailure = fn
+}
+
+// Enqueue schedules c for delivery to chatID.
+func (q *Queue) Enqueue(chatID int64, c tgbotapi.Chattable) {
+	q.enqueue(chatID, job{c: c})
+}
+
+// EnqueueWait schedules c for delivery to chatID like Enqueue, but waits for
+// it to be sent and returns the result. Failures are returned rather than
+// reported through OnFailure.
+func (q *Queue) EnqueueWait(chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	done := make(chan delivery, 1)
+	q.enqueue(chatID, job{c: c, done: done})
+	d := <-done
+	return d.msg, d.err
+}
+
+func (q *Queue) enqueue(chatID int64, j job) {
+	q.pending.Add(1)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := keyOf(chatID, j.c)
+	chat, ok := q.chats[key]
+	if !ok {
+		chat = &chatQueue{limiter: newLimiter(q.cfg.ChatRate, float64(q.cfg.ChatBurst))}
+		q.chats[key] = chat
+	}
+	chat.jobs = append(chat.jobs, j)
+	if !chat.running {
+		chat.running = true
+		go q.run(chatID, key, chat)
+	}
+}
+
+// Drain waits until everything queued so far has been delivered or given up on.
+// It reports false if that takes longer than timeout.
+func (q *Queue) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// run delivers a chat's requests until its queue is empty.
+func (q *Queue) run(chatID int64, key chatKey, chat *chatQueue) {
+	for {
+		q.mu.Lock()
+		if len(chat.jobs) == 0 {
+			chat.running = false
+			// Once its limiter has refilled, an idle queue is no different
+			// from a new one and can go.
+			time.AfterFunc(chat.limiter.untilFull(time.Now()), func() { q.forget(key, chat) })
+			q.mu.Unlock()
+			return
+		}
+		j := chat.jobs[0]
+		chat.jobs = chat.jobs[1:]
+		q.mu.Unlock()
+
+		msg, err := q.deliver(chat, j.c)
+		switch {
+		case j.done != nil:
+			j.done <- delivery{msg: msg, err: err}
+		case err != nil:
+			q.fail(chatID, err)
+		}
+		q.pending.Done()
+	}
+}
+
+// forget drops the queue of a chat that has stayed idle until its limiter
+// refilled. A queue that is busy again is kept; its next run tries once more.
+func (q *Queue) forget(key chatKey, chat *chatQueue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.chats[key] != chat || chat.running {
+		return
+	}
+	if wait := chat.limiter.untilFull(time.Now()); wait > 0 {
+		time.AfterFunc(wait, func() { q.forget(key, chat) })
+		return
+	}
+	delete(q.chats, key)
+}
+
+// send makes one request. Edits of inline messages are answered with true
+// rather than the edited message, which Send can't decode.
+func send(api sender, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok && edit.InlineMessageID != "" {
+		_, err := api.Request(c)
+		return tgbotapi.Message{}, err
+	}
+	return api.Send(c)
+}
+
+// deliver sends one request, retrying after flood waits and transient errors.
+func (q *Queue) deliver(chat *chatQueue, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	retries := 0
+	for {
+		time.Sleep(chat.limiter.reserve(time.Now()))
+		q.mu.Lock()
+		wait := q.global.reserve(time.Now())
+		q.mu.Unlock()
+		time.Sleep(wait)
+
+		msg, err := send(q.api, c)
+		if err == nil {
+			return msg, nil
+		}
+
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) {
+			switch {
+			case apiErr.RetryAfter > 0:
+				// Flood waits don't count as retries: Telegram says exactly when to come back.
+				time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+				continue
+			case isUnreachable(apiErr):
+				return tgbotapi.Message{}, fmt.Errorf("%w: %v", messaging.ErrUnreachable, err)
+			case apiErr.Code >= 400 && apiErr.Code < 500:
+				return tgbotapi.Message{}, err
+			}
+		}
+
+		if retries >= q.cfg.MaxRetries {
+			return tgbotapi.Message{}, fmt.Errorf("не удалось отправить после %d попыток: %v", retries+1, err)
+		}
+		time.Sleep(q.cfg.RetryDelay << retries)
+		retries++
+	}
+}
+
+func (q *Queue) fail(chatID int64, err error) {
+	q.mu.Lock()
+	onFailure := q.onFailure
+	q.mu.Unlock()
+
+	log.Printf("Giving up on message to %d: %v", chatID, err)
+	if onFailure != nil {
+		onFailure(chatID, err)
+	}
+}
+
+// isUnreachable reports whether the error means the chat cannot receive anything anymore.
+func isUnreachable(err *tgbotapi.Error) bool {
+	if err.Code == 403 {
+		return true
+	}
+	return err.Code == 400 && (strings.Contains(err.Message, "chat not found") || strings.Contains(err.Message, "user is deactivated"))
+}
+
+// limiter is a token bucket that hands out reservations instead of blocking.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate, burst float64) *limiter {
+	return &limiter{rate: rate, burst: burst, tokens: burst}
+}
+
+// untilFull is how long the bucket takes to refill completely.
+func (l *limiter) untilFull(now time.Time) time.Duration {
+	tokens := l.tokens
+	if !l.last.IsZero() {
+		tokens += now.Sub(l.last).Seconds() * l.rate
+	}
+	if tokens >= l.burst {
+		return 0
+	}
+	return time.Duration((l.burst - tokens) / l.rate * float64(time.Second))
+}
+
+// reserve takes one token and returns how long to wait before using it.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
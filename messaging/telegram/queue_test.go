@@ -0,0 +1,91 @@
+package telegram
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recorder is a sender that accepts every request and counts them.
+type recorder struct {
+	mu   sync.Mutex
+	sent int
+}
+
+func (r *recorder) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent++
+	return tgbotapi.Message{}, nil
+}
+
+func (r *recorder) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent++
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func inlineEdit(id, text string) tgbotapi.EditMessageTextConfig {
+	return tgbotapi.EditMessageTextConfig{BaseEdit: tgbotapi.BaseEdit{InlineMessageID: id}, Text: text}
+}
+
+func TestInlineEditsHaveTheirOwnLimit(t *testing.T) {
+	api := &recorder{}
+	q := NewQueue(api, QueueConfig{GlobalRate: 1000, ChatRate: 5, ChatBurst: 1})
+
+	// Inline messages come without a chat; they must not wait on each other
+	// or on chat 0.
+	start := time.Now()
+	q.Enqueue(0, inlineEdit("first", "a"))
+	q.Enqueue(0, inlineEdit("second", "b"))
+	q.Enqueue(0, tgbotapi.NewMessage(0, "c"))
+	if !q.Drain(2 * time.Second) {
+		t.Fatal("queue didn't drain")
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("three requests to different queues took %v", elapsed)
+	}
+
+	// Edits of the same inline message still share its limit.
+	start = time.Now()
+	q.Enqueue(0, inlineEdit("first", "d"))
+	q.Enqueue(0, inlineEdit("first", "e"))
+	if !q.Drain(3 * time.Second) {
+		t.Fatal("queue didn't drain")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("two edits of one inline message took only %v", elapsed)
+	}
+	if api.sent != 5 {
+		t.Errorf("sent %d requests, want 5", api.sent)
+	}
+}
+
+func TestIdleChatsAreForgotten(t *testing.T) {
+	q := NewQueue(&recorder{}, QueueConfig{GlobalRate: 1000, ChatRate: 20, ChatBurst: 2})
+	for chatID := int64(1); chatID <= 100; chatID++ {
+		q.Enqueue(chatID, tgbotapi.NewMessage(chatID, "hi"))
+	}
+	q.Enqueue(0, inlineEdit("inline", "hi"))
+	if !q.Drain(2 * time.Second) {
+		t.Fatal("queue didn't drain")
+	}
+
+	// Limiters refill within a tenth of a second at 20 messages per second.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		q.mu.Lock()
+		left := len(q.chats)
+		q.mu.Unlock()
+		if left == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d idle chat queues are still kept", left)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,10 +2,12 @@ package models
 
 import (
 	"fmt"
-	"sync"
+	"strings"
 	"time"
 )
 
+// GameState is where a session is in its lifecycle. Only the game manager's
+// state machine changes it.
 type GameState int
 
 const (
@@ -13,8 +15,26 @@ const (
 	StateInProgress
 	StateFinished
 	StateWaitingRematch
+	StateResolvingRound
+	StateAbandoned
 )
 
+var stateNames = [...]string{
+	StateWaitingForPlayerB: "waiting",
+	StateInProgress:        "in-progress",
+	StateFinished:          "finished",
+	StateWaitingRematch:    "awaiting-rematch",
+	StateResolvingRound:    "round-resolving",
+	StateAbandoned:         "abandoned",
+}
+
+func (s GameState) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("GameState(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
 type PlayerChoice string
 
 const (
@@ -23,6 +43,76 @@ const (
 	ChoiceDefect    PlayerChoice = "предать"
 )
 
+// Payoff is the score table of a single round: Reward for mutual cooperation,
+// Sucker for cooperating against a defector, Temptation for defecting against a
+// cooperator and Punishment for mutual defection.
+type Payoff struct {
+	Reward     int `json:"reward"`
+	Sucker     int `json:"sucker"`
+	Temptation int `json:"temptation"`
+	Punishment int `json:"punishment"`
+}
+
+// ClassicPayoff is the standard 3/0/5/1 prisoner's dilemma table.
+var ClassicPayoff = Payoff{Reward: 3, Sucker: 0, Temptation: 5, Punishment: 1}
+
+// String is the table in R/S/T/P order.
+func (p Payoff) String() string {
+	return fmt.Sprintf("%d/%d/%d/%d", p.Reward, p.Sucker, p.Temptation, p.Punishment)
+}
+
+// PayoffPreset is a named payoff table players can pick for a game.
+type PayoffPreset struct {
+	// Key identifies the preset in button payloads, so it is kept short.
+	Key    string
+	Name   string
+	Payoff Payoff
+}
+
+// PayoffPresets are the tables offered when creating a game, the default first.
+// All of them keep mutual cooperation the best outcome over repeated rounds.
+var PayoffPresets = []PayoffPreset{
+	{Key: "c", Name: "Классика", Payoff: ClassicPayoff},
+	{Key: "m", Name: "Мягкая", Payoff: Payoff{Reward: 3, Sucker: 1, Temptation: 4, Punishment: 2}},
+	{Key: "h", Name: "Жесткая", Payoff: Payoff{Reward: 3, Sucker: -3, Temptation: 6, Punishment: 0}},
+}
+
+// PresetByKey looks up a payoff preset by its key.
+func PresetByKey(key string) (PayoffPreset, bool) {
+	for _, preset := range PayoffPresets {
+		if preset.Key == key {
+			return preset, true
+		}
+	}
+	return PayoffPreset{}, false
+}
+
+// PayoffName is the name of the preset with the given table, or the table
+// itself if it isn't one of the presets.
+func PayoffName(p Payoff) string {
+	for _, preset := range PayoffPresets {
+		if preset.Payoff == p {
+			return preset.Name
+		}
+	}
+	return p.String()
+}
+
+// Scores returns the points both players earn for a pair of moves.
+func (p Payoff) Scores(a, b PlayerChoice) (int, int) {
+	switch {
+	case a == ChoiceNegotiate && b == ChoiceNegotiate:
+		return p.Reward, p.Reward
+	case a == ChoiceNegotiate && b == ChoiceDefect:
+		return p.Sucker, p.Temptation
+	case a == ChoiceDefect && b == ChoiceNegotiate:
+		return p.Temptation, p.Sucker
+	case a == ChoiceDefect && b == ChoiceDefect:
+		return p.Punishment, p.Punishment
+	}
+	return 0, 0
+}
+
 type RoundResult struct {
 	Round         int
 	PlayerAChoice PlayerChoice
@@ -30,6 +120,10 @@ type RoundResult struct {
 	PlayerAScore  int
 	PlayerBScore  int
 	Timestamp     time.Time
+	// PlayerAResponse and PlayerBResponse are how long each player took to
+	// move, zero for bots and for moves made for a player who ran out of time.
+	PlayerAResponse time.Duration
+	PlayerBResponse time.Duration
 }
 
 type Player struct {
@@ -39,36 +133,83 @@ type Player struct {
 	CurrentChoice PlayerChoice
 	LastMoveTime  time.Time
 	WantsRematch  bool
+	IsBot         bool
 }
 
 // Session represents a single game instance between two players.
+// A live session is owned by the game manager; everything outside it works on
+// copies made with Clone.
 type Session struct {
-	ID           int64
+	ID int64
+	// GameID changes with every game played in the session, rematches included,
+	// so buttons from an earlier game can be told apart.
+	GameID       string
 	PlayerA      *Player
 	PlayerB      *Player
 	TotalRounds  int
 	CurrentRound int
 	State        GameState
-	Mutex        sync.Mutex
 	History      []RoundResult
+	// StartedAt is when the first round of the game began.
+	StartedAt    time.Time
 	TurnDeadline time.Time
+	// Payoff scores the rounds and TurnTimeout limits each move; a zero
+	// TurnTimeout means the manager's default.
+	Payoff      Payoff
+	TurnTimeout time.Duration
+	// ForfeitedBy is the player who forfeited the game, if anyone did.
+	ForfeitedBy int64
+	// TimedOut is the player whose move time ran out, ending the game, if
+	// anyone's did. BothTimedOut is set when neither player moved in time;
+	// TimedOut is then player A.
+	TimedOut     int64
+	BothTimedOut bool
+	// SpectateID is the key of the session's spectate link, empty when
+	// spectators aren't allowed. Spectators stay on through rematches.
+	SpectateID string
+	Spectators []int64
+	// Card is the public match card of a game challenged in a group chat or
+	// shared through inline mode, zero for other games. Rematches are played
+	// without one.
+	Card GroupCard
+	// TournamentID and TournamentRound tie a tournament match to its pairing
+	// round; TournamentID is empty for other games.
+	TournamentID    string
+	TournamentRound int
+}
+
+// RanOutOfTime reports whether the player's move time ran out, ending the game.
+func (s *Session) RanOutOfTime(playerID int64) bool {
+	if s.BothTimedOut {
+		return playerID == s.PlayerA.ID || playerID == s.PlayerB.ID
+	}
+	return s.TimedOut != 0 && s.TimedOut == playerID
+}
+
+// Clone returns a deep copy of the session.
+func (s *Session) Clone() *Session {
+	c := *s
+	playerA, playerB := *s.PlayerA, *s.PlayerB
+	c.PlayerA, c.PlayerB = &playerA, &playerB
+	c.History = append([]RoundResult(nil), s.History...)
+	c.Spectators = append([]int64(nil), s.Spectators...)
+	return &c
 }
 
-// NEW: Helper method to get round history summary for a player
+// GetHistorySummary is the round-by-round table of the game as the given
+// player sees it: both moves of every round and what each of them scored.
 func (s *Session) GetHistorySummary(playerID int64) string {
 	if len(s.History) == 0 {
-		return "No previous rounds."
+		return "Сыгранных раундов пока нет."
 	}
 
-	summary := "📚 Previous rounds:\n"
+	summary := "📚 Сыгранные раунды:\n"
 	for _, round := range s.History {
-		var yourChoice, theirChoice PlayerChoice
-		if playerID == s.PlayerA.ID {
-			yourChoice = round.PlayerAChoice
-			theirChoice = round.PlayerBChoice
-		} else {
-			yourChoice = round.PlayerBChoice
-			theirChoice = round.PlayerAChoice
+		yourChoice, theirChoice := round.PlayerAChoice, round.PlayerBChoice
+		yourScore, theirScore := round.PlayerAScore, round.PlayerBScore
+		if playerID != s.PlayerA.ID {
+			yourChoice, theirChoice = theirChoice, yourChoice
+			yourScore, theirScore = theirScore, yourScore
 		}
 
 		yourEmoji := "😇"
@@ -81,15 +222,84 @@ func (s *Session) GetHistorySummary(playerID int64) string {
 			theirEmoji = "😈"
 		}
 
-		summary += fmt.Sprintf("R%d: ты %s, Он(а) %s\n", round.Round, yourEmoji, theirEmoji)
+		summary += fmt.Sprintf("Р%d: вы %s %+d, соперник %s %+d\n", round.Round, yourEmoji, yourScore, theirEmoji, theirScore)
 	}
 
 	return summary
 }
 
+// GameSettings are the rules an inviter picks for a new game.
+type GameSettings struct {
+	Rounds int
+	Payoff Payoff
+	// TurnTimeout is how long each player has to move; the manager's default when zero.
+	TurnTimeout time.Duration
+	// Public invites are listed in the lobby for anyone to join.
+	Public bool
+	// AllowSpectators gives the game a link anyone can use to watch it.
+	AllowSpectators bool
+	// Target is who may accept the invite; anyone may when it is zero.
+	Target InviteTarget
+}
+
+// PendingInvite is an invitation to a game that nobody has accepted yet.
 type PendingInvite struct {
+	GameSettings
 	InviteID        string
 	InviterID       int64
 	InviterUsername string
-	Rounds          int
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	// MessageID is the inviter's waiting-room message, zero until it is known.
+	MessageID int
+	// Card is the match card of a challenge made in a group chat or of an
+	// invite shared through inline mode.
+	Card GroupCard
+}
+
+// GroupCard is a message that shows a game to a whole chat while it is
+// played: a card posted in a group chat, or an invite a player shared into
+// any chat through inline mode.
+type GroupCard struct {
+	ChatID    int64
+	MessageID int
+	// InlineMessageID identifies a card shared through inline mode, which
+	// has no ChatID or MessageID.
+	InlineMessageID string
+}
+
+// IsZero reports whether there is no card.
+func (c GroupCard) IsZero() bool {
+	return c.MessageID == 0 && c.InlineMessageID == ""
+}
+
+// InviteTarget restricts an invite to one player, by ID or, for players the
+// bot hasn't met yet, by username. When both are set the ID decides.
+type InviteTarget struct {
+	ID       int64
+	Username string
+}
+
+// IsZero reports whether the invite is open to anyone.
+func (t InviteTarget) IsZero() bool {
+	return t.ID == 0 && t.Username == ""
+}
+
+// Matches reports whether the player with the given ID and username may accept the invite.
+func (t InviteTarget) Matches(playerID int64, username string) bool {
+	switch {
+	case t.IsZero():
+		return true
+	case t.ID != 0:
+		return t.ID == playerID
+	}
+	return username != "" && strings.EqualFold(t.Username, username)
+}
+
+// String is how the target is shown to players: @username, or the ID when the username is unknown.
+func (t InviteTarget) String() string {
+	if t.Username != "" {
+		return "@" + t.Username
+	}
+	return fmt.Sprintf("ID %d", t.ID)
 }
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// TournamentFormat is how a tournament pairs its players.
+type TournamentFormat string
+
+const (
+	// FormatSwiss pairs players with similar standings who haven't met yet,
+	// for about log2(players) pairing rounds.
+	FormatSwiss TournamentFormat = "swiss"
+	// FormatRoundRobin has everyone play everyone once.
+	FormatRoundRobin TournamentFormat = "round-robin"
+)
+
+// TournamentScoring is what standings are ranked by.
+type TournamentScoring string
+
+const (
+	// ScoreByPoints ranks by the total score of all matches, then by match wins.
+	ScoreByPoints TournamentScoring = "points"
+	// ScoreByWins ranks by match wins, then draws, then total score.
+	ScoreByWins TournamentScoring = "wins"
+)
+
+// TournamentState is where a tournament is in its lifecycle.
+type TournamentState int
+
+const (
+	TournamentRegistering TournamentState = iota
+	TournamentRunning
+	TournamentFinished
+	TournamentCancelled
+)
+
+// TournamentSettings are what an organizer picks for a tournament.
+type TournamentSettings struct {
+	Format  TournamentFormat
+	Scoring TournamentScoring
+	// Rounds is how many rounds each match lasts.
+	Rounds int
+	Payoff Payoff
+	// TurnTimeout is how long each player has to move; the manager's default when zero.
+	TurnTimeout time.Duration
+	// StartAt is when the tournament starts on its own; zero when the organizer starts it.
+	StartAt time.Time
+}
+
+// Tournament is an event in which registered players are paired for matches
+// over several pairing rounds.
+type Tournament struct {
+	TournamentSettings
+	ID            string
+	OrganizerID   int64
+	OrganizerName string
+	CreatedAt     time.Time
+	// EndedAt is when the tournament finished or was cancelled.
+	EndedAt time.Time
+	State   TournamentState
+	// Players are in the order they registered.
+	Players []TournamentPlayer
+	// Round is the pairing round being played, zero before the start.
+	Round int
+	// TotalRounds is how many pairing rounds there are, known once the tournament starts.
+	TotalRounds int
+	Pairings    []Pairing
+}
+
+// TournamentPlayer is a registered player and their record so far.
+type TournamentPlayer struct {
+	ID       int64
+	Username string
+	// Points is the player's total score over all of their matches.
+	Points int
+	Wins   int
+	Draws  int
+	Losses int
+	HadBye bool
+}
+
+// Pairing is one match of a pairing round. A pairing without PlayerB is a bye.
+type Pairing struct {
+	Round   int
+	PlayerA int64
+	PlayerB int64
+	Done    bool
+	ScoreA  int
+	ScoreB  int
+	// ForfeitA and ForfeitB are set for players who forfeited the match or
+	// couldn't be seated for it.
+	ForfeitA bool
+	ForfeitB bool
+}
+
+// IsBye reports whether the pairing is a bye.
+func (p Pairing) IsBye() bool {
+	return p.PlayerB == 0
+}
+
+// Clone returns a deep copy of the tournament.
+func (t *Tournament) Clone() *Tournament {
+	c := *t
+	c.Players = append([]TournamentPlayer(nil), t.Players...)
+	c.Pairings = append([]Pairing(nil), t.Pairings...)
+	return &c
+}
+
+// Player returns the registered player with the given ID.
+func (t *Tournament) Player(playerID int64) (*TournamentPlayer, bool) {
+	for i := range t.Players {
+		if t.Players[i].ID == playerID {
+			return &t.Players[i], true
+		}
+	}
+	return nil, false
+}
+
+// Met reports whether two players were already paired against each other.
+func (t *Tournament) Met(a, b int64) bool {
+	for _, p := range t.Pairings {
+		if p.PlayerA == a && p.PlayerB == b || p.PlayerA == b && p.PlayerB == a {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundPairings lists the pairings of one pairing round.
+func (t *Tournament) RoundPairings(round int) []Pairing {
+	var pairings []Pairing
+	for _, p := range t.Pairings {
+		if p.Round == round {
+			pairings = append(pairings, p)
+		}
+	}
+	return pairings
+}
+
+// Standings ranks the players by the tournament's scoring, best first. Ties
+// keep the registration order.
+func (t *Tournament) Standings() []TournamentPlayer {
+	standings := append([]TournamentPlayer(nil), t.Players...)
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if t.Scoring == ScoreByWins {
+			switch {
+			case a.Wins != b.Wins:
+				return a.Wins > b.Wins
+			case a.Draws != b.Draws:
+				return a.Draws > b.Draws
+			}
+			return a.Points > b.Points
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return a.Wins > b.Wins
+	})
+	return standings
+}
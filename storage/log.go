@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Log is an append-only sequence of JSON records, each filed under a key.
+// Records are never changed or removed once appended, and the records of one
+// key are read back without going through the others.
+type Log interface {
+	// Append encodes v and adds it to the end of the log under key.
+	Append(key string, v interface{}) error
+	// Scan calls fn with every record appended under key, oldest first, and
+	// stops at the first error fn returns.
+	Scan(key string, fn func(record []byte) error) error
+}
+
+// FileLog keeps a log as a file with one JSON line per record, holding the
+// record and its key. Where each key's lines are is indexed in memory, built
+// when the log is opened.
+type FileLog struct {
+	mu    sync.Mutex
+	file  logFile
+	size  int64
+	index map[string][]span
+}
+
+// logFile is what a FileLog needs of its file; tests stand in for the disk.
+type logFile interface {
+	io.Reader
+	io.Writer
+	io.ReaderAt
+	Truncate(size int64) error
+	Name() string
+	Close() error
+}
+
+// span is where one line of a FileLog is.
+type span struct {
+	offset int64
+	length int
+}
+
+// line is how a FileLog stores a record.
+type line struct {
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record"`
+}
+
+// OpenFileLog opens the log at path for appending, creating it if needed, and
+// indexes the records already in it. A last line cut short by a crash is
+// dropped, and lines that aren't records are logged and skipped.
+func OpenFileLog(path string) (*FileLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &FileLog{file: file, index: make(map[string][]span)}
+	if err := l.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return l, nil
+}
+
+// load indexes the lines of the file.
+func (l *FileLog) load() error {
+	reader := bufio.NewReader(l.file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				return l.file.Truncate(l.size)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var rec line
+			if err := json.Unmarshal(data, &rec); err != nil {
+				log.Printf("Skipping corrupt line at offset %d of %s: %v", l.size, l.file.Name(), err)
+			} else {
+				l.index[rec.Key] = append(l.index[rec.Key], span{offset: l.size, length: len(data)})
+			}
+		}
+		l.size += int64(len(data))
+	}
+}
+
+// Append writes v as the next line of the log. If the write fails, whatever
+// part of the line reached the file is cut off again, so the next line
+// doesn't run into it.
+func (l *FileLog) Append(key string, v interface{}) error {
+	record, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(line{Key: key, Record: record})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(data); err != nil {
+		if terr := l.file.Truncate(l.size); terr != nil {
+			return fmt.Errorf("%v; truncating to the last line: %v", err, terr)
+		}
+		return err
+	}
+	l.index[key] = append(l.index[key], span{offset: l.size, length: len(data)})
+	l.size += int64(len(data))
+	return nil
+}
+
+// Scan reads the lines of key that were appended before it was called.
+func (l *FileLog) Scan(key string, fn func(record []byte) error) error {
+	l.mu.Lock()
+	spans := l.index[key]
+	l.mu.Unlock()
+
+	for _, s := range spans {
+		data := make([]byte, s.length)
+		if _, err := l.file.ReadAt(data, s.offset); err != nil {
+			return err
+		}
+		var rec line
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("offset %d: %v", s.offset, err)
+		}
+		if err := fn(rec.Record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// MemoryLog is an in-process Log, used when nothing should touch the disk.
+type MemoryLog struct {
+	mu      sync.RWMutex
+	records map[string][][]byte
+}
+
+// NewMemoryLog creates an empty in-memory log.
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{records: make(map[string][][]byte)}
+}
+
+// Append encodes v and adds it to the log under key.
+func (l *MemoryLog) Append(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records[key] = append(l.records[key], data)
+	return nil
+}
+
+// Scan calls fn with the records of key appended before it was called.
+func (l *MemoryLog) Scan(key string, fn func(record []byte) error) error {
+	l.mu.RLock()
+	records := l.records[key]
+	l.mu.RUnlock()
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type entry struct {
+	N int `json:"n"`
+}
+
+// scanAll reads the entries of key.
+func scanAll(t *testing.T, l Log, key string) []int {
+	t.Helper()
+	var got []int
+	err := l.Scan(key, func(record []byte) error {
+		var e entry
+		if err := json.Unmarshal(record, &e); err != nil {
+			return err
+		}
+		got = append(got, e.N)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan(%q): %v", key, err)
+	}
+	return got
+}
+
+// fill appends 1..6 alternating between keys a and b.
+func fill(t *testing.T, l Log) {
+	t.Helper()
+	for n := 1; n <= 6; n++ {
+		key := "a"
+		if n%2 == 0 {
+			key = "b"
+		}
+		if err := l.Append(key, entry{N: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkKeys(t *testing.T, l Log) {
+	t.Helper()
+	if got := scanAll(t, l, "a"); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("a = %v, want [1 3 5]", got)
+	}
+	if got := scanAll(t, l, "b"); !reflect.DeepEqual(got, []int{2, 4, 6}) {
+		t.Errorf("b = %v, want [2 4 6]", got)
+	}
+	if got := scanAll(t, l, "c"); got != nil {
+		t.Errorf("c = %v, want nothing", got)
+	}
+}
+
+func TestMemoryLog(t *testing.T) {
+	l := NewMemoryLog()
+	fill(t, l)
+	checkKeys(t, l)
+}
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "log.jsonl")
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, l)
+	checkKeys(t, l)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening rebuilds the index, and new records follow the old ones.
+	l, err = OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	checkKeys(t, l)
+	if err := l.Append("a", entry{N: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, l, "a"); !reflect.DeepEqual(got, []int{1, 3, 5, 7}) {
+		t.Errorf("a = %v, want [1 3 5 7]", got)
+	}
+}
+
+func TestFileLogDropsATornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, l)
+	l.Close()
+
+	// A crash in the middle of a write leaves half a line behind.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"key":"a","record":{"n":`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	l, err = OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Append("b", entry{N: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, l, "a"); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("a = %v, want [1 3 5]", got)
+	}
+	if got := scanAll(t, l, "b"); !reflect.DeepEqual(got, []int{2, 4, 6, 8}) {
+		t.Errorf("b = %v, want [2 4 6 8]", got)
+	}
+}
+
+func TestFileLogSkipsACorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	data := `{"key":"a","record":{"n":1}}` + "\nnot json\n" + `{"key":"a","record":{"n":3}}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := scanAll(t, l, "a"); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("a = %v, want [1 3]", got)
+	}
+}
+
+// shortFile is a log file whose next write stops halfway, as when the disk
+// fills up.
+type shortFile struct {
+	*os.File
+	fail bool
+}
+
+func (f *shortFile) Write(p []byte) (int, error) {
+	if !f.fail {
+		return f.File.Write(p)
+	}
+	f.fail = false
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestFileLogCutsAFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, l)
+	l.file = &shortFile{File: l.file.(*os.File), fail: true}
+	if err := l.Append("a", entry{N: 7}); err == nil {
+		t.Fatal("a failed write was reported as appended")
+	}
+	if err := l.Append("b", entry{N: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, l, "b"); !reflect.DeepEqual(got, []int{2, 4, 6, 8}) {
+		t.Errorf("b = %v, want [2 4 6 8]", got)
+	}
+	l.Close()
+
+	// Nothing of the failed line is left in the file.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 7 || !json.Valid(bytes.Split(data, []byte("\n"))[6]) {
+		t.Errorf("log after a failed write:\n%s", data)
+	}
+	l, err = OpenFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := scanAll(t, l, "a"); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("a = %v, want [1 3 5]", got)
+	}
+	if got := scanAll(t, l, "b"); !reflect.DeepEqual(got, []int{2, 4, 6, 8}) {
+		t.Errorf("b = %v, want [2 4 6 8]", got)
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by Load when no document exists under the given key.
+var ErrNotFound = errors.New("документ не найден")
+
+// Store persists JSON documents grouped into collections.
+type Store interface {
+	Load(collection, key string, v interface{}) error
+	Save(collection, key string, v interface{}) error
+	Delete(collection, key string) error
+	List(collection string) ([]string, error)
+}
+
+// FileStore keeps every document as a JSON file under dir/collection/key.json.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a file-backed store rooted at dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(collection, key string) string {
+	return filepath.Join(s.dir, collection, key+".json")
+}
+
+// Load decodes the document stored under collection/key into v.
+func (s *FileStore) Load(collection, key string, v interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.path(collection, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Save encodes v and atomically replaces the document under collection/key.
+func (s *FileStore) Save(collection, key string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(s.dir, collection), 0o755); err != nil {
+		return err
+	}
+	target := s.path(collection, key)
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// Delete removes the document under collection/key. Missing documents are ignored.
+func (s *FileStore) Delete(collection, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(collection, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the sorted keys of all documents in a collection.
+func (s *FileStore) List(collection string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, collection))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// MemoryStore is an in-process Store, used when nothing should touch the disk.
+type MemoryStore struct {
+	docs map[string]map[string][]byte
+	mu   sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{docs: make(map[string]map[string][]byte)}
+}
+
+// Load decodes the document stored under collection/key into v.
+func (s *MemoryStore) Load(collection, key string, v interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.docs[collection][key]
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Save encodes v and stores it under collection/key.
+func (s *MemoryStore) Save(collection, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.docs[collection] == nil {
+		s.docs[collection] = make(map[string][]byte)
+	}
+	s.docs[collection][key] = data
+	return nil
+}
+
+// Delete removes the document under collection/key.
+func (s *MemoryStore) Delete(collection, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.docs[collection], key)
+	return nil
+}
+
+// List returns the sorted keys of all documents in a collection.
+func (s *MemoryStore) List(collection string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.docs[collection]))
+	for key := range s.docs[collection] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,87 @@
+package strategy
+
+import (
+	"math/rand"
+	"prisoners-dilemma-bot/models"
+)
+
+// TitForTat cooperates first, then copies the opponent's previous move.
+type TitForTat struct{}
+
+func (TitForTat) Name() string { return "Tit-for-Tat" }
+
+func (TitForTat) Next(history []Round) models.PlayerChoice {
+	if len(history) == 0 {
+		return models.ChoiceNegotiate
+	}
+	return history[len(history)-1].Opponent
+}
+
+// TitForTwoTats defects only after two consecutive defections.
+type TitForTwoTats struct{}
+
+func (TitForTwoTats) Name() string { return "Tit-for-Two-Tats" }
+
+func (TitForTwoTats) Next(history []Round) models.PlayerChoice {
+	n := len(history)
+	if n >= 2 && history[n-1].Opponent == models.ChoiceDefect && history[n-2].Opponent == models.ChoiceDefect {
+		return models.ChoiceDefect
+	}
+	return models.ChoiceNegotiate
+}
+
+// Grudger cooperates until the opponent defects once, then defects forever.
+type Grudger struct{}
+
+func (Grudger) Name() string { return "Grudger" }
+
+func (Grudger) Next(history []Round) models.PlayerChoice {
+	for _, r := range history {
+		if r.Opponent == models.ChoiceDefect {
+			return models.ChoiceDefect
+		}
+	}
+	return models.ChoiceNegotiate
+}
+
+// Pavlov (win-stay, lose-shift) repeats its move after matching moves and switches otherwise.
+type Pavlov struct{}
+
+func (Pavlov) Name() string { return "Pavlov" }
+
+func (Pavlov) Next(history []Round) models.PlayerChoice {
+	if len(history) == 0 {
+		return models.ChoiceNegotiate
+	}
+	last := history[len(history)-1]
+	if last.Own == last.Opponent {
+		return models.ChoiceNegotiate
+	}
+	return models.ChoiceDefect
+}
+
+// AlwaysDefect never cooperates.
+type AlwaysDefect struct{}
+
+func (AlwaysDefect) Name() string { return "Always Defect" }
+
+func (AlwaysDefect) Next([]Round) models.PlayerChoice { return models.ChoiceDefect }
+
+// AlwaysCooperate never defects.
+type AlwaysCooperate struct{}
+
+func (AlwaysCooperate) Name() string { return "Always Cooperate" }
+
+func (AlwaysCooperate) Next([]Round) models.PlayerChoice { return models.ChoiceNegotiate }
+
+// Random flips a fair coin every round.
+type Random struct{}
+
+func (Random) Name() string { return "Random" }
+
+func (Random) Next([]Round) models.PlayerChoice {
+	if rand.Intn(2) == 0 {
+		return models.ChoiceNegotiate
+	}
+	return models.ChoiceDefect
+}
@@ -0,0 +1,116 @@
+package strategy
+
+import "sort"
+
+// Fit says how many of a player's moves agree with a known strategy.
+type Fit struct {
+	Name    string `json:"name"`
+	Matched int    `json:"matched"`
+	Total   int    `json:"total"`
+}
+
+// Percent returns the share of matching moves as a whole percentage.
+func (f Fit) Percent() int {
+	if f.Total == 0 {
+		return 0
+	}
+	return f.Matched * 100 / f.Total
+}
+
+// Style accumulates fits per strategy name, e.g. over a player's lifetime.
+type Style map[string]Fit
+
+// Add merges the fits of one more game into the style.
+func (s Style) Add(fits []Fit) {
+	for _, f := range fits {
+		acc := s[f.Name]
+		acc.Name = f.Name
+		acc.Matched += f.Matched
+		acc.Total += f.Total
+		s[f.Name] = acc
+	}
+}
+
+// Ranked returns the accumulated fits, best match first.
+func (s Style) Ranked() []Fit {
+	fits := make([]Fit, 0, len(s))
+	for _, f := range s {
+		fits = append(fits, f)
+	}
+	rank(fits)
+	return fits
+}
+
+// library is the set of deterministic strategies a player is compared against.
+// Random is scored separately because it cannot be replayed move by move.
+var library = []Strategy{
+	TitForTat{},
+	TitForTwoTats{},
+	Grudger{},
+	Pavlov{},
+	AlwaysDefect{},
+	AlwaysCooperate{},
+}
+
+// Classify compares the player's own moves in history with what every known
+// strategy would have played in the same position, best match first.
+func Classify(history []Round) []Fit {
+	fits := make([]Fit, 0, len(library)+1)
+	for _, s := range library {
+		fit := Fit{Name: s.Name(), Total: len(history)}
+		for i, r := range history {
+			if s.Next(history[:i]) == r.Own {
+				fit.Matched++
+			}
+		}
+		fits = append(fits, fit)
+	}
+	fits = append(fits, randomFit(history))
+	rank(fits)
+	return fits
+}
+
+// randomFit measures how unpredictable the player is. Moves are grouped by the
+// previous joint outcome (or "first move"); within each group only a balanced
+// mix of C and D counts as random, so a group of all-C or all-D scores zero.
+func randomFit(history []Round) Fit {
+	var counts [5][2]int
+	for i, r := range history {
+		context := 4
+		if i > 0 {
+			prev := history[i-1]
+			context = actionOf(prev.Own)*2 + actionOf(prev.Opponent)
+		}
+		counts[context][actionOf(r.Own)]++
+	}
+
+	fit := Fit{Name: Random{}.Name(), Total: len(history)}
+	for _, c := range counts {
+		fit.Matched += 2 * min(c[actCooperate], c[actDefect])
+	}
+	return fit
+}
+
+func rank(fits []Fit) {
+	sort.SliceStable(fits, func(i, j int) bool {
+		if fits[i].Percent() != fits[j].Percent() {
+			return fits[i].Percent() > fits[j].Percent()
+		}
+		return fits[i].Name < fits[j].Name
+	})
+}
+
+var descriptions = map[string]string{
+	TitForTat{}.Name():       "начинает с сотрудничества и затем повторяет предыдущий ход соперника",
+	TitForTwoTats{}.Name():   "прощает одиночное предательство и мстит только после двух подряд",
+	Grudger{}.Name():         "сотрудничает, пока его не предадут, а затем не прощает никогда",
+	Pavlov{}.Name():          "повторяет ход после удачного раунда и меняет его после неудачного",
+	AlwaysDefect{}.Name():    "предаёт в каждом раунде",
+	AlwaysCooperate{}.Name(): "сотрудничает в каждом раунде",
+	Random{}.Name():          "ходит непредсказуемо, без видимой связи с действиями соперника",
+}
+
+// Describe explains a classic strategy in one sentence for players.
+func Describe(name string) string {
+	return descriptions[name]
+}
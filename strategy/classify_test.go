@@ -0,0 +1,119 @@
+package strategy
+
+import (
+	"prisoners-dilemma-bot/models"
+	"testing"
+)
+
+// play builds the history of a player making the own moves against the opponent moves.
+func play(own, opponent []models.PlayerChoice) []Round {
+	moves := make([][2]models.PlayerChoice, len(own))
+	for i := range own {
+		moves[i] = [2]models.PlayerChoice{own[i], opponent[i]}
+	}
+	return rounds(moves...)
+}
+
+func fitOf(fits []Fit, name string) Fit {
+	for _, f := range fits {
+		if f.Name == name {
+			return f
+		}
+	}
+	return Fit{}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []Round
+		best     string
+		percents map[string]int
+	}{
+		{
+			name:    "tit for tat",
+			history: play([]models.PlayerChoice{c, c, d, d, c}, []models.PlayerChoice{c, d, d, c, c}),
+			best:    TitForTat{}.Name(),
+			percents: map[string]int{
+				TitForTat{}.Name():    100,
+				AlwaysDefect{}.Name(): 40,
+			},
+		},
+		{
+			name:    "always defect",
+			history: play([]models.PlayerChoice{d, d, d, d}, []models.PlayerChoice{c, c, c, c}),
+			best:    AlwaysDefect{}.Name(),
+			percents: map[string]int{
+				AlwaysDefect{}.Name():    100,
+				AlwaysCooperate{}.Name(): 0,
+				// Defecting against a cooperator wins, so Pavlov sticks to it.
+				Pavlov{}.Name(): 75,
+				Random{}.Name(): 0,
+			},
+		},
+		{
+			name:    "grudger",
+			history: play([]models.PlayerChoice{c, c, d, d, d}, []models.PlayerChoice{c, d, c, c, c}),
+			best:    Grudger{}.Name(),
+			percents: map[string]int{
+				Grudger{}.Name():   100,
+				TitForTat{}.Name(): 60,
+			},
+		},
+		{
+			name: "mixed moves after the same outcome",
+			// After CD the player once cooperated and once defected.
+			history: play([]models.PlayerChoice{c, c, d, c}, []models.PlayerChoice{d, d, d, d}),
+			percents: map[string]int{
+				Random{}.Name(): 50,
+			},
+		},
+		{
+			name:    "no moves",
+			history: nil,
+			percents: map[string]int{
+				TitForTat{}.Name(): 0,
+				Random{}.Name():    0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fits := Classify(tt.history)
+			if len(fits) != len(library)+1 {
+				t.Fatalf("got %d fits, want %d", len(fits), len(library)+1)
+			}
+			if tt.best != "" && fits[0].Name != tt.best {
+				t.Errorf("best fit = %s (%d%%), want %s", fits[0].Name, fits[0].Percent(), tt.best)
+			}
+			for name, want := range tt.percents {
+				if got := fitOf(fits, name).Percent(); got != want {
+					t.Errorf("%s fit = %d%%, want %d%%", name, got, want)
+				}
+			}
+			for i := 1; i < len(fits); i++ {
+				if fits[i].Percent() > fits[i-1].Percent() {
+					t.Errorf("fits not ranked: %s %d%% after %s %d%%", fits[i].Name, fits[i].Percent(), fits[i-1].Name, fits[i-1].Percent())
+				}
+			}
+		})
+	}
+}
+
+func TestStyleAccumulates(t *testing.T) {
+	style := make(Style)
+	style.Add([]Fit{{Name: "A", Matched: 1, Total: 4}, {Name: "B", Matched: 3, Total: 4}})
+	style.Add([]Fit{{Name: "A", Matched: 4, Total: 4}, {Name: "B", Matched: 0, Total: 4}})
+
+	ranked := style.Ranked()
+	if len(ranked) != 2 {
+		t.Fatalf("got %d fits, want 2", len(ranked))
+	}
+	// A: 5 of 8, B: 3 of 8.
+	if ranked[0].Name != "A" || ranked[0].Matched != 5 || ranked[0].Total != 8 || ranked[0].Percent() != 62 {
+		t.Errorf("best fit = %+v, want A with 5 of 8", ranked[0])
+	}
+	if ranked[1].Name != "B" || ranked[1].Percent() != 37 {
+		t.Errorf("second fit = %+v, want B with 3 of 8", ranked[1])
+	}
+}
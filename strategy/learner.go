@@ -0,0 +1,226 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"prisoners-dilemma-bot/models"
+	"strings"
+)
+
+// LearnerConfig holds the tunable parameters of the Q-learning opponent.
+type LearnerConfig struct {
+	Alpha        float64 // learning rate
+	Gamma        float64 // discount factor for future rewards
+	Epsilon      float64 // initial exploration rate for a new player
+	EpsilonDecay float64 // multiplier applied to epsilon after every game
+	MinEpsilon   float64 // exploration never decays below this value
+	Memory       int     // number of last joint moves forming the state
+	NGram        int     // length of the human move n-gram; 0 disables the predictor
+}
+
+// DefaultLearnerConfig returns the settings used when nothing is configured.
+func DefaultLearnerConfig() LearnerConfig {
+	return LearnerConfig{
+		Alpha:        0.3,
+		Gamma:        0.9,
+		Epsilon:      0.2,
+		EpsilonDecay: 0.95,
+		MinEpsilon:   0.02,
+		Memory:       2,
+		NGram:        3,
+	}
+}
+
+// Validate reports the first setting that is out of range.
+func (c LearnerConfig) Validate() error {
+	switch {
+	case c.Alpha < 0 || c.Alpha > 1:
+		return fmt.Errorf("alpha must be in [0, 1], got %g", c.Alpha)
+	case c.Gamma < 0 || c.Gamma > 1:
+		return fmt.Errorf("gamma must be in [0, 1], got %g", c.Gamma)
+	case c.Epsilon < 0 || c.Epsilon > 1:
+		return fmt.Errorf("epsilon must be in [0, 1], got %g", c.Epsilon)
+	case c.EpsilonDecay < 0 || c.EpsilonDecay > 1:
+		return fmt.Errorf("epsilon decay must be in [0, 1], got %g", c.EpsilonDecay)
+	case c.MinEpsilon < 0 || c.MinEpsilon > 1:
+		return fmt.Errorf("min epsilon must be in [0, 1], got %g", c.MinEpsilon)
+	case c.Memory < 0:
+		return fmt.Errorf("memory must not be negative, got %d", c.Memory)
+	case c.NGram < 0:
+		return fmt.Errorf("n-gram length must not be negative, got %d", c.NGram)
+	}
+	return nil
+}
+
+// Policy is the learned state of a Learner, kept per human player across games.
+type Policy struct {
+	Q       map[string][2]float64 `json:"q"`
+	NGram   map[string][2]int     `json:"ngram,omitempty"`
+	Epsilon float64               `json:"epsilon"`
+	Games   int                   `json:"games"`
+}
+
+// NewPolicy creates an empty policy that starts exploring at cfg.Epsilon.
+func NewPolicy(cfg LearnerConfig) *Policy {
+	return &Policy{
+		Q:       make(map[string][2]float64),
+		NGram:   make(map[string][2]int),
+		Epsilon: cfg.Epsilon,
+	}
+}
+
+// action indexes into the Q and n-gram tables.
+const (
+	actCooperate = 0
+	actDefect    = 1
+)
+
+func actionOf(c models.PlayerChoice) int {
+	if c == models.ChoiceDefect {
+		return actDefect
+	}
+	return actCooperate
+}
+
+func choiceOf(action int) models.PlayerChoice {
+	if action == actDefect {
+		return models.ChoiceDefect
+	}
+	return models.ChoiceNegotiate
+}
+
+// QLearner is a tabular Q-learning opponent whose state is the last few joint
+// moves, optionally extended with an n-gram prediction of the opponent's move.
+type QLearner struct {
+	cfg    LearnerConfig
+	policy *Policy
+
+	lastState  string
+	lastAction int
+	pending    bool
+}
+
+// NewQLearner creates a learner that continues from policy, or from scratch when policy is nil.
+func NewQLearner(cfg LearnerConfig, policy *Policy) *QLearner {
+	if policy == nil {
+		policy = NewPolicy(cfg)
+	}
+	if policy.Q == nil {
+		policy.Q = make(map[string][2]float64)
+	}
+	if policy.NGram == nil {
+		policy.NGram = make(map[string][2]int)
+	}
+	return &QLearner{cfg: cfg, policy: policy}
+}
+
+func (l *QLearner) Name() string { return "Q-learning" }
+
+// Policy exposes the learned tables for persistence and inspection.
+func (l *QLearner) Policy() *Policy { return l.policy }
+
+// Next picks a move epsilon-greedily from the Q table.
+func (l *QLearner) Next(history []Round) models.PlayerChoice {
+	state := l.state(history)
+
+	action := bestAction(l.policy.Q[state])
+	if rand.Float64() < l.policy.Epsilon {
+		action = rand.Intn(2)
+	}
+
+	l.lastState = state
+	l.lastAction = action
+	l.pending = true
+	return choiceOf(action)
+}
+
+// Observe applies the Q update for the move chosen by the last call to Next
+// and feeds the opponent's latest move to the n-gram model.
+func (l *QLearner) Observe(history []Round) {
+	if len(history) == 0 {
+		return
+	}
+	last := history[len(history)-1]
+
+	if l.cfg.NGram > 0 {
+		context := opponentContext(history[:len(history)-1], l.cfg.NGram)
+		counts := l.policy.NGram[context]
+		counts[actionOf(last.Opponent)]++
+		l.policy.NGram[context] = counts
+	}
+
+	if !l.pending {
+		return
+	}
+	l.pending = false
+
+	next := l.policy.Q[l.state(history)]
+	target := float64(last.OwnScore) + l.cfg.Gamma*math.Max(next[0], next[1])
+
+	values := l.policy.Q[l.lastState]
+	values[l.lastAction] += l.cfg.Alpha * (target - values[l.lastAction])
+	l.policy.Q[l.lastState] = values
+}
+
+// EndGame decays exploration once a game is over.
+func (l *QLearner) EndGame() {
+	l.pending = false
+	l.policy.Games++
+	l.policy.Epsilon = math.Max(l.cfg.MinEpsilon, l.policy.Epsilon*l.cfg.EpsilonDecay)
+}
+
+// Predict returns the opponent move the n-gram model considers most likely
+// next, or ChoiceNone when the predictor is disabled or has no data.
+func (l *QLearner) Predict(history []Round) models.PlayerChoice {
+	if l.cfg.NGram <= 0 {
+		return models.ChoiceNone
+	}
+	counts, ok := l.policy.NGram[opponentContext(history, l.cfg.NGram)]
+	if !ok || counts[0] == counts[1] {
+		return models.ChoiceNone
+	}
+	if counts[actDefect] > counts[actCooperate] {
+		return models.ChoiceDefect
+	}
+	return models.ChoiceNegotiate
+}
+
+// state encodes the last Memory joint moves as "own+opponent" pairs, oldest first,
+// followed by the n-gram prediction when the predictor is enabled.
+func (l *QLearner) state(history []Round) string {
+	parts := make([]string, 0, l.cfg.Memory+1)
+	for i := len(history) - l.cfg.Memory; i < len(history); i++ {
+		if i < 0 {
+			parts = append(parts, "--")
+			continue
+		}
+		parts = append(parts, symbol(history[i].Own)+symbol(history[i].Opponent))
+	}
+	if l.cfg.NGram > 0 {
+		parts = append(parts, "p"+symbol(l.Predict(history)))
+	}
+	return strings.Join(parts, ",")
+}
+
+func opponentContext(history []Round, n int) string {
+	var sb strings.Builder
+	for i := len(history) - n; i < len(history); i++ {
+		if i < 0 {
+			sb.WriteString("-")
+			continue
+		}
+		sb.WriteString(symbol(history[i].Opponent))
+	}
+	return sb.String()
+}
+
+func bestAction(values [2]float64) int {
+	if values[actDefect] > values[actCooperate] {
+		return actDefect
+	}
+	if values[actDefect] == values[actCooperate] {
+		return rand.Intn(2)
+	}
+	return actCooperate
+}
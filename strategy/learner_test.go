@@ -0,0 +1,132 @@
+package strategy
+
+import (
+	"math"
+	"prisoners-dilemma-bot/models"
+	"testing"
+)
+
+const (
+	c = models.ChoiceNegotiate
+	d = models.ChoiceDefect
+)
+
+func rounds(moves ...[2]models.PlayerChoice) []Round {
+	history := make([]Round, len(moves))
+	for i, m := range moves {
+		own, opp := models.ClassicPayoff.Scores(m[0], m[1])
+		history[i] = Round{Own: m[0], Opponent: m[1], OwnScore: own, OpponentScore: opp}
+	}
+	return history
+}
+
+func TestLearnerState(t *testing.T) {
+	tests := []struct {
+		name    string
+		memory  int
+		ngram   int
+		history []Round
+		want    string
+	}{
+		{"empty history is padded", 2, 0, nil, "--,--"},
+		{"short history is padded", 2, 0, rounds([2]models.PlayerChoice{c, d}), "--,CD"},
+		{"oldest first", 2, 0, rounds([2]models.PlayerChoice{c, c}, [2]models.PlayerChoice{d, c}), "CC,DC"},
+		{"only the last moves count", 1, 0, rounds([2]models.PlayerChoice{c, c}, [2]models.PlayerChoice{d, c}), "DC"},
+		{"no memory", 0, 0, rounds([2]models.PlayerChoice{c, c}), ""},
+		{"prediction without data", 1, 2, rounds([2]models.PlayerChoice{c, d}), "CD,p-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LearnerConfig{Memory: tt.memory, NGram: tt.ngram}
+			if got := NewQLearner(cfg, nil).state(tt.history); got != tt.want {
+				t.Errorf("state() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLearnerPrediction(t *testing.T) {
+	l := NewQLearner(LearnerConfig{NGram: 1}, nil)
+	// The opponent answers a defection by defecting, twice.
+	history := rounds([2]models.PlayerChoice{c, d}, [2]models.PlayerChoice{c, d}, [2]models.PlayerChoice{c, d})
+	for i := 1; i <= len(history); i++ {
+		l.Observe(history[:i])
+	}
+	if got := l.Predict(history); got != d {
+		t.Errorf("Predict() = %q, want %q", got, d)
+	}
+	if got := l.state(history); got != "pD" {
+		t.Errorf("state() = %q, want %q", got, "pD")
+	}
+}
+
+func TestLearnerUpdate(t *testing.T) {
+	cfg := LearnerConfig{Alpha: 0.5, Gamma: 0.9, Memory: 1}
+	policy := NewPolicy(cfg)
+	// The learner prefers defecting at the start and knows the value of
+	// the state defecting against a cooperator leads to.
+	policy.Q["--"] = [2]float64{0, 1}
+	policy.Q["DC"] = [2]float64{2, 4}
+	l := NewQLearner(cfg, policy)
+
+	if move := l.Next(nil); move != d {
+		t.Fatalf("Next() = %q, want the greedy %q", move, d)
+	}
+	l.Observe(rounds([2]models.PlayerChoice{d, c}))
+
+	// Q(s, a) += alpha * (reward + gamma * max Q(s', .) - Q(s, a))
+	want := 1 + 0.5*(5+0.9*4-1)
+	if got := policy.Q["--"][actDefect]; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Q[--][defect] = %g, want %g", got, want)
+	}
+	if got := policy.Q["--"][actCooperate]; got != 0 {
+		t.Errorf("Q[--][cooperate] = %g, want it untouched", got)
+	}
+
+	// Observing again without a new move changes nothing.
+	l.Observe(rounds([2]models.PlayerChoice{d, c}))
+	if got := policy.Q["--"][actDefect]; math.Abs(got-want) > 1e-9 {
+		t.Errorf("second Observe changed Q[--][defect] to %g", got)
+	}
+}
+
+func TestLearnerEpsilonDecay(t *testing.T) {
+	cfg := LearnerConfig{Epsilon: 0.2, EpsilonDecay: 0.5, MinEpsilon: 0.06}
+	l := NewQLearner(cfg, nil)
+	for _, want := range []float64{0.1, 0.06, 0.06} {
+		l.EndGame()
+		if got := l.Policy().Epsilon; math.Abs(got-want) > 1e-9 {
+			t.Fatalf("after game %d epsilon = %g, want %g", l.Policy().Games, got, want)
+		}
+	}
+	if l.Policy().Games != 3 {
+		t.Errorf("Games = %d, want 3", l.Policy().Games)
+	}
+}
+
+func TestLearnerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *LearnerConfig)
+		ok     bool
+	}{
+		{"defaults", func(cfg *LearnerConfig) {}, true},
+		{"no predictor", func(cfg *LearnerConfig) { cfg.NGram = 0 }, true},
+		{"negative alpha", func(cfg *LearnerConfig) { cfg.Alpha = -0.1 }, false},
+		{"gamma above one", func(cfg *LearnerConfig) { cfg.Gamma = 1.5 }, false},
+		{"epsilon above one", func(cfg *LearnerConfig) { cfg.Epsilon = 2 }, false},
+		{"negative decay", func(cfg *LearnerConfig) { cfg.EpsilonDecay = -1 }, false},
+		{"negative min epsilon", func(cfg *LearnerConfig) { cfg.MinEpsilon = -0.01 }, false},
+		{"negative memory", func(cfg *LearnerConfig) { cfg.Memory = -1 }, false},
+		{"negative n-gram", func(cfg *LearnerConfig) { cfg.NGram = -2 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultLearnerConfig()
+			tt.modify(&cfg)
+			if err := cfg.Validate(); (err == nil) != tt.ok {
+				t.Errorf("Validate() = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
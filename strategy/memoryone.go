@@ -0,0 +1,334 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"prisoners-dilemma-bot/models"
+	"sort"
+)
+
+// Outcome indexes of the memory-one state, always from the strategy's own side:
+// own move first, opponent's move second.
+const (
+	OutcomeCC = iota
+	OutcomeCD
+	OutcomeDC
+	OutcomeDD
+)
+
+// MemoryOne is a stochastic strategy that cooperates with probability P[outcome]
+// depending only on the previous round, and with probability Initial in round one.
+type MemoryOne struct {
+	Label   string
+	Initial float64
+	P       [4]float64
+}
+
+func (s MemoryOne) Name() string { return s.Label }
+
+func (s MemoryOne) Next(history []Round) models.PlayerChoice {
+	p := s.Initial
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		p = s.P[outcomeOf(last.Own, last.Opponent)]
+	}
+	if rand.Float64() < p {
+		return models.ChoiceNegotiate
+	}
+	return models.ChoiceDefect
+}
+
+func outcomeOf(own, opponent models.PlayerChoice) int {
+	return actionOf(own)*2 + actionOf(opponent)
+}
+
+// mirror maps an outcome to the same outcome seen by the other player.
+var mirror = [4]int{OutcomeCC, OutcomeDC, OutcomeCD, OutcomeDD}
+
+// MemoryOneLibrary returns the classic strategies that can be written as memory-one vectors.
+// Grudger appears as Grim Trigger, which behaves identically.
+func MemoryOneLibrary() []MemoryOne {
+	return []MemoryOne{
+		{Label: TitForTat{}.Name(), Initial: 1, P: [4]float64{1, 0, 1, 0}},
+		{Label: Grudger{}.Name(), Initial: 1, P: [4]float64{1, 0, 0, 0}},
+		{Label: Pavlov{}.Name(), Initial: 1, P: [4]float64{1, 0, 0, 1}},
+		{Label: AlwaysDefect{}.Name(), Initial: 0, P: [4]float64{0, 0, 0, 0}},
+		{Label: AlwaysCooperate{}.Name(), Initial: 1, P: [4]float64{1, 1, 1, 1}},
+		{Label: Random{}.Name(), Initial: 0.5, P: [4]float64{0.5, 0.5, 0.5, 0.5}},
+	}
+}
+
+// Stationary returns the long-run share of rounds spent in each outcome, seen
+// from x's side, when x plays y. Chains with a unique stationary distribution are
+// solved exactly; otherwise the limit depends on the first round, and the
+// time average of the chain started from the initial moves is used instead.
+func Stationary(x, y MemoryOne) [4]float64 {
+	m := transitionMatrix(x, y)
+	if v, err := solveStationary(m); err == nil {
+		// Rounding can leave tiny negative probabilities behind.
+		for i := range v {
+			v[i] = math.Max(0, v[i])
+		}
+		return v
+	}
+	return cesaroAverage(m, initialDistribution(x, y))
+}
+
+// ExpectedPayoffs returns the long-run average score per round of x and y.
+func ExpectedPayoffs(x, y MemoryOne, payoff models.Payoff) (float64, float64) {
+	v := Stationary(x, y)
+	sx := ownPayoffs(payoff)
+	sy := opponentPayoffs(payoff)
+
+	var px, py float64
+	for i := range v {
+		px += v[i] * sx[i]
+		py += v[i] * sy[i]
+	}
+	return px, py
+}
+
+func ownPayoffs(p models.Payoff) [4]float64 {
+	return [4]float64{float64(p.Reward), float64(p.Sucker), float64(p.Temptation), float64(p.Punishment)}
+}
+
+func opponentPayoffs(p models.Payoff) [4]float64 {
+	return [4]float64{float64(p.Reward), float64(p.Temptation), float64(p.Sucker), float64(p.Punishment)}
+}
+
+func transitionMatrix(x, y MemoryOne) [4][4]float64 {
+	var m [4][4]float64
+	for state := 0; state < 4; state++ {
+		px := x.P[state]
+		py := y.P[mirror[state]]
+		m[state][OutcomeCC] = px * py
+		m[state][OutcomeCD] = px * (1 - py)
+		m[state][OutcomeDC] = (1 - px) * py
+		m[state][OutcomeDD] = (1 - px) * (1 - py)
+	}
+	return m
+}
+
+func initialDistribution(x, y MemoryOne) [4]float64 {
+	return [4]float64{
+		x.Initial * y.Initial,
+		x.Initial * (1 - y.Initial),
+		(1 - x.Initial) * y.Initial,
+		(1 - x.Initial) * (1 - y.Initial),
+	}
+}
+
+var errSingular = errors.New("stationary distribution is not unique")
+
+// solveStationary solves v(M - I) = 0 with sum(v) = 1 by Gaussian elimination.
+func solveStationary(m [4][4]float64) ([4]float64, error) {
+	// Rows of a are the equations: column j of (M - I)^T, last one replaced by normalization.
+	var a [4][5]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 4; j++ {
+			a[i][j] = m[j][i]
+		}
+		a[i][i]--
+	}
+	for j := 0; j < 4; j++ {
+		a[3][j] = 1
+	}
+	a[3][4] = 1
+
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return [4]float64{}, errSingular
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			factor := a[row][col] / a[col][col]
+			for k := col; k < 5; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+
+	var v [4]float64
+	for i := 0; i < 4; i++ {
+		v[i] = a[i][4] / a[i][i]
+	}
+	return v, nil
+}
+
+// cesaroSteps bounds the averaging used for chains without a unique stationary distribution.
+const cesaroSteps = 20000
+
+func cesaroAverage(m [4][4]float64, start [4]float64) [4]float64 {
+	var sum [4]float64
+	v := start
+	for step := 0; step < cesaroSteps; step++ {
+		var next [4]float64
+		for i := 0; i < 4; i++ {
+			sum[i] += v[i]
+			for j := 0; j < 4; j++ {
+				next[j] += v[i] * m[i][j]
+			}
+		}
+		v = next
+	}
+	for i := range sum {
+		sum[i] /= cesaroSteps
+	}
+	return sum
+}
+
+// ZeroDeterminant builds the Press–Dyson strategy that enforces
+// (S_X - baseline) = chi * (S_Y - baseline) against any opponent.
+// Use baseline = Punishment with chi > 1 for an extortionate strategy and
+// baseline = Reward with chi > 1 for a generous one. phiShare in (0, 1] picks
+// the scale factor as a share of the largest one that keeps all probabilities valid.
+func ZeroDeterminant(label string, payoff models.Payoff, chi, baseline, phiShare float64) (MemoryOne, error) {
+	if chi < 1 {
+		return MemoryOne{}, fmt.Errorf("chi must be at least 1, got %g", chi)
+	}
+	if phiShare <= 0 || phiShare > 1 {
+		return MemoryOne{}, fmt.Errorf("phi share must be in (0, 1], got %g", phiShare)
+	}
+
+	sx := ownPayoffs(payoff)
+	sy := opponentPayoffs(payoff)
+	base := [4]float64{1, 1, 0, 0}
+
+	var coef [4]float64
+	phiMax := math.Inf(1)
+	for i := 0; i < 4; i++ {
+		coef[i] = (sx[i] - baseline) - chi*(sy[i]-baseline)
+		switch {
+		case coef[i] > 0:
+			phiMax = math.Min(phiMax, (1-base[i])/coef[i])
+		case coef[i] < 0:
+			phiMax = math.Min(phiMax, -base[i]/coef[i])
+		}
+	}
+	if math.IsInf(phiMax, 1) || phiMax <= 0 {
+		return MemoryOne{}, fmt.Errorf("no zero-determinant strategy exists for chi=%g and baseline=%g", chi, baseline)
+	}
+
+	phi := phiMax * phiShare
+	s := MemoryOne{Label: label}
+	for i := 0; i < 4; i++ {
+		s.P[i] = clamp(base[i] + phi*coef[i])
+	}
+	s.Initial = s.P[OutcomeCC]
+	if baseline <= float64(payoff.Punishment) {
+		s.Initial = 0
+	}
+	return s, nil
+}
+
+func clamp(p float64) float64 {
+	return math.Max(0, math.Min(1, p))
+}
+
+// Extortioner is the extortionate ZD strategy used as a bot opponent.
+func Extortioner(payoff models.Payoff) MemoryOne {
+	s, err := ZeroDeterminant("ZD Extortioner", payoff, 3, float64(payoff.Punishment), 0.5)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// GenerousZD is the generous ZD strategy used as a bot opponent.
+func GenerousZD(payoff models.Payoff) MemoryOne {
+	s, err := ZeroDeterminant("ZD Generous", payoff, 2, float64(payoff.Reward), 0.5)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Transitions counts a player's moves by the outcome of the previous round,
+// which is enough to estimate their memory-one vector.
+type Transitions struct {
+	First [2]int    `json:"first"`
+	After [4][2]int `json:"after"`
+}
+
+// Add counts every move the player made in history.
+func (t *Transitions) Add(history []Round) {
+	for i, r := range history {
+		if i == 0 {
+			t.First[actionOf(r.Own)]++
+			continue
+		}
+		prev := history[i-1]
+		t.After[outcomeOf(prev.Own, prev.Opponent)][actionOf(r.Own)]++
+	}
+}
+
+// Samples returns how many moves were seen after each outcome.
+func (t Transitions) Samples() [4]int {
+	var n [4]int
+	for i, c := range t.After {
+		n[i] = c[actCooperate] + c[actDefect]
+	}
+	return n
+}
+
+// Estimate returns the observed cooperation frequencies. Outcomes that never
+// occurred are NaN, since nothing is known about them.
+func (t Transitions) Estimate(label string) MemoryOne {
+	s := MemoryOne{Label: label, Initial: ratio(t.First)}
+	for i, c := range t.After {
+		s.P[i] = ratio(c)
+	}
+	return s
+}
+
+func ratio(c [2]int) float64 {
+	total := c[actCooperate] + c[actDefect]
+	if total == 0 {
+		return math.NaN()
+	}
+	return float64(c[actCooperate]) / float64(total)
+}
+
+// Closest ranks library strategies by distance to s over the outcomes s knows about.
+func Closest(s MemoryOne, library []MemoryOne) []MemoryOne {
+	ranked := append([]MemoryOne(nil), library...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return distance(s, ranked[i]) < distance(s, ranked[j])
+	})
+	return ranked
+}
+
+func distance(a, b MemoryOne) float64 {
+	var d float64
+	for i := 0; i < 4; i++ {
+		if math.IsNaN(a.P[i]) || math.IsNaN(b.P[i]) {
+			continue
+		}
+		d += (a.P[i] - b.P[i]) * (a.P[i] - b.P[i])
+	}
+	return math.Sqrt(d)
+}
+
+// Filled replaces unknown probabilities with fallback so the strategy can be simulated.
+func (s MemoryOne) Filled(fallback float64) MemoryOne {
+	if math.IsNaN(s.Initial) {
+		s.Initial = fallback
+	}
+	for i := range s.P {
+		if math.IsNaN(s.P[i]) {
+			s.P[i] = fallback
+		}
+	}
+	return s
+}
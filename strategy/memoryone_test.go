@@ -0,0 +1,184 @@
+package strategy
+
+import (
+	"errors"
+	"math"
+	"prisoners-dilemma-bot/models"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+var (
+	tft  = MemoryOne{Label: "TFT", Initial: 1, P: [4]float64{1, 0, 1, 0}}
+	wsls = MemoryOne{Label: "WSLS", Initial: 1, P: [4]float64{1, 0, 0, 1}}
+	allC = MemoryOne{Label: "ALLC", Initial: 1, P: [4]float64{1, 1, 1, 1}}
+	allD = MemoryOne{Label: "ALLD", Initial: 0, P: [4]float64{0, 0, 0, 0}}
+)
+
+func approxEqual(a, b [4]float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSolveStationary(t *testing.T) {
+	tests := []struct {
+		name string
+		m    [4][4]float64
+		want [4]float64
+		err  error
+	}{
+		{"WSLS vs WSLS settles on mutual cooperation", transitionMatrix(wsls, wsls), [4]float64{1, 0, 0, 0}, nil},
+		{"WSLS vs ALLD alternates between CD and DD", transitionMatrix(wsls, allD), [4]float64{0, 0.5, 0, 0.5}, nil},
+		{"ALLD vs ALLC", transitionMatrix(allD, allC), [4]float64{0, 0, 1, 0}, nil},
+		{"uniform chain", [4][4]float64{
+			{0.25, 0.25, 0.25, 0.25},
+			{0.25, 0.25, 0.25, 0.25},
+			{0.25, 0.25, 0.25, 0.25},
+			{0.25, 0.25, 0.25, 0.25},
+		}, [4]float64{0.25, 0.25, 0.25, 0.25}, nil},
+		{"TFT vs TFT has several absorbing classes", transitionMatrix(tft, tft), [4]float64{}, errSingular},
+		{"identity is singular", [4][4]float64{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}, [4]float64{}, errSingular},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := solveStationary(tt.m)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("solveStationary() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && !approxEqual(got, tt.want) {
+				t.Errorf("solveStationary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStationaryFallsBackToTheFirstRound(t *testing.T) {
+	// TFT vs TFT has no unique distribution; who opens decides the outcome.
+	tests := []struct {
+		name string
+		x, y MemoryOne
+		want [4]float64
+	}{
+		{"both open cooperating", tft, tft, [4]float64{1, 0, 0, 0}},
+		{"both open defecting", MemoryOne{P: tft.P}, MemoryOne{P: tft.P}, [4]float64{0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Stationary(tt.x, tt.y); !approxEqual(got, tt.want) {
+				t.Errorf("Stationary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedPayoffs(t *testing.T) {
+	tests := []struct {
+		name   string
+		x, y   MemoryOne
+		px, py float64
+	}{
+		{"TFT vs TFT", tft, tft, 3, 3},
+		{"WSLS vs WSLS", wsls, wsls, 3, 3},
+		{"WSLS vs ALLD", wsls, allD, 0.5, 3},
+		{"ALLD vs ALLC", allD, allC, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			px, py := ExpectedPayoffs(tt.x, tt.y, models.ClassicPayoff)
+			if math.Abs(px-tt.px) > 1e-6 || math.Abs(py-tt.py) > 1e-6 {
+				t.Errorf("ExpectedPayoffs() = %g, %g, want %g, %g", px, py, tt.px, tt.py)
+			}
+		})
+	}
+}
+
+func TestZeroDeterminant(t *testing.T) {
+	classic := models.ClassicPayoff
+	tests := []struct {
+		name     string
+		chi      float64
+		baseline float64
+		phiShare float64
+		want     [4]float64
+		initial  float64
+		wantErr  bool
+	}{
+		// Press and Dyson's extortioner: p = (1-4φ, 1-13φ, 7φ, 0) with φ at most 1/13.
+		{"extortionate chi=3", 3, 1, 1, [4]float64{9.0 / 13, 0, 7.0 / 13, 0}, 0, false},
+		{"extortionate chi=3, half phi", 3, 1, 0.5, [4]float64{11.0 / 13, 0.5, 3.5 / 13, 0}, 0, false},
+		{"chi=1 at punishment is TFT-like", 1, 1, 1, [4]float64{1, 0, 1, 0}, 0, false},
+		{"generous chi=2", 2, 3, 1, [4]float64{1, 1.0 / 8, 1, 1.0 / 4}, 1, false},
+		{"chi below one", 0.5, 1, 1, [4]float64{}, 0, true},
+		{"phi share zero", 3, 1, 0, [4]float64{}, 0, true},
+		{"phi share above one", 3, 1, 1.5, [4]float64{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ZeroDeterminant("zd", classic, tt.chi, tt.baseline, tt.phiShare)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ZeroDeterminant() = %v, want an error", s.P)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ZeroDeterminant() error = %v", err)
+			}
+			if !approxEqual(s.P, tt.want) {
+				t.Errorf("P = %v, want %v", s.P, tt.want)
+			}
+			if s.Initial != tt.initial {
+				t.Errorf("Initial = %g, want %g", s.Initial, tt.initial)
+			}
+		})
+	}
+}
+
+func TestExtortionAgainstAlwaysCooperate(t *testing.T) {
+	zd, err := ZeroDeterminant("zd", models.ClassicPayoff, 3, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ALLC keeps the chain between CC and DC: 7/11 of rounds are CC.
+	if got, want := Stationary(zd, allC), [4]float64{7.0 / 11, 0, 4.0 / 11, 0}; !approxEqual(got, want) {
+		t.Errorf("Stationary() = %v, want %v", got, want)
+	}
+	sx, sy := ExpectedPayoffs(zd, allC, models.ClassicPayoff)
+	if math.Abs(sx-41.0/11) > tolerance || math.Abs(sy-21.0/11) > tolerance {
+		t.Errorf("payoffs = %g, %g, want %g, %g", sx, sy, 41.0/11, 21.0/11)
+	}
+	// The enforced relation: S_X - P = chi (S_Y - P).
+	if math.Abs((sx-1)-3*(sy-1)) > tolerance {
+		t.Errorf("S_X - P = %g, 3 (S_Y - P) = %g", sx-1, 3*(sy-1))
+	}
+}
+
+func TestTransitionsEstimate(t *testing.T) {
+	var tr Transitions
+	tr.Add(rounds(
+		[2]models.PlayerChoice{c, d},
+		[2]models.PlayerChoice{d, d},
+		[2]models.PlayerChoice{d, c},
+		[2]models.PlayerChoice{c, c},
+	))
+	s := tr.Estimate("player")
+	if s.Initial != 1 {
+		t.Errorf("Initial = %g, want 1", s.Initial)
+	}
+	// After CD the player defected, after DD defected, after DC cooperated;
+	// nothing is known about CC.
+	want := [4]float64{math.NaN(), 0, 1, 0}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(s.P[i]) || !math.IsNaN(want[i]) && want[i] != s.P[i] {
+			t.Errorf("P[%d] = %g, want %g", i, s.P[i], want[i])
+		}
+	}
+	if got := Closest(s, MemoryOneLibrary())[0].Label; got != (TitForTat{}).Name() {
+		t.Errorf("closest strategy = %s, want %s", got, TitForTat{}.Name())
+	}
+}
@@ -0,0 +1,86 @@
+package strategy
+
+import (
+	"prisoners-dilemma-bot/models"
+	"sort"
+)
+
+// Round is one played round seen from a single player's side.
+type Round struct {
+	Own           models.PlayerChoice
+	Opponent      models.PlayerChoice
+	OwnScore      int
+	OpponentScore int
+}
+
+// Strategy decides the next move given everything played so far.
+type Strategy interface {
+	Name() string
+	Next(history []Round) models.PlayerChoice
+}
+
+// Learner is a strategy that updates itself after every finished round.
+type Learner interface {
+	Strategy
+	Observe(history []Round)
+	EndGame()
+	Policy() *Policy
+}
+
+// FromHistory converts session history into rounds seen by player A or player B.
+func FromHistory(history []models.RoundResult, asPlayerA bool) []Round {
+	rounds := make([]Round, len(history))
+	for i, r := range history {
+		if asPlayerA {
+			rounds[i] = Round{Own: r.PlayerAChoice, Opponent: r.PlayerBChoice, OwnScore: r.PlayerAScore, OpponentScore: r.PlayerBScore}
+		} else {
+			rounds[i] = Round{Own: r.PlayerBChoice, Opponent: r.PlayerAChoice, OwnScore: r.PlayerBScore, OpponentScore: r.PlayerAScore}
+		}
+	}
+	return rounds
+}
+
+// LearnerName is the registry name of the adaptive Q-learning opponent.
+const LearnerName = "learner"
+
+var registry = map[string]func() Strategy{
+	"tft":     func() Strategy { return TitForTat{} },
+	"tf2t":    func() Strategy { return TitForTwoTats{} },
+	"grudger": func() Strategy { return Grudger{} },
+	"pavlov":  func() Strategy { return Pavlov{} },
+	"alld":    func() Strategy { return AlwaysDefect{} },
+	"allc":    func() Strategy { return AlwaysCooperate{} },
+	"random":  func() Strategy { return Random{} },
+
+	"zd_extort":   func() Strategy { return Extortioner(models.ClassicPayoff) },
+	"zd_generous": func() Strategy { return GenerousZD(models.ClassicPayoff) },
+}
+
+// Lookup returns a fresh instance of the fixed strategy registered under name.
+func Lookup(name string) (Strategy, bool) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// Names lists the registered fixed strategies in a stable order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func symbol(c models.PlayerChoice) string {
+	switch c {
+	case models.ChoiceNegotiate:
+		return "C"
+	case models.ChoiceDefect:
+		return "D"
+	}
+	return "-"
+}
@@ -4,54 +4,562 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"prisoners-dilemma-bot/callback"
+	"prisoners-dilemma-bot/messaging"
 	"prisoners-dilemma-bot/models"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// ChoiceKeyboard creates the inline keyboard for players to make their move.
-func ChoiceKeyboard() tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🤝 договориться", string(models.ChoiceNegotiate)),
-			tgbotapi.NewInlineKeyboardButtonData("⚔️ предать", string(models.ChoiceDefect)),
+// ChoiceKeyboard creates the inline keyboard for a player's move in one round of a game.
+func ChoiceKeyboard(codec *callback.Codec, playerID int64, gameID string, round int) *messaging.Keyboard {
+	move := func(arg string) string {
+		return codec.Encode(playerID, callback.Data{Action: callback.ActionMove, GameID: gameID, Round: round, Arg: arg})
+	}
+	return messaging.Inline(
+		messaging.Row(
+			messaging.DataButton("🤝 договориться", move(callback.ArgCooperate)),
+			messaging.DataButton("⚔️ предать", move(callback.ArgDefect)),
 		),
 	)
 }
 
+// ChoiceFromArg maps the argument of a move button back to the move.
+func ChoiceFromArg(arg string) (models.PlayerChoice, bool) {
+	switch arg {
+	case callback.ArgCooperate:
+		return models.ChoiceNegotiate, true
+	case callback.ArgDefect:
+		return models.ChoiceDefect, true
+	}
+	return models.ChoiceNone, false
+}
+
 // MainMenuKeyboard creates the persistent keyboard for the main menu.
-func MainMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
-	return tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("🚀 Создать новую игру"),
+func MainMenuKeyboard() *messaging.Keyboard {
+	return messaging.Menu(
+		messaging.Row(
+			messaging.TextButton("🚀 Создать новую игру"),
+		),
+		messaging.Row(
+			messaging.TextButton("🌐 Открытые игры"),
+		),
+		messaging.Row(
+			messaging.TextButton("🤖 Играть с ботом"),
+		),
+		messaging.Row(
+			messaging.TextButton("👤 Профиль"),
+			messaging.TextButton("❓ Помощь"),
+		),
+	)
+}
+
+// TurnTimeouts are the move time limits offered when creating a game; zero
+// stands for the bot's default.
+var TurnTimeouts = []time.Duration{0, 30 * time.Second, 10 * time.Minute}
+
+// InviteForm is the state of the new game form. It travels in the payloads of
+// the form's buttons as "<preset>/<timeout in seconds>/<flags>[/<target>]",
+// where flags add up formPublic and formSpectators.
+type InviteForm struct {
+	// Preset is the key of a models.PayoffPreset.
+	Preset string
+	// Timeout is one of TurnTimeouts.
+	Timeout    time.Duration
+	Public     bool
+	Spectators bool
+	// Target is the @username or user ID of a challenge, empty for an open invite.
+	Target string
+}
+
+// Flags of the new game form.
+const (
+	formPublic = 1 << iota
+	formSpectators
+)
+
+// NewInviteForm is the form with the default settings.
+func NewInviteForm(target string) InviteForm {
+	return InviteForm{Preset: models.PayoffPresets[0].Key, Target: target}
+}
+
+func (f InviteForm) String() string {
+	flags := 0
+	if f.Public {
+		flags |= formPublic
+	}
+	if f.Spectators {
+		flags |= formSpectators
+	}
+	s := f.Preset + "/" + strconv.Itoa(int(f.Timeout/time.Second)) + "/" + strconv.Itoa(flags)
+	if f.Target != "" {
+		s += "/" + f.Target
+	}
+	return s
+}
+
+// ParseInviteForm reads a form encoded with InviteForm.String.
+func ParseInviteForm(s string) (InviteForm, error) {
+	fields := strings.SplitN(s, "/", 4)
+	if len(fields) < 3 {
+		return InviteForm{}, fmt.Errorf("invalid form %q", s)
+	}
+	flags, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return InviteForm{}, fmt.Errorf("invalid flags %q", fields[2])
+	}
+	f := InviteForm{Preset: fields[0], Public: flags&formPublic != 0, Spectators: flags&formSpectators != 0}
+	if _, ok := models.PresetByKey(f.Preset); !ok {
+		return InviteForm{}, fmt.Errorf("unknown payoff preset %q", f.Preset)
+	}
+	seconds, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return InviteForm{}, fmt.Errorf("invalid timeout %q", fields[1])
+	}
+	f.Timeout = time.Duration(seconds) * time.Second
+	if len(fields) == 4 {
+		f.Target = fields[3]
+	}
+	return f, nil
+}
+
+// FormOf is the form that produces the given settings, bar the number of rounds.
+func FormOf(settings models.GameSettings) InviteForm {
+	form := NewInviteForm("")
+	for _, preset := range models.PayoffPresets {
+		if preset.Payoff == settings.Payoff {
+			form.Preset = preset.Key
+		}
+	}
+	form.Timeout = settings.TurnTimeout
+	form.Public = settings.Public
+	form.Spectators = settings.AllowSpectators
+	return form
+}
+
+// Settings turns the form into the settings of a game with the given number of rounds.
+func (f InviteForm) Settings(rounds int) models.GameSettings {
+	preset, _ := models.PresetByKey(f.Preset)
+	return models.GameSettings{
+		Rounds:          rounds,
+		Payoff:          preset.Payoff,
+		TurnTimeout:     f.Timeout,
+		Public:          f.Public,
+		AllowSpectators: f.Spectators,
+	}
+}
+
+// TimeoutLabel is the button text of a move time limit.
+func TimeoutLabel(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "⏱ Обычное"
+	case d < time.Minute:
+		return fmt.Sprintf("⚡ %d сек", int(d/time.Second))
+	}
+	return fmt.Sprintf("🐢 %d мин", int(d/time.Minute))
+}
+
+// RoundsKeyboard creates the new game form: picking the number of rounds creates
+// the invite, the other buttons change its settings.
+func RoundsKeyboard(codec *callback.Codec, playerID int64, form InviteForm) *messaging.Keyboard {
+	button := func(rounds int) messaging.Button {
+		data := codec.Encode(playerID, callback.Data{Action: callback.ActionRounds, Arg: strconv.Itoa(rounds) + "/" + form.String()})
+		return messaging.DataButton(strconv.Itoa(rounds)+" Раундов", data)
+	}
+	option := func(text string, selected bool, changed InviteForm) messaging.Button {
+		return selectable(text, selected, codec.Encode(playerID, callback.Data{Action: callback.ActionForm, Arg: changed.String()}))
+	}
+
+	rows := append([][]messaging.Button{messaging.Row(button(10), button(15), button(20))}, formRows(form, option)...)
+	// A challenge is never listed in the lobby.
+	if form.Target == "" {
+		private, public := form, form
+		private.Public, public.Public = false, true
+		rows = append(rows, messaging.Row(
+			option("🔒 По ссылке", !form.Public, private),
+			option("🌐 В лобби", form.Public, public),
+		))
+	}
+	return messaging.Inline(rows...)
+}
+
+// GroupRounds are the game lengths group admins can pick from.
+var GroupRounds = []int{5, 10, 15, 20}
+
+// GroupSettingsKeyboard lets a group admin change the settings challenges in
+// the group start with. Every button saves the settings with one of them changed.
+func GroupSettingsKeyboard(codec *callback.Codec, adminID int64, rounds int, form InviteForm) *messaging.Keyboard {
+	option := func(text string, selected bool, changed InviteForm) messaging.Button {
+		return selectable(text, selected, codec.Encode(adminID, callback.Data{Action: callback.ActionGroup, Arg: strconv.Itoa(rounds) + "/" + changed.String()}))
+	}
+	lengths := make([]messaging.Button, 0, len(GroupRounds))
+	for _, n := range GroupRounds {
+		data := codec.Encode(adminID, callback.Data{Action: callback.ActionGroup, Arg: strconv.Itoa(n) + "/" + form.String()})
+		lengths = append(lengths, selectable(strconv.Itoa(n)+" Раундов", n == rounds, data))
+	}
+	return messaging.Inline(append([][]messaging.Button{lengths}, formRows(form, option)...)...)
+}
+
+// selectable is a settings button, marked when its value is the one picked.
+func selectable(text string, selected bool, data string) messaging.Button {
+	if selected {
+		text = "✅ " + text
+	}
+	return messaging.DataButton(text, data)
+}
+
+// formRows are the payoff, move time and spectator buttons of a settings form.
+func formRows(form InviteForm, option func(text string, selected bool, changed InviteForm) messaging.Button) [][]messaging.Button {
+	presets := make([]messaging.Button, 0, len(models.PayoffPresets))
+	for _, preset := range models.PayoffPresets {
+		changed := form
+		changed.Preset = preset.Key
+		presets = append(presets, option(preset.Name, form.Preset == preset.Key, changed))
+	}
+	timeouts := make([]messaging.Button, 0, len(TurnTimeouts))
+	for _, timeout := range TurnTimeouts {
+		changed := form
+		changed.Timeout = timeout
+		timeouts = append(timeouts, option(TimeoutLabel(timeout), form.Timeout == timeout, changed))
+	}
+	spectators := form
+	spectators.Spectators = !form.Spectators
+	return [][]messaging.Button{
+		presets,
+		timeouts,
+		messaging.Row(option("👁 Зрители", form.Spectators, spectators)),
+	}
+}
+
+// TournamentStarts are the start times an organizer can pick, as delays from
+// creating the tournament; zero means the organizer starts it by hand.
+var TournamentStarts = []time.Duration{0, 15 * time.Minute, time.Hour}
+
+// TournamentRounds are the match lengths an organizer can pick from.
+var TournamentRounds = []int{5, 10, 20}
+
+// TournamentForm holds the settings picked so far in the new tournament form.
+type TournamentForm struct {
+	Format  models.TournamentFormat
+	Scoring models.TournamentScoring
+	// Preset is the key of a models.PayoffPreset.
+	Preset string
+	// Timeout is one of TurnTimeouts.
+	Timeout time.Duration
+	// StartIn is one of TournamentStarts.
+	StartIn time.Duration
+}
+
+// NewTournamentForm is the form with the default settings.
+func NewTournamentForm() TournamentForm {
+	return TournamentForm{Format: models.FormatSwiss, Scoring: models.ScoreByPoints, Preset: models.PayoffPresets[0].Key}
+}
+
+func (f TournamentForm) String() string {
+	format, scoring := "s", "p"
+	if f.Format == models.FormatRoundRobin {
+		format = "r"
+	}
+	if f.Scoring == models.ScoreByWins {
+		scoring = "w"
+	}
+	return strings.Join([]string{format, scoring, f.Preset,
+		strconv.Itoa(int(f.Timeout / time.Second)), strconv.Itoa(int(f.StartIn / time.Minute))}, "/")
+}
+
+// ParseTournamentForm reads a form encoded with TournamentForm.String.
+func ParseTournamentForm(s string) (TournamentForm, error) {
+	fields := strings.Split(s, "/")
+	if len(fields) != 5 {
+		return TournamentForm{}, fmt.Errorf("invalid tournament form %q", s)
+	}
+	f := NewTournamentForm()
+	switch fields[0] {
+	case "s":
+	case "r":
+		f.Format = models.FormatRoundRobin
+	default:
+		return TournamentForm{}, fmt.Errorf("unknown tournament format %q", fields[0])
+	}
+	switch fields[1] {
+	case "p":
+	case "w":
+		f.Scoring = models.ScoreByWins
+	default:
+		return TournamentForm{}, fmt.Errorf("unknown tournament scoring %q", fields[1])
+	}
+	if _, ok := models.PresetByKey(fields[2]); !ok {
+		return TournamentForm{}, fmt.Errorf("unknown payoff preset %q", fields[2])
+	}
+	f.Preset = fields[2]
+	seconds, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return TournamentForm{}, fmt.Errorf("invalid timeout %q", fields[3])
+	}
+	minutes, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return TournamentForm{}, fmt.Errorf("invalid start delay %q", fields[4])
+	}
+	f.Timeout, f.StartIn = time.Duration(seconds)*time.Second, time.Duration(minutes)*time.Minute
+	return f, nil
+}
+
+// Settings turns the form into the settings of a tournament with matches of
+// the given number of rounds, created at now.
+func (f TournamentForm) Settings(rounds int, now time.Time) models.TournamentSettings {
+	preset, _ := models.PresetByKey(f.Preset)
+	settings := models.TournamentSettings{
+		Format:      f.Format,
+		Scoring:     f.Scoring,
+		Rounds:      rounds,
+		Payoff:      preset.Payoff,
+		TurnTimeout: f.Timeout,
+	}
+	if f.StartIn > 0 {
+		settings.StartAt = now.Add(f.StartIn)
+	}
+	return settings
+}
+
+// StartLabel is the button text of a tournament start time.
+func StartLabel(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "▶️ Вручную"
+	case d < time.Hour:
+		return fmt.Sprintf("⏰ Через %d мин", int(d/time.Minute))
+	}
+	return fmt.Sprintf("⏰ Через %d ч", int(d/time.Hour))
+}
+
+// TournamentFormKeyboard creates the new tournament form: picking the match
+// length creates the tournament, the other buttons change its settings.
+func TournamentFormKeyboard(codec *callback.Codec, organizerID int64, form TournamentForm) *messaging.Keyboard {
+	option := func(text string, selected bool, changed TournamentForm) messaging.Button {
+		return selectable(text, selected, codec.Encode(organizerID, callback.Data{Action: callback.ActionTourForm, Arg: changed.String()}))
+	}
+	lengths := make([]messaging.Button, 0, len(TournamentRounds))
+	for _, n := range TournamentRounds {
+		data := codec.Encode(organizerID, callback.Data{Action: callback.ActionTourNew, Arg: strconv.Itoa(n) + "/" + form.String()})
+		lengths = append(lengths, messaging.DataButton(strconv.Itoa(n)+" Раундов", data))
+	}
+
+	swiss, roundRobin := form, form
+	swiss.Format, roundRobin.Format = models.FormatSwiss, models.FormatRoundRobin
+	byPoints, byWins := form, form
+	byPoints.Scoring, byWins.Scoring = models.ScoreByPoints, models.ScoreByWins
+	presets := make([]messaging.Button, 0, len(models.PayoffPresets))
+	for _, preset := range models.PayoffPresets {
+		changed := form
+		changed.Preset = preset.Key
+		presets = append(presets, option(preset.Name, form.Preset == preset.Key, changed))
+	}
+	timeouts := make([]messaging.Button, 0, len(TurnTimeouts))
+	for _, timeout := range TurnTimeouts {
+		changed := form
+		changed.Timeout = timeout
+		timeouts = append(timeouts, option(TimeoutLabel(timeout), form.Timeout == timeout, changed))
+	}
+	starts := make([]messaging.Button, 0, len(TournamentStarts))
+	for _, start := range TournamentStarts {
+		changed := form
+		changed.StartIn = start
+		starts = append(starts, option(StartLabel(start), form.StartIn == start, changed))
+	}
+
+	return messaging.Inline(
+		lengths,
+		messaging.Row(
+			option("🇨🇭 Швейцарская", form.Format == models.FormatSwiss, swiss),
+			option("🔁 Круговая", form.Format == models.FormatRoundRobin, roundRobin),
+		),
+		messaging.Row(
+			option("💯 По очкам", form.Scoring == models.ScoreByPoints, byPoints),
+			option("🏅 По победам", form.Scoring == models.ScoreByWins, byWins),
+		),
+		presets,
+		timeouts,
+		starts,
+	)
+}
+
+// TournamentKeyboard is attached to the organizer's tournament message while
+// registration is open.
+func TournamentKeyboard(codec *callback.Codec, organizerID int64, tournamentID, joinURL string) *messaging.Keyboard {
+	return messaging.Inline(
+		messaging.Row(
+			messaging.URLButton("📝 Ссылка для регистрации", joinURL),
+		),
+		messaging.Row(
+			messaging.DataButton("▶️ Начать турнир", codec.Encode(organizerID, callback.Data{Action: callback.ActionTourStart, Arg: tournamentID})),
+			messaging.DataButton("❌ Отменить турнир", codec.Encode(organizerID, callback.Data{Action: callback.ActionTourStop, Arg: tournamentID})),
+		),
+	)
+}
+
+// TournamentEntryKeyboard lets a registered player withdraw before the tournament starts.
+func TournamentEntryKeyboard(codec *callback.Codec, playerID int64, tournamentID string) *messaging.Keyboard {
+	data := codec.Encode(playerID, callback.Data{Action: callback.ActionTourLeave, Arg: tournamentID})
+	return messaging.Inline(
+		messaging.Row(
+			messaging.DataButton("🚪 Отказаться от участия", data),
+		),
+	)
+}
+
+// LobbyKeyboard has a join button for each listed invite, numbered from first,
+// and buttons to move between the lobby's pages.
+func LobbyKeyboard(codec *callback.Codec, playerID int64, inviteIDs []string, first, page, pages int) *messaging.Keyboard {
+	rows := make([][]messaging.Button, 0, len(inviteIDs)+1)
+	for i, id := range inviteIDs {
+		data := codec.Encode(playerID, callback.Data{Action: callback.ActionJoin, Arg: id})
+		rows = append(rows, messaging.Row(messaging.DataButton(fmt.Sprintf("▶️ Играть №%d", first+i), data)))
+	}
+	turn := func(text string, page int) messaging.Button {
+		return messaging.DataButton(text, codec.Encode(playerID, callback.Data{Action: callback.ActionLobby, Arg: strconv.Itoa(page)}))
+	}
+	var nav []messaging.Button
+	if page > 0 {
+		nav = append(nav, turn("◀️ Назад", page-1))
+	}
+	nav = append(nav, turn("🔄 Обновить", page))
+	if page < pages-1 {
+		nav = append(nav, turn("Вперед ▶️", page+1))
+	}
+	return messaging.Inline(append(rows, nav)...)
+}
+
+// OpponentKeyboard creates the inline keyboard for picking a bot opponent.
+func OpponentKeyboard(codec *callback.Codec, playerID int64) *messaging.Keyboard {
+	opponent := func(text, strategyName string) messaging.Button {
+		return messaging.DataButton(text, codec.Encode(playerID, callback.Data{Action: callback.ActionOpponent, Arg: strategyName}))
+	}
+	return messaging.Inline(
+		messaging.Row(
+			opponent("🧠 Обучающийся бот", "learner"),
+		),
+		messaging.Row(
+			opponent("Tit-for-Tat", "tft"),
+			opponent("Tit-for-Two-Tats", "tf2t"),
+		),
+		messaging.Row(
+			opponent("Grudger", "grudger"),
+			opponent("Pavlov", "pavlov"),
+		),
+		messaging.Row(
+			opponent("Always Defect", "alld"),
+			opponent("Always Cooperate", "allc"),
+		),
+		messaging.Row(
+			opponent("ZD Extortioner", "zd_extort"),
+			opponent("ZD Generous", "zd_generous"),
+		),
+		messaging.Row(
+			opponent("Random", "random"),
+		),
+	)
+}
+
+// BotRoundsKeyboard creates the rounds selection keyboard for a game against the given bot strategy.
+func BotRoundsKeyboard(codec *callback.Codec, playerID int64, strategyName string) *messaging.Keyboard {
+	button := func(rounds int) messaging.Button {
+		data := codec.Encode(playerID, callback.Data{Action: callback.ActionBotRounds, Arg: strategyName + "/" + strconv.Itoa(rounds)})
+		return messaging.DataButton(strconv.Itoa(rounds)+" Раундов", data)
+	}
+	return messaging.Inline(
+		messaging.Row(button(10), button(15), button(20)),
+	)
+}
+
+// InviteKeyboard creates the inline keyboard with the invite link button and a button to cancel the invite.
+func InviteKeyboard(codec *callback.Codec, playerID int64, inviteID, inviteURL string) *messaging.Keyboard {
+	return messaging.Inline(
+		messaging.Row(
+			messaging.URLButton("➡️ Принять приглашение", inviteURL),
+		),
+		messaging.Row(
+			messaging.DataButton("❌ Отменить приглашение", cancelInvite(codec, playerID, inviteID)),
 		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("❓ Помощь"),
+	)
+}
+
+// SpectatorKeyboard lets a spectator stop watching a game.
+func SpectatorKeyboard(codec *callback.Codec, userID int64, spectateID string) *messaging.Keyboard {
+	data := codec.Encode(userID, callback.Data{Action: callback.ActionUnwatch, Arg: spectateID})
+	return messaging.Inline(
+		messaging.Row(
+			messaging.DataButton("🚪 Перестать смотреть", data),
 		),
 	)
 }
 
-// RoundsKeyboard creates the inline keyboard for selecting the number of rounds.
-func RoundsKeyboard() tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("10 Раундов", "rounds_10"),
-			tgbotapi.NewInlineKeyboardButtonData("15 Раундов", "rounds_15"),
-			tgbotapi.NewInlineKeyboardButtonData("20 Раундов", "rounds_20"),
+// ChallengeKeyboard is attached to a challenge sent straight to the challenged player.
+func ChallengeKeyboard(inviteURL string) *messaging.Keyboard {
+	return messaging.Inline(
+		messaging.Row(
+			messaging.URLButton("⚔️ Принять вызов", inviteURL),
 		),
 	)
 }
 
+// InlineInviteKeyboard is attached to an invite shared through inline mode.
+// Anyone in the chat may accept it.
+func InlineInviteKeyboard(codec *callback.Codec, inviteID string) *messaging.Keyboard {
+	data := codec.Encode(callback.Anyone, callback.Data{Action: callback.ActionAccept, Arg: inviteID})
+	return messaging.Inline(
+		messaging.Row(
+			messaging.DataButton("✅ Принять приглашение", data),
+		),
+	)
+}
+
+// OpenInvitesKeyboard has a cancel button for each of the listed invites, numbered as in the list.
+func OpenInvitesKeyboard(codec *callback.Codec, playerID int64, inviteIDs []string) *messaging.Keyboard {
+	rows := make([][]messaging.Button, 0, len(inviteIDs))
+	for i, id := range inviteIDs {
+		text := fmt.Sprintf("❌ Отменить №%d", i+1)
+		rows = append(rows, messaging.Row(messaging.DataButton(text, cancelInvite(codec, playerID, id))))
+	}
+	return messaging.Inline(rows...)
+}
+
+func cancelInvite(codec *callback.Codec, playerID int64, inviteID string) string {
+	return codec.Encode(playerID, callback.Data{Action: callback.ActionCancel, Arg: inviteID})
+}
+
 // NEW: RematchKeyboard creates the inline keyboard for rematch options
-func RematchKeyboard() tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Играть снова", "rematch_yes"),
-			tgbotapi.NewInlineKeyboardButtonData("🚪 Главное меню", "rematch_no"),
+func RematchKeyboard(codec *callback.Codec, playerID int64, gameID string) *messaging.Keyboard {
+	answer := func(arg string) string {
+		return codec.Encode(playerID, callback.Data{Action: callback.ActionRematch, GameID: gameID, Arg: arg})
+	}
+	return messaging.Inline(
+		messaging.Row(
+			messaging.DataButton("🔄 Играть снова", answer(callback.ArgYes)),
+			messaging.DataButton("🚪 Главное меню", answer(callback.ArgNo)),
 		),
 	)
 }
 
+// exportLabels are the buttons of the export formats offered after a game.
+var exportLabels = []struct{ format, label string }{
+	{"json", "📦 JSON"},
+	{"csv", "📊 CSV"},
+	{"txt", "📝 Текст"},
+}
+
+// ExportKeyboard offers the record of a finished game as a file in each export format.
+func ExportKeyboard(codec *callback.Codec, playerID int64, gameID string) *messaging.Keyboard {
+	buttons := make([]messaging.Button, 0, len(exportLabels))
+	for _, l := range exportLabels {
+		data := codec.Encode(playerID, callback.Data{Action: callback.ActionExport, GameID: gameID, Arg: l.format})
+		buttons = append(buttons, messaging.DataButton(l.label, data))
+	}
+	return messaging.Inline(buttons)
+}
+
 // GenerateID creates a random, URL-safe string for invite links.
 func GenerateID(length int) (string, error) {
 	bytes := make([]byte, length)